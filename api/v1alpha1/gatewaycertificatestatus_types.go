@@ -0,0 +1,162 @@
+/*
+MIT License
+
+Copyright (c) 2026
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// GatewayCertificateStatusConditionReady агрегированное условие: все домены Gateway
+	// покрыты готовыми сертификатами
+	GatewayCertificateStatusConditionReady = "Ready"
+
+	// DomainConditionCovered условие домена: домен входит в dnsNames сертификата Gateway
+	DomainConditionCovered = "Covered"
+
+	// DomainConditionCertificateReady условие домена: сертификат, покрывающий домен, выпущен
+	DomainConditionCertificateReady = "CertificateReady"
+
+	// CertificateConditionReady условие сертификата: копия условия Ready из cert-manager
+	CertificateConditionReady = "Ready"
+
+	// CertificateConditionTemporary условие сертификата: Gateway использует временный самоподписанный секрет
+	CertificateConditionTemporary = "TemporaryCertificateActive"
+)
+
+// GatewayReference ссылка на Gateway, состояние которого описывает ресурс
+type GatewayReference struct {
+	// Group API группа Gateway (networking.istio.io или gateway.networking.k8s.io)
+	Group string `json:"group"`
+
+	// Kind тип ресурса Gateway
+	Kind string `json:"kind"`
+
+	// Name имя Gateway (namespace совпадает с namespace ресурса статуса)
+	Name string `json:"name"`
+}
+
+// DomainStatus состояние домена, обслуживаемого Gateway
+type DomainStatus struct {
+	// Name доменное имя из VirtualService (или HTTPRoute)
+	Name string `json:"name"`
+
+	// Certificate сертификат, покрывающий домен, в формате "namespace/name"
+	// +optional
+	Certificate string `json:"certificate,omitempty"`
+
+	// Conditions состояние домена
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// CertificateStatus состояние cert-manager Certificate, используемого Gateway
+type CertificateStatus struct {
+	// Name имя Certificate
+	Name string `json:"name"`
+
+	// Namespace namespace Certificate
+	Namespace string `json:"namespace"`
+
+	// SecretName секрет, который создает Certificate и использует Gateway
+	SecretName string `json:"secretName"`
+
+	// DNSNames DNS имена сертификата
+	// +optional
+	DNSNames []string `json:"dnsNames,omitempty"`
+
+	// NotAfter время истечения выпущенного сертификата
+	// +optional
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+
+	// Conditions состояние сертификата
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// GatewayCertificateStatusSpec defines the desired state of GatewayCertificateStatus
+type GatewayCertificateStatusSpec struct {
+	// GatewayRef ссылка на Gateway в том же namespace
+	GatewayRef GatewayReference `json:"gatewayRef"`
+}
+
+// GatewayCertificateStatusStatus defines the observed state of GatewayCertificateStatus
+type GatewayCertificateStatusStatus struct {
+	// ObservedGeneration поколение Gateway, по которому построен статус
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Domains состояние доменов Gateway
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Domains []DomainStatus `json:"domains,omitempty"`
+
+	// Certificates состояние сертификатов, секреты которых использует Gateway
+	// +optional
+	Certificates []CertificateStatus `json:"certificates,omitempty"`
+
+	// Conditions агрегированное состояние Gateway
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=gwcs
+// +kubebuilder:printcolumn:name="Gateway",type=string,JSONPath=`.spec.gatewayRef.name`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// GatewayCertificateStatus is the Schema for the gatewaycertificatestatuses API.
+// Ресурс создается оператором для каждого Gateway (с тем же именем и в том же namespace)
+// и описывает состояние его доменов и сертификатов
+type GatewayCertificateStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GatewayCertificateStatusSpec   `json:"spec,omitempty"`
+	Status GatewayCertificateStatusStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// GatewayCertificateStatusList contains a list of GatewayCertificateStatus.
+type GatewayCertificateStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GatewayCertificateStatus `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GatewayCertificateStatus{}, &GatewayCertificateStatusList{})
+}
@@ -0,0 +1,233 @@
+/*
+MIT License
+
+Copyright (c) 2026
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Http01PolicyConditionReady тип условия, показывающий, что политика принята оператором
+	Http01PolicyConditionReady = "Ready"
+
+	// Http01PolicyConditionConflicted тип условия, показывающий, что часть Gateway
+	// уже выбрана другой (более старой) политикой в том же namespace
+	Http01PolicyConditionConflicted = "Conflicted"
+)
+
+// GatewayMode способ применения временного сертификата и отключения httpsRedirect
+// +kubebuilder:validation:Enum=Patch;Overlay
+type GatewayMode string
+
+const (
+	// GatewayModePatch оператор изменяет credentialName и httpsRedirect в Gateway пользователя
+	GatewayModePatch GatewayMode = "Patch"
+
+	// GatewayModeOverlay оператор не изменяет Gateway пользователя, а создает рядом собственный
+	// overlay Gateway с тем же селектором, временным секретом на 443 и HTTP без редиректа на 80
+	GatewayModeOverlay GatewayMode = "Overlay"
+)
+
+// HTTPSRedirectMode способ открыть HTTP01 challenge на HTTP серверах с httpsRedirect
+// +kubebuilder:validation:Enum=Server;ChallengePath
+type HTTPSRedirectMode string
+
+const (
+	// HTTPSRedirectModeServer оператор отключает httpsRedirect на HTTP серверах Gateway,
+	// и на время выпуска весь сайт доступен по HTTP
+	HTTPSRedirectModeServer HTTPSRedirectMode = "Server"
+
+	// HTTPSRedirectModeChallengePath оператор переносит редирект в VirtualService хоста:
+	// по HTTP обслуживается только /.well-known/acme-challenge/, остальные запросы перенаправляются на HTTPS.
+	// Если хост обслуживает VirtualService пользователя, httpsRedirect не отключается
+	HTTPSRedirectModeChallengePath HTTPSRedirectMode = "ChallengePath"
+)
+
+// TemporaryCertificateSourceType источник временного сертификата
+// +kubebuilder:validation:Enum=SelfSigned;Issuer;Secret
+type TemporaryCertificateSourceType string
+
+const (
+	// TemporaryCertificateSourceSelfSigned оператор создает одноразовый self-signed Issuer
+	TemporaryCertificateSourceSelfSigned TemporaryCertificateSourceType = "SelfSigned"
+
+	// TemporaryCertificateSourceIssuer временный сертификат выпускает указанный Issuer или ClusterIssuer
+	// (например, внутренний CA, корневой сертификат которого доверен клиентам)
+	TemporaryCertificateSourceIssuer TemporaryCertificateSourceType = "Issuer"
+
+	// TemporaryCertificateSourceSecret оператор копирует существующий TLS секрет (например, wildcard)
+	// во временный секрет вместо выпуска сертификата
+	TemporaryCertificateSourceSecret TemporaryCertificateSourceType = "Secret"
+)
+
+// TemporaryCertificateIssuerRef ссылка на Issuer или ClusterIssuer cert-manager
+type TemporaryCertificateIssuerRef struct {
+	// Name имя Issuer (в namespace Certificate) или ClusterIssuer
+	Name string `json:"name"`
+
+	// Kind тип issuer
+	// +kubebuilder:default=Issuer
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Group API группа issuer
+	// +kubebuilder:default="cert-manager.io"
+	// +optional
+	Group string `json:"group,omitempty"`
+}
+
+// TemporaryCertificateSecretRef ссылка на существующий TLS секрет
+type TemporaryCertificateSecretRef struct {
+	// Name имя секрета с tls.crt и tls.key
+	Name string `json:"name"`
+
+	// Namespace секрета, по умолчанию namespace политики. Секреты других namespace не копируются
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// TemporaryCertificateSource задает, откуда берется временный сертификат
+// +kubebuilder:validation:XValidation:rule="self.type != 'Issuer' || has(self.issuerRef)",message="issuerRef is required for type Issuer"
+// +kubebuilder:validation:XValidation:rule="self.type != 'Secret' || has(self.secretRef)",message="secretRef is required for type Secret"
+type TemporaryCertificateSource struct {
+	// Type источник временного сертификата: SelfSigned, Issuer или Secret
+	// +kubebuilder:default=SelfSigned
+	// +optional
+	Type TemporaryCertificateSourceType `json:"type,omitempty"`
+
+	// IssuerRef issuer временного сертификата для type Issuer
+	// +optional
+	IssuerRef *TemporaryCertificateIssuerRef `json:"issuerRef,omitempty"`
+
+	// SecretRef секрет, копируемый во временный секрет, для type Secret
+	// +optional
+	SecretRef *TemporaryCertificateSecretRef `json:"secretRef,omitempty"`
+}
+
+// TemporaryCertificatePolicy задает параметры временного сертификата,
+// который выпускается на время прохождения HTTP01 challenge
+type TemporaryCertificatePolicy struct {
+	// Enabled разрешает выпуск временного сертификата для выбранных Gateway
+	// +kubebuilder:default=true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Duration срок действия временного сертификата (минимум 1h, как требует cert-manager)
+	// +kubebuilder:default="24h"
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('1h')",message="duration must be at least 1h"
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// Source источник временного сертификата (по умолчанию самоподписанный)
+	// +optional
+	Source TemporaryCertificateSource `json:"source,omitempty"`
+}
+
+// Http01PolicySpec defines the desired state of Http01Policy
+type Http01PolicySpec struct {
+	// GatewaySelector выбирает Gateway (Istio и Gateway API) в namespace политики по меткам.
+	// Пустой селектор выбирает все Gateway namespace
+	GatewaySelector metav1.LabelSelector `json:"gatewaySelector"`
+
+	// TemporaryCertificate задает выпуск временного сертификата
+	// +optional
+	TemporaryCertificate TemporaryCertificatePolicy `json:"temporaryCertificate,omitempty"`
+
+	// ManageHTTPSRedirect разрешает оператору отключать httpsRedirect на HTTP серверах Gateway
+	// на время прохождения HTTP01 challenge
+	// +kubebuilder:default=true
+	// +optional
+	ManageHTTPSRedirect *bool `json:"manageHTTPSRedirect,omitempty"`
+
+	// HTTPSRedirectMode задает, отключается ли httpsRedirect для всего сервера (Server) или
+	// редирект переносится в VirtualService хоста с исключением пути challenge (ChallengePath).
+	// ChallengePath не применяется к хостам, которые обслуживает VirtualService пользователя: его маршруты
+	// объединяются перед редиректом, поэтому httpsRedirect сохраняется и на Gateway создается Warning
+	// событие ChallengePathRedirectRefused. Для таких хостов используйте Server
+	// +kubebuilder:default=Server
+	// +optional
+	HTTPSRedirectMode HTTPSRedirectMode `json:"httpsRedirectMode,omitempty"`
+
+	// GatewayMode задает, изменяет ли оператор Gateway пользователя (Patch) или создает
+	// overlay Gateway <имя Gateway>-http01-overlay (Overlay), например для Gateway под управлением GitOps
+	// +kubebuilder:default=Patch
+	// +optional
+	GatewayMode GatewayMode `json:"gatewayMode,omitempty"`
+
+	// DisableHSTS разрешает оператору создавать EnvoyFilter, удаляющий заголовок
+	// Strict-Transport-Security, пока Gateway использует временный сертификат
+	// +kubebuilder:default=true
+	// +optional
+	DisableHSTS *bool `json:"disableHSTS,omitempty"`
+}
+
+// Http01PolicyStatus defines the observed state of Http01Policy
+type Http01PolicyStatus struct {
+	// ObservedGeneration поколение spec, обработанное оператором
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// MatchedGateways список Gateway, к которым применяется политика,
+	// в формате "<group>/<name>"
+	// +optional
+	MatchedGateways []string `json:"matchedGateways,omitempty"`
+
+	// Conditions текущее состояние политики
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=h01p
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Gateways",type=string,JSONPath=`.status.matchedGateways`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Http01Policy is the Schema for the http01policies API.
+// Политика задает поведение оператора при прохождении HTTP01 challenge для выбранных Gateway
+type Http01Policy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Http01PolicySpec   `json:"spec,omitempty"`
+	Status Http01PolicyStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// Http01PolicyList contains a list of Http01Policy.
+type Http01PolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Http01Policy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Http01Policy{}, &Http01PolicyList{})
+}
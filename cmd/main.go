@@ -34,9 +34,13 @@ import (
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
 	"github.com/rieset/istio-http01/internal/controller"
 	// +kubebuilder:scaffold:imports
 )
@@ -49,7 +53,11 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(certmanagerv1.AddToScheme(scheme))
+	utilruntime.Must(cmacme.AddToScheme(scheme))
 	utilruntime.Must(istionetworkingv1beta1.AddToScheme(scheme))
+	utilruntime.Must(gatewayapiv1.AddToScheme(scheme))
+	utilruntime.Must(gatewayapiv1beta1.AddToScheme(scheme))
+	utilruntime.Must(http01v1alpha1.AddToScheme(scheme))
 
 	// +kubebuilder:scaffold:scheme
 }
@@ -63,6 +71,7 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var uninstallCleanup bool
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -81,10 +90,22 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.BoolVar(&uninstallCleanup, "uninstall-cleanup", false,
+		"Roll back Gateway changes of all certificates handled by the operator, remove its finalizers and exit. "+
+			"Used by the Helm hook when the chart is uninstalled.")
 
 	// Настройка логгера
 	setupLogger()
 
+	// Режим удаления оператора: откат изменений Gateway без запуска контроллеров
+	if uninstallCleanup {
+		if err := runUninstallCleanup(); err != nil {
+			setupLog.Error(err, "uninstall cleanup failed")
+			os.Exit(1)
+		}
+		return
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
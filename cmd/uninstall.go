@@ -0,0 +1,33 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - runUninstallCleanup() error
+ *   Создает менеджер без metrics, probes и leader election и откатывает изменения Gateway (--uninstall-cleanup)
+ */
+
+package main
+
+import (
+	"fmt"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/rieset/istio-http01/internal/controller"
+)
+
+// runUninstallCleanup откатывает изменения Gateway всех сертификатов и снимает finalizer оператора
+// Выполняется одноразовым Job при удалении chart, поэтому metrics, probes и leader election не нужны
+func runUninstallCleanup() error {
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create manager: %w", err)
+	}
+
+	setupLog.Info("running uninstall cleanup")
+	return controller.RunUninstallCleanup(ctrl.SetupSignalHandler(), mgr)
+}
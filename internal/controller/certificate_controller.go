@@ -4,56 +4,17 @@
  * - (r *CertificateReconciler) Reconcile(ctx, req) (ctrl.Result, error)
  *   Обрабатывает изменения Certificate ресурсов и выводит информацию в логи
  *
- * - (r *CertificateReconciler) SetupWithManager(mgr) error
- *   Настраивает контроллер для работы с менеджером
- *
- * - (r *CertificateReconciler) isCertificateReady(cert) bool
- *   Проверяет, готов ли Certificate (выпущен ли сертификат)
- *
- * - (r *CertificateReconciler) findGatewaysUsingCertificate(ctx, secretName, secretNamespace) ([]*Gateway, error)
- *   Находит все Gateway, которые используют указанный сертификат
- *
- * - (r *CertificateReconciler) hasHTTPSRedirect(gateway) bool
- *   Проверяет, включен ли httpsRedirect в Gateway
- *
- * - (r *CertificateReconciler) createSelfSignedCertificate(ctx, cert, gateway) error
- *   Создает самоподписанный сертификат для Gateway когда основной не готов
- *
- * - (r *CertificateReconciler) updateGatewayWithTemporarySecret(ctx, gateway, originalSecretName, tempSecretName) error
- *   Обновляет Gateway для использования временного секрета и отключает HSTS
- *
- * - (r *CertificateReconciler) restoreGatewayOriginalSecret(ctx, gateway, originalSecretName) error
- *   Восстанавливает оригинальный секрет в Gateway и включает обратно HSTS
- *
- * - (r *CertificateReconciler) deleteTemporarySelfSignedCertificate(ctx, cert) error
- *   Удаляет временный самоподписанный сертификат и issuer
- *
- * - (r *CertificateReconciler) disableHTTPSRedirectForHTTP01(ctx, gateway, originalSecretName) error
- *   Отключает httpsRedirect в Gateway для прохождения HTTP01 challenge
- *
- * - (r *CertificateReconciler) createEnvoyFilterToDisableHSTS(ctx, gateway, originalSecretName) error
- *   Создает EnvoyFilter для отключения HSTS заголовка
- *
- * - (r *CertificateReconciler) deleteEnvoyFilterForHSTS(ctx, gateway, originalSecretName) error
- *   Удаляет EnvoyFilter для отключения HSTS
- *
- * - (r *CertificateReconciler) ensureTemporaryCertificateSetup(ctx, cert, gateway) error
- *   Проверяет и восстанавливает состояние временного сертификата, httpRedirect и EnvoyFilter
- *
- * - (r *CertificateReconciler) getDomainsForGateway(ctx, gateway) ([]string, error)
- *   Получает список доменов для Gateway из связанных VirtualService
- *
- * - (r *CertificateReconciler) getIngressGatewayIP(ctx, gateway) (string, error)
- *   Получает IP адрес ingress gateway для Gateway
- *
- * - (r *CertificateReconciler) verifyCertificateViaHTTPS(ctx, gateway, expectedDNSNames, ingressIP) error
- *   Проверяет сертификат через HTTPS запрос и сравнивает домены
- *
- * - (r *CertificateReconciler) verifyCertificateViaHTTP(ctx, gateway, ingressIP) error
- *   Проверяет доступность через HTTP запрос
- *
- * - (r *CertificateReconciler) findCertificateBySecretName(ctx, secretName, secretNamespace) *Certificate
- *   Находит Certificate по имени секрета
+ * Дополнительные функции находятся в:
+ * - certificate_controller_setup.go - SetupWithManager и наблюдение за связанными ресурсами
+ *   (функции сопоставления - в certificate_watches.go)
+ * - certificate_issuing.go - временный сертификат и HTTP01 challenge на время выпуска
+ * - certificate_issued.go - восстановление Gateway после выпуска сертификата
+ * - certificate_finalizer.go - finalizer и откат Gateway при удалении Certificate
+ * - certificate_sweeper.go - удаление временных ресурсов удаленных Certificate
+ * - certificate_overlay.go - overlay Gateway режима Overlay
+ * - certificate_helpers.go, certificate_gateway.go, certificate_temporary.go, certificate_verification.go -
+ *   вспомогательные функции, функции Gateway, временного сертификата и проверки сертификатов
+ * - certificate_gatewayapi.go - функции для Gateway API Gateway
  */
 
 package controller
@@ -61,13 +22,11 @@ package controller
 import (
 	"context"
 	"fmt"
-	"time"
 
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
-	istionetworkingv1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -83,15 +42,26 @@ type CertificateReconciler struct {
 	client.Client
 	Scheme    *runtime.Scheme
 	DebugMode bool
+	// GatewayAPIEnabled включает обработку Gateway API (gateway.networking.k8s.io) Gateway
+	GatewayAPIEnabled bool
+	// Recorder создает события на Certificate и Gateway при каждом изменении
+	Recorder record.EventRecorder
 }
 
-// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificates/status,verbs=get
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates/finalizers,verbs=update
 // +kubebuilder:rbac:groups=cert-manager.io,resources=issuers,verbs=get;list;watch;create;delete
-// +kubebuilder:rbac:groups=networking.istio.io,resources=gateways,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=clusterissuers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.istio.io,resources=gateways,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=networking.istio.io,resources=envoyfilters,verbs=get;list;watch;create;update;delete
-// +kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices,verbs=get;list;watch;create;update;delete
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=http01.istio-http01.rieset.io,resources=http01policies,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
 
 // Reconcile обрабатывает Certificate ресурсы
 func (r *CertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -100,7 +70,20 @@ func (r *CertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// Получение Certificate
 	cert := &certmanagerv1.Certificate{}
 	if err := r.Get(ctx, req.NamespacedName, cert); err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		if apierrors.IsNotFound(err) {
+			// Certificate удален: изменения Gateway откатил finalizer gateway-restore, временные ресурсы
+			// namespace сертификата удаляет GC по owner reference, остальное - sweeper при старте оператора.
+			// Полный обход кластера на каждое удаление не выполняется
+			forgetCertificatePending(req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Certificate удаляется - откатываем изменения Gateway до снятия finalizer
+	if !cert.DeletionTimestamp.IsZero() {
+		forgetCertificatePending(req.NamespacedName)
+		return ctrl.Result{}, r.finalizeCertificate(ctx, cert)
 	}
 
 	// Вывод информации о Certificate
@@ -146,213 +129,63 @@ func (r *CertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	// Проверка готовности сертификата
 	isReady := r.isCertificateReady(cert)
-	if !isReady {
+	r.recordCertificateReadiness(ctx, cert, isReady)
+
+	// Временный сертификат и маршрутизация challenge нужны только сертификатам issuer'ов с ACME HTTP01 solver
+	// Сертификаты DNS01, CA и других issuer'ов не затрагиваются (восстановление Gateway выполняется для всех)
+	usesHTTP01, err := r.certificateUsesHTTP01(ctx, cert)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Gateway API Gateway обрабатываются отдельно: certificateRefs переключаются так же, как credentialName
+	// restoreFailed - не все изменения откачены после выпуска сертификата, finalizer остается
+	restoreFailed := false
+	if r.GatewayAPIEnabled && (isReady || usesHTTP01) {
+		if err := r.reconcileGatewayAPIGateways(ctx, cert, isReady); err != nil {
+			logger.Error(err, "failed to reconcile Gateway API Gateways for certificate",
+				"certificateName", cert.Name,
+				"secretName", cert.Spec.SecretName,
+			)
+			if !isReady {
+				// Повтор с backoff (например, Http01Policy не удалось прочитать): Istio Gateway в этой реконсиляции не изменяются
+				return ctrl.Result{}, err
+			}
+			restoreFailed = true
+		}
+	}
+	if !isReady && !usesHTTP01 {
+		logger.Info("Certificate is not ready yet, issuer has no ACME HTTP01 solver for its domains, skipping",
+			"certificateName", cert.Name,
+			"certificateNamespace", cert.Namespace,
+			"issuerRef", fmt.Sprintf("%s/%s", cert.Spec.IssuerRef.Kind, cert.Spec.IssuerRef.Name),
+		)
+	} else if !isReady {
 		logger.Info("Certificate is not ready yet",
 			"certificateName", cert.Name,
 			"certificateNamespace", cert.Namespace,
 			"secretName", cert.Spec.SecretName,
 		)
 
-		// Поиск Gateway, которые используют этот сертификат
-		gateways, err := r.findGatewaysUsingCertificate(ctx, cert.Spec.SecretName, cert.Namespace)
-		if err != nil {
-			logger.Error(err, "failed to find Gateways using certificate",
-				"certificateName", cert.Name,
-				"secretName", cert.Spec.SecretName,
-			)
-		} else if len(gateways) > 0 {
-			// Периодическая проверка и восстановление состояния для Gateway с httpsRedirect
-			for _, gateway := range gateways {
-				// Проверяем, что Gateway действительно связан с этим сертификатом
-				// Проверяем по оригинальному или временному секрету
-				originalSecretName := cert.Spec.SecretName
-				tempSecretName := fmt.Sprintf("%s-temp", cert.Spec.SecretName)
-				isGatewayRelated := r.isGatewayUsingSecret(ctx, gateway, originalSecretName, cert.Namespace) ||
-					r.isGatewayUsingSecret(ctx, gateway, tempSecretName, cert.Namespace) ||
-					(gateway.Annotations != nil && gateway.Annotations[fmt.Sprintf("istio-http01.rieset.io/original-credential-name-%s", originalSecretName)] != "")
-
-				if !isGatewayRelated {
-					logger.V(1).Info("Gateway not related to certificate, skipping",
-						"certificateName", cert.Name,
-						"gatewayName", gateway.Name,
-						"gatewayNamespace", gateway.Namespace,
-					)
-					continue
-				}
-
-				if r.hasHTTPSRedirect(gateway) {
-					// Проверяем и восстанавливаем состояние временного сертификата, httpRedirect и EnvoyFilter
-					if err := r.ensureTemporaryCertificateSetup(ctx, cert, gateway); err != nil {
-						logger.Error(err, "failed to ensure temporary certificate setup",
-							"certificateName", cert.Name,
-							"gatewayName", gateway.Name,
-							"gatewayNamespace", gateway.Namespace,
-						)
-					}
-				} else {
-					// Проверяем, использует ли Gateway временный секрет, но httpsRedirect не отключен
-					if r.isGatewayUsingSecret(ctx, gateway, tempSecretName, cert.Namespace) {
-						// Gateway использует временный секрет, но httpsRedirect может быть включен
-						// Отключаем его для прохождения HTTP01 challenge
-						if err := r.disableHTTPSRedirectForHTTP01(ctx, gateway, cert.Spec.SecretName, cert.Namespace); err != nil {
-							logger.Error(err, "failed to disable httpsRedirect for HTTP01 challenge",
-								"gatewayName", gateway.Name,
-								"gatewayNamespace", gateway.Namespace,
-							)
-						}
-					}
-				}
-			}
+		if err := r.reconcileIssuingCertificate(ctx, cert); err != nil {
+			return ctrl.Result{}, err
 		}
 	} else {
-		// Сертификат готов - проверяем, нужно ли восстановить оригинальный секрет в Gateway
-		gateways, err := r.findGatewaysUsingCertificate(ctx, cert.Spec.SecretName, cert.Namespace)
-		if err != nil {
-			logger.Error(err, "failed to find Gateways using certificate",
-				"certificateName", cert.Name,
-				"secretName", cert.Spec.SecretName,
-			)
-		} else if len(gateways) > 0 {
-			// Проверяем, использует ли Gateway временный секрет - если да, убеждаемся, что EnvoyFilter существует
-			tempSecretName := fmt.Sprintf("%s-temp", cert.Spec.SecretName)
-			for _, gateway := range gateways {
-				usesTempSecret := r.isGatewayUsingSecret(ctx, gateway, tempSecretName, cert.Namespace)
-				logger.Info("Проверка использования секрета в Gateway для очистки EnvoyFilter",
-					"gatewayName", gateway.Name,
-					"gatewayNamespace", gateway.Namespace,
-					"usesTempSecret", usesTempSecret,
-					"tempSecretName", tempSecretName,
-				)
-				if usesTempSecret {
-					// Gateway использует временный секрет - проверяем наличие EnvoyFilter
-					envoyFilterName := fmt.Sprintf("disable-hsts-%s-%s", gateway.Namespace, gateway.Name)
-					envoyFilter := &istionetworkingv1alpha3.EnvoyFilter{}
-					if err := r.Get(ctx, client.ObjectKey{
-						Name:      envoyFilterName,
-						Namespace: gateway.Namespace,
-					}, envoyFilter); err != nil {
-						// EnvoyFilter не существует - создаем его
-						logger.Info("Certificate ready but Gateway uses temporary secret, ensuring EnvoyFilter exists",
-							"gatewayName", gateway.Name,
-							"gatewayNamespace", gateway.Namespace,
-						)
-						if err := r.createEnvoyFilterToDisableHSTS(ctx, gateway, cert.Spec.SecretName); err != nil {
-							logger.Error(err, "failed to create EnvoyFilter for temporary certificate",
-								"gatewayName", gateway.Name,
-								"gatewayNamespace", gateway.Namespace,
-							)
-						}
-					}
-				} else {
-					// Gateway использует оригинальный секрет - проверяем и удаляем EnvoyFilter, если он существует
-					// Используем unstructured для проверки, так как тип v1alpha3.EnvoyFilter не зарегистрирован в схеме
-					envoyFilterName := fmt.Sprintf("disable-hsts-%s-%s", gateway.Namespace, gateway.Name)
-					envoyFilter := &unstructured.Unstructured{}
-					envoyFilter.SetGroupVersionKind(schema.GroupVersionKind{
-						Group:   "networking.istio.io",
-						Version: "v1alpha3",
-						Kind:    "EnvoyFilter",
-					})
-					envoyFilter.SetName(envoyFilterName)
-					envoyFilter.SetNamespace(gateway.Namespace)
-					err := r.Get(ctx, client.ObjectKey{
-						Name:      envoyFilterName,
-						Namespace: gateway.Namespace,
-					}, envoyFilter)
-					if err == nil {
-						// EnvoyFilter существует, но Gateway использует оригинальный секрет - удаляем его
-						logger.Info("Сертификат готов и Gateway использует оригинальный секрет, удаляем EnvoyFilter",
-							"gatewayName", gateway.Name,
-							"gatewayNamespace", gateway.Namespace,
-							"envoyFilterName", envoyFilterName,
-						)
-						if err := r.deleteEnvoyFilterForHSTS(ctx, gateway, cert.Spec.SecretName); err != nil {
-							logger.Error(err, "не удалось удалить EnvoyFilter для HSTS",
-								"gatewayName", gateway.Name,
-								"gatewayNamespace", gateway.Namespace,
-							)
-						}
-					} else {
-						logger.V(1).Info("EnvoyFilter не найден (возможно, уже удален)",
-							"gatewayName", gateway.Name,
-							"gatewayNamespace", gateway.Namespace,
-							"envoyFilterName", envoyFilterName,
-						)
-					}
-				}
-			}
-
-			// В debug режиме проверяем, прошло ли 5 минут с момента создания временного сертификата
-			if r.DebugMode {
-				tempCertName := fmt.Sprintf("%s-temp-selfsigned", cert.Name)
-				tempCert := &certmanagerv1.Certificate{}
-				if err := r.Get(ctx, client.ObjectKey{
-					Name:      tempCertName,
-					Namespace: cert.Namespace,
-				}, tempCert); err == nil {
-					// Временный сертификат существует - проверяем время создания
-					creationTime := tempCert.CreationTimestamp.Time
-					elapsed := time.Since(creationTime)
-					minElapsed := 5 * time.Minute
-
-					if elapsed < minElapsed {
-						logger.Info("Debug mode: delaying certificate restoration",
-							"certificateName", cert.Name,
-							"elapsed", elapsed,
-							"required", minElapsed,
-							"remaining", minElapsed-elapsed,
-						)
-						// Возвращаем результат с временем до следующей проверки
-						remaining := minElapsed - elapsed
-						if remaining < 30*time.Second {
-							remaining = 30 * time.Second
-						}
-						return ctrl.Result{RequeueAfter: remaining}, nil
-					}
-					logger.Info("Debug mode: 5 minutes elapsed, restoring certificate",
-						"certificateName", cert.Name,
-						"elapsed", elapsed,
-					)
-				}
-			}
-
-			// Восстанавливаем оригинальный секрет в Gateway и включаем обратно HSTS
-			for _, gateway := range gateways {
-				if err := r.restoreGatewayOriginalSecret(ctx, gateway, cert.Spec.SecretName, cert.Namespace); err != nil {
-					logger.Error(err, "failed to restore original secret in Gateway",
-						"certificateName", cert.Name,
-						"gatewayName", gateway.Name,
-						"gatewayNamespace", gateway.Namespace,
-					)
-				}
-			}
-
-			// Удаляем временный самоподписанный сертификат
-			if err := r.deleteTemporarySelfSignedCertificate(ctx, cert); err != nil {
-				logger.Error(err, "failed to delete temporary self-signed certificate",
-					"certificateName", cert.Name,
-				)
-			}
+		// Сертификат готов - восстанавливаем оригинальный секрет в Gateway
+		result, failed := r.reconcileIssuedCertificate(ctx, cert)
+		if !result.IsZero() {
+			return result, nil
 		}
+		restoreFailed = restoreFailed || failed
 	}
 
-	// Периодическая проверка для отслеживания готовности временных сертификатов
-	return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
-}
-
-// Вспомогательные функции перенесены в certificate_helpers.go
-
-// createSelfSignedCertificate перенесена в certificate_temporary.go
-
-// Функции Gateway перенесены в certificate_gateway.go
-
-// ensureTemporaryCertificateSetup перенесена в certificate_temporary.go
-
-// Функции проверки сертификатов перенесены в certificate_verification.go
+	// Сертификат выпущен и все изменения Gateway откачены - finalizer больше не нужен
+	if isReady && !restoreFailed {
+		if err := r.removeCertificateFinalizer(ctx, cert); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
-// SetupWithManager настраивает контроллер
-func (r *CertificateReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&certmanagerv1.Certificate{}).
-		Complete(r)
+	// Повторная реконсиляция запускается событиями связанных ресурсов (см. SetupWithManager)
+	return ctrl.Result{}, nil
 }
@@ -0,0 +1,76 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) SetupWithManager(mgr) error
+ *   Настраивает контроллер и наблюдение за связанными ресурсами (функции сопоставления в certificate_watches.go)
+ */
+
+package controller
+
+import (
+	"context"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// SetupWithManager настраивает контроллер
+// Вместо периодической реконсиляции контроллер следит за ресурсами, от которых зависит состояние сертификата:
+// Gateway и их VirtualService/HTTPRoute, секретами, EnvoyFilter отключения HSTS, временными сертификатами,
+// а также Issuer и ClusterIssuer (набор solver'ов определяет, нужна ли обработка HTTP01)
+func (r *CertificateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	envoyFilter := &unstructured.Unstructured{}
+	envoyFilter.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "networking.istio.io",
+		Version: "v1alpha3",
+		Kind:    "EnvoyFilter",
+	})
+	managedByOperator := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetLabels()["app.kubernetes.io/managed-by"] == istioHTTP01ManagedByLabel
+	})
+
+	controllerBuilder := ctrl.NewControllerManagedBy(mgr).
+		// Временные сертификаты реконсилируются через оригинальный сертификат
+		For(&certmanagerv1.Certificate{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return !isTemporaryObject(obj)
+		}))).
+		Watches(&certmanagerv1.Certificate{},
+			handler.EnqueueRequestsFromMapFunc(originalCertificateForTemporary),
+			builder.WithPredicates(predicate.NewPredicateFuncs(isTemporaryObject)),
+		).
+		Watches(&istionetworkingv1beta1.Gateway{}, handler.EnqueueRequestsFromMapFunc(r.certificatesForGateway)).
+		Watches(&istionetworkingv1beta1.VirtualService{}, handler.EnqueueRequestsFromMapFunc(r.certificatesForVirtualService)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.certificatesForSecret), builder.OnlyMetadata).
+		Watches(envoyFilter, handler.EnqueueRequestsFromMapFunc(r.certificatesForEnvoyFilter), builder.WithPredicates(managedByOperator)).
+		Watches(&certmanagerv1.Issuer{}, handler.EnqueueRequestsFromMapFunc(r.certificatesForIssuer)).
+		Watches(&certmanagerv1.ClusterIssuer{}, handler.EnqueueRequestsFromMapFunc(r.certificatesForIssuer))
+
+	if r.GatewayAPIEnabled {
+		controllerBuilder = controllerBuilder.
+			Watches(&gatewayapiv1.Gateway{}, handler.EnqueueRequestsFromMapFunc(r.certificatesForGatewayAPI)).
+			Watches(&gatewayapiv1.HTTPRoute{}, handler.EnqueueRequestsFromMapFunc(r.certificatesForHTTPRoute))
+	}
+
+	// Временные ресурсы сертификатов, удаленных пока оператор не работал, убираются при старте
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		if err := r.sweepOrphanedTemporaryResources(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "failed to sweep orphaned temporary resources")
+		}
+		return nil
+	})); err != nil {
+		return err
+	}
+
+	return controllerBuilder.Complete(r)
+}
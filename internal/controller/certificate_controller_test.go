@@ -0,0 +1,321 @@
+/*
+ * Интеграционные тесты CertificateReconciler (envtest):
+ *
+ * - полный цикл ACME HTTP01 сертификата: не готов -> временный сертификат и EnvoyFilter ->
+ *   Gateway на временном секрете без httpsRedirect -> сертификат выпущен -> восстановление Gateway
+ * - удаление сертификата до выпуска: finalizer откатывает Gateway, EnvoyFilter и временный сертификат
+ * - режим Overlay Http01Policy: временный секрет обслуживает overlay Gateway, Gateway пользователя не изменяется
+ * - сертификат issuer'а без HTTP01 solver'а: Gateway и временные ресурсы не затрагиваются
+ *
+ * Unit тесты (fake client):
+ *
+ * - реконсиляция удаленного Certificate не обходит временные ресурсы кластера
+ */
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+// getHSTSEnvoyFilter получает EnvoyFilter отключения HSTS для Gateway (тип v1alpha3 не зарегистрирован в схеме)
+func getHSTSEnvoyFilter(gateway *istionetworkingv1beta1.Gateway) error {
+	envoyFilter := &unstructured.Unstructured{}
+	envoyFilter.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "networking.istio.io",
+		Version: "v1alpha3",
+		Kind:    "EnvoyFilter",
+	})
+	return k8sClient.Get(testCtx, client.ObjectKey{
+		Name:      hstsEnvoyFilterName(gateway),
+		Namespace: gateway.Namespace,
+	}, envoyFilter)
+}
+
+// gatewayServers возвращает credentialName HTTPS сервера и httpsRedirect HTTP сервера Gateway
+func gatewayServers(key client.ObjectKey) (string, bool, error) {
+	gateway := &istionetworkingv1beta1.Gateway{}
+	if err := k8sClient.Get(testCtx, key, gateway); err != nil {
+		return "", false, err
+	}
+	credentialName, httpsRedirect := "", false
+	for _, server := range gateway.Spec.Servers {
+		switch server.Port.Number {
+		case 443:
+			credentialName = server.GetTls().GetCredentialName()
+		case 80:
+			httpsRedirect = server.GetTls().GetHttpsRedirect()
+		}
+	}
+	return credentialName, httpsRedirect, nil
+}
+
+// createTestACMEIssuer создает Issuer с ACME HTTP01 solver'ом
+func createTestACMEIssuer(namespace string) *certmanagerv1.Issuer {
+	class := "istio"
+	issuer := &certmanagerv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "letsencrypt", Namespace: namespace},
+		Spec: certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{ACME: &cmacme.ACMEIssuer{
+			Server:     "https://acme.example.com/directory",
+			PrivateKey: cmmeta.SecretKeySelector{LocalObjectReference: cmmeta.LocalObjectReference{Name: "letsencrypt-key"}},
+			Solvers: []cmacme.ACMEChallengeSolver{{
+				HTTP01: &cmacme.ACMEChallengeSolverHTTP01{Ingress: &cmacme.ACMEChallengeSolverHTTP01Ingress{Class: &class}},
+			}},
+		}}},
+	}
+	Expect(k8sClient.Create(testCtx, issuer)).To(Succeed())
+	return issuer
+}
+
+var _ = Describe("CertificateReconciler", func() {
+	const (
+		host       = "app.example.com"
+		secretName = "app-tls"
+	)
+
+	var (
+		namespace string
+		gateway   *istionetworkingv1beta1.Gateway
+	)
+
+	BeforeEach(func() {
+		requireEnvtest()
+		namespace = createTestNamespace()
+
+		gateway = newTestGateway(namespace, "public", host, secretName)
+		Expect(k8sClient.Create(testCtx, gateway)).To(Succeed())
+		Expect(k8sClient.Create(testCtx, newTestVirtualService(namespace, "app", host, gateway.Name))).To(Succeed())
+	})
+
+	It("serves a temporary certificate until the ACME HTTP01 certificate is issued", func() {
+		issuer := createTestACMEIssuer(namespace)
+
+		cert := &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace},
+			Spec: certmanagerv1.CertificateSpec{
+				SecretName: secretName,
+				DNSNames:   []string{host},
+				IssuerRef:  cmmeta.ObjectReference{Name: issuer.Name, Kind: certmanagerv1.IssuerKind},
+			},
+		}
+		Expect(k8sClient.Create(testCtx, cert)).To(Succeed())
+		gatewayKey := client.ObjectKeyFromObject(gateway)
+		tempCertKey := client.ObjectKey{Name: "app-temp-selfsigned", Namespace: namespace}
+
+		By("creating the temporary self-signed certificate and the HSTS EnvoyFilter")
+		tempCert := &certmanagerv1.Certificate{}
+		Eventually(func() error {
+			return k8sClient.Get(testCtx, tempCertKey, tempCert)
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+		Expect(tempCert.Spec.SecretName).To(Equal(secretName + "-temp"))
+		Expect(tempCert.Spec.DNSNames).To(ContainElement(host))
+		Expect(tempCert.Labels).To(HaveKeyWithValue("istio-http01.rieset.io/original-cert", cert.Name))
+		Expect(metav1.GetControllerOf(tempCert)).To(HaveField("Name", cert.Name))
+		Expect(k8sClient.Get(testCtx, client.ObjectKey{Name: "app-temp-selfsigned-issuer", Namespace: namespace}, &certmanagerv1.Issuer{})).To(Succeed())
+		Eventually(func() error {
+			return getHSTSEnvoyFilter(gateway)
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+
+		By("switching the Gateway to the temporary secret once it is issued")
+		setCertificateReady(tempCertKey, true)
+		Eventually(func(g Gomega) {
+			credentialName, httpsRedirect, err := gatewayServers(gatewayKey)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(credentialName).To(Equal(secretName + "-temp"))
+			g.Expect(httpsRedirect).To(BeFalse())
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+
+		updated := &istionetworkingv1beta1.Gateway{}
+		Expect(k8sClient.Get(testCtx, gatewayKey, updated)).To(Succeed())
+		Expect(updated.Annotations).To(HaveKeyWithValue("istio-http01.rieset.io/original-credential-name-"+secretName, secretName))
+		Expect(updated.Annotations).To(HaveKey("istio-http01.rieset.io/original-https-redirect-" + secretName))
+
+		By("restoring the Gateway once the certificate is issued")
+		setCertificateReady(client.ObjectKeyFromObject(cert), true)
+		Eventually(func(g Gomega) {
+			credentialName, httpsRedirect, err := gatewayServers(gatewayKey)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(credentialName).To(Equal(secretName))
+			g.Expect(httpsRedirect).To(BeTrue())
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+
+		Eventually(func() bool {
+			return apierrors.IsNotFound(getHSTSEnvoyFilter(gateway))
+		}, eventuallyTimeout, eventuallyInterval).Should(BeTrue())
+		Eventually(func() bool {
+			return apierrors.IsNotFound(k8sClient.Get(testCtx, tempCertKey, &certmanagerv1.Certificate{}))
+		}, eventuallyTimeout, eventuallyInterval).Should(BeTrue())
+
+		Expect(k8sClient.Get(testCtx, gatewayKey, updated)).To(Succeed())
+		Expect(updated.Annotations).NotTo(HaveKey("istio-http01.rieset.io/original-credential-name-" + secretName))
+		Expect(updated.Annotations).NotTo(HaveKey("istio-http01.rieset.io/original-https-redirect-" + secretName))
+
+		By("removing the finalizer once nothing is left to roll back")
+		Eventually(func(g Gomega) {
+			issued := &certmanagerv1.Certificate{}
+			g.Expect(k8sClient.Get(testCtx, client.ObjectKeyFromObject(cert), issued)).To(Succeed())
+			g.Expect(issued.Finalizers).NotTo(ContainElement(certificateFinalizer))
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+	})
+
+	It("rolls the Gateway back when the certificate is deleted before it is issued", func() {
+		issuer := createTestACMEIssuer(namespace)
+		cert := &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace},
+			Spec: certmanagerv1.CertificateSpec{
+				SecretName: secretName,
+				DNSNames:   []string{host},
+				IssuerRef:  cmmeta.ObjectReference{Name: issuer.Name, Kind: certmanagerv1.IssuerKind},
+			},
+		}
+		Expect(k8sClient.Create(testCtx, cert)).To(Succeed())
+		certKey := client.ObjectKeyFromObject(cert)
+		gatewayKey := client.ObjectKeyFromObject(gateway)
+		tempCertKey := client.ObjectKey{Name: "app-temp-selfsigned", Namespace: namespace}
+
+		By("switching the Gateway to the temporary secret")
+		Eventually(func() error {
+			return k8sClient.Get(testCtx, tempCertKey, &certmanagerv1.Certificate{})
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+		setCertificateReady(tempCertKey, true)
+		Eventually(func(g Gomega) {
+			credentialName, httpsRedirect, err := gatewayServers(gatewayKey)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(credentialName).To(Equal(secretName + "-temp"))
+			g.Expect(httpsRedirect).To(BeFalse())
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+
+		pending := &certmanagerv1.Certificate{}
+		Expect(k8sClient.Get(testCtx, certKey, pending)).To(Succeed())
+		Expect(pending.Finalizers).To(ContainElement(certificateFinalizer))
+
+		By("restoring the Gateway before the certificate is removed")
+		Expect(k8sClient.Delete(testCtx, cert)).To(Succeed())
+		Eventually(func() bool {
+			return apierrors.IsNotFound(k8sClient.Get(testCtx, certKey, &certmanagerv1.Certificate{}))
+		}, eventuallyTimeout, eventuallyInterval).Should(BeTrue())
+
+		credentialName, httpsRedirect, err := gatewayServers(gatewayKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentialName).To(Equal(secretName))
+		Expect(httpsRedirect).To(BeTrue())
+		Expect(apierrors.IsNotFound(getHSTSEnvoyFilter(gateway))).To(BeTrue())
+		Expect(apierrors.IsNotFound(k8sClient.Get(testCtx, tempCertKey, &certmanagerv1.Certificate{}))).To(BeTrue())
+	})
+
+	It("serves the temporary certificate from an overlay Gateway in Overlay mode", func() {
+		Expect(k8sClient.Create(testCtx, &http01v1alpha1.Http01Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "gitops", Namespace: namespace},
+			Spec:       http01v1alpha1.Http01PolicySpec{GatewayMode: http01v1alpha1.GatewayModeOverlay},
+		})).To(Succeed())
+		issuer := createTestACMEIssuer(namespace)
+		cert := &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace},
+			Spec: certmanagerv1.CertificateSpec{
+				SecretName: secretName,
+				DNSNames:   []string{host},
+				IssuerRef:  cmmeta.ObjectReference{Name: issuer.Name, Kind: certmanagerv1.IssuerKind},
+			},
+		}
+		Expect(k8sClient.Create(testCtx, cert)).To(Succeed())
+		gatewayKey := client.ObjectKeyFromObject(gateway)
+		overlayKey := client.ObjectKey{Name: overlayGatewayName(gateway.Name), Namespace: namespace}
+		tempCertKey := client.ObjectKey{Name: "app-temp-selfsigned", Namespace: namespace}
+
+		By("creating the overlay Gateway once the temporary certificate is issued")
+		Eventually(func() error {
+			return k8sClient.Get(testCtx, tempCertKey, &certmanagerv1.Certificate{})
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+		setCertificateReady(tempCertKey, true)
+		overlay := &istionetworkingv1beta1.Gateway{}
+		Eventually(func() error {
+			return k8sClient.Get(testCtx, overlayKey, overlay)
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+		Expect(overlay.Spec.Selector).To(Equal(gateway.Spec.Selector))
+		Expect(metav1.GetControllerOf(overlay)).To(HaveField("Name", gateway.Name))
+		credentialName, httpsRedirect, err := gatewayServers(overlayKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentialName).To(Equal(secretName + "-temp"))
+		Expect(httpsRedirect).To(BeFalse())
+
+		Consistently(func(g Gomega) {
+			credentialName, httpsRedirect, err := gatewayServers(gatewayKey)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(credentialName).To(Equal(secretName))
+			g.Expect(httpsRedirect).To(BeTrue())
+		}, 3*time.Second, eventuallyInterval).Should(Succeed())
+
+		By("deleting the overlay Gateway once the certificate is issued")
+		setCertificateReady(client.ObjectKeyFromObject(cert), true)
+		Eventually(func() bool {
+			return apierrors.IsNotFound(k8sClient.Get(testCtx, overlayKey, &istionetworkingv1beta1.Gateway{}))
+		}, eventuallyTimeout, eventuallyInterval).Should(BeTrue())
+	})
+
+	It("leaves Gateways alone for certificates of issuers without HTTP01", func() {
+		issuer := &certmanagerv1.Issuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "internal-ca", Namespace: namespace},
+			Spec: certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{
+				CA: &certmanagerv1.CAIssuer{SecretName: "internal-ca"},
+			}},
+		}
+		Expect(k8sClient.Create(testCtx, issuer)).To(Succeed())
+
+		cert := &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace},
+			Spec: certmanagerv1.CertificateSpec{
+				SecretName: secretName,
+				DNSNames:   []string{host},
+				IssuerRef:  cmmeta.ObjectReference{Name: issuer.Name, Kind: certmanagerv1.IssuerKind},
+			},
+		}
+		Expect(k8sClient.Create(testCtx, cert)).To(Succeed())
+
+		Consistently(func(g Gomega) {
+			g.Expect(apierrors.IsNotFound(k8sClient.Get(testCtx,
+				client.ObjectKey{Name: "app-temp-selfsigned", Namespace: namespace}, &certmanagerv1.Certificate{}))).To(BeTrue())
+			credentialName, httpsRedirect, err := gatewayServers(client.ObjectKeyFromObject(gateway))
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(credentialName).To(Equal(secretName))
+			g.Expect(httpsRedirect).To(BeTrue())
+		}, 3*time.Second, eventuallyInterval).Should(Succeed())
+	})
+})
+
+var _ = Describe("CertificateReconciler for a deleted Certificate", func() {
+	It("does not sweep the cluster on every delete event", func() {
+		lists := 0
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+			WithInterceptorFuncs(interceptor.Funcs{
+				List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+					lists++
+					return c.List(ctx, list, opts...)
+				},
+			}).
+			Build()
+		r := &CertificateReconciler{Client: c, Scheme: c.Scheme()}
+
+		_, err := r.Reconcile(testCtx, ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "app", Name: "deleted"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lists).To(BeZero())
+	})
+})
@@ -1,22 +1,26 @@
 /*
  * Функции, определенные в этом файле:
  *
- * - (r *CertificateReconciler) createEnvoyFilterToDisableHSTS(ctx, gateway, originalSecretName) error
- *   Создает EnvoyFilter для отключения HSTS заголовка
+ * - (r *CertificateReconciler) createEnvoyFilterToDisableHSTS(ctx, gateway, cert) error
+ *   Создает или обновляет EnvoyFilter для обработки HSTS заголовка по аннотациям Gateway и добавляет
+ *   в него ссылку на секрет сертификата (owner reference на Certificate из namespace Gateway; Lua код - в certificate_hsts.go)
  *
- * - (r *CertificateReconciler) deleteEnvoyFilterForHSTS(ctx, gateway, originalSecretName) error
- *   Удаляет EnvoyFilter для отключения HSTS
+ * Ссылки секретов (аннотация hsts-secrets), их снятие и удаление EnvoyFilter - в certificate_hsts_refs.go
  */
 
 package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
-	istionetworkingv1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -24,28 +28,112 @@ import (
 )
 
 // createEnvoyFilterToDisableHSTS создает EnvoyFilter для отключения HSTS заголовка
-func (r *CertificateReconciler) createEnvoyFilterToDisableHSTS(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, originalSecretName string) error {
+// EnvoyFilter общий для всех сертификатов Gateway: каждый Certificate из namespace Gateway добавляет
+// owner reference, и GC удаляет EnvoyFilter вместе с последним из них (см. setSharedOwnerReference).
+// Кроме того, каждый сертификат добавляет ссылку namespace/name своего секрета в аннотацию hsts-secrets - по ним
+// Lua фильтр обрабатывает только DNS имена ожидающих выпуска сертификатов, а deleteEnvoyFilterForHSTS удаляет
+// EnvoyFilter с последней ссылкой.
+// Режим и область обработки задают аннотации hsts-mode и hsts-scope Gateway: при их изменении
+// существующий EnvoyFilter обновляется, а в режиме keep удаляется
+func (r *CertificateReconciler) createEnvoyFilterToDisableHSTS(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, cert *certmanagerv1.Certificate) error {
 	logger := log.FromContext(ctx)
+	originalSecretName := cert.Spec.SecretName
 
-	envoyFilterName := fmt.Sprintf("disable-hsts-%s-%s", gateway.Namespace, gateway.Name)
+	// Http01Policy может запрещать создание EnvoyFilter для Gateway
+	policy, err := resolveHTTP01Policy(ctx, r.Client, gateway)
+	if err != nil {
+		return err
+	}
+	if !policy.DisableHSTS {
+		logger.V(1).Info("HSTS EnvoyFilter disabled by Http01Policy",
+			"gatewayName", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+			"policy", policy.PolicyName,
+		)
+		return nil
+	}
+
+	hsts, err := gatewayHSTSSettings(gateway)
+	if err != nil {
+		recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonInvalidHSTSAnnotation,
+			"%v, using defaults", err)
+		logger.Error(err, "invalid HSTS annotations on Gateway, using defaults",
+			"gatewayName", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+		)
+	}
+	if hsts.Mode == hstsModeKeep {
+		// HSTS оставлен без изменений - EnvoyFilter не нужен (и удаляется, если режим сменился)
+		logger.V(1).Info("HSTS handling disabled by Gateway annotation",
+			"gatewayName", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+		)
+		return r.deleteEnvoyFilterForHSTS(ctx, gateway, "")
+	}
+	secretRef := hstsSecretRef(cert.Namespace, originalSecretName)
+
+	envoyFilterName := r.adoptHSTSEnvoyFilter(ctx, gateway)
 	envoyFilterNamespace := gateway.Namespace
 
-	// Проверяем, не создан ли уже EnvoyFilter
-	existingFilter := &istionetworkingv1alpha3.EnvoyFilter{}
+	// Проверяем, не создан ли уже EnvoyFilter (тип v1alpha3.EnvoyFilter не зарегистрирован в схеме)
+	existingFilter := &unstructured.Unstructured{}
+	existingFilter.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "networking.istio.io",
+		Version: "v1alpha3",
+		Kind:    "EnvoyFilter",
+	})
 	if err := r.Get(ctx, client.ObjectKey{
 		Name:      envoyFilterName,
 		Namespace: envoyFilterNamespace,
 	}, existingFilter); err == nil {
-		// EnvoyFilter уже существует
+		// EnvoyFilter уже существует - добавляем owner reference и ссылку на секрет этого сертификата
+		// и обновляем spec, если изменились режим, область или хосты
 		logger.V(1).Info("EnvoyFilter to disable HSTS already exists",
 			"envoyFilterName", envoyFilterName,
 			"namespace", envoyFilterNamespace,
 		)
+		changed, err := setSharedOwnerReference(cert, existingFilter, r.Scheme, false)
+		if err != nil {
+			return fmt.Errorf("failed to set owner reference on EnvoyFilter: %w", err)
+		}
+		refs := hstsSecretRefs(existingFilter.GetAnnotations())
+		if !slices.Contains(refs, secretRef) {
+			refs = append(refs, secretRef)
+			setHSTSSecretRefs(existingFilter, refs)
+			changed = true
+		}
+		hosts, err := r.hstsHosts(ctx, gateway, refs, hsts)
+		if errors.Is(err, errNoHSTSHosts) {
+			// Хостов области не осталось - EnvoyFilter удаляется, а не обрабатывает все хосты Gateway
+			recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonEnvoyFilterFailed,
+				"%v, deleting EnvoyFilter %s instead of handling Strict-Transport-Security of all hosts", err, envoyFilterName)
+			return r.deleteEnvoyFilterForHSTS(ctx, gateway, "")
+		}
+		if err != nil {
+			return err
+		}
+		spec := hstsEnvoyFilterSpec(gateway, hstsLuaCode(hsts.Mode, hosts))
+		if existingSpec, _, _ := unstructured.NestedMap(existingFilter.Object, "spec"); !equality.Semantic.DeepEqual(existingSpec, spec) {
+			if err := unstructured.SetNestedMap(existingFilter.Object, spec, "spec"); err != nil {
+				return fmt.Errorf("failed to set EnvoyFilter spec: %w", err)
+			}
+			logger.Info("Updating HSTS EnvoyFilter",
+				"envoyFilterName", envoyFilterName,
+				"hstsMode", hsts.Mode,
+				"hstsScope", hsts.Scope,
+			)
+			changed = true
+		}
+		if changed {
+			if err := r.Update(ctx, existingFilter); err != nil {
+				return fmt.Errorf("failed to update EnvoyFilter: %w", err)
+			}
+		}
 		return nil
 	}
 
 	// Создаем EnvoyFilter для отключения HSTS заголовка через unstructured
-	// Используем HTTP_FILTER для удаления заголовка через Lua filter
+	// Используем HTTP_FILTER для удаления или замены заголовка через Lua filter
 	envoyFilter := &unstructured.Unstructured{}
 	envoyFilter.SetGroupVersionKind(schema.GroupVersionKind{
 		Group:   "networking.istio.io",
@@ -54,64 +142,37 @@ func (r *CertificateReconciler) createEnvoyFilterToDisableHSTS(ctx context.Conte
 	})
 	envoyFilter.SetName(envoyFilterName)
 	envoyFilter.SetNamespace(envoyFilterNamespace)
+	if _, err := setSharedOwnerReference(cert, envoyFilter, r.Scheme, true); err != nil {
+		return fmt.Errorf("failed to set owner reference on EnvoyFilter: %w", err)
+	}
 	envoyFilter.SetLabels(map[string]string{
 		"app.kubernetes.io/managed-by":         "istio-http01",
 		"istio-http01.rieset.io/temp":          tempLabelValue,
 		"istio-http01.rieset.io/original-cert": originalSecretName,
 	})
+	envoyFilter.SetAnnotations(map[string]string{
+		hstsGatewayAnnotation: gateway.Name,
+	})
+	setHSTSSecretRefs(envoyFilter, []string{secretRef})
 
-	// Устанавливаем spec через unstructured
-	// Получаем селектор из Gateway для правильного выбора workload
-	workloadLabels := make(map[string]interface{})
-	if len(gateway.Spec.Selector) > 0 {
-		// Используем селектор из Gateway
-		for key, value := range gateway.Spec.Selector {
-			workloadLabels[key] = value
-		}
-	} else {
-		// Если селектор не указан, используем стандартный istio ingressgateway
-		workloadLabels["istio"] = "ingressgateway"
+	hosts, err := r.hstsHosts(ctx, gateway, []string{secretRef}, hsts)
+	if errors.Is(err, errNoHSTSHosts) {
+		recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonEnvoyFilterFailed,
+			"%v, EnvoyFilter %s is not created: Strict-Transport-Security is sent unchanged", err, envoyFilterName)
+		return nil
 	}
-
-	spec := map[string]interface{}{
-		"workloadSelector": map[string]interface{}{
-			"labels": workloadLabels,
-		},
-		"configPatches": []interface{}{
-			map[string]interface{}{
-				"applyTo": "HTTP_FILTER",
-				"match": map[string]interface{}{
-					"context": "GATEWAY",
-					"proxy": map[string]interface{}{
-						"proxyVersion": ".*",
-					},
-					"listener": map[string]interface{}{
-						"filterChain": map[string]interface{}{
-							"filter": map[string]interface{}{
-								"name": "envoy.filters.network.http_connection_manager",
-							},
-						},
-					},
-				},
-				"patch": map[string]interface{}{
-					"operation": "INSERT_BEFORE",
-					"value": map[string]interface{}{
-						"name": "envoy.filters.http.lua",
-						"typed_config": map[string]interface{}{
-							"@type":       "type.googleapis.com/envoy.extensions.filters.http.lua.v3.Lua",
-							"inline_code": "function envoy_on_response(response_handle)\n  response_handle:headers():remove(\"strict-transport-security\")\nend\n",
-						},
-					},
-				},
-			},
-		},
+	if err != nil {
+		return err
 	}
+	spec := hstsEnvoyFilterSpec(gateway, hstsLuaCode(hsts.Mode, hosts))
 	if err := unstructured.SetNestedMap(envoyFilter.Object, spec, "spec"); err != nil {
 		return fmt.Errorf("failed to set EnvoyFilter spec: %w", err)
 	}
 
 	if err := r.Create(ctx, envoyFilter); err != nil {
 		if !strings.Contains(err.Error(), "already exists") {
+			recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonEnvoyFilterFailed,
+				"Failed to create EnvoyFilter %s to disable HSTS: %v", envoyFilterName, err)
 			return fmt.Errorf("failed to create EnvoyFilter to disable HSTS: %w", err)
 		}
 		logger.V(1).Info("EnvoyFilter to disable HSTS already exists",
@@ -119,58 +180,17 @@ func (r *CertificateReconciler) createEnvoyFilterToDisableHSTS(ctx context.Conte
 			"namespace", envoyFilterNamespace,
 		)
 	} else {
+		recordEvent(r.Recorder, gateway, corev1.EventTypeNormal, eventReasonHSTSEnvoyFilterCreated,
+			"Created EnvoyFilter %s to handle Strict-Transport-Security (%s, %s) while the temporary certificate is served", envoyFilterName, hsts.Mode, hsts.Scope)
 		logger.Info("Created EnvoyFilter to disable HSTS",
 			"envoyFilterName", envoyFilterName,
+			"hstsMode", hsts.Mode,
+			"hstsScope", hsts.Scope,
 			"gatewayName", gateway.Name,
 			"gatewayNamespace", gateway.Namespace,
 		)
 	}
-
-	return nil
-}
-
-// deleteEnvoyFilterForHSTS удаляет EnvoyFilter для отключения HSTS
-func (r *CertificateReconciler) deleteEnvoyFilterForHSTS(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, _ string) error {
-	logger := log.FromContext(ctx)
-
-	envoyFilterName := fmt.Sprintf("disable-hsts-%s-%s", gateway.Namespace, gateway.Name)
-	envoyFilterNamespace := gateway.Namespace
-
-	// Используем unstructured для получения EnvoyFilter, так как тип v1alpha3.EnvoyFilter не зарегистрирован в схеме
-	envoyFilter := &unstructured.Unstructured{}
-	envoyFilter.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "networking.istio.io",
-		Version: "v1alpha3",
-		Kind:    "EnvoyFilter",
-	})
-	envoyFilter.SetName(envoyFilterName)
-	envoyFilter.SetNamespace(envoyFilterNamespace)
-	if err := r.Get(ctx, client.ObjectKey{
-		Name:      envoyFilterName,
-		Namespace: envoyFilterNamespace,
-	}, envoyFilter); err != nil {
-		// EnvoyFilter не найден, возможно уже удален
-		return nil
-	}
-
-	// Проверяем, что это наш EnvoyFilter
-	labels, found, err := unstructured.NestedStringMap(envoyFilter.Object, "metadata", "labels")
-	if err != nil || !found || labels["istio-http01.rieset.io/temp"] != tempLabelValue {
-		return nil
-	}
-
-	if err := r.Delete(ctx, envoyFilter); err != nil {
-		logger.Error(err, "failed to delete EnvoyFilter for HSTS",
-			"envoyFilterName", envoyFilterName,
-		)
-		return fmt.Errorf("failed to delete EnvoyFilter: %w", err)
-	}
-
-	logger.Info("EnvoyFilter для отключения HSTS удален (HSTS включен обратно)",
-		"envoyFilterName", envoyFilterName,
-		"gatewayName", gateway.Name,
-		"gatewayNamespace", gateway.Namespace,
-	)
+	hstsEnvoyFiltersActive.WithLabelValues(gateway.Name, gateway.Namespace).Set(1)
 
 	return nil
 }
@@ -0,0 +1,136 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) ensureCertificateFinalizer(ctx, cert) error
+ *   Добавляет finalizer на Certificate перед тем, как оператор изменит Gateway
+ *
+ * - (r *CertificateReconciler) removeCertificateFinalizer(ctx, cert) error
+ *   Снимает finalizer с Certificate, когда откатывать больше нечего
+ *
+ * - (r *CertificateReconciler) finalizeCertificate(ctx, cert) error
+ *   Откатывает изменения Gateway удаляемого Certificate и снимает finalizer
+ *
+ * - (r *CertificateReconciler) rollbackCertificateChanges(ctx, cert) error
+ *   Восстанавливает оригинальный секрет и httpsRedirect в Gateway, удаляет overlay Gateway, EnvoyFilter и временный сертификат
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// certificateFinalizer finalizer на Certificate, Gateway которых переключены оператором
+// Без него удаление Certificate оставляет Gateway на временном секрете с отключенными httpsRedirect и HSTS
+const certificateFinalizer = "istio-http01.rieset.io/gateway-restore"
+
+// ensureCertificateFinalizer добавляет finalizer на Certificate перед изменением Gateway
+func (r *CertificateReconciler) ensureCertificateFinalizer(ctx context.Context, cert *certmanagerv1.Certificate) error {
+	if controllerutil.ContainsFinalizer(cert, certificateFinalizer) {
+		return nil
+	}
+
+	patch := client.MergeFromWithOptions(cert.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	controllerutil.AddFinalizer(cert, certificateFinalizer)
+	if err := r.Patch(ctx, cert, patch); err != nil {
+		return fmt.Errorf("failed to add finalizer to Certificate: %w", err)
+	}
+
+	log.FromContext(ctx).Info("Added finalizer to Certificate",
+		"certificateName", cert.Name,
+		"certificateNamespace", cert.Namespace,
+		"finalizer", certificateFinalizer,
+	)
+	return nil
+}
+
+// removeCertificateFinalizer снимает finalizer с Certificate
+func (r *CertificateReconciler) removeCertificateFinalizer(ctx context.Context, cert *certmanagerv1.Certificate) error {
+	if !controllerutil.ContainsFinalizer(cert, certificateFinalizer) {
+		return nil
+	}
+
+	patch := client.MergeFromWithOptions(cert.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	controllerutil.RemoveFinalizer(cert, certificateFinalizer)
+	if err := r.Patch(ctx, cert, patch); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to remove finalizer from Certificate: %w", err)
+	}
+
+	log.FromContext(ctx).Info("Removed finalizer from Certificate",
+		"certificateName", cert.Name,
+		"certificateNamespace", cert.Namespace,
+		"finalizer", certificateFinalizer,
+	)
+	return nil
+}
+
+// finalizeCertificate откатывает изменения Gateway удаляемого Certificate и снимает finalizer
+// При ошибке finalizer остается, и откат повторяется при следующей реконсиляции
+func (r *CertificateReconciler) finalizeCertificate(ctx context.Context, cert *certmanagerv1.Certificate) error {
+	if !controllerutil.ContainsFinalizer(cert, certificateFinalizer) {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Rolling back Gateway changes before Certificate removal",
+		"certificateName", cert.Name,
+		"certificateNamespace", cert.Namespace,
+		"secretName", cert.Spec.SecretName,
+	)
+	if err := r.rollbackCertificateChanges(ctx, cert); err != nil {
+		return err
+	}
+	return r.removeCertificateFinalizer(ctx, cert)
+}
+
+// rollbackCertificateChanges восстанавливает оригинальный секрет и httpsRedirect во всех Gateway сертификата,
+// удаляет серверы сертификата из overlay Gateway, EnvoyFilter отключения HSTS и временный самоподписанный сертификат
+// В отличие от восстановления после выпуска сертификата, ошибки возвращаются, а не только логируются
+func (r *CertificateReconciler) rollbackCertificateChanges(ctx context.Context, cert *certmanagerv1.Certificate) error {
+	var errs []error
+
+	gateways, err := r.findGatewaysUsingCertificate(ctx, cert.Spec.SecretName, cert.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to find Gateways using certificate: %w", err)
+	}
+	for _, gateway := range gateways {
+		if err := r.restoreGatewayOriginalSecret(ctx, gateway, cert.Spec.SecretName, cert.Namespace); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// restoreGatewayOriginalSecret только логирует ошибку удаления EnvoyFilter
+		if err := r.deleteEnvoyFilterForHSTS(ctx, gateway, hstsSecretRef(cert.Namespace, cert.Spec.SecretName)); err != nil {
+			errs = append(errs, err)
+		}
+		if err := r.removeOverlayGatewayServers(ctx, gateway, cert.Spec.SecretName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if r.GatewayAPIEnabled {
+		gatewayAPIGateways, err := r.findGatewayAPIGatewaysUsingCertificate(ctx, cert.Spec.SecretName, cert.Namespace)
+		if err != nil {
+			return fmt.Errorf("failed to find Gateway API Gateways using certificate: %w", err)
+		}
+		for _, gateway := range gatewayAPIGateways {
+			if err := r.restoreGatewayAPIOriginalSecret(ctx, gateway, cert.Spec.SecretName, cert.Namespace); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	// Временный сертификат удаляется последним: пока Gateway не восстановлены, его секрет еще используется
+	if len(errs) == 0 {
+		if err := r.deleteTemporarySelfSignedCertificate(ctx, cert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
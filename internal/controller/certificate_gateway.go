@@ -7,8 +7,11 @@
  * - (r *CertificateReconciler) restoreGatewayOriginalSecret(ctx, gateway, originalSecretName, secretNamespace) error
  *   Восстанавливает оригинальный секрет в Gateway и включает обратно HSTS
  *
- * - (r *CertificateReconciler) disableHTTPSRedirectForHTTP01(ctx, gateway, originalSecretName, secretNamespace) error
- *   Отключает httpsRedirect в Gateway для прохождения HTTP01 challenge
+ * - (r *CertificateReconciler) disableHTTPSRedirectForHTTP01(ctx, gateway, cert) error
+ *   Отключает httpsRedirect на HTTP серверах доменов сертификата для прохождения HTTP01 challenge
+ *   (в режиме ChallengePath редирект переносится в VirtualService хоста, см. certificate_redirect.go)
+ *
+ * Серверы классифицируются по протоколу и режиму TLS (gateway_servers.go), а не по номеру порта
  */
 
 package controller
@@ -20,91 +23,120 @@ import (
 
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
 )
 
 // updateGatewayWithTemporarySecret обновляет Gateway для использования временного секрета и отключает HSTS
 func (r *CertificateReconciler) updateGatewayWithTemporarySecret(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, cert *certmanagerv1.Certificate, originalSecretName, tempSecretName, secretNamespace string) error {
 	logger := log.FromContext(ctx)
 
-	// Получаем актуальную версию Gateway
+	// Определяем формат credentialName (с namespace или без)
+	credentialName := tempSecretName
+	if secretNamespace != "" && secretNamespace != gateway.Namespace {
+		credentialName = fmt.Sprintf("%s/%s", secretNamespace, tempSecretName)
+	}
+
+	// Обновляем credentialName в HTTPS серверах и отключаем httpsRedirect на HTTP серверах доменов сертификата,
+	// если Http01Policy разрешает менять httpsRedirect
+	hosts := certificateHosts(cert)
+	policy, err := resolveHTTP01Policy(ctx, r.Client, gateway)
+	if err != nil {
+		return err
+	}
 	gatewayKey := client.ObjectKey{
 		Name:      gateway.Name,
 		Namespace: gateway.Namespace,
 	}
-	updatedGateway := &istionetworkingv1beta1.Gateway{}
-	if err := r.Get(ctx, gatewayKey, updatedGateway); err != nil {
-		return fmt.Errorf("failed to get Gateway: %w", err)
-	}
+	var updated, secretSwapped, httpsRedirectDisabled bool
 
-	// Определяем формат credentialName (с namespace или без)
-	credentialName := tempSecretName
-	if secretNamespace != "" && secretNamespace != gateway.Namespace {
-		credentialName = fmt.Sprintf("%s/%s", secretNamespace, tempSecretName)
+	// В режиме ChallengePath редирект на HTTPS переносится в VirtualService хостов до отключения httpsRedirect;
+	// если хосты обслуживают VirtualService пользователя, httpsRedirect сохраняется
+	manageHTTPSRedirect := policy.ManageHTTPSRedirect
+	if manageHTTPSRedirect && policy.HTTPSRedirectMode == http01v1alpha1.HTTPSRedirectModeChallengePath {
+		manageHTTPSRedirect, err = r.ensureChallengePathRedirect(ctx, gateway, cert)
+		if err != nil {
+			return fmt.Errorf("failed to add HTTPS redirect to VirtualServices: %w", err)
+		}
 	}
 
-	// Обновляем credentialName в HTTPS серверах и отключаем httpsRedirect на HTTP серверах
-	updated := false
-	httpsRedirectDisabled := false
+	err = retryGatewayPatch(func() error {
+		updated, secretSwapped, httpsRedirectDisabled = false, false, false
 
-	for i := range updatedGateway.Spec.Servers {
-		server := updatedGateway.Spec.Servers[i]
+		// Получаем актуальную версию Gateway
+		updatedGateway := &istionetworkingv1beta1.Gateway{}
+		if err := r.Get(ctx, gatewayKey, updatedGateway); err != nil {
+			return fmt.Errorf("failed to get Gateway: %w", err)
+		}
+		original := updatedGateway.DeepCopy()
 
-		// Обновляем HTTPS серверы (порт 443) - меняем credentialName на временный
-		if server.Port != nil && server.Port.Number == 443 && server.Tls != nil {
-			currentCredentialName := server.Tls.CredentialName
-			var matches bool
-			if strings.Contains(currentCredentialName, "/") {
-				parts := strings.Split(currentCredentialName, "/")
-				if len(parts) == 2 && parts[0] == secretNamespace && parts[1] == originalSecretName {
-					matches = true
+		for i := range updatedGateway.Spec.Servers {
+			server := updatedGateway.Spec.Servers[i]
+
+			// Обновляем HTTPS и TLS серверы, терминирующие TLS, - меняем credentialName на временный
+			if isTLSTerminatingServer(server) {
+				currentCredentialName := server.Tls.CredentialName
+				var matches bool
+				if strings.Contains(currentCredentialName, "/") {
+					parts := strings.Split(currentCredentialName, "/")
+					if len(parts) == 2 && parts[0] == secretNamespace && parts[1] == originalSecretName {
+						matches = true
+					}
+				} else {
+					// Формат "name" - проверяем совпадение имени независимо от namespace
+					if currentCredentialName == originalSecretName {
+						matches = true
+					}
 				}
-			} else {
-				// Формат "name" - проверяем совпадение имени независимо от namespace
-				if currentCredentialName == originalSecretName {
-					matches = true
+
+				if matches {
+					updatedGateway.Spec.Servers[i].Tls.CredentialName = credentialName
+					secretSwapped = true
+					updated = true
 				}
 			}
+		}
 
-			if matches {
-				updatedGateway.Spec.Servers[i].Tls.CredentialName = credentialName
-				updated = true
-			}
+		// Отключаем httpsRedirect на HTTP серверах доменов сертификата для прохождения HTTP01 challenge
+		// (ключи серверов сохраняются в аннотации original-https-redirect-<секрет>)
+		if manageHTTPSRedirect && disableServerHTTPSRedirects(updatedGateway, originalSecretName, hosts) {
+			httpsRedirectDisabled = true
+			updated = true
 		}
 
-		// Отключаем httpsRedirect на HTTP серверах (порт 80) для прохождения HTTP01 challenge
-		if server.Port != nil && server.Port.Number == 80 && server.Tls != nil && server.Tls.HttpsRedirect {
-			// Сохраняем оригинальное значение httpsRedirect в аннотации
+		if updated {
+			// Добавляем аннотацию для отслеживания оригинального секрета
 			if updatedGateway.Annotations == nil {
 				updatedGateway.Annotations = make(map[string]string)
 			}
-			httpsRedirectKey := fmt.Sprintf("istio-http01.rieset.io/original-https-redirect-%s", originalSecretName)
-			if _, exists := updatedGateway.Annotations[httpsRedirectKey]; !exists {
-				updatedGateway.Annotations[httpsRedirectKey] = tempLabelValue
+			originalCredentialKey := fmt.Sprintf("istio-http01.rieset.io/original-credential-name-%s", originalSecretName)
+			originalCredentialValue := originalSecretName
+			if secretNamespace != "" && secretNamespace != gateway.Namespace {
+				originalCredentialValue = fmt.Sprintf("%s/%s", secretNamespace, originalSecretName)
 			}
-
-			// Отключаем httpsRedirect
-			updatedGateway.Spec.Servers[i].Tls.HttpsRedirect = false
-			httpsRedirectDisabled = true
-			updated = true
+			updatedGateway.Annotations[originalCredentialKey] = originalCredentialValue
 		}
+		return patchGateway(ctx, r.Client, original, updatedGateway)
+	})
+	if err != nil {
+		recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonGatewayUpdateFailed,
+			"Failed to switch Gateway to temporary secret %s: %v", tempSecretName, err)
+		return fmt.Errorf("failed to update Gateway: %w", err)
 	}
 
 	if updated {
-		// Добавляем аннотацию для отслеживания оригинального секрета
-		if updatedGateway.Annotations == nil {
-			updatedGateway.Annotations = make(map[string]string)
+		if secretSwapped {
+			recordEvent(r.Recorder, gateway, corev1.EventTypeNormal, eventReasonTemporarySecretApplied,
+				"Switched credentialName from %s to %s until certificate %s is issued", originalSecretName, credentialName, cert.Name)
+			recordEvent(r.Recorder, cert, corev1.EventTypeNormal, eventReasonTemporarySecretApplied,
+				"Gateway %s/%s serves temporary secret %s until the certificate is issued", gateway.Namespace, gateway.Name, tempSecretName)
 		}
-		originalCredentialKey := fmt.Sprintf("istio-http01.rieset.io/original-credential-name-%s", originalSecretName)
-		originalCredentialValue := originalSecretName
-		if secretNamespace != "" && secretNamespace != gateway.Namespace {
-			originalCredentialValue = fmt.Sprintf("%s/%s", secretNamespace, originalSecretName)
-		}
-		updatedGateway.Annotations[originalCredentialKey] = originalCredentialValue
-
-		if err := r.Update(ctx, updatedGateway); err != nil {
-			return fmt.Errorf("failed to update Gateway: %w", err)
+		if httpsRedirectDisabled {
+			recordEvent(r.Recorder, gateway, corev1.EventTypeNormal, eventReasonHTTPSRedirectDisabled,
+				"Disabled httpsRedirect on HTTP servers of certificate %s for the HTTP01 challenge", cert.Name)
 		}
 
 		logger.Info("Updated Gateway to use temporary self-signed certificate",
@@ -118,7 +150,7 @@ func (r *CertificateReconciler) updateGatewayWithTemporarySecret(ctx context.Con
 		// Создаем EnvoyFilter для отключения HSTS (если еще не создан)
 		// EnvoyFilter должен быть создан уже при создании временного сертификата,
 		// но проверяем на случай, если он был удален или не был создан
-		if err := r.createEnvoyFilterToDisableHSTS(ctx, gateway, originalSecretName); err != nil {
+		if err := r.createEnvoyFilterToDisableHSTS(ctx, gateway, cert); err != nil {
 			logger.Error(err, "failed to create EnvoyFilter to disable HSTS",
 				"gatewayName", gateway.Name,
 				"gatewayNamespace", gateway.Namespace,
@@ -143,14 +175,12 @@ func (r *CertificateReconciler) updateGatewayWithTemporarySecret(ctx context.Con
 				)
 			} else if ingressIP != "" {
 				// Получаем DNS имена из временного сертификата
-				tempCertName := fmt.Sprintf("%s-temp-selfsigned", cert.Name)
-				tempCert := &certmanagerv1.Certificate{}
-				if err := r.Get(ctx, client.ObjectKey{
-					Name:      tempCertName,
-					Namespace: cert.Namespace,
-				}, tempCert); err == nil {
+				if credential, err := r.getTemporaryCredential(ctx, cert); err == nil && credential != nil {
 					// Проверяем сертификат через HTTPS
-					if err := r.verifyCertificateViaHTTPS(ctx, gateway, tempCert.Spec.DNSNames, ingressIP); err != nil {
+					if err := r.verifyCertificateViaHTTPS(ctx, gateway, credential.DNSNames, ingressIP); err != nil {
+						recordVerificationFailure(gateway, verificationMethodHTTPS)
+						recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonVerificationFailed,
+							"Temporary certificate %s verification via HTTPS failed: %v", credential.SecretName, err)
 						logger.Error(err, "failed to verify temporary certificate via HTTPS",
 							"gatewayName", gateway.Name,
 							"gatewayNamespace", gateway.Namespace,
@@ -169,75 +199,72 @@ func (r *CertificateReconciler) updateGatewayWithTemporarySecret(ctx context.Con
 func (r *CertificateReconciler) restoreGatewayOriginalSecret(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, originalSecretName, secretNamespace string) error {
 	logger := log.FromContext(ctx)
 
-	// Получаем актуальную версию Gateway
-	gatewayKey := client.ObjectKey{
-		Name:      gateway.Name,
-		Namespace: gateway.Namespace,
-	}
-	updatedGateway := &istionetworkingv1beta1.Gateway{}
-	if err := r.Get(ctx, gatewayKey, updatedGateway); err != nil {
-		return fmt.Errorf("failed to get Gateway: %w", err)
-	}
-
 	// Определяем формат credentialName (с namespace или без)
 	originalCredentialName := originalSecretName
 	if secretNamespace != "" && secretNamespace != gateway.Namespace {
 		originalCredentialName = fmt.Sprintf("%s/%s", secretNamespace, originalSecretName)
 	}
 
-	// Проверяем, используется ли временный секрет
+	gatewayKey := client.ObjectKey{
+		Name:      gateway.Name,
+		Namespace: gateway.Namespace,
+	}
 	tempSecretPrefix := fmt.Sprintf("%s-temp", originalSecretName)
-	needsRestoreSecret := false
+	var needsRestoreSecret, needsRestoreRedirect bool
 
-	for i := range updatedGateway.Spec.Servers {
-		server := updatedGateway.Spec.Servers[i]
-		if server.Tls == nil {
-			continue
-		}
+	err := retryGatewayPatch(func() error {
+		needsRestoreSecret, needsRestoreRedirect = false, false
 
-		currentCredentialName := server.Tls.CredentialName
-		// Проверяем, является ли текущий секрет временным
-		if strings.Contains(currentCredentialName, tempSecretPrefix) {
-			updatedGateway.Spec.Servers[i].Tls.CredentialName = originalCredentialName
-			needsRestoreSecret = true
+		// Получаем актуальную версию Gateway
+		updatedGateway := &istionetworkingv1beta1.Gateway{}
+		if err := r.Get(ctx, gatewayKey, updatedGateway); err != nil {
+			return fmt.Errorf("failed to get Gateway: %w", err)
 		}
-	}
+		original := updatedGateway.DeepCopy()
 
-	// Проверяем, нужно ли восстановить httpsRedirect (даже если секрет уже оригинальный)
-	httpsRedirectKey := fmt.Sprintf("istio-http01.rieset.io/original-https-redirect-%s", originalSecretName)
-	shouldRestoreRedirect := false
-	if updatedGateway.Annotations != nil {
-		if redirectValue, exists := updatedGateway.Annotations[httpsRedirectKey]; exists && redirectValue == tempLabelValue {
-			shouldRestoreRedirect = true
-		}
-	}
-
-	// Восстанавливаем httpsRedirect на HTTP серверах, если он был отключен
-	needsRestoreRedirect := false
-	if shouldRestoreRedirect {
+		// Проверяем, используется ли временный секрет
 		for i := range updatedGateway.Spec.Servers {
 			server := updatedGateway.Spec.Servers[i]
-			// Восстанавливаем httpsRedirect на HTTP серверах (порт 80), если он отключен
-			if server.Port != nil && server.Port.Number == 80 && server.Tls != nil && !server.Tls.HttpsRedirect {
-				updatedGateway.Spec.Servers[i].Tls.HttpsRedirect = true
-				needsRestoreRedirect = true
+			if server.Tls == nil {
+				continue
+			}
+
+			currentCredentialName := server.Tls.CredentialName
+			// Проверяем, является ли текущий секрет временным
+			if strings.Contains(currentCredentialName, tempSecretPrefix) {
+				updatedGateway.Spec.Servers[i].Tls.CredentialName = originalCredentialName
+				needsRestoreSecret = true
 			}
 		}
-	}
 
-	// Обновляем Gateway, если нужно восстановить секрет или httpsRedirect
-	if needsRestoreSecret || needsRestoreRedirect {
-		// Удаляем аннотации с оригинальными значениями
-		if updatedGateway.Annotations != nil {
+		// Восстанавливаем httpsRedirect на серверах, записанных для секрета (даже если секрет уже оригинальный),
+		// кроме серверов, которые еще нужны другим ожидающим сертификатам
+		needsRestoreRedirect, _ = restoreServerHTTPSRedirects(updatedGateway, originalSecretName)
+
+		// Удаляем аннотацию с оригинальным секретом
+		if needsRestoreSecret || needsRestoreRedirect {
 			originalCredentialKey := fmt.Sprintf("istio-http01.rieset.io/original-credential-name-%s", originalSecretName)
 			delete(updatedGateway.Annotations, originalCredentialKey)
-			if needsRestoreRedirect {
-				delete(updatedGateway.Annotations, httpsRedirectKey)
-			}
 		}
+		return patchGateway(ctx, r.Client, original, updatedGateway)
+	})
+	if err != nil {
+		recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonGatewayUpdateFailed,
+			"Failed to restore original secret %s: %v", originalSecretName, err)
+		return fmt.Errorf("failed to update Gateway: %w", err)
+	}
 
-		if err := r.Update(ctx, updatedGateway); err != nil {
-			return fmt.Errorf("failed to update Gateway: %w", err)
+	if needsRestoreSecret || needsRestoreRedirect {
+		if needsRestoreSecret {
+			temporaryCertificatesRestored.WithLabelValues(gateway.Name, gateway.Namespace).Inc()
+			recordEvent(r.Recorder, gateway, corev1.EventTypeNormal, eventReasonOriginalSecretRestored,
+				"Restored credentialName %s after the certificate was issued", originalCredentialName)
+			r.recordCertificateEvent(ctx, originalSecretName, secretNamespace, corev1.EventTypeNormal, eventReasonOriginalSecretRestored,
+				"Gateway %s/%s switched back to secret %s", gateway.Namespace, gateway.Name, originalSecretName)
+		}
+		if needsRestoreRedirect {
+			recordEvent(r.Recorder, gateway, corev1.EventTypeNormal, eventReasonHTTPSRedirectRestored,
+				"Restored httpsRedirect on HTTP servers of secret %s", originalSecretName)
 		}
 
 		logger.Info("Restored original secret and httpsRedirect in Gateway",
@@ -249,6 +276,12 @@ func (r *CertificateReconciler) restoreGatewayOriginalSecret(ctx context.Context
 		)
 	}
 
+	// Редирект режима ChallengePath больше не нужен - httpsRedirect сервера снова включен
+	// Ошибка возвращается, чтобы finalizer gateway-restore остался и маршруты редиректа удалились при повторе
+	if err := r.removeChallengePathRedirect(ctx, gateway, originalSecretName); err != nil {
+		return fmt.Errorf("failed to remove HTTPS redirect routes of secret %s: %w", originalSecretName, err)
+	}
+
 	// Удаляем EnvoyFilter для отключения HSTS (включаем обратно HSTS)
 	// Делаем это всегда, даже если Gateway уже восстановлен, чтобы убедиться, что EnvoyFilter удален
 	logger.Info("Попытка удалить EnvoyFilter для HSTS",
@@ -256,7 +289,7 @@ func (r *CertificateReconciler) restoreGatewayOriginalSecret(ctx context.Context
 		"gatewayNamespace", gateway.Namespace,
 		"originalSecretName", originalSecretName,
 	)
-	if err := r.deleteEnvoyFilterForHSTS(ctx, gateway, originalSecretName); err != nil {
+	if err := r.deleteEnvoyFilterForHSTS(ctx, gateway, hstsSecretRef(secretNamespace, originalSecretName)); err != nil {
 		logger.Error(err, "failed to delete EnvoyFilter for HSTS",
 			"gatewayName", gateway.Name,
 			"gatewayNamespace", gateway.Namespace,
@@ -285,6 +318,9 @@ func (r *CertificateReconciler) restoreGatewayOriginalSecret(ctx context.Context
 			if cert != nil {
 				// Проверяем сертификат через HTTPS
 				if err := r.verifyCertificateViaHTTPS(ctx, gateway, cert.Spec.DNSNames, ingressIP); err != nil {
+					recordVerificationFailure(gateway, verificationMethodHTTPS)
+					recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonVerificationFailed,
+						"Certificate %s verification via HTTPS failed after restore: %v", cert.Name, err)
 					logger.Error(err, "failed to verify certificate via HTTPS after restore",
 						"gatewayName", gateway.Name,
 						"gatewayNamespace", gateway.Namespace,
@@ -296,6 +332,9 @@ func (r *CertificateReconciler) restoreGatewayOriginalSecret(ctx context.Context
 			} else {
 				// Если не удалось получить Certificate, проверяем доступность через HTTP
 				if err := r.verifyCertificateViaHTTP(ctx, gateway, ingressIP); err != nil {
+					recordVerificationFailure(gateway, verificationMethodHTTP)
+					recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonVerificationFailed,
+						"Verification via HTTP failed after restore: %v", err)
 					logger.Error(err, "failed to verify certificate via HTTP",
 						"gatewayName", gateway.Name,
 						"gatewayNamespace", gateway.Namespace,
@@ -309,53 +348,67 @@ func (r *CertificateReconciler) restoreGatewayOriginalSecret(ctx context.Context
 	return nil
 }
 
-// disableHTTPSRedirectForHTTP01 отключает httpsRedirect в Gateway для прохождения HTTP01 challenge
+// disableHTTPSRedirectForHTTP01 отключает httpsRedirect на HTTP серверах, hosts которых пересекаются
+// с доменами сертификата, для прохождения HTTP01 challenge
 // НЕ меняет HTTPS сервер, чтобы избежать проблем с HSTS
-func (r *CertificateReconciler) disableHTTPSRedirectForHTTP01(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, originalSecretName, _ string) error {
+func (r *CertificateReconciler) disableHTTPSRedirectForHTTP01(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, cert *certmanagerv1.Certificate) error {
 	logger := log.FromContext(ctx)
+	originalSecretName := cert.Spec.SecretName
 
-	// Получаем актуальную версию Gateway
-	gatewayKey := client.ObjectKey{
-		Name:      gateway.Name,
-		Namespace: gateway.Namespace,
+	// Http01Policy может запрещать изменение httpsRedirect для Gateway
+	policy, err := resolveHTTP01Policy(ctx, r.Client, gateway)
+	if err != nil {
+		return err
 	}
-	updatedGateway := &istionetworkingv1beta1.Gateway{}
-	if err := r.Get(ctx, gatewayKey, updatedGateway); err != nil {
-		return fmt.Errorf("failed to get Gateway: %w", err)
+	if !policy.ManageHTTPSRedirect {
+		logger.V(1).Info("httpsRedirect management disabled by Http01Policy",
+			"gatewayName", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+			"policy", policy.PolicyName,
+		)
+		return nil
 	}
 
-	// Проверяем, не отключен ли уже httpsRedirect
-	httpsRedirectKey := fmt.Sprintf("istio-http01.rieset.io/original-https-redirect-%s", originalSecretName)
-	alreadyDisabled := false
-	if updatedGateway.Annotations != nil {
-		if _, exists := updatedGateway.Annotations[httpsRedirectKey]; exists {
-			alreadyDisabled = true
+	// В режиме ChallengePath по HTTP остается доступен только путь challenge
+	if policy.HTTPSRedirectMode == http01v1alpha1.HTTPSRedirectModeChallengePath {
+		applied, err := r.ensureChallengePathRedirect(ctx, gateway, cert)
+		if err != nil {
+			return fmt.Errorf("failed to add HTTPS redirect to VirtualServices: %w", err)
+		}
+		if !applied {
+			// Хосты обслуживают VirtualService пользователя - httpsRedirect не отключается
+			return nil
 		}
 	}
 
-	// Проверяем и отключаем httpsRedirect на HTTP серверах (порт 80)
+	gatewayKey := client.ObjectKey{
+		Name:      gateway.Name,
+		Namespace: gateway.Namespace,
+	}
+	hosts := certificateHosts(cert)
 	updated := false
-	for i := range updatedGateway.Spec.Servers {
-		server := updatedGateway.Spec.Servers[i]
-		if server.Port != nil && server.Port.Number == 80 && server.Tls != nil && server.Tls.HttpsRedirect {
-			// Сохраняем оригинальное значение httpsRedirect в аннотации
-			if updatedGateway.Annotations == nil {
-				updatedGateway.Annotations = make(map[string]string)
-			}
-			if !alreadyDisabled {
-				updatedGateway.Annotations[httpsRedirectKey] = tempLabelValue
-			}
 
-			// Отключаем httpsRedirect
-			updatedGateway.Spec.Servers[i].Tls.HttpsRedirect = false
-			updated = true
+	err = retryGatewayPatch(func() error {
+		// Получаем актуальную версию Gateway
+		updatedGateway := &istionetworkingv1beta1.Gateway{}
+		if err := r.Get(ctx, gatewayKey, updatedGateway); err != nil {
+			return fmt.Errorf("failed to get Gateway: %w", err)
 		}
+		original := updatedGateway.DeepCopy()
+
+		// Отключаем httpsRedirect на HTTP серверах доменов сертификата и записываем их ключи в аннотацию
+		updated = disableServerHTTPSRedirects(updatedGateway, originalSecretName, hosts)
+		return patchGateway(ctx, r.Client, original, updatedGateway)
+	})
+	if err != nil {
+		recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonGatewayUpdateFailed,
+			"Failed to disable httpsRedirect for the HTTP01 challenge: %v", err)
+		return fmt.Errorf("failed to update Gateway: %w", err)
 	}
 
 	if updated {
-		if err := r.Update(ctx, updatedGateway); err != nil {
-			return fmt.Errorf("failed to update Gateway: %w", err)
-		}
+		recordEvent(r.Recorder, gateway, corev1.EventTypeNormal, eventReasonHTTPSRedirectDisabled,
+			"Disabled httpsRedirect on HTTP servers of secret %s for the HTTP01 challenge", originalSecretName)
 
 		logger.Info("Disabled httpsRedirect in Gateway for HTTP01 challenge (HTTPS server unchanged to avoid HSTS issues)",
 			"gatewayName", gateway.Name,
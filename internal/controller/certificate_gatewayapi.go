@@ -0,0 +1,194 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) reconcileGatewayAPIGateways(ctx, cert, certReady) error
+ *   Выпускает временный сертификат и переключает certificateRefs Gateway API Gateway, либо восстанавливает оригинальный секрет
+ *
+ * - (r *CertificateReconciler) findGatewayAPIGatewaysUsingCertificate(ctx, secretName, secretNamespace) ([]*Gateway, error)
+ *   Находит все Gateway API Gateway, listener'ы которых ссылаются на оригинальный или временный секрет
+ *
+ * Переключение certificateRefs на временный секрет и обратно - в certificate_gatewayapi_refs.go
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// reconcileGatewayAPIGateways обрабатывает Gateway API Gateway, использующие секрет сертификата
+// Пока сертификат не готов - выпускает временный сертификат и переключает certificateRefs на него,
+// после готовности - восстанавливает оригинальный секрет и удаляет временный сертификат
+func (r *CertificateReconciler) reconcileGatewayAPIGateways(ctx context.Context, cert *certmanagerv1.Certificate, certReady bool) error {
+	logger := log.FromContext(ctx)
+
+	gateways, err := r.findGatewayAPIGatewaysUsingCertificate(ctx, cert.Spec.SecretName, cert.Namespace)
+	if err != nil {
+		return err
+	}
+	if len(gateways) == 0 {
+		return nil
+	}
+
+	tempSecretName := fmt.Sprintf("%s-temp", cert.Spec.SecretName)
+
+	if certReady {
+		// Сертификат готов - восстанавливаем оригинальный секрет во всех Gateway
+		// Ошибки возвращаются, чтобы finalizer Certificate не снимался до восстановления всех Gateway
+		var errs []error
+		for _, gateway := range gateways {
+			if err := r.restoreGatewayAPIOriginalSecret(ctx, gateway, cert.Spec.SecretName, cert.Namespace); err != nil {
+				logger.Error(err, "failed to restore original secret in Gateway API Gateway",
+					"certificateName", cert.Name,
+					"gatewayName", gateway.Name,
+					"gatewayNamespace", gateway.Namespace,
+				)
+				errs = append(errs, err)
+			}
+		}
+		errs = append(errs, r.deleteTemporarySelfSignedCertificate(ctx, cert))
+		return errors.Join(errs...)
+	}
+
+	// Политики всех Gateway определяются до изменений: если Http01Policy не удалось прочитать,
+	// ни один Gateway не изменяется, реконсиляция повторяется
+	policies := make(map[*gatewayapiv1.Gateway]http01PolicySettings, len(gateways))
+	for _, gateway := range gateways {
+		policy, err := resolveHTTP01Policy(ctx, r.Client, gateway)
+		if err != nil {
+			return err
+		}
+		policies[gateway] = policy
+	}
+
+	for _, gateway := range gateways {
+		// Временный сертификат нужен только если HTTP трафик перенаправляется на HTTPS,
+		// иначе HTTP01 challenge проходит по HTTP без участия HTTPS listener'а
+		redirect, err := hasGatewayAPIHTTPSRedirect(ctx, r.Client, gateway)
+		if err != nil {
+			logger.Error(err, "failed to check https redirect for Gateway API Gateway",
+				"gatewayName", gateway.Name,
+				"gatewayNamespace", gateway.Namespace,
+			)
+			continue
+		}
+		if !redirect {
+			logger.V(1).Info("Gateway API Gateway has no https redirect, skipping temporary certificate",
+				"gatewayName", gateway.Name,
+				"gatewayNamespace", gateway.Namespace,
+			)
+			continue
+		}
+
+		policy := policies[gateway]
+		if !policy.TemporaryCertificateEnabled {
+			logger.V(1).Info("Temporary certificate disabled by Http01Policy",
+				"gatewayName", gateway.Name,
+				"gatewayNamespace", gateway.Namespace,
+				"policy", policy.PolicyName,
+			)
+			continue
+		}
+
+		// Gateway будет изменен - finalizer гарантирует откат при удалении Certificate
+		if err := r.ensureCertificateFinalizer(ctx, cert); err != nil {
+			return err
+		}
+
+		credential, err := r.getTemporaryCredential(ctx, cert)
+		if err != nil {
+			return err
+		}
+		if credential == nil {
+			// Временный сертификат не существует - создаем его для доменов HTTPRoute
+			domains, err := getDomainsForGatewayAPI(ctx, r.Client, gateway)
+			if err != nil {
+				logger.Error(err, "failed to get domains for Gateway API Gateway, using certificate DNS names",
+					"gatewayName", gateway.Name,
+					"gatewayNamespace", gateway.Namespace,
+				)
+			}
+			if err := r.provisionTemporaryCredential(ctx, cert, gateway, domains, policy); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := r.refreshFallbackSecret(ctx, cert, gateway, policy); err != nil {
+			return err
+		}
+
+		if !credential.Ready {
+			logger.V(1).Info("Temporary certificate not ready yet, waiting",
+				"certificateName", cert.Name,
+				"tempSecretName", credential.SecretName,
+			)
+			continue
+		}
+
+		if err := r.updateGatewayAPIWithTemporarySecret(ctx, gateway, cert.Spec.SecretName, tempSecretName, cert.Namespace); err != nil {
+			logger.Error(err, "failed to update Gateway API Gateway with temporary secret",
+				"gatewayName", gateway.Name,
+				"gatewayNamespace", gateway.Namespace,
+			)
+		}
+	}
+
+	return nil
+}
+
+// findGatewayAPIGatewaysUsingCertificate находит все Gateway API Gateway, использующие указанный сертификат
+// Ищет listener'ы, certificateRefs которых ссылаются на оригинальный или временный (с суффиксом -temp) секрет
+func (r *CertificateReconciler) findGatewayAPIGatewaysUsingCertificate(ctx context.Context, secretName, secretNamespace string) ([]*gatewayapiv1.Gateway, error) {
+	tempSecretName := fmt.Sprintf("%s-temp", secretName)
+
+	// Получение Gateway, certificateRefs которых ссылаются на оригинальный или временный секрет (по индексу)
+	var candidates []*gatewayapiv1.Gateway
+	seen := make(map[client.ObjectKey]bool)
+	for _, name := range []string{secretName, tempSecretName} {
+		gatewayList := &gatewayapiv1.GatewayList{}
+		if err := r.List(ctx, gatewayList, client.MatchingFields{gatewayAPICertificateRefIndex: fmt.Sprintf("%s/%s", secretNamespace, name)}); err != nil {
+			return nil, fmt.Errorf("failed to list Gateway API Gateways: %w", err)
+		}
+		for i := range gatewayList.Items {
+			key := client.ObjectKeyFromObject(&gatewayList.Items[i])
+			if !seen[key] {
+				seen[key] = true
+				candidates = append(candidates, &gatewayList.Items[i])
+			}
+		}
+	}
+
+	var matchingGateways []*gatewayapiv1.Gateway
+	for _, gateway := range candidates {
+		gatewayFound := false
+
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.TLS == nil {
+				continue
+			}
+			for _, ref := range listener.TLS.CertificateRefs {
+				if isSecretCertificateRef(ref, gateway, secretName, secretNamespace) ||
+					isSecretCertificateRef(ref, gateway, tempSecretName, secretNamespace) {
+					gatewayFound = true
+					break
+				}
+			}
+			if gatewayFound {
+				break
+			}
+		}
+
+		if gatewayFound {
+			matchingGateways = append(matchingGateways, gateway)
+		}
+	}
+
+	return matchingGateways, nil
+}
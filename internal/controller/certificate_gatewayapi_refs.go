@@ -0,0 +1,170 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) updateGatewayAPIWithTemporarySecret(ctx, gateway, originalSecretName, tempSecretName, secretNamespace) error
+ *   Переключает certificateRefs Gateway API Gateway на временный секрет
+ *
+ * - (r *CertificateReconciler) restoreGatewayAPIOriginalSecret(ctx, gateway, originalSecretName, secretNamespace) error
+ *   Восстанавливает оригинальный секрет в certificateRefs Gateway API Gateway
+ *
+ * - isSecretCertificateRef(ref, gateway, secretName, secretNamespace) bool
+ *   Проверяет, указывает ли certificateRef на Secret с указанным именем и namespace
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// updateGatewayAPIWithTemporarySecret переключает certificateRefs Gateway API Gateway на временный секрет
+// Работает так же, как updateGatewayWithTemporarySecret для credentialName Istio Gateway
+func (r *CertificateReconciler) updateGatewayAPIWithTemporarySecret(ctx context.Context, gateway *gatewayapiv1.Gateway, originalSecretName, tempSecretName, secretNamespace string) error {
+	logger := log.FromContext(ctx)
+
+	updated := false
+	err := retryGatewayPatch(func() error {
+		updated = false
+
+		// Получаем актуальную версию Gateway
+		updatedGateway := &gatewayapiv1.Gateway{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(gateway), updatedGateway); err != nil {
+			return fmt.Errorf("failed to get Gateway API Gateway: %w", err)
+		}
+		original := updatedGateway.DeepCopy()
+
+		for i := range updatedGateway.Spec.Listeners {
+			listener := &updatedGateway.Spec.Listeners[i]
+			if listener.TLS == nil {
+				continue
+			}
+			for j := range listener.TLS.CertificateRefs {
+				if isSecretCertificateRef(listener.TLS.CertificateRefs[j], updatedGateway, originalSecretName, secretNamespace) {
+					listener.TLS.CertificateRefs[j].Name = gatewayapiv1.ObjectName(tempSecretName)
+					updated = true
+				}
+			}
+		}
+
+		if !updated {
+			return nil
+		}
+
+		// Добавляем аннотацию для отслеживания оригинального секрета
+		if updatedGateway.Annotations == nil {
+			updatedGateway.Annotations = make(map[string]string)
+		}
+		originalCredentialKey := fmt.Sprintf("istio-http01.rieset.io/original-credential-name-%s", originalSecretName)
+		updatedGateway.Annotations[originalCredentialKey] = fmt.Sprintf("%s/%s", secretNamespace, originalSecretName)
+
+		return patchGateway(ctx, r.Client, original, updatedGateway)
+	})
+	if err != nil {
+		recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonGatewayUpdateFailed,
+			"Failed to switch certificateRefs to temporary secret %s: %v", tempSecretName, err)
+		return fmt.Errorf("failed to update Gateway API Gateway: %w", err)
+	}
+	if !updated {
+		return nil
+	}
+
+	recordEvent(r.Recorder, gateway, corev1.EventTypeNormal, eventReasonTemporarySecretApplied,
+		"Switched certificateRefs from %s to %s until the certificate is issued", originalSecretName, tempSecretName)
+	r.recordCertificateEvent(ctx, originalSecretName, secretNamespace, corev1.EventTypeNormal, eventReasonTemporarySecretApplied,
+		"Gateway %s/%s serves temporary secret %s until the certificate is issued", gateway.Namespace, gateway.Name, tempSecretName)
+
+	logger.Info("Updated Gateway API Gateway to use temporary self-signed certificate",
+		"gatewayName", gateway.Name,
+		"gatewayNamespace", gateway.Namespace,
+		"originalSecretName", originalSecretName,
+		"tempSecretName", tempSecretName,
+	)
+
+	return nil
+}
+
+// restoreGatewayAPIOriginalSecret восстанавливает оригинальный секрет в certificateRefs Gateway API Gateway
+func (r *CertificateReconciler) restoreGatewayAPIOriginalSecret(ctx context.Context, gateway *gatewayapiv1.Gateway, originalSecretName, secretNamespace string) error {
+	logger := log.FromContext(ctx)
+
+	tempSecretName := fmt.Sprintf("%s-temp", originalSecretName)
+	restored := false
+	err := retryGatewayPatch(func() error {
+		restored = false
+
+		// Получаем актуальную версию Gateway
+		updatedGateway := &gatewayapiv1.Gateway{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(gateway), updatedGateway); err != nil {
+			return fmt.Errorf("failed to get Gateway API Gateway: %w", err)
+		}
+		original := updatedGateway.DeepCopy()
+
+		for i := range updatedGateway.Spec.Listeners {
+			listener := &updatedGateway.Spec.Listeners[i]
+			if listener.TLS == nil {
+				continue
+			}
+			for j := range listener.TLS.CertificateRefs {
+				if isSecretCertificateRef(listener.TLS.CertificateRefs[j], updatedGateway, tempSecretName, secretNamespace) {
+					listener.TLS.CertificateRefs[j].Name = gatewayapiv1.ObjectName(originalSecretName)
+					restored = true
+				}
+			}
+		}
+
+		if !restored {
+			return nil
+		}
+
+		// Удаляем аннотацию с оригинальным значением
+		delete(updatedGateway.Annotations, fmt.Sprintf("istio-http01.rieset.io/original-credential-name-%s", originalSecretName))
+
+		return patchGateway(ctx, r.Client, original, updatedGateway)
+	})
+	if err != nil {
+		recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonGatewayUpdateFailed,
+			"Failed to restore original secret %s: %v", originalSecretName, err)
+		return fmt.Errorf("failed to update Gateway API Gateway: %w", err)
+	}
+	if !restored {
+		return nil
+	}
+
+	temporaryCertificatesRestored.WithLabelValues(gateway.Name, gateway.Namespace).Inc()
+	recordEvent(r.Recorder, gateway, corev1.EventTypeNormal, eventReasonOriginalSecretRestored,
+		"Restored certificateRefs to %s after the certificate was issued", originalSecretName)
+	r.recordCertificateEvent(ctx, originalSecretName, secretNamespace, corev1.EventTypeNormal, eventReasonOriginalSecretRestored,
+		"Gateway %s/%s switched back to secret %s", gateway.Namespace, gateway.Name, originalSecretName)
+
+	logger.Info("Restored original secret in Gateway API Gateway",
+		"gatewayName", gateway.Name,
+		"gatewayNamespace", gateway.Namespace,
+		"originalSecretName", originalSecretName,
+	)
+
+	return nil
+}
+
+// isSecretCertificateRef проверяет, указывает ли certificateRef на Secret с указанным именем и namespace
+// Namespace в certificateRef по умолчанию совпадает с namespace Gateway
+func isSecretCertificateRef(ref gatewayapiv1.SecretObjectReference, gateway *gatewayapiv1.Gateway, secretName, secretNamespace string) bool {
+	if ref.Group != nil && *ref.Group != "" {
+		return false
+	}
+	if ref.Kind != nil && *ref.Kind != "Secret" {
+		return false
+	}
+
+	refNamespace := gateway.Namespace
+	if ref.Namespace != nil {
+		refNamespace = string(*ref.Namespace)
+	}
+
+	return string(ref.Name) == secretName && refNamespace == secretNamespace
+}
@@ -7,8 +7,8 @@
  * - (r *CertificateReconciler) findGatewaysUsingCertificate(ctx, secretName, secretNamespace) ([]*Gateway, error)
  *   Находит все Gateway, которые используют указанный сертификат
  *
- * - (r *CertificateReconciler) hasHTTPSRedirect(gateway) bool
- *   Проверяет, включен ли httpsRedirect в Gateway
+ * - (r *CertificateReconciler) hasHTTPSRedirect(gateway, hosts) bool
+ *   Проверяет, включен ли httpsRedirect на HTTP серверах Gateway с доменами сертификата
  *
  * - (r *CertificateReconciler) isGatewayUsingSecret(ctx, gateway, secretName, secretNamespace) bool
  *   Проверяет, использует ли Gateway указанный секрет
@@ -48,18 +48,32 @@ func (r *CertificateReconciler) isCertificateReady(cert *certmanagerv1.Certifica
 func (r *CertificateReconciler) findGatewaysUsingCertificate(ctx context.Context, secretName, secretNamespace string) ([]*istionetworkingv1beta1.Gateway, error) {
 	logger := log.FromContext(ctx)
 
-	// Получение всех Gateway во всех namespace
-	gatewayList := &istionetworkingv1beta1.GatewayList{}
-	if err := r.List(ctx, gatewayList, client.InNamespace("")); err != nil {
-		return nil, fmt.Errorf("failed to list Gateways: %w", err)
-	}
-
 	var matchingGateways []*istionetworkingv1beta1.Gateway
 	tempSecretName := fmt.Sprintf("%s-temp", secretName)
 
+	// Получение Gateway, credentialName которых ссылается на оригинальный или временный секрет (по индексу)
+	var candidates []*istionetworkingv1beta1.Gateway
+	seen := make(map[client.ObjectKey]bool)
+	for _, name := range []string{secretName, tempSecretName} {
+		gatewayList := &istionetworkingv1beta1.GatewayList{}
+		if err := r.List(ctx, gatewayList, client.MatchingFields{gatewayCredentialNameIndex: name}); err != nil {
+			return nil, fmt.Errorf("failed to list Gateways: %w", err)
+		}
+		for _, gateway := range gatewayList.Items {
+			// overlay Gateway оператора использует временный секрет, но не является Gateway пользователя
+			if isOverlayGateway(gateway) {
+				continue
+			}
+			key := client.ObjectKeyFromObject(gateway)
+			if !seen[key] {
+				seen[key] = true
+				candidates = append(candidates, gateway)
+			}
+		}
+	}
+
 	// Проверяем каждый Gateway
-	for i := range gatewayList.Items {
-		gateway := gatewayList.Items[i]
+	for _, gateway := range candidates {
 		gatewayFound := false
 
 		// Проверяем все серверы в Gateway
@@ -134,15 +148,13 @@ func (r *CertificateReconciler) findGatewaysUsingCertificate(ctx context.Context
 	return matchingGateways, nil
 }
 
-// hasHTTPSRedirect проверяет, включен ли httpsRedirect в Gateway
-func (r *CertificateReconciler) hasHTTPSRedirect(gateway *istionetworkingv1beta1.Gateway) bool {
-	// Проверяем все серверы в Gateway
+// hasHTTPSRedirect проверяет, включен ли httpsRedirect на HTTP серверах Gateway, hosts которых
+// пересекаются с hosts (пустой список - любой сервер)
+func (r *CertificateReconciler) hasHTTPSRedirect(gateway *istionetworkingv1beta1.Gateway, hosts []string) bool {
 	for _, server := range gateway.Spec.Servers {
-		// Ищем HTTP сервер (обычно порт 80) с включенным httpsRedirect
-		if server.Port != nil && server.Port.Number == 80 {
-			if server.Tls != nil && server.Tls.HttpsRedirect {
-				return true
-			}
+		// HTTP сервер определяется по протоколу порта, а не по номеру (8080, именованные порты)
+		if isHTTPServer(server) && server.Tls != nil && server.Tls.HttpsRedirect && serverHostsOverlap(server.Hosts, hosts) {
+			return true
 		}
 	}
 	return false
@@ -194,9 +206,9 @@ func (r *CertificateReconciler) isGatewayUsingSecret(ctx context.Context, gatewa
 func (r *CertificateReconciler) findCertificateBySecretName(ctx context.Context, secretName, secretNamespace string) *certmanagerv1.Certificate {
 	logger := log.FromContext(ctx)
 
-	// Получение всех Certificate в указанном namespace
+	// Получение Certificate с указанным секретом в namespace (по индексу)
 	certList := &certmanagerv1.CertificateList{}
-	if err := r.List(ctx, certList, client.InNamespace(secretNamespace)); err != nil {
+	if err := r.List(ctx, certList, client.InNamespace(secretNamespace), client.MatchingFields{certificateSecretNameIndex: secretName}); err != nil {
 		logger.V(1).Info("Failed to list Certificates",
 			"secretNamespace", secretNamespace,
 			"error", err,
@@ -0,0 +1,167 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - gatewayHSTSSettings(gateway) (hstsSettings, error)
+ *   Возвращает режим и область обработки HSTS из аннотаций Gateway
+ *
+ * - (r *CertificateReconciler) hstsHosts(ctx, gateway, secretRefs, settings) ([]string, error)
+ *   Возвращает хосты, для которых EnvoyFilter обрабатывает HSTS (nil - все хосты, только для области all)
+ *
+ * - (r *CertificateReconciler) certificateHostsForSecrets(ctx, secretRefs) ([]string, error)
+ *   Возвращает DNS имена Certificate, выпускающих секреты, которые используют EnvoyFilter
+ *
+ * - normalizeHosts(hosts) []string
+ *   Приводит хосты к нижнему регистру, сортирует и удаляет дубликаты
+ *
+ * Код Lua фильтра и spec EnvoyFilter - в certificate_hsts_filter.go,
+ * ссылки секретов EnvoyFilter - в certificate_hsts_refs.go
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// hstsModeAnnotation аннотация Gateway с режимом обработки HSTS
+	hstsModeAnnotation = "istio-http01.rieset.io/hsts-mode"
+
+	// hstsScopeAnnotation аннотация Gateway с областью обработки HSTS
+	hstsScopeAnnotation = "istio-http01.rieset.io/hsts-scope"
+)
+
+// hstsMode режим обработки заголовка Strict-Transport-Security на время временного сертификата
+type hstsMode string
+
+const (
+	// hstsModeStrip удаляет заголовок (по умолчанию)
+	hstsModeStrip hstsMode = "strip"
+
+	// hstsModeMaxAgeZero заменяет заголовок на max-age=0, чтобы браузеры сбросили сохраненный HSTS
+	hstsModeMaxAgeZero hstsMode = "max-age-zero"
+
+	// hstsModeKeep оставляет заголовок без изменений, EnvoyFilter не создается
+	hstsModeKeep hstsMode = "keep"
+)
+
+// hstsScope область обработки заголовка Strict-Transport-Security
+type hstsScope string
+
+const (
+	// hstsScopeCertificateHosts обрабатывает только ответы DNS имен сертификатов, ожидающих выпуска (по умолчанию)
+	hstsScopeCertificateHosts hstsScope = "certificate-hosts"
+
+	// hstsScopeAll обрабатывает ответы всех хостов Gateway
+	hstsScopeAll hstsScope = "all"
+
+	// hstsScopeGatewayHosts обрабатывает только ответы доменов Gateway из VirtualService (getDomainsForGateway)
+	hstsScopeGatewayHosts hstsScope = "gateway-hosts"
+)
+
+// errNoHSTSHosts для области certificate-hosts или gateway-hosts не найдено ни одного хоста:
+// EnvoyFilter не создается, чтобы не обрабатывать HSTS всех хостов Gateway
+var errNoHSTSHosts = errors.New("no hosts found for HSTS scope")
+
+// hstsSettings настройки обработки HSTS для Gateway
+type hstsSettings struct {
+	Mode  hstsMode
+	Scope hstsScope
+}
+
+// gatewayHSTSSettings возвращает настройки HSTS из аннотаций Gateway
+// Неизвестные значения заменяются значениями по умолчанию, ошибка описывает некорректную аннотацию
+func gatewayHSTSSettings(gateway *istionetworkingv1beta1.Gateway) (hstsSettings, error) {
+	settings := hstsSettings{Mode: hstsModeStrip, Scope: hstsScopeCertificateHosts}
+	var invalid []string
+
+	switch value := hstsMode(gateway.Annotations[hstsModeAnnotation]); value {
+	case "":
+	case hstsModeStrip, hstsModeMaxAgeZero, hstsModeKeep:
+		settings.Mode = value
+	default:
+		invalid = append(invalid, fmt.Sprintf("%s=%q (expected %s, %s or %s)", hstsModeAnnotation, value, hstsModeStrip, hstsModeMaxAgeZero, hstsModeKeep))
+	}
+
+	switch value := hstsScope(gateway.Annotations[hstsScopeAnnotation]); value {
+	case "":
+	case hstsScopeCertificateHosts, hstsScopeAll, hstsScopeGatewayHosts:
+		settings.Scope = value
+	default:
+		invalid = append(invalid, fmt.Sprintf("%s=%q (expected %s, %s or %s)", hstsScopeAnnotation, value, hstsScopeCertificateHosts, hstsScopeGatewayHosts, hstsScopeAll))
+	}
+
+	if len(invalid) > 0 {
+		return settings, fmt.Errorf("invalid HSTS annotations: %s", strings.Join(invalid, ", "))
+	}
+	return settings, nil
+}
+
+// hstsHosts возвращает отсортированные хосты, ответы которых обрабатывает EnvoyFilter
+// certificate-hosts - DNS имена сертификатов из secretRefs, gateway-hosts - домены Gateway из VirtualService
+// (без доменов - DNS имена сертификатов). Область не расширяется: nil (все хосты) возвращается только для all,
+// ошибки чтения возвращаются вызывающему, а отсутствие хостов - как errNoHSTSHosts
+func (r *CertificateReconciler) hstsHosts(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, secretRefs []string, settings hstsSettings) ([]string, error) {
+	if settings.Scope == hstsScopeAll {
+		return nil, nil
+	}
+
+	if settings.Scope == hstsScopeGatewayHosts {
+		gatewayDomains, err := r.getDomainsForGateway(ctx, gateway)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Gateway domains for HSTS EnvoyFilter: %w", err)
+		}
+		if len(gatewayDomains) > 0 {
+			return normalizeHosts(gatewayDomains), nil
+		}
+	}
+
+	certificateHosts, err := r.certificateHostsForSecrets(ctx, secretRefs)
+	if err != nil {
+		return nil, err
+	}
+	if len(certificateHosts) == 0 {
+		return nil, fmt.Errorf("%w %s on Gateway %s/%s", errNoHSTSHosts, settings.Scope, gateway.Namespace, gateway.Name)
+	}
+	return certificateHosts, nil
+}
+
+// certificateHostsForSecrets возвращает DNS имена (и commonName) Certificate, выпускающих секреты из secretRefs (namespace/name)
+func (r *CertificateReconciler) certificateHostsForSecrets(ctx context.Context, secretRefs []string) ([]string, error) {
+	var hosts []string
+	for _, secretRef := range secretRefs {
+		secretNamespace, secretName, _ := strings.Cut(secretRef, "/")
+		certificates := &certmanagerv1.CertificateList{}
+		if err := r.List(ctx, certificates, client.InNamespace(secretNamespace), client.MatchingFields{certificateSecretNameIndex: secretName}); err != nil {
+			return normalizeHosts(hosts), fmt.Errorf("failed to list Certificates for secret %s/%s: %w", secretNamespace, secretName, err)
+		}
+		for _, certificate := range certificates.Items {
+			hosts = append(hosts, certificate.Spec.DNSNames...)
+			if certificate.Spec.CommonName != "" {
+				hosts = append(hosts, certificate.Spec.CommonName)
+			}
+		}
+	}
+	return normalizeHosts(hosts), nil
+}
+
+// normalizeHosts приводит хосты к нижнему регистру, сортирует и удаляет дубликаты
+func normalizeHosts(hosts []string) []string {
+	if len(hosts) == 0 {
+		return nil
+	}
+	normalized := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		normalized = append(normalized, strings.ToLower(host))
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
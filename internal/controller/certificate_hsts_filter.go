@@ -0,0 +1,120 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - hstsLuaCode(mode, hosts) string
+ *   Формирует код Lua фильтра, удаляющего или переписывающего заголовок Strict-Transport-Security
+ *
+ * - hstsEnvoyFilterSpec(gateway, luaCode) map[string]interface{}
+ *   Формирует spec EnvoyFilter с Lua фильтром для workload Gateway
+ */
+
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+// hstsLuaCode формирует код Lua фильтра для режима mode
+// Если hosts не пуст, хост запроса (:authority без порта) сохраняется в dynamic metadata,
+// и заголовок обрабатывается только для этих хостов; "*.example.com" совпадает с одним уровнем поддомена
+func hstsLuaCode(mode hstsMode, hosts []string) string {
+	action := "  response_handle:headers():remove(\"strict-transport-security\")\n"
+	if mode == hstsModeMaxAgeZero {
+		// replace добавляет заголовок, если приложение его не отправило
+		action = "  response_handle:headers():replace(\"strict-transport-security\", \"max-age=0\")\n"
+	}
+
+	if len(hosts) == 0 {
+		return "function envoy_on_response(response_handle)\n" + action + "end\n"
+	}
+
+	var exact, wildcard []string
+	for _, host := range hosts {
+		if suffix, ok := strings.CutPrefix(host, "*"); ok {
+			wildcard = append(wildcard, strconv.Quote(suffix))
+		} else {
+			exact = append(exact, "["+strconv.Quote(host)+"] = true")
+		}
+	}
+
+	var code strings.Builder
+	code.WriteString("local hosts = {" + strings.Join(exact, ", ") + "}\n")
+	code.WriteString("local wildcards = {" + strings.Join(wildcard, ", ") + "}\n")
+	code.WriteString(`local function matches(host)
+  if hosts[host] then
+    return true
+  end
+  for _, suffix in ipairs(wildcards) do
+    local prefix = string.sub(host, 1, #host - #suffix)
+    if #host > #suffix and string.sub(host, -#suffix) == suffix and not string.find(prefix, ".", 1, true) then
+      return true
+    end
+  end
+  return false
+end
+function envoy_on_request(request_handle)
+  local host = string.lower(request_handle:headers():get(":authority") or "")
+  host = (string.gsub(host, ":%d+$", ""))
+  request_handle:streamInfo():dynamicMetadata():set("istio-http01.hsts", "host", host)
+end
+function envoy_on_response(response_handle)
+  local metadata = response_handle:streamInfo():dynamicMetadata():get("istio-http01.hsts")
+  if metadata == nil or not matches(metadata["host"] or "") then
+    return
+  end
+`)
+	code.WriteString(action)
+	code.WriteString("end\n")
+	return code.String()
+}
+
+// hstsEnvoyFilterSpec формирует spec EnvoyFilter с Lua фильтром для workload, выбранного селектором Gateway
+func hstsEnvoyFilterSpec(gateway *istionetworkingv1beta1.Gateway, luaCode string) map[string]interface{} {
+	workloadLabels := make(map[string]interface{})
+	if len(gateway.Spec.Selector) > 0 {
+		// Используем селектор из Gateway
+		for key, value := range gateway.Spec.Selector {
+			workloadLabels[key] = value
+		}
+	} else {
+		// Если селектор не указан, используем стандартный istio ingressgateway
+		workloadLabels["istio"] = "ingressgateway"
+	}
+
+	return map[string]interface{}{
+		"workloadSelector": map[string]interface{}{
+			"labels": workloadLabels,
+		},
+		"configPatches": []interface{}{
+			map[string]interface{}{
+				"applyTo": "HTTP_FILTER",
+				"match": map[string]interface{}{
+					"context": "GATEWAY",
+					"proxy": map[string]interface{}{
+						"proxyVersion": ".*",
+					},
+					"listener": map[string]interface{}{
+						"filterChain": map[string]interface{}{
+							"filter": map[string]interface{}{
+								"name": "envoy.filters.network.http_connection_manager",
+							},
+						},
+					},
+				},
+				"patch": map[string]interface{}{
+					"operation": "INSERT_BEFORE",
+					"value": map[string]interface{}{
+						"name": "envoy.filters.http.lua",
+						"typed_config": map[string]interface{}{
+							"@type":       "type.googleapis.com/envoy.extensions.filters.http.lua.v3.Lua",
+							"inline_code": luaCode,
+						},
+					},
+				},
+			},
+		},
+	}
+}
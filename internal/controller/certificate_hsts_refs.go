@@ -0,0 +1,183 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - hstsSecretRef(namespace, name) string
+ *   Возвращает ссылку namespace/name секрета сертификата, который использует EnvoyFilter
+ *
+ * - hstsSecretRefs(annotations) []string
+ *   Возвращает ссылки секретов из аннотации hsts-secrets EnvoyFilter
+ *
+ * - setHSTSSecretRefs(obj, refs)
+ *   Записывает ссылки секретов в аннотацию hsts-secrets (без ссылок аннотация удаляется)
+ *
+ * - (r *CertificateReconciler) deleteEnvoyFilterForHSTS(ctx, gateway, secretRef) error
+ *   Снимает ссылку секрета с EnvoyFilter для отключения HSTS и удаляет его, когда ссылок не осталось
+ *
+ * - (r *CertificateReconciler) releaseEnvoyFilterForHSTS(ctx, gateway, envoyFilter, secretRef, remainingRefs) error
+ *   Снимает ссылку секрета с EnvoyFilter, который используют другие сертификаты, и пересчитывает хосты
+ *
+ * Ссылки служат счетчиком ссылок EnvoyFilter для отключения HSTS (создается в certificate_envoyfilter.go)
+ */
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// hstsSecretsAnnotation аннотация EnvoyFilter с JSON списком секретов (namespace/name) сертификатов, которые его используют
+// Список служит счетчиком ссылок: EnvoyFilter удаляется, когда он становится пустым. Одна аннотация
+// (а не аннотация на секрет) не ограничивает длину имени секрета и различает одноименные секреты разных namespace
+const hstsSecretsAnnotation = "istio-http01.rieset.io/hsts-secrets"
+
+// hstsSecretRef возвращает ссылку namespace/name секрета сертификата
+func hstsSecretRef(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// hstsSecretRefs возвращает отсортированные ссылки секретов из аннотации hsts-secrets
+// Некорректное значение аннотации считается пустым списком
+func hstsSecretRefs(annotations map[string]string) []string {
+	value := annotations[hstsSecretsAnnotation]
+	if value == "" {
+		return nil
+	}
+	var refs []string
+	if err := json.Unmarshal([]byte(value), &refs); err != nil {
+		return nil
+	}
+	refs = slices.DeleteFunc(refs, func(ref string) bool { return ref == "" })
+	slices.Sort(refs)
+	return slices.Compact(refs)
+}
+
+// setHSTSSecretRefs записывает отсортированные ссылки секретов в аннотацию hsts-secrets объекта
+// Без ссылок аннотация удаляется
+func setHSTSSecretRefs(obj client.Object, refs []string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	refs = slices.Clone(refs)
+	slices.Sort(refs)
+	refs = slices.Compact(refs)
+	if len(refs) == 0 {
+		delete(annotations, hstsSecretsAnnotation)
+	} else {
+		// json.Marshal списка строк не возвращает ошибку
+		value, _ := json.Marshal(refs)
+		annotations[hstsSecretsAnnotation] = string(value)
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// deleteEnvoyFilterForHSTS снимает ссылку секрета secretRef (namespace/name, см. hstsSecretRef) с EnvoyFilter
+// для отключения HSTS. Пока EnvoyFilter используют другие сертификаты, он остается, а Lua фильтр перестает
+// обрабатывать хосты этого сертификата. Без ссылок (или при пустом secretRef) EnvoyFilter удаляется
+func (r *CertificateReconciler) deleteEnvoyFilterForHSTS(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, secretRef string) error {
+	logger := log.FromContext(ctx)
+
+	envoyFilterName := r.adoptHSTSEnvoyFilter(ctx, gateway)
+	envoyFilterNamespace := gateway.Namespace
+
+	// Используем unstructured для получения EnvoyFilter, так как тип v1alpha3.EnvoyFilter не зарегистрирован в схеме
+	envoyFilter := &unstructured.Unstructured{}
+	envoyFilter.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "networking.istio.io",
+		Version: "v1alpha3",
+		Kind:    "EnvoyFilter",
+	})
+	envoyFilter.SetName(envoyFilterName)
+	envoyFilter.SetNamespace(envoyFilterNamespace)
+	if err := r.Get(ctx, client.ObjectKey{
+		Name:      envoyFilterName,
+		Namespace: envoyFilterNamespace,
+	}, envoyFilter); err != nil {
+		if !apierrors.IsNotFound(err) {
+			// Ошибка чтения не означает, что EnvoyFilter удален: откат должен повториться
+			return fmt.Errorf("failed to get EnvoyFilter %s/%s: %w", envoyFilterNamespace, envoyFilterName, err)
+		}
+		// EnvoyFilter не найден, возможно уже удален
+		hstsEnvoyFiltersActive.DeleteLabelValues(gateway.Name, gateway.Namespace)
+		return nil
+	}
+
+	// Проверяем, что это наш EnvoyFilter
+	labels, found, err := unstructured.NestedStringMap(envoyFilter.Object, "metadata", "labels")
+	if err != nil || !found || labels["istio-http01.rieset.io/temp"] != tempLabelValue {
+		return nil
+	}
+
+	// EnvoyFilter прежних версий без аннотации hsts-secrets удаляется сразу
+	if refs := hstsSecretRefs(envoyFilter.GetAnnotations()); secretRef != "" && len(refs) > 0 {
+		if !slices.Contains(refs, secretRef) {
+			return nil
+		}
+		refs = slices.DeleteFunc(refs, func(ref string) bool { return ref == secretRef })
+		if len(refs) > 0 {
+			return r.releaseEnvoyFilterForHSTS(ctx, gateway, envoyFilter, secretRef, refs)
+		}
+	}
+
+	if err := r.Delete(ctx, envoyFilter); err != nil {
+		logger.Error(err, "failed to delete EnvoyFilter for HSTS",
+			"envoyFilterName", envoyFilterName,
+		)
+		recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonEnvoyFilterFailed,
+			"Failed to delete EnvoyFilter %s: %v", envoyFilterName, err)
+		return fmt.Errorf("failed to delete EnvoyFilter: %w", err)
+	}
+	hstsEnvoyFiltersActive.DeleteLabelValues(gateway.Name, gateway.Namespace)
+	recordEvent(r.Recorder, gateway, corev1.EventTypeNormal, eventReasonHSTSEnvoyFilterDeleted,
+		"Deleted EnvoyFilter %s, Strict-Transport-Security is sent again", envoyFilterName)
+
+	logger.Info("EnvoyFilter для отключения HSTS удален (HSTS включен обратно)",
+		"envoyFilterName", envoyFilterName,
+		"gatewayName", gateway.Name,
+		"gatewayNamespace", gateway.Namespace,
+	)
+
+	return nil
+}
+
+// releaseEnvoyFilterForHSTS снимает с EnvoyFilter ссылку секрета, которую используют и другие сертификаты,
+// и пересчитывает хосты Lua фильтра по оставшимся ссылкам. Если у оставшихся ссылок нет хостов области,
+// EnvoyFilter удаляется
+func (r *CertificateReconciler) releaseEnvoyFilterForHSTS(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, envoyFilter *unstructured.Unstructured, secretRef string, remainingRefs []string) error {
+	hsts, _ := gatewayHSTSSettings(gateway)
+	hosts, err := r.hstsHosts(ctx, gateway, remainingRefs, hsts)
+	if errors.Is(err, errNoHSTSHosts) {
+		return r.deleteEnvoyFilterForHSTS(ctx, gateway, "")
+	}
+	if err != nil {
+		return err
+	}
+
+	setHSTSSecretRefs(envoyFilter, remainingRefs)
+	spec := hstsEnvoyFilterSpec(gateway, hstsLuaCode(hsts.Mode, hosts))
+	if err := unstructured.SetNestedMap(envoyFilter.Object, spec, "spec"); err != nil {
+		return fmt.Errorf("failed to set EnvoyFilter spec: %w", err)
+	}
+	if err := r.Update(ctx, envoyFilter); err != nil {
+		return fmt.Errorf("failed to release EnvoyFilter: %w", err)
+	}
+
+	log.FromContext(ctx).Info("Released HSTS EnvoyFilter, still used by other certificates",
+		"envoyFilterName", envoyFilter.GetName(),
+		"secret", secretRef,
+		"remainingSecrets", len(remainingRefs),
+	)
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+ * Тесты ссылок секретов EnvoyFilter отключения HSTS (certificate_hsts_refs.go):
+ *
+ * - аннотации EnvoyFilter допустимы для длинного имени секрета
+ * - одноименные секреты разных namespace - разные ссылки: снятие одной не удаляет EnvoyFilter другой
+ * - deleteEnvoyFilterForHSTS: ошибка чтения EnvoyFilter возвращается, а не считается удалением
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("HSTS EnvoyFilter secret references", func() {
+	newReconciler := func(objects ...client.Object) *CertificateReconciler {
+		scheme := newTestHSTSScheme()
+		c := fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(objects...).
+			WithIndex(&certmanagerv1.Certificate{}, certificateSecretNameIndex, certificateSecretName).
+			WithIndex(&istionetworkingv1beta1.VirtualService{}, virtualServiceGatewayIndex, virtualServiceGatewayRefs).
+			Build()
+		return &CertificateReconciler{Client: c, Scheme: scheme}
+	}
+
+	It("keeps the annotation keys valid for long secret names", func() {
+		secretName := "app-example-com-wildcard-production-certificate-tls-secret-2"
+		Expect(secretName).To(HaveLen(60))
+		gateway := newTestGateway("app", "public", "app.example.com", secretName)
+		cert := testHSTSCertificate("app", "app", secretName, "app.example.com")
+		r := newReconciler(gateway, cert)
+
+		Expect(r.createEnvoyFilterToDisableHSTS(testCtx, gateway, cert)).To(Succeed())
+
+		envoyFilter, _, err := getTestHSTSEnvoyFilter(r.Client, gateway)
+		Expect(err).NotTo(HaveOccurred())
+		for key := range envoyFilter.GetAnnotations() {
+			Expect(validation.IsQualifiedName(key)).To(BeEmpty(), key)
+		}
+		Expect(hstsSecretRefs(envoyFilter.GetAnnotations())).To(Equal([]string{"app/" + secretName}))
+	})
+
+	It("tracks secrets with the same name in different namespaces separately", func() {
+		gateway := newTestGateway("app", "public", "app.example.com", "shared-tls")
+		appCert := testHSTSCertificate("app", "app", "shared-tls", "app.example.com")
+		shopCert := testHSTSCertificate("shop", "shop", "shared-tls", "shop.example.com")
+		r := newReconciler(gateway, appCert, shopCert)
+
+		Expect(r.createEnvoyFilterToDisableHSTS(testCtx, gateway, appCert)).To(Succeed())
+		Expect(r.createEnvoyFilterToDisableHSTS(testCtx, gateway, shopCert)).To(Succeed())
+		envoyFilter, _, err := getTestHSTSEnvoyFilter(r.Client, gateway)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hstsSecretRefs(envoyFilter.GetAnnotations())).To(Equal([]string{"app/shared-tls", "shop/shared-tls"}))
+
+		By("releasing the certificate of the first namespace")
+		Expect(r.deleteEnvoyFilterForHSTS(testCtx, gateway, hstsSecretRef("app", "shared-tls"))).To(Succeed())
+		envoyFilter, code, err := getTestHSTSEnvoyFilter(r.Client, gateway)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hstsSecretRefs(envoyFilter.GetAnnotations())).To(Equal([]string{"shop/shared-tls"}))
+		Expect(code).To(ContainSubstring(`["shop.example.com"] = true`))
+		Expect(code).NotTo(ContainSubstring("app.example.com"))
+	})
+
+	It("returns read errors instead of treating the EnvoyFilter as deleted", func() {
+		gateway := newTestGateway("app", "public", "app.example.com", "app-tls")
+		cert := testHSTSCertificate("app", "app", "app-tls", "app.example.com")
+		r := newReconciler(gateway, cert)
+		Expect(r.createEnvoyFilterToDisableHSTS(testCtx, gateway, cert)).To(Succeed())
+
+		r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if obj.GetObjectKind().GroupVersionKind().Kind == "EnvoyFilter" {
+					return errors.New("cache is not synced")
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+		})
+		Expect(r.deleteEnvoyFilterForHSTS(testCtx, gateway, hstsSecretRef("app", "app-tls"))).
+			To(MatchError(ContainSubstring("cache is not synced")))
+	})
+})
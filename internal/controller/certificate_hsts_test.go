@@ -0,0 +1,189 @@
+/*
+ * Тесты обработки HSTS (certificate_hsts.go, certificate_hsts_filter.go, certificate_hsts_refs.go):
+ *
+ * - gatewayHSTSSettings: значения по умолчанию, режимы и области из аннотаций, некорректные значения
+ * - hstsLuaCode: удаление и замена заголовка, проверка хостов только для области gateway-hosts
+ * - createEnvoyFilterToDisableHSTS / deleteEnvoyFilterForHSTS: общий EnvoyFilter обрабатывает DNS имена
+ *   ожидающих сертификатов и удаляется со снятием последней ссылки
+ * - hstsHosts: область certificate-hosts не расширяется до доменов Gateway и всех хостов
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// testHSTSCertificate возвращает Certificate с одним DNS именем
+func testHSTSCertificate(namespace, name, secretName, host string) *certmanagerv1.Certificate {
+	return &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID("uid-" + name)},
+		Spec: certmanagerv1.CertificateSpec{
+			SecretName: secretName,
+			DNSNames:   []string{host},
+		},
+	}
+}
+
+// newTestHSTSScheme возвращает схему с unstructured EnvoyFilter
+// Тип v1alpha3.EnvoyFilter не зарегистрирован в схеме оператора
+func newTestHSTSScheme() *runtime.Scheme {
+	scheme := newTestScheme()
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1alpha3", Kind: "EnvoyFilter"}, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1alpha3", Kind: "EnvoyFilterList"}, &unstructured.UnstructuredList{})
+	return scheme
+}
+
+// getTestHSTSEnvoyFilter получает EnvoyFilter отключения HSTS и его Lua код
+func getTestHSTSEnvoyFilter(c client.Client, gateway *istionetworkingv1beta1.Gateway) (*unstructured.Unstructured, string, error) {
+	envoyFilter := &unstructured.Unstructured{}
+	envoyFilter.SetGroupVersionKind(schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1alpha3", Kind: "EnvoyFilter"})
+	if err := c.Get(testCtx, client.ObjectKey{Name: hstsEnvoyFilterName(gateway), Namespace: gateway.Namespace}, envoyFilter); err != nil {
+		return nil, "", err
+	}
+	patches, _, _ := unstructured.NestedSlice(envoyFilter.Object, "spec", "configPatches")
+	Expect(patches).To(HaveLen(1))
+	code, _, _ := unstructured.NestedString(patches[0].(map[string]interface{}), "patch", "value", "typed_config", "inline_code")
+	return envoyFilter, code, nil
+}
+
+var _ = Describe("HSTS handling", func() {
+	It("reads the HSTS mode and scope from Gateway annotations", func() {
+		gateway := newTestGateway("app", "public", "app.example.com", "app-tls")
+
+		settings, err := gatewayHSTSSettings(gateway)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(settings).To(Equal(hstsSettings{Mode: hstsModeStrip, Scope: hstsScopeCertificateHosts}))
+
+		gateway.Annotations = map[string]string{
+			hstsModeAnnotation:  "max-age-zero",
+			hstsScopeAnnotation: "gateway-hosts",
+		}
+		settings, err = gatewayHSTSSettings(gateway)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(settings).To(Equal(hstsSettings{Mode: hstsModeMaxAgeZero, Scope: hstsScopeGatewayHosts}))
+
+		By("falling back to defaults for unknown values")
+		gateway.Annotations = map[string]string{
+			hstsModeAnnotation:  "drop",
+			hstsScopeAnnotation: "gateway-hosts",
+		}
+		settings, err = gatewayHSTSSettings(gateway)
+		Expect(err).To(MatchError(ContainSubstring(hstsModeAnnotation)))
+		Expect(settings).To(Equal(hstsSettings{Mode: hstsModeStrip, Scope: hstsScopeGatewayHosts}))
+	})
+
+	It("strips or rewrites the header for all hosts", func() {
+		code := hstsLuaCode(hstsModeStrip, nil)
+		Expect(code).To(ContainSubstring(`remove("strict-transport-security")`))
+		Expect(code).NotTo(ContainSubstring("envoy_on_request"))
+
+		code = hstsLuaCode(hstsModeMaxAgeZero, nil)
+		Expect(code).To(ContainSubstring(`replace("strict-transport-security", "max-age=0")`))
+		Expect(code).NotTo(ContainSubstring("remove("))
+	})
+
+	It("limits the header handling to the Gateway hosts", func() {
+		code := hstsLuaCode(hstsModeStrip, []string{"*.example.com", "app.example.com"})
+		Expect(code).To(ContainSubstring(`local hosts = {["app.example.com"] = true}`))
+		Expect(code).To(ContainSubstring(`local wildcards = {".example.com"}`))
+		Expect(code).To(ContainSubstring("function envoy_on_request(request_handle)"))
+		Expect(code).To(ContainSubstring("not matches(metadata[\"host\"] or \"\")"))
+	})
+
+	It("shares the EnvoyFilter between certificates and deletes it with the last reference", func() {
+		scheme := newTestHSTSScheme()
+
+		gateway := newTestGateway("app", "public", "app.example.com", "app-tls")
+		appCert := testHSTSCertificate("app", "app", "app-tls", "app.example.com")
+		shopCert := testHSTSCertificate("shop", "shop", "shop-tls", "shop.example.com")
+		c := fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(gateway, appCert, shopCert).
+			WithIndex(&certmanagerv1.Certificate{}, certificateSecretNameIndex, certificateSecretName).
+			WithIndex(&istionetworkingv1beta1.VirtualService{}, virtualServiceGatewayIndex, virtualServiceGatewayRefs).
+			Build()
+		r := &CertificateReconciler{Client: c, Scheme: scheme}
+
+		Expect(r.createEnvoyFilterToDisableHSTS(testCtx, gateway, appCert)).To(Succeed())
+		Expect(r.createEnvoyFilterToDisableHSTS(testCtx, gateway, shopCert)).To(Succeed())
+
+		envoyFilter, code, err := getTestHSTSEnvoyFilter(c, gateway)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hstsSecretRefs(envoyFilter.GetAnnotations())).To(Equal([]string{"app/app-tls", "shop/shop-tls"}))
+		Expect(code).To(ContainSubstring(`["app.example.com"] = true`))
+		Expect(code).To(ContainSubstring(`["shop.example.com"] = true`))
+
+		By("releasing the first certificate")
+		Expect(r.deleteEnvoyFilterForHSTS(testCtx, gateway, "app/app-tls")).To(Succeed())
+		envoyFilter, code, err = getTestHSTSEnvoyFilter(c, gateway)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hstsSecretRefs(envoyFilter.GetAnnotations())).To(Equal([]string{"shop/shop-tls"}))
+		Expect(code).NotTo(ContainSubstring("app.example.com"))
+		Expect(code).To(ContainSubstring(`["shop.example.com"] = true`))
+
+		By("releasing the last certificate")
+		Expect(r.deleteEnvoyFilterForHSTS(testCtx, gateway, "shop/shop-tls")).To(Succeed())
+		_, _, err = getTestHSTSEnvoyFilter(c, gateway)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("never widens the certificate-hosts scope", func() {
+		scheme := newTestHSTSScheme()
+		gateway := newTestGateway("app", "public", "app.example.com", "app-tls")
+		// Сертификат без DNS имен: домены Gateway из VirtualService не должны подставляться вместо них
+		ipCert := testHSTSCertificate("app", "app", "app-tls", "")
+		ipCert.Spec.DNSNames = nil
+		ipCert.Spec.IPAddresses = []string{"192.0.2.10"}
+		build := func(funcs interceptor.Funcs, cert *certmanagerv1.Certificate) *CertificateReconciler {
+			c := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(gateway, cert, newTestVirtualService("app", "app", "app.example.com", gateway.Name)).
+				WithIndex(&certmanagerv1.Certificate{}, certificateSecretNameIndex, certificateSecretName).
+				WithIndex(&istionetworkingv1beta1.VirtualService{}, virtualServiceGatewayIndex, virtualServiceGatewayRefs).
+				WithInterceptorFuncs(funcs).
+				Build()
+			return &CertificateReconciler{Client: c, Scheme: scheme}
+		}
+		settings := hstsSettings{Mode: hstsModeStrip, Scope: hstsScopeCertificateHosts}
+		refs := []string{"app/app-tls"}
+
+		By("creating no EnvoyFilter without certificate hosts")
+		r := build(interceptor.Funcs{}, ipCert)
+		_, err := r.hstsHosts(testCtx, gateway, refs, settings)
+		Expect(errors.Is(err, errNoHSTSHosts)).To(BeTrue())
+		Expect(r.createEnvoyFilterToDisableHSTS(testCtx, gateway, ipCert)).To(Succeed())
+		_, _, err = getTestHSTSEnvoyFilter(r.Client, gateway)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		By("returning the error when Certificates cannot be listed")
+		r = build(interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if _, ok := list.(*certmanagerv1.CertificateList); ok {
+					return errors.New("cache is not synced")
+				}
+				return c.List(ctx, list, opts...)
+			},
+		}, testHSTSCertificate("app", "app", "app-tls", "app.example.com"))
+		hosts, err := r.hstsHosts(testCtx, gateway, refs, settings)
+		Expect(err).To(MatchError(ContainSubstring("cache is not synced")))
+		Expect(hosts).To(BeNil())
+		Expect(r.createEnvoyFilterToDisableHSTS(testCtx, gateway, ipCert)).To(MatchError(ContainSubstring("cache is not synced")))
+		_, _, err = getTestHSTSEnvoyFilter(r.Client, gateway)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,169 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) reconcileIssuedCertificate(ctx, cert) (ctrl.Result, bool)
+ *   Возвращает оригинальный секрет в Gateway выпущенного сертификата и удаляет временные ресурсы
+ *
+ * Вызывается из Reconcile (certificate_controller.go); finalizer снимается, если откат выполнен полностью
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istionetworkingv1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reconcileIssuedCertificate восстанавливает оригинальный секрет в Gateway выпущенного сертификата,
+// удаляет серверы overlay Gateway, EnvoyFilter отключения HSTS и временный сертификат.
+// Возвращает RequeueAfter, если в debug режиме откат отложен, и true, если не все изменения откачены
+func (r *CertificateReconciler) reconcileIssuedCertificate(ctx context.Context, cert *certmanagerv1.Certificate) (ctrl.Result, bool) {
+	logger := log.FromContext(ctx)
+	restoreFailed := false
+
+	// Сертификат готов - проверяем, нужно ли восстановить оригинальный секрет в Gateway
+	gateways, err := r.findGatewaysUsingCertificate(ctx, cert.Spec.SecretName, cert.Namespace)
+	if err != nil {
+		logger.Error(err, "failed to find Gateways using certificate",
+			"certificateName", cert.Name,
+			"secretName", cert.Spec.SecretName,
+		)
+		restoreFailed = true
+	} else if len(gateways) > 0 {
+		// Проверяем, использует ли Gateway временный секрет - если да, убеждаемся, что EnvoyFilter существует
+		tempSecretName := fmt.Sprintf("%s-temp", cert.Spec.SecretName)
+		for _, gateway := range gateways {
+			usesTempSecret := r.isGatewayUsingSecret(ctx, gateway, tempSecretName, cert.Namespace)
+			logger.Info("Проверка использования секрета в Gateway для очистки EnvoyFilter",
+				"gatewayName", gateway.Name,
+				"gatewayNamespace", gateway.Namespace,
+				"usesTempSecret", usesTempSecret,
+				"tempSecretName", tempSecretName,
+			)
+			if usesTempSecret {
+				// Gateway использует временный секрет - проверяем наличие EnvoyFilter
+				envoyFilterName := r.adoptHSTSEnvoyFilter(ctx, gateway)
+				envoyFilter := &istionetworkingv1alpha3.EnvoyFilter{}
+				if err := r.Get(ctx, client.ObjectKey{
+					Name:      envoyFilterName,
+					Namespace: gateway.Namespace,
+				}, envoyFilter); err != nil {
+					// EnvoyFilter не существует - создаем его
+					logger.Info("Certificate ready but Gateway uses temporary secret, ensuring EnvoyFilter exists",
+						"gatewayName", gateway.Name,
+						"gatewayNamespace", gateway.Namespace,
+					)
+					if err := r.createEnvoyFilterToDisableHSTS(ctx, gateway, cert); err != nil {
+						logger.Error(err, "failed to create EnvoyFilter for temporary certificate",
+							"gatewayName", gateway.Name,
+							"gatewayNamespace", gateway.Namespace,
+						)
+					}
+				}
+			} else {
+				// Gateway использует оригинальный секрет - проверяем и удаляем EnvoyFilter, если он существует
+				// Используем unstructured для проверки, так как тип v1alpha3.EnvoyFilter не зарегистрирован в схеме
+				envoyFilterName := r.adoptHSTSEnvoyFilter(ctx, gateway)
+				envoyFilter := &unstructured.Unstructured{}
+				envoyFilter.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "networking.istio.io",
+					Version: "v1alpha3",
+					Kind:    "EnvoyFilter",
+				})
+				envoyFilter.SetName(envoyFilterName)
+				envoyFilter.SetNamespace(gateway.Namespace)
+				err := r.Get(ctx, client.ObjectKey{
+					Name:      envoyFilterName,
+					Namespace: gateway.Namespace,
+				}, envoyFilter)
+				if err == nil {
+					// EnvoyFilter существует, но Gateway использует оригинальный секрет - удаляем его
+					logger.Info("Сертификат готов и Gateway использует оригинальный секрет, удаляем EnvoyFilter",
+						"gatewayName", gateway.Name,
+						"gatewayNamespace", gateway.Namespace,
+						"envoyFilterName", envoyFilterName,
+					)
+					if err := r.deleteEnvoyFilterForHSTS(ctx, gateway, hstsSecretRef(cert.Namespace, cert.Spec.SecretName)); err != nil {
+						logger.Error(err, "не удалось удалить EnvoyFilter для HSTS",
+							"gatewayName", gateway.Name,
+							"gatewayNamespace", gateway.Namespace,
+						)
+					}
+				} else {
+					logger.V(1).Info("EnvoyFilter не найден (возможно, уже удален)",
+						"gatewayName", gateway.Name,
+						"gatewayNamespace", gateway.Namespace,
+						"envoyFilterName", envoyFilterName,
+					)
+				}
+			}
+		}
+
+		// В debug режиме проверяем, прошло ли 5 минут с момента создания временного сертификата
+		if r.DebugMode {
+			if credential, err := r.getTemporaryCredential(ctx, cert); err == nil && credential != nil {
+				// Временный сертификат существует - проверяем время создания
+				creationTime := credential.CreatedAt
+				elapsed := time.Since(creationTime)
+				minElapsed := 5 * time.Minute
+
+				if elapsed < minElapsed {
+					logger.Info("Debug mode: delaying certificate restoration",
+						"certificateName", cert.Name,
+						"elapsed", elapsed,
+						"required", minElapsed,
+						"remaining", minElapsed-elapsed,
+					)
+					// Возвращаем результат с временем до следующей проверки
+					remaining := minElapsed - elapsed
+					if remaining < 30*time.Second {
+						remaining = 30 * time.Second
+					}
+					return ctrl.Result{RequeueAfter: remaining}, false
+				}
+				logger.Info("Debug mode: 5 minutes elapsed, restoring certificate",
+					"certificateName", cert.Name,
+					"elapsed", elapsed,
+				)
+			}
+		}
+
+		// Восстанавливаем оригинальный секрет в Gateway, удаляем серверы overlay Gateway и включаем обратно HSTS
+		for _, gateway := range gateways {
+			if err := r.restoreGatewayOriginalSecret(ctx, gateway, cert.Spec.SecretName, cert.Namespace); err != nil {
+				logger.Error(err, "failed to restore original secret in Gateway",
+					"certificateName", cert.Name,
+					"gatewayName", gateway.Name,
+					"gatewayNamespace", gateway.Namespace,
+				)
+				restoreFailed = true
+			}
+			if err := r.removeOverlayGatewayServers(ctx, gateway, cert.Spec.SecretName); err != nil {
+				logger.Error(err, "failed to remove overlay Gateway servers",
+					"certificateName", cert.Name,
+					"gatewayName", gateway.Name,
+					"gatewayNamespace", gateway.Namespace,
+				)
+				restoreFailed = true
+			}
+		}
+
+		// Удаляем временный самоподписанный сертификат
+		if err := r.deleteTemporarySelfSignedCertificate(ctx, cert); err != nil {
+			logger.Error(err, "failed to delete temporary self-signed certificate",
+				"certificateName", cert.Name,
+			)
+			restoreFailed = true
+		}
+	}
+	return ctrl.Result{}, restoreFailed
+}
@@ -0,0 +1,107 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) reconcileIssuingCertificate(ctx, cert) error
+ *   Переводит Gateway сертификата, который еще не выпущен, на временный сертификат и открывает HTTP01 challenge
+ *
+ * Вызывается из Reconcile (certificate_controller.go) для сертификатов issuer'ов с ACME HTTP01 solver
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+// reconcileIssuingCertificate проверяет и восстанавливает состояние Gateway сертификата на время выпуска:
+// временный секрет, отключенный httpsRedirect и EnvoyFilter HSTS (режим Patch) или overlay Gateway (режим Overlay).
+// Возвращает ошибку, если не удалось прочитать Http01Policy или добавить finalizer: реконсиляция повторяется.
+// Ошибки изменения отдельных Gateway только записываются в лог
+func (r *CertificateReconciler) reconcileIssuingCertificate(ctx context.Context, cert *certmanagerv1.Certificate) error {
+	logger := log.FromContext(ctx)
+
+	// Поиск Gateway, которые используют этот сертификат
+	gateways, err := r.findGatewaysUsingCertificate(ctx, cert.Spec.SecretName, cert.Namespace)
+	if err != nil {
+		logger.Error(err, "failed to find Gateways using certificate",
+			"certificateName", cert.Name,
+			"secretName", cert.Spec.SecretName,
+		)
+	} else if len(gateways) > 0 {
+		// Политики всех Gateway определяются до изменений: если Http01Policy не удалось прочитать,
+		// ни один Gateway не изменяется, реконсиляция повторяется
+		policies := make(map[*istionetworkingv1beta1.Gateway]http01PolicySettings, len(gateways))
+		for _, gateway := range gateways {
+			policy, err := resolveHTTP01Policy(ctx, r.Client, gateway)
+			if err != nil {
+				return err
+			}
+			policies[gateway] = policy
+		}
+
+		// Периодическая проверка и восстановление состояния для Gateway с httpsRedirect
+		for _, gateway := range gateways {
+			// Проверяем, что Gateway действительно связан с этим сертификатом
+			// Проверяем по оригинальному или временному секрету
+			originalSecretName := cert.Spec.SecretName
+			tempSecretName := fmt.Sprintf("%s-temp", cert.Spec.SecretName)
+			isGatewayRelated := r.isGatewayUsingSecret(ctx, gateway, originalSecretName, cert.Namespace) ||
+				r.isGatewayUsingSecret(ctx, gateway, tempSecretName, cert.Namespace) ||
+				(gateway.Annotations != nil && gateway.Annotations[fmt.Sprintf("istio-http01.rieset.io/original-credential-name-%s", originalSecretName)] != "")
+
+			if !isGatewayRelated {
+				logger.V(1).Info("Gateway not related to certificate, skipping",
+					"certificateName", cert.Name,
+					"gatewayName", gateway.Name,
+					"gatewayNamespace", gateway.Namespace,
+				)
+				continue
+			}
+
+			// Gateway будет изменен - finalizer гарантирует откат при удалении Certificate
+			if err := r.ensureCertificateFinalizer(ctx, cert); err != nil {
+				return err
+			}
+
+			if policies[gateway].GatewayMode == http01v1alpha1.GatewayModeOverlay {
+				// Режим Overlay: Gateway пользователя не изменяется, временный секрет обслуживает overlay Gateway
+				if err := r.ensureOverlayGateway(ctx, cert, gateway); err != nil {
+					logger.Error(err, "failed to ensure overlay Gateway",
+						"certificateName", cert.Name,
+						"gatewayName", gateway.Name,
+						"gatewayNamespace", gateway.Namespace,
+					)
+				}
+			} else if r.hasHTTPSRedirect(gateway, certificateHosts(cert)) {
+				// Проверяем и восстанавливаем состояние временного сертификата, httpRedirect и EnvoyFilter
+				if err := r.ensureTemporaryCertificateSetup(ctx, cert, gateway); err != nil {
+					logger.Error(err, "failed to ensure temporary certificate setup",
+						"certificateName", cert.Name,
+						"gatewayName", gateway.Name,
+						"gatewayNamespace", gateway.Namespace,
+					)
+				}
+			} else {
+				// Проверяем, использует ли Gateway временный секрет, но httpsRedirect не отключен
+				if r.isGatewayUsingSecret(ctx, gateway, tempSecretName, cert.Namespace) {
+					// Gateway использует временный секрет, но httpsRedirect может быть включен
+					// Отключаем его для прохождения HTTP01 challenge
+					if err := r.disableHTTPSRedirectForHTTP01(ctx, gateway, cert); err != nil {
+						logger.Error(err, "failed to disable httpsRedirect for HTTP01 challenge",
+							"gatewayName", gateway.Name,
+							"gatewayNamespace", gateway.Namespace,
+						)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
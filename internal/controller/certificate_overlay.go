@@ -0,0 +1,128 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) ensureOverlayGateway(ctx, cert, gateway) error
+ *   Выпускает временный сертификат и создает overlay Gateway вместо изменения Gateway пользователя (режим Overlay)
+ *
+ * - overlayGatewayName(gatewayName) string
+ *   Формирует имя overlay Gateway
+ *
+ * - isOverlayGateway(obj) bool
+ *   Проверяет, является ли Gateway overlay Gateway оператора
+ *
+ * Создание, обновление и удаление overlay Gateway - в certificate_overlay_gateway.go
+ * Формирование серверов overlay Gateway - в certificate_overlay_servers.go
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// overlayGatewaySuffix суффикс имени overlay Gateway
+	overlayGatewaySuffix = "-http01-overlay"
+
+	// overlayGatewayLabel метка overlay Gateway с именем Gateway пользователя
+	overlayGatewayLabel = "istio-http01.rieset.io/overlay-for"
+
+	// overlaySecretAnnotationPrefix префикс аннотации overlay Gateway с namespace секрета, серверы которого он содержит
+	overlaySecretAnnotationPrefix = "istio-http01.rieset.io/overlay-secret-"
+)
+
+// ensureOverlayGateway выпускает временный сертификат и создает overlay Gateway для режима Overlay Http01Policy
+// Gateway пользователя не изменяется: overlay Gateway с тем же селектором обслуживает временный секрет на HTTPS
+// серверах и HTTP без редиректа. Изменения, сделанные ранее в режиме Patch, откатываются
+func (r *CertificateReconciler) ensureOverlayGateway(ctx context.Context, cert *certmanagerv1.Certificate, gateway *istionetworkingv1beta1.Gateway) error {
+	logger := log.FromContext(ctx)
+	policy, err := resolveHTTP01Policy(ctx, r.Client, gateway)
+	if err != nil {
+		return err
+	}
+
+	// Gateway мог быть изменен до переключения политики в режим Overlay
+	originalCredentialKey := fmt.Sprintf("istio-http01.rieset.io/original-credential-name-%s", cert.Spec.SecretName)
+	if _, exists := gateway.Annotations[originalCredentialKey]; exists {
+		if err := r.restoreGatewayOriginalSecret(ctx, gateway, cert.Spec.SecretName, cert.Namespace); err != nil {
+			return err
+		}
+	}
+
+	// Без httpsRedirect challenge проходит через Gateway пользователя, временный сертификат не нужен
+	if !r.hasHTTPSRedirect(gateway, certificateHosts(cert)) {
+		return nil
+	}
+
+	tempCredentialName := ""
+	if policy.TemporaryCertificateEnabled {
+		credential, err := r.getTemporaryCredential(ctx, cert)
+		if err != nil {
+			return err
+		}
+		if credential == nil {
+			// Временный сертификат должен покрывать все домены Gateway
+			gatewayDomains, err := r.getDomainsForGateway(ctx, gateway)
+			if err != nil {
+				gatewayDomains = cert.Spec.DNSNames
+			}
+			if err := r.provisionTemporaryCredential(ctx, cert, gateway, gatewayDomains, policy); err != nil {
+				return err
+			}
+			// EnvoyFilter создается сразу, до того как временный сертификат станет готовым
+			if err := r.createEnvoyFilterToDisableHSTS(ctx, gateway, cert); err != nil {
+				logger.Error(err, "failed to create EnvoyFilter to disable HSTS (will retry later)",
+					"gatewayName", gateway.Name,
+					"gatewayNamespace", gateway.Namespace,
+				)
+			}
+			// overlay Gateway создается после готовности временного сертификата
+			return nil
+		}
+		if err := r.refreshFallbackSecret(ctx, cert, gateway, policy); err != nil {
+			return err
+		}
+		if !credential.Ready {
+			logger.V(1).Info("Temporary certificate not ready yet, waiting",
+				"certificateName", cert.Name,
+				"tempSecretName", credential.SecretName,
+			)
+			return nil
+		}
+		if err := r.createEnvoyFilterToDisableHSTS(ctx, gateway, cert); err != nil {
+			logger.Error(err, "failed to create EnvoyFilter to disable HSTS",
+				"gatewayName", gateway.Name,
+				"gatewayNamespace", gateway.Namespace,
+			)
+		}
+
+		tempCredentialName = credential.SecretName
+		if cert.Namespace != gateway.Namespace {
+			tempCredentialName = fmt.Sprintf("%s/%s", cert.Namespace, credential.SecretName)
+		}
+	}
+
+	servers := buildOverlayServers(gateway, cert.Spec.SecretName, cert.Namespace, certificateHosts(cert), tempCredentialName, policy.ManageHTTPSRedirect)
+	if len(servers) == 0 {
+		return nil
+	}
+	return r.upsertOverlayGatewayServers(ctx, gateway, cert.Spec.SecretName, cert.Namespace, servers)
+}
+
+// overlayGatewayName формирует имя overlay Gateway для Gateway пользователя
+func overlayGatewayName(gatewayName string) string {
+	return gatewayName + overlayGatewaySuffix
+}
+
+// isOverlayGateway проверяет, является ли Gateway overlay Gateway оператора
+// overlay Gateway не обрабатываются как Gateway пользователя
+func isOverlayGateway(obj client.Object) bool {
+	_, ok := obj.GetLabels()[overlayGatewayLabel]
+	return ok
+}
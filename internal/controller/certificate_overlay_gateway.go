@@ -0,0 +1,155 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) upsertOverlayGatewayServers(ctx, gateway, secretName, secretNamespace, servers) error
+ *   Создает overlay Gateway или заменяет в нем серверы указанного секрета
+ *
+ * - (r *CertificateReconciler) removeOverlayGatewayServers(ctx, gateway, secretName) error
+ *   Удаляет из overlay Gateway серверы секрета и сам overlay Gateway, если серверов не осталось
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// upsertOverlayGatewayServers создает overlay Gateway или заменяет в нем серверы секрета
+// overlay Gateway общий для всех сертификатов Gateway пользователя и принадлежит ему (owner reference)
+func (r *CertificateReconciler) upsertOverlayGatewayServers(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, secretName, secretNamespace string, servers []*istioapinetworkingv1beta1.Server) error {
+	logger := log.FromContext(ctx)
+
+	overlay := &istionetworkingv1beta1.Gateway{}
+	err := r.Get(ctx, client.ObjectKey{Name: overlayGatewayName(gateway.Name), Namespace: gateway.Namespace}, overlay)
+	if apierrors.IsNotFound(err) {
+		overlay = &istionetworkingv1beta1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      overlayGatewayName(gateway.Name),
+				Namespace: gateway.Namespace,
+				Labels: map[string]string{
+					"app.kubernetes.io/managed-by": "istio-http01",
+					"istio-http01.rieset.io/temp":  tempLabelValue,
+					overlayGatewayLabel:            gateway.Name,
+				},
+				Annotations: map[string]string{
+					overlaySecretAnnotationPrefix + secretName: secretNamespace,
+				},
+			},
+		}
+		overlay.Spec.Selector = gateway.Spec.Selector
+		overlay.Spec.Servers = servers
+		// GC удалит overlay Gateway вместе с Gateway пользователя
+		if err := controllerutil.SetControllerReference(gateway, overlay, r.Scheme); err != nil {
+			return fmt.Errorf("failed to set owner reference on overlay Gateway: %w", err)
+		}
+		if err := r.Create(ctx, overlay); err != nil {
+			recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonGatewayUpdateFailed,
+				"Failed to create overlay Gateway %s: %v", overlay.Name, err)
+			return fmt.Errorf("failed to create overlay Gateway: %w", err)
+		}
+		recordEvent(r.Recorder, gateway, corev1.EventTypeNormal, eventReasonTemporarySecretApplied,
+			"Created overlay Gateway %s for secret %s until the certificate is issued", overlay.Name, secretName)
+		logger.Info("Created overlay Gateway",
+			"gatewayName", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+			"overlayGatewayName", overlay.Name,
+			"secretName", secretName,
+		)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get overlay Gateway: %w", err)
+	}
+
+	// Серверы других секретов сохраняются, серверы секрета заменяются актуальными
+	updated := make([]*istioapinetworkingv1beta1.Server, 0, len(overlay.Spec.Servers)+len(servers))
+	for _, server := range overlay.Spec.Servers {
+		if !isOverlayServerFor(server, secretName) {
+			updated = append(updated, server)
+		}
+	}
+	updated = append(updated, servers...)
+
+	desired := overlay.DeepCopy()
+	desired.Spec.Selector = gateway.Spec.Selector
+	desired.Spec.Servers = updated
+	if desired.Annotations == nil {
+		desired.Annotations = make(map[string]string)
+	}
+	desired.Annotations[overlaySecretAnnotationPrefix+secretName] = secretNamespace
+	if proto.Equal(&overlay.Spec, &desired.Spec) && overlay.Annotations[overlaySecretAnnotationPrefix+secretName] == secretNamespace {
+		return nil
+	}
+
+	if err := r.Update(ctx, desired); err != nil {
+		return fmt.Errorf("failed to update overlay Gateway: %w", err)
+	}
+	logger.Info("Updated overlay Gateway",
+		"gatewayName", gateway.Name,
+		"gatewayNamespace", gateway.Namespace,
+		"overlayGatewayName", overlay.Name,
+		"secretName", secretName,
+		"servers", len(updated),
+	)
+	return nil
+}
+
+// removeOverlayGatewayServers удаляет из overlay Gateway серверы секрета
+// overlay Gateway без серверов удаляется
+func (r *CertificateReconciler) removeOverlayGatewayServers(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, secretName string) error {
+	logger := log.FromContext(ctx)
+
+	overlay := &istionetworkingv1beta1.Gateway{}
+	if err := r.Get(ctx, client.ObjectKey{Name: overlayGatewayName(gateway.Name), Namespace: gateway.Namespace}, overlay); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	remaining := make([]*istioapinetworkingv1beta1.Server, 0, len(overlay.Spec.Servers))
+	for _, server := range overlay.Spec.Servers {
+		if !isOverlayServerFor(server, secretName) {
+			remaining = append(remaining, server)
+		}
+	}
+
+	if len(remaining) == 0 {
+		if err := r.Delete(ctx, overlay); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete overlay Gateway: %w", err)
+		}
+		recordEvent(r.Recorder, gateway, corev1.EventTypeNormal, eventReasonOriginalSecretRestored,
+			"Deleted overlay Gateway %s after the certificate was issued", overlay.Name)
+		logger.Info("Deleted overlay Gateway",
+			"gatewayName", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+			"overlayGatewayName", overlay.Name,
+		)
+		return nil
+	}
+
+	_, tracked := overlay.Annotations[overlaySecretAnnotationPrefix+secretName]
+	if len(remaining) == len(overlay.Spec.Servers) && !tracked {
+		return nil
+	}
+	overlay.Spec.Servers = remaining
+	delete(overlay.Annotations, overlaySecretAnnotationPrefix+secretName)
+	if err := r.Update(ctx, overlay); err != nil {
+		return fmt.Errorf("failed to update overlay Gateway: %w", err)
+	}
+	logger.Info("Removed secret servers from overlay Gateway",
+		"gatewayName", gateway.Name,
+		"gatewayNamespace", gateway.Namespace,
+		"overlayGatewayName", overlay.Name,
+		"secretName", secretName,
+	)
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - buildOverlayServers(gateway, secretName, secretNamespace, hosts, tempCredentialName, manageHTTPSRedirect) []*Server
+ *   Формирует серверы overlay Gateway: HTTPS серверы с временным секретом и HTTP серверы доменов сертификата без редиректа
+ *
+ * - isOverlayServerFor(server, secretName) bool
+ *   Проверяет, создан ли сервер overlay Gateway для указанного секрета
+ *
+ * - credentialNameMatches(credentialName, secretName, secretNamespace) bool
+ *   Проверяет, ссылается ли credentialName ("name" или "namespace/name") на секрет
+ */
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+// buildOverlayServers формирует серверы overlay Gateway для секрета
+// HTTPS и TLS серверы с оригинальным секретом копируются с временным секретом (если tempCredentialName задан),
+// HTTP серверы с httpsRedirect, hosts которых пересекаются с hosts, копируются без TLS настроек
+// (если политика разрешает управлять редиректом). Серверы определяются по протоколу, а не по номеру порта.
+// Имя сервера <секрет>-<индекс сервера в Gateway пользователя> связывает его с секретом
+func buildOverlayServers(gateway *istionetworkingv1beta1.Gateway, secretName, secretNamespace string, hosts []string, tempCredentialName string, manageHTTPSRedirect bool) []*istioapinetworkingv1beta1.Server {
+	var servers []*istioapinetworkingv1beta1.Server
+	for i, server := range gateway.Spec.Servers {
+		if server.Port == nil || server.Tls == nil {
+			continue
+		}
+
+		var overlayServer *istioapinetworkingv1beta1.Server
+		switch {
+		case isTLSTerminatingServer(server) && tempCredentialName != "" &&
+			credentialNameMatches(server.Tls.CredentialName, secretName, secretNamespace):
+			overlayServer = server.DeepCopy()
+			overlayServer.Tls.CredentialName = tempCredentialName
+		case isHTTPServer(server) && manageHTTPSRedirect && server.Tls.HttpsRedirect && serverHostsOverlap(server.Hosts, hosts):
+			overlayServer = server.DeepCopy()
+			overlayServer.Tls = nil
+		default:
+			continue
+		}
+		overlayServer.Name = fmt.Sprintf("%s-%d", secretName, i)
+		servers = append(servers, overlayServer)
+	}
+
+	// HTTP серверы нужны только вместе с временным секретом или при отключенном временном сертификате
+	if tempCredentialName != "" {
+		hasHTTPS := false
+		for _, server := range servers {
+			if server.Tls != nil {
+				hasHTTPS = true
+				break
+			}
+		}
+		if !hasHTTPS {
+			return nil
+		}
+	}
+	return servers
+}
+
+// isOverlayServerFor проверяет, создан ли сервер overlay Gateway для секрета (имя <секрет>-<индекс>)
+func isOverlayServerFor(server *istioapinetworkingv1beta1.Server, secretName string) bool {
+	index, found := strings.CutPrefix(server.GetName(), secretName+"-")
+	if !found {
+		return false
+	}
+	_, err := strconv.Atoi(index)
+	return err == nil
+}
+
+// credentialNameMatches проверяет, ссылается ли credentialName на секрет
+// credentialName может быть в формате "name" или "namespace/name"
+func credentialNameMatches(credentialName, secretName, secretNamespace string) bool {
+	if namespace, name, found := strings.Cut(credentialName, "/"); found {
+		return namespace == secretNamespace && name == secretName
+	}
+	return credentialName == secretName
+}
@@ -0,0 +1,56 @@
+/*
+ * Тесты overlay Gateway режима Overlay (certificate_overlay_servers.go):
+ *
+ * - buildOverlayServers: HTTPS сервер с временным секретом и HTTP сервер без редиректа
+ * - buildOverlayServers: без временного сертификата и без серверов секрета
+ * - isOverlayServerFor: серверы секретов с общим префиксом имени не путаются
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+)
+
+var _ = Describe("Overlay Gateway", func() {
+	It("copies the secret servers with the temporary secret and without httpsRedirect", func() {
+		gateway := newTestGateway("app", "public", "app.example.com", "app-tls")
+
+		servers := buildOverlayServers(gateway, "app-tls", "app", []string{"app.example.com"}, "app-tls-temp", true)
+		Expect(servers).To(HaveLen(2))
+		Expect(servers[0].Name).To(Equal("app-tls-0"))
+		Expect(servers[0].Port.Number).To(BeEquivalentTo(80))
+		Expect(servers[0].Tls).To(BeNil())
+		Expect(servers[0].Hosts).To(Equal([]string{"app.example.com"}))
+		Expect(servers[1].Name).To(Equal("app-tls-1"))
+		Expect(servers[1].Tls.CredentialName).To(Equal("app-tls-temp"))
+
+		By("leaving the user Gateway unchanged")
+		Expect(gateway.Spec.Servers[0].Tls.HttpsRedirect).To(BeTrue())
+		Expect(gateway.Spec.Servers[1].Tls.CredentialName).To(Equal("app-tls"))
+	})
+
+	It("builds only HTTP servers without a temporary certificate", func() {
+		gateway := newTestGateway("app", "public", "app.example.com", "app-tls")
+
+		servers := buildOverlayServers(gateway, "app-tls", "app", []string{"app.example.com"}, "", true)
+		Expect(servers).To(HaveLen(1))
+		Expect(servers[0].Port.Number).To(BeEquivalentTo(80))
+
+		Expect(buildOverlayServers(gateway, "app-tls", "app", []string{"app.example.com"}, "", false)).To(BeEmpty())
+	})
+
+	It("builds nothing for Gateways without the secret", func() {
+		gateway := newTestGateway("app", "public", "app.example.com", "other-tls")
+		Expect(buildOverlayServers(gateway, "app-tls", "app", []string{"app.example.com"}, "app-tls-temp", true)).To(BeEmpty())
+	})
+
+	It("tells servers of secrets with a common name prefix apart", func() {
+		server := &istioapinetworkingv1beta1.Server{Name: "app-tls-www-1"}
+		Expect(isOverlayServerFor(server, "app-tls-www")).To(BeTrue())
+		Expect(isOverlayServerFor(server, "app-tls")).To(BeFalse())
+	})
+})
@@ -0,0 +1,243 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - httpsRedirectRouteName(secretName) string
+ *   Возвращает имя маршрута редиректа на HTTPS, добавленного для секрета сертификата
+ *
+ * - buildHTTPSRedirectRoute(secretName) *HTTPRoute
+ *   Формирует маршрут, перенаправляющий запросы по HTTP на HTTPS (кроме маршрутов challenge перед ним)
+ *
+ * - isHTTPSRedirectRoute(route) bool
+ *   Проверяет, является ли маршрут VirtualService хоста редиректом на HTTPS режима ChallengePath
+ *
+ * - (r *CertificateReconciler) ensureChallengePathRedirect(ctx, gateway, cert) (bool, error)
+ *   Добавляет маршрут редиректа на HTTPS в VirtualService хостов сертификата перед отключением httpsRedirect
+ *
+ * - (r *CertificateReconciler) virtualServicesForHosts(ctx, gateway, hosts) ([]string, error)
+ *   Возвращает VirtualService пользователя, привязанные к Gateway и обслуживающие хосты сертификата
+ *
+ * - (r *CertificateReconciler) removeChallengePathRedirect(ctx, gateway, secretName) error
+ *   Удаляет маршруты редиректа секрета из VirtualService хостов после восстановления httpsRedirect
+ *
+ * Istio выполняет httpsRedirect сервера до маршрутизации, поэтому исключить путь challenge из него нельзя.
+ * В режиме ChallengePath Http01Policy редирект переносится в VirtualService хоста, где маршруты токенов
+ * challenge стоят перед ним (см. solverRouteRank). Если хост обслуживает и VirtualService пользователя,
+ * режим не применяется: Istio объединяет маршруты VirtualService хоста в порядке создания, и маршруты
+ * пользователя отдали бы сайт по HTTP раньше редиректа
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+const (
+	// httpsRedirectRoutePrefix префикс имени маршрута редиректа на HTTPS в VirtualService хоста
+	httpsRedirectRoutePrefix = "istio-http01-https-redirect-"
+)
+
+// httpsRedirectRouteName возвращает имя маршрута редиректа, добавленного для секрета сертификата
+func httpsRedirectRouteName(secretName string) string {
+	return httpsRedirectRoutePrefix + secretName
+}
+
+// buildHTTPSRedirectRoute формирует маршрут, перенаправляющий все запросы по HTTP на HTTPS
+// Маршрут совпадает только со схемой http, чтобы HTTPS сервер того же Gateway не зациклился
+func buildHTTPSRedirectRoute(secretName string) *istioapinetworkingv1beta1.HTTPRoute {
+	return &istioapinetworkingv1beta1.HTTPRoute{
+		Name: httpsRedirectRouteName(secretName),
+		Match: []*istioapinetworkingv1beta1.HTTPMatchRequest{{
+			Scheme: &istioapinetworkingv1beta1.StringMatch{
+				MatchType: &istioapinetworkingv1beta1.StringMatch_Exact{Exact: "http"},
+			},
+		}},
+		Redirect: &istioapinetworkingv1beta1.HTTPRedirect{
+			Scheme:       "https",
+			RedirectCode: 301,
+		},
+	}
+}
+
+// isHTTPSRedirectRoute проверяет, является ли маршрут редиректом на HTTPS, добавленным оператором
+func isHTTPSRedirectRoute(route *istioapinetworkingv1beta1.HTTPRoute) bool {
+	return route.GetRedirect() != nil && strings.HasPrefix(route.GetName(), httpsRedirectRoutePrefix)
+}
+
+// ensureChallengePathRedirect добавляет маршрут редиректа на HTTPS в VirtualService хостов сертификата
+// Вызывается до отключения httpsRedirect на сервере, чтобы сайт ни в какой момент не открывался по HTTP.
+// VirtualService хоста общий с маршрутами challenge (solverVirtualServiceName): маршруты токенов стоят перед
+// редиректом. Owner reference на Service солверов снимаются - пока есть редирект, VirtualService удаляет Certificate.
+// Возвращает false, если хосты обслуживают VirtualService пользователя: редирект не добавляется,
+// на Gateway создается Warning событие, и httpsRedirect отключать нельзя
+func (r *CertificateReconciler) ensureChallengePathRedirect(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, cert *certmanagerv1.Certificate) (bool, error) {
+	logger := log.FromContext(ctx)
+	route := buildHTTPSRedirectRoute(cert.Spec.SecretName)
+
+	// Wildcard домены не выпускаются через HTTP01
+	hosts := slices.DeleteFunc(slices.Clone(certificateHosts(cert)), func(host string) bool {
+		return strings.HasPrefix(host, "*")
+	})
+	virtualServices, err := r.virtualServicesForHosts(ctx, gateway, hosts)
+	if err != nil {
+		return false, err
+	}
+	if len(virtualServices) > 0 {
+		recordEvent(r.Recorder, gateway, corev1.EventTypeWarning, eventReasonChallengePathRefused,
+			"httpsRedirectMode ChallengePath cannot be applied to %s: VirtualServices %s also serve these hosts and their routes are merged before the redirect; httpsRedirect is kept",
+			strings.Join(hosts, ", "), strings.Join(virtualServices, ", "))
+		logger.Info("VirtualServices of the certificate hosts would bypass the HTTPS redirect, keeping httpsRedirect",
+			"gatewayName", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+			"certificate", cert.Name,
+			"virtualServices", virtualServices,
+		)
+		return false, nil
+	}
+
+	for _, host := range hosts {
+		if err := adoptLegacySolverVirtualService(ctx, r.Client, gateway.Namespace, host); err != nil {
+			return false, err
+		}
+		vs := &istionetworkingv1beta1.VirtualService{}
+		key := client.ObjectKey{Name: solverVirtualServiceName(host), Namespace: gateway.Namespace}
+		err := r.Get(ctx, key, vs)
+		if apierrors.IsNotFound(err) {
+			vs = &istionetworkingv1beta1.VirtualService{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      key.Name,
+					Namespace: key.Namespace,
+					Labels: map[string]string{
+						"app.kubernetes.io/managed-by":       "istio-http01",
+						"acme.cert-manager.io/http01-solver": http01SolverLabelValue,
+					},
+				},
+				Spec: istioapinetworkingv1beta1.VirtualService{
+					Hosts:    []string{host},
+					Gateways: []string{gateway.Name},
+					Http:     []*istioapinetworkingv1beta1.HTTPRoute{route},
+				},
+			}
+			if err := r.Create(ctx, vs); err != nil {
+				return false, fmt.Errorf("failed to create VirtualService %s/%s: %w", key.Namespace, key.Name, err)
+			}
+			logger.Info("Created VirtualService with HTTPS redirect outside the challenge path",
+				"virtualService", key.Name,
+				"virtualServiceNamespace", key.Namespace,
+				"host", host,
+			)
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to get VirtualService %s/%s: %w", key.Namespace, key.Name, err)
+		}
+
+		changed := false
+		if !slices.ContainsFunc(vs.Spec.Http, func(existing *istioapinetworkingv1beta1.HTTPRoute) bool {
+			return existing.GetName() == route.Name
+		}) {
+			vs.Spec.Http = append(vs.Spec.Http, route.DeepCopy())
+			slices.SortStableFunc(vs.Spec.Http, func(a, b *istioapinetworkingv1beta1.HTTPRoute) int {
+				return solverRouteRank(a) - solverRouteRank(b)
+			})
+			vs.SetOwnerReferences(nil)
+			changed = true
+		}
+		if !slices.Contains(vs.Spec.Gateways, gateway.Name) &&
+			!slices.Contains(vs.Spec.Gateways, gateway.Namespace+"/"+gateway.Name) {
+			vs.Spec.Gateways = append(vs.Spec.Gateways, gateway.Name)
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if err := r.Update(ctx, vs); err != nil {
+			return false, fmt.Errorf("failed to update VirtualService %s/%s: %w", key.Namespace, key.Name, err)
+		}
+		logger.Info("Added HTTPS redirect outside the challenge path to VirtualService",
+			"virtualService", key.Name,
+			"virtualServiceNamespace", key.Namespace,
+			"host", host,
+		)
+	}
+	return true, nil
+}
+
+// virtualServicesForHosts возвращает "namespace/name" VirtualService пользователя, привязанных к Gateway
+// (индекс spec.gateways), hosts которых совпадают с хостами сертификата точно или по wildcard
+func (r *CertificateReconciler) virtualServicesForHosts(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, hosts []string) ([]string, error) {
+	virtualServiceList := &istionetworkingv1beta1.VirtualServiceList{}
+	if err := r.List(ctx, virtualServiceList, client.MatchingFields{
+		virtualServiceGatewayIndex: gateway.Namespace + "/" + gateway.Name,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list VirtualServices: %w", err)
+	}
+
+	var virtualServices []string
+	for _, vs := range virtualServiceList.Items {
+		if vs.Labels["app.kubernetes.io/managed-by"] == istioHTTP01ManagedByLabel {
+			continue
+		}
+		if slices.ContainsFunc(hosts, func(host string) bool {
+			_, _, ok := matchVirtualServiceHosts(host, vs.Spec.Hosts)
+			return ok
+		}) {
+			virtualServices = append(virtualServices, vs.Namespace+"/"+vs.Name)
+		}
+	}
+	slices.Sort(virtualServices)
+	return virtualServices, nil
+}
+
+// removeChallengePathRedirect удаляет маршруты редиректа секрета из VirtualService оператора в namespace Gateway
+// VirtualService без маршрутов удаляется, маршруты challenge остальных подов сохраняются
+func (r *CertificateReconciler) removeChallengePathRedirect(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, secretName string) error {
+	logger := log.FromContext(ctx)
+	routeName := httpsRedirectRouteName(secretName)
+
+	virtualServiceList := &istionetworkingv1beta1.VirtualServiceList{}
+	if err := r.List(ctx, virtualServiceList, client.InNamespace(gateway.Namespace), client.MatchingLabels{
+		"app.kubernetes.io/managed-by":       "istio-http01",
+		"acme.cert-manager.io/http01-solver": http01SolverLabelValue,
+	}); err != nil {
+		return fmt.Errorf("failed to list VirtualServices: %w", err)
+	}
+
+	for _, vs := range virtualServiceList.Items {
+		routes := slices.DeleteFunc(slices.Clone(vs.Spec.Http), func(route *istioapinetworkingv1beta1.HTTPRoute) bool {
+			return route.GetName() == routeName
+		})
+		if len(routes) == len(vs.Spec.Http) {
+			continue
+		}
+		vs.Spec.Http = routes
+
+		if len(routes) == 0 {
+			if err := r.Delete(ctx, vs); client.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("failed to delete VirtualService %s/%s: %w", vs.Namespace, vs.Name, err)
+			}
+		} else if err := r.Update(ctx, vs); err != nil {
+			return fmt.Errorf("failed to update VirtualService %s/%s: %w", vs.Namespace, vs.Name, err)
+		}
+		logger.Info("Removed HTTPS redirect route from VirtualService",
+			"virtualService", vs.Name,
+			"virtualServiceNamespace", vs.Namespace,
+			"secretName", secretName,
+			"virtualServiceDeleted", len(routes) == 0,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+ * Тесты режима ChallengePath (certificate_redirect.go):
+ *
+ * - редирект переносится в VirtualService хоста оператора, и httpsRedirect отключается
+ * - VirtualService пользователя для того же хоста: режим не применяется, httpsRedirect сохраняется
+ *   (и при отключении, и при замене секрета временным), на Gateway создается Warning событие
+ * - restoreGatewayOriginalSecret возвращает ошибку удаления маршрутов редиректа (finalizer остается)
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+var _ = Describe("ChallengePath HTTPS redirect", func() {
+	const host = "app.example.com"
+
+	var (
+		gateway *istionetworkingv1beta1.Gateway
+		cert    *certmanagerv1.Certificate
+		policy  *http01v1alpha1.Http01Policy
+	)
+
+	BeforeEach(func() {
+		gateway = newTestGateway("app", "public", host, "app-tls")
+		cert = &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "app"},
+			Spec:       certmanagerv1.CertificateSpec{SecretName: "app-tls", DNSNames: []string{host}},
+		}
+		policy = &http01v1alpha1.Http01Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "challenge-path", Namespace: "app"},
+			Spec:       http01v1alpha1.Http01PolicySpec{HTTPSRedirectMode: http01v1alpha1.HTTPSRedirectModeChallengePath},
+		}
+	})
+
+	disable := func(objects ...client.Object) (client.Client, *record.FakeRecorder) {
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+			WithObjects(append([]client.Object{gateway, cert, policy}, objects...)...).
+			WithIndex(&istionetworkingv1beta1.VirtualService{}, virtualServiceGatewayIndex, virtualServiceGatewayRefs).
+			Build()
+		recorder := record.NewFakeRecorder(10)
+		r := &CertificateReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder}
+		Expect(r.disableHTTPSRedirectForHTTP01(testCtx, gateway, cert)).To(Succeed())
+		return c, recorder
+	}
+
+	httpsRedirect := func(c client.Client) bool {
+		updated := &istionetworkingv1beta1.Gateway{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(gateway), updated)).To(Succeed())
+		return updated.Spec.Servers[0].Tls.GetHttpsRedirect()
+	}
+
+	It("moves the redirect into the host VirtualService before disabling httpsRedirect", func() {
+		c, _ := disable()
+
+		vs := &istionetworkingv1beta1.VirtualService{}
+		Expect(c.Get(testCtx, client.ObjectKey{Namespace: "app", Name: solverVirtualServiceName(host)}, vs)).To(Succeed())
+		Expect(vs.Spec.Http).To(HaveLen(1))
+		Expect(isHTTPSRedirectRoute(vs.Spec.Http[0])).To(BeTrue())
+		Expect(httpsRedirect(c)).To(BeFalse())
+	})
+
+	It("keeps httpsRedirect when an older application VirtualService serves the host", func() {
+		app := newTestVirtualService("app", "app", host, gateway.Name)
+		app.CreationTimestamp = metav1.NewTime(metav1.Now().AddDate(0, -1, 0))
+		c, recorder := disable(app)
+
+		Expect(httpsRedirect(c)).To(BeTrue())
+		err := c.Get(testCtx, client.ObjectKey{Namespace: "app", Name: solverVirtualServiceName(host)}, &istionetworkingv1beta1.VirtualService{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(recorder.Events).To(Receive(And(
+			ContainSubstring(eventReasonChallengePathRefused),
+			ContainSubstring("app/app"),
+		)))
+	})
+
+	It("swaps the temporary secret but keeps httpsRedirect when an application VirtualService serves the host", func() {
+		app := newTestVirtualService("app", "app", host, gateway.Name)
+		c := fake.NewClientBuilder().WithScheme(newTestHSTSScheme()).
+			WithObjects(gateway, cert, policy, app).
+			WithIndex(&certmanagerv1.Certificate{}, certificateSecretNameIndex, certificateSecretName).
+			WithIndex(&istionetworkingv1beta1.VirtualService{}, virtualServiceGatewayIndex, virtualServiceGatewayRefs).
+			Build()
+		recorder := record.NewFakeRecorder(10)
+		r := &CertificateReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder}
+
+		Expect(r.updateGatewayWithTemporarySecret(testCtx, gateway, cert, "app-tls", "app-tls-temp", "app")).To(Succeed())
+
+		updated := &istionetworkingv1beta1.Gateway{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(gateway), updated)).To(Succeed())
+		Expect(updated.Spec.Servers[1].Tls.CredentialName).To(Equal("app-tls-temp"))
+		Expect(updated.Spec.Servers[0].Tls.GetHttpsRedirect()).To(BeTrue())
+		Expect(recorder.Events).To(Receive(And(
+			ContainSubstring(eventReasonChallengePathRefused),
+			ContainSubstring("app/app"),
+		)))
+	})
+
+	It("returns the error of removing redirect routes from the rollback", func() {
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+			WithObjects(gateway, cert, policy).
+			WithInterceptorFuncs(interceptor.Funcs{
+				List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+					if _, ok := list.(*istionetworkingv1beta1.VirtualServiceList); ok {
+						return errors.New("cache is not synced")
+					}
+					return c.List(ctx, list, opts...)
+				},
+			}).
+			Build()
+		r := &CertificateReconciler{Client: c, Scheme: c.Scheme()}
+
+		Expect(r.restoreGatewayOriginalSecret(testCtx, gateway, cert.Spec.SecretName, cert.Namespace)).
+			To(MatchError(ContainSubstring("cache is not synced")))
+	})
+})
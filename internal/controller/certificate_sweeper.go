@@ -0,0 +1,124 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) sweepOrphanedTemporaryResources(ctx) error
+ *   Удаляет временные Certificate, Issuer и EnvoyFilter оператора, оригинальный Certificate которых удален
+ *
+ * - (r *CertificateReconciler) sweepOrphanedTemporaryObjects(ctx, list, suffix) (int, error)
+ *   Удаляет временные Certificate или Issuer без owner reference, оригинальный Certificate которых удален
+ *
+ * - (r *CertificateReconciler) certificateExists(ctx, namespace, name) (bool, error)
+ *   Проверяет, существует ли Certificate
+ *
+ * Очистка ресурсов Gateway (EnvoyFilter отключения HSTS, серверы overlay Gateway) - в certificate_sweeper_gateway.go
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// temporaryObjectLabels метки временных ресурсов, созданных оператором
+var temporaryObjectLabels = client.MatchingLabels{
+	"app.kubernetes.io/managed-by": "istio-http01",
+	"istio-http01.rieset.io/temp":  tempLabelValue,
+}
+
+// sweepOrphanedTemporaryResources удаляет временные ресурсы, оригинальный Certificate которых удален
+// Ресурсы в namespace сертификата удаляет GC по owner reference; sweeper нужен для EnvoyFilter Gateway
+// из другого namespace и для ресурсов, созданных версиями оператора без owner reference.
+// Запускается при старте оператора (после удаления Certificate откат выполняет finalizer gateway-restore)
+func (r *CertificateReconciler) sweepOrphanedTemporaryResources(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	certificates, err := r.sweepOrphanedTemporaryObjects(ctx, &certmanagerv1.CertificateList{}, "-temp-selfsigned")
+	if err != nil {
+		return err
+	}
+	issuers, err := r.sweepOrphanedTemporaryObjects(ctx, &certmanagerv1.IssuerList{}, "-temp-selfsigned-issuer")
+	if err != nil {
+		return err
+	}
+	envoyFilters, err := r.sweepOrphanedEnvoyFilters(ctx)
+	if err != nil {
+		return err
+	}
+	overlaySecrets, err := r.sweepOrphanedOverlayGateways(ctx)
+	if err != nil {
+		return err
+	}
+
+	if certificates+issuers+envoyFilters+overlaySecrets > 0 {
+		logger.Info("Swept orphaned temporary resources",
+			"certificates", certificates,
+			"issuers", issuers,
+			"envoyFilters", envoyFilters,
+			"overlaySecrets", overlaySecrets,
+		)
+	}
+	return nil
+}
+
+// sweepOrphanedTemporaryObjects удаляет временные Certificate или Issuer, оригинальный Certificate которых удален
+// Оригинальный Certificate берется из метки original-cert, у ресурсов прежних версий - из имени без suffix
+func (r *CertificateReconciler) sweepOrphanedTemporaryObjects(ctx context.Context, list client.ObjectList, suffix string) (int, error) {
+	if err := r.List(ctx, list, temporaryObjectLabels); err != nil {
+		return 0, fmt.Errorf("failed to list temporary objects: %w", err)
+	}
+	objects, err := meta.ExtractList(list)
+	if err != nil {
+		return 0, fmt.Errorf("failed to extract temporary objects: %w", err)
+	}
+
+	swept := 0
+	for _, item := range objects {
+		obj, ok := item.(client.Object)
+		if !ok || len(obj.GetOwnerReferences()) > 0 {
+			continue
+		}
+
+		originalName := obj.GetLabels()["istio-http01.rieset.io/original-cert"]
+		if originalName == "" {
+			originalName = strings.TrimSuffix(obj.GetName(), suffix)
+		}
+		exists, err := r.certificateExists(ctx, obj.GetNamespace(), originalName)
+		if err != nil {
+			return swept, err
+		}
+		if exists {
+			continue
+		}
+
+		if err := r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return swept, fmt.Errorf("failed to delete orphaned temporary object %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+		}
+		log.FromContext(ctx).Info("Deleted orphaned temporary object",
+			"name", obj.GetName(),
+			"namespace", obj.GetNamespace(),
+			"originalCertificate", originalName,
+		)
+		swept++
+	}
+	return swept, nil
+}
+
+// certificateExists проверяет, существует ли Certificate
+func (r *CertificateReconciler) certificateExists(ctx context.Context, namespace, name string) (bool, error) {
+	err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, &certmanagerv1.Certificate{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get Certificate: %w", err)
+	}
+	return true, nil
+}
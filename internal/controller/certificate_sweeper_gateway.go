@@ -0,0 +1,151 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) sweepOrphanedEnvoyFilters(ctx) (int, error)
+ *   Удаляет EnvoyFilter отключения HSTS без owner reference, Gateway которых удален, и снимает ссылки секретов удаленных Certificate
+ *
+ * - (r *CertificateReconciler) sweepOrphanedOverlayGateways(ctx) (int, error)
+ *   Удаляет из overlay Gateway серверы секретов, которые не выпускает ни один Certificate
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// sweepOrphanedEnvoyFilters удаляет EnvoyFilter отключения HSTS без owner reference, если удален их Gateway,
+// и снимает ссылки аннотации hsts-secrets на секреты, которые не выпускает ни один Certificate (EnvoyFilter прежних версий
+// без ссылок удаляется, если не осталось ни одного Certificate с секретом из метки original-cert)
+func (r *CertificateReconciler) sweepOrphanedEnvoyFilters(ctx context.Context) (int, error) {
+	// Тип v1alpha3.EnvoyFilter не зарегистрирован в схеме
+	envoyFilters := &unstructured.UnstructuredList{}
+	envoyFilters.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "networking.istio.io",
+		Version: "v1alpha3",
+		Kind:    "EnvoyFilterList",
+	})
+	if err := r.List(ctx, envoyFilters, temporaryObjectLabels); err != nil {
+		return 0, fmt.Errorf("failed to list EnvoyFilters: %w", err)
+	}
+
+	swept := 0
+	for i := range envoyFilters.Items {
+		envoyFilter := &envoyFilters.Items[i]
+		if len(envoyFilter.GetOwnerReferences()) > 0 {
+			continue
+		}
+
+		orphaned := false
+		// Имя Gateway - в аннотации hsts-gateway; EnvoyFilter прежних версий назывались disable-hsts-<namespace>-<имя Gateway>
+		gatewayName := envoyFilter.GetAnnotations()[hstsGatewayAnnotation]
+		if gatewayName == "" {
+			gatewayName = strings.TrimPrefix(envoyFilter.GetName(), fmt.Sprintf("disable-hsts-%s-", envoyFilter.GetNamespace()))
+		}
+		gateway := &istionetworkingv1beta1.Gateway{}
+		err := r.Get(ctx, client.ObjectKey{Name: gatewayName, Namespace: envoyFilter.GetNamespace()}, gateway)
+		switch {
+		case apierrors.IsNotFound(err):
+			orphaned = true
+		case err != nil:
+			return swept, fmt.Errorf("failed to get Gateway: %w", err)
+		case len(hstsSecretRefs(envoyFilter.GetAnnotations())) > 0:
+			// Ссылки секретов: снимаем ссылки секретов без Certificate, последняя снятая ссылка удаляет EnvoyFilter
+			for _, secretRef := range hstsSecretRefs(envoyFilter.GetAnnotations()) {
+				secretNamespace, secretName, _ := strings.Cut(secretRef, "/")
+				certificates := &certmanagerv1.CertificateList{}
+				if err := r.List(ctx, certificates, client.InNamespace(secretNamespace), client.MatchingFields{
+					certificateSecretNameIndex: secretName,
+				}); err != nil {
+					return swept, fmt.Errorf("failed to list Certificates: %w", err)
+				}
+				if len(certificates.Items) > 0 {
+					continue
+				}
+				if err := r.deleteEnvoyFilterForHSTS(ctx, gateway, secretRef); err != nil {
+					return swept, err
+				}
+				swept++
+			}
+			continue
+		default:
+			// Метка original-cert содержит имя секрета сертификата, namespace сертификата неизвестен
+			certificates := &certmanagerv1.CertificateList{}
+			if err := r.List(ctx, certificates, client.MatchingFields{
+				certificateSecretNameIndex: envoyFilter.GetLabels()["istio-http01.rieset.io/original-cert"],
+			}); err != nil {
+				return swept, fmt.Errorf("failed to list Certificates: %w", err)
+			}
+			orphaned = len(certificates.Items) == 0
+		}
+		if !orphaned {
+			continue
+		}
+
+		if err := r.Delete(ctx, envoyFilter); client.IgnoreNotFound(err) != nil {
+			return swept, fmt.Errorf("failed to delete orphaned EnvoyFilter %s/%s: %w", envoyFilter.GetNamespace(), envoyFilter.GetName(), err)
+		}
+		hstsEnvoyFiltersActive.DeleteLabelValues(gatewayName, envoyFilter.GetNamespace())
+		log.FromContext(ctx).Info("Deleted orphaned EnvoyFilter",
+			"envoyFilterName", envoyFilter.GetName(),
+			"namespace", envoyFilter.GetNamespace(),
+		)
+		swept++
+	}
+	return swept, nil
+}
+
+// sweepOrphanedOverlayGateways удаляет из overlay Gateway серверы секретов, которые не выпускает ни один Certificate
+// Сам overlay Gateway удаляет GC вместе с Gateway пользователя; без серверов он удаляется removeOverlayGatewayServers
+func (r *CertificateReconciler) sweepOrphanedOverlayGateways(ctx context.Context) (int, error) {
+	overlays := &istionetworkingv1beta1.GatewayList{}
+	if err := r.List(ctx, overlays, temporaryObjectLabels); err != nil {
+		return 0, fmt.Errorf("failed to list overlay Gateways: %w", err)
+	}
+
+	swept := 0
+	for _, overlay := range overlays.Items {
+		if !isOverlayGateway(overlay) {
+			continue
+		}
+		gateway := &istionetworkingv1beta1.Gateway{}
+		if err := r.Get(ctx, client.ObjectKey{Name: overlay.Labels[overlayGatewayLabel], Namespace: overlay.Namespace}, gateway); err != nil {
+			// Gateway пользователя удален - overlay Gateway удалит GC
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return swept, fmt.Errorf("failed to get Gateway: %w", err)
+		}
+
+		for key, secretNamespace := range overlay.Annotations {
+			secretName, found := strings.CutPrefix(key, overlaySecretAnnotationPrefix)
+			if !found {
+				continue
+			}
+			certificates := &certmanagerv1.CertificateList{}
+			if err := r.List(ctx, certificates, client.InNamespace(secretNamespace), client.MatchingFields{
+				certificateSecretNameIndex: secretName,
+			}); err != nil {
+				return swept, fmt.Errorf("failed to list Certificates: %w", err)
+			}
+			if len(certificates.Items) > 0 {
+				continue
+			}
+			if err := r.removeOverlayGatewayServers(ctx, gateway, secretName); err != nil {
+				return swept, err
+			}
+			swept++
+		}
+	}
+	return swept, nil
+}
@@ -1,11 +1,17 @@
 /*
  * Функции, определенные в этом файле:
  *
- * - (r *CertificateReconciler) createSelfSignedCertificate(ctx, cert, gateway) error
- *   Создает самоподписанный сертификат для Gateway когда основной не готов
+ * - (r *CertificateReconciler) createTemporaryCertificate(ctx, cert, gateway) error
+ *   Создает временный сертификат для Gateway когда основной не готов (источник задает Http01Policy)
+ *
+ * - (r *CertificateReconciler) createTemporaryCertificateResources(ctx, cert, gateway, extraDomains, duration, issuerRef) error
+ *   Создает временный Certificate (и self-signed Issuer, если issuer не задан) для DNS имен сертификата и дополнительных доменов
+ *
+ * - (r *CertificateReconciler) createTemporarySelfSignedIssuer(ctx, cert) (*ObjectReference, error)
+ *   Создает одноразовый self-signed Issuer временного сертификата
  *
  * - (r *CertificateReconciler) deleteTemporarySelfSignedCertificate(ctx, cert) error
- *   Удаляет временный самоподписанный сертификат и issuer
+ *   Удаляет временный сертификат, self-signed issuer и скопированный временный секрет
  *
  * - (r *CertificateReconciler) ensureTemporaryCertificateSetup(ctx, cert, gateway) error
  *   Проверяет и восстанавливает состояние временного сертификата, httpRedirect и EnvoyFilter
@@ -17,18 +23,21 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	certmanagermetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
 	istionetworkingv1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
 	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-// createSelfSignedCertificate создает самоподписанный сертификат для Gateway
-func (r *CertificateReconciler) createSelfSignedCertificate(ctx context.Context, cert *certmanagerv1.Certificate, gateway *istionetworkingv1beta1.Gateway) error {
+// createTemporaryCertificate создает временный сертификат для Gateway из источника Http01Policy
+func (r *CertificateReconciler) createTemporaryCertificate(ctx context.Context, cert *certmanagerv1.Certificate, gateway *istionetworkingv1beta1.Gateway) error {
 	logger := log.FromContext(ctx)
 
 	// Проверяем, что Gateway действительно связан с этим сертификатом
@@ -48,15 +57,24 @@ func (r *CertificateReconciler) createSelfSignedCertificate(ctx context.Context,
 		return fmt.Errorf("gateway %s/%s is not related to certificate %s", gateway.Namespace, gateway.Name, cert.Name)
 	}
 
+	// Источник и срок действия временного сертификата задаются Http01Policy Gateway
+	policy, err := resolveHTTP01Policy(ctx, r.Client, gateway)
+	if err != nil {
+		return err
+	}
+
 	// Проверяем, не создан ли уже временный сертификат
-	tempCertName := fmt.Sprintf("%s-temp-selfsigned", cert.Name)
-	tempCert := &certmanagerv1.Certificate{}
-	if err := r.Get(ctx, client.ObjectKey{
-		Name:      tempCertName,
-		Namespace: cert.Namespace,
-	}, tempCert); err == nil {
+	credential, err := r.getTemporaryCredential(ctx, cert)
+	if err != nil {
+		return err
+	}
+	if credential != nil {
+		// Копия секрета источника Secret следует за ротацией этого секрета
+		if err := r.refreshFallbackSecret(ctx, cert, gateway, policy); err != nil {
+			return err
+		}
 		// Временный сертификат уже существует - проверяем, готов ли он
-		if r.isCertificateReady(tempCert) {
+		if credential.Ready {
 			// Временный сертификат готов - обновляем Gateway, если еще не обновлен
 			if err := r.updateGatewayWithTemporarySecret(ctx, gateway, cert, cert.Spec.SecretName, tempSecretName, cert.Namespace); err != nil {
 				logger.Error(err, "failed to update Gateway with temporary secret",
@@ -79,35 +97,6 @@ func (r *CertificateReconciler) createSelfSignedCertificate(ctx context.Context,
 		return nil
 	}
 
-	// Создаем временный Issuer с self-signed типом
-	issuerName := fmt.Sprintf("%s-temp-selfsigned-issuer", cert.Name)
-	issuer := &certmanagerv1.Issuer{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      issuerName,
-			Namespace: cert.Namespace,
-			Labels: map[string]string{
-				"app.kubernetes.io/managed-by": "istio-http01",
-				"istio-http01.rieset.io/temp":  tempLabelValue,
-			},
-		},
-		Spec: certmanagerv1.IssuerSpec{
-			IssuerConfig: certmanagerv1.IssuerConfig{
-				SelfSigned: &certmanagerv1.SelfSignedIssuer{},
-			},
-		},
-	}
-
-	// Создаем Issuer
-	if err := r.Create(ctx, issuer); err != nil {
-		if !strings.Contains(err.Error(), "already exists") {
-			return fmt.Errorf("failed to create self-signed issuer: %w", err)
-		}
-		logger.V(1).Info("Self-signed issuer already exists",
-			"issuerName", issuerName,
-			"namespace", cert.Namespace,
-		)
-	}
-
 	// Получаем домены Gateway из связанных VirtualService
 	// Временный сертификат должен покрывать все домены Gateway, а не только DNS имена из оригинального сертификата
 	gatewayDomains, err := r.getDomainsForGateway(ctx, gateway)
@@ -120,13 +109,71 @@ func (r *CertificateReconciler) createSelfSignedCertificate(ctx context.Context,
 		gatewayDomains = cert.Spec.DNSNames
 	}
 
-	// Объединяем домены Gateway и DNS имена из сертификата, чтобы покрыть все возможные домены
+	if err := r.provisionTemporaryCredential(ctx, cert, gateway, gatewayDomains, policy); err != nil {
+		return err
+	}
+
+	logger.Info("Created temporary certificate for Gateway",
+		"certificateName", cert.Name,
+		"source", policy.TemporaryCertificateSource.Type,
+		"gatewayName", gateway.Name,
+		"gatewayNamespace", gateway.Namespace,
+		"tempSecretName", tempSecretName,
+	)
+
+	// Создаем EnvoyFilter СРАЗУ при создании временного сертификата, ДО того как он станет готовым
+	// Это предотвращает кеширование HSTS заголовка браузером при первом обращении
+	// EnvoyFilter будет активен с момента создания, даже если временный сертификат еще не готов
+	if err := r.createEnvoyFilterToDisableHSTS(ctx, gateway, cert); err != nil {
+		logger.Error(err, "failed to create EnvoyFilter to disable HSTS (will retry later)",
+			"gatewayName", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+		)
+		// Не возвращаем ошибку, так как EnvoyFilter будет создан при следующей реконсиляции
+	}
+
+	// Получаем созданный сертификат из кластера для проверки готовности
+	// Скопированный секрет готов сразу, Certificate - после выпуска cert-manager
+	if credential, err := r.getTemporaryCredential(ctx, cert); err == nil && credential != nil {
+		// Проверяем готовность временного сертификата и обновляем Gateway, если готов
+		// Если не готов, обновление произойдет при следующей реконсиляции
+		if credential.Ready {
+			if err := r.updateGatewayWithTemporarySecret(ctx, gateway, cert, cert.Spec.SecretName, tempSecretName, cert.Namespace); err != nil {
+				logger.Error(err, "failed to update Gateway with temporary secret",
+					"gatewayName", gateway.Name,
+					"gatewayNamespace", gateway.Namespace,
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
+// createTemporaryCertificateResources создает временный Certificate, покрывающий DNS имена оригинального
+// сертификата и дополнительные домены. Без issuerRef сертификат выпускает одноразовый self-signed Issuer;
+// имя Certificate <cert>-temp-selfsigned сохраняется для любого issuer ради совместимости
+func (r *CertificateReconciler) createTemporaryCertificateResources(ctx context.Context, cert *certmanagerv1.Certificate, gateway client.Object, extraDomains []string, duration time.Duration, issuerRef *certmanagermetav1.ObjectReference) error {
+	logger := log.FromContext(ctx)
+
+	tempCertName := fmt.Sprintf("%s-temp-selfsigned", cert.Name)
+	tempSecretName := fmt.Sprintf("%s-temp", cert.Spec.SecretName)
+
+	if issuerRef == nil {
+		ref, err := r.createTemporarySelfSignedIssuer(ctx, cert)
+		if err != nil {
+			return err
+		}
+		issuerRef = ref
+	}
+
+	// Объединяем дополнительные домены и DNS имена из сертификата, чтобы покрыть все возможные домены
 	// Используем map для исключения дубликатов
 	allDNSNames := make(map[string]bool)
 	for _, dnsName := range cert.Spec.DNSNames {
 		allDNSNames[dnsName] = true
 	}
-	for _, domain := range gatewayDomains {
+	for _, domain := range extraDomains {
 		allDNSNames[domain] = true
 	}
 
@@ -137,12 +184,19 @@ func (r *CertificateReconciler) createSelfSignedCertificate(ctx context.Context,
 	}
 
 	logger.Info("Creating temporary certificate with DNS names from Gateway and Certificate",
-		"gatewayDomains", gatewayDomains,
+		"gatewayDomains", extraDomains,
 		"certificateDNSNames", cert.Spec.DNSNames,
 		"combinedDNSNames", dnsNamesList,
 	)
 
-	// Создаем временный Certificate с self-signed issuer
+	// Обновление за 1 час до истечения; для коротких сертификатов - на середине срока,
+	// так как cert-manager требует renewBefore меньше duration
+	renewBefore := time.Hour
+	if duration <= 2*time.Hour {
+		renewBefore = duration / 2
+	}
+
+	// Создаем временный Certificate
 	tempCertificate := &certmanagerv1.Certificate{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      tempCertName,
@@ -157,70 +211,99 @@ func (r *CertificateReconciler) createSelfSignedCertificate(ctx context.Context,
 			SecretName:  tempSecretName,
 			DNSNames:    dnsNamesList,
 			CommonName:  cert.Spec.CommonName,
-			Duration:    &metav1.Duration{Duration: 24 * 60 * 60 * 1000000000}, // 24 часа
-			RenewBefore: &metav1.Duration{Duration: 1 * 60 * 60 * 1000000000},  // 1 час до истечения
-			IssuerRef: certmanagermetav1.ObjectReference{
-				Name:  issuerName,
-				Kind:  "Issuer",
-				Group: "cert-manager.io",
-			},
+			Duration:    &metav1.Duration{Duration: duration},
+			RenewBefore: &metav1.Duration{Duration: renewBefore},
+			IssuerRef:   *issuerRef,
 		},
 	}
+	if err := controllerutil.SetControllerReference(cert, tempCertificate, r.Scheme); err != nil {
+		return fmt.Errorf("failed to set owner reference on temporary certificate: %w", err)
+	}
 
 	// Создаем Certificate
 	if err := r.Create(ctx, tempCertificate); err != nil {
 		if !strings.Contains(err.Error(), "already exists") {
-			return fmt.Errorf("failed to create temporary self-signed certificate: %w", err)
+			return fmt.Errorf("failed to create temporary certificate: %w", err)
 		}
-		logger.V(1).Info("Temporary self-signed certificate already exists",
+		logger.V(1).Info("Temporary certificate already exists",
 			"certificateName", tempCertName,
 			"namespace", cert.Namespace,
 		)
+	} else {
+		temporaryCertificatesIssued.WithLabelValues(gateway.GetName(), gateway.GetNamespace()).Inc()
+		recordEvent(r.Recorder, cert, corev1.EventTypeNormal, eventReasonTemporaryCertificateIssued,
+			"Created temporary certificate %s (secret %s, %s %s) for Gateway %s/%s", tempCertName, tempSecretName, issuerRef.Kind, issuerRef.Name, gateway.GetNamespace(), gateway.GetName())
 	}
 
-	logger.Info("Created temporary self-signed certificate for Gateway",
-		"certificateName", tempCertName,
-		"gatewayName", gateway.Name,
-		"gatewayNamespace", gateway.Namespace,
-		"tempSecretName", tempSecretName,
-	)
+	return nil
+}
 
-	// Создаем EnvoyFilter СРАЗУ при создании временного сертификата, ДО того как он станет готовым
-	// Это предотвращает кеширование HSTS заголовка браузером при первом обращении
-	// EnvoyFilter будет активен с момента создания, даже если временный сертификат еще не готов
-	if err := r.createEnvoyFilterToDisableHSTS(ctx, gateway, cert.Spec.SecretName); err != nil {
-		logger.Error(err, "failed to create EnvoyFilter to disable HSTS (will retry later)",
-			"gatewayName", gateway.Name,
-			"gatewayNamespace", gateway.Namespace,
-		)
-		// Не возвращаем ошибку, так как EnvoyFilter будет создан при следующей реконсиляции
+// createTemporarySelfSignedIssuer создает одноразовый self-signed Issuer временного сертификата
+// и возвращает ссылку на него
+func (r *CertificateReconciler) createTemporarySelfSignedIssuer(ctx context.Context, cert *certmanagerv1.Certificate) (*certmanagermetav1.ObjectReference, error) {
+	logger := log.FromContext(ctx)
+
+	issuerName := fmt.Sprintf("%s-temp-selfsigned-issuer", cert.Name)
+	issuer := &certmanagerv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      issuerName,
+			Namespace: cert.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by":         "istio-http01",
+				"istio-http01.rieset.io/temp":          tempLabelValue,
+				"istio-http01.rieset.io/original-cert": cert.Name,
+			},
+		},
+		Spec: certmanagerv1.IssuerSpec{
+			IssuerConfig: certmanagerv1.IssuerConfig{
+				SelfSigned: &certmanagerv1.SelfSignedIssuer{},
+			},
+		},
+	}
+	// Временные ресурсы всегда в namespace сертификата - GC удалит их вместе с Certificate
+	if err := controllerutil.SetControllerReference(cert, issuer, r.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to set owner reference on self-signed issuer: %w", err)
 	}
 
-	// Получаем созданный сертификат из кластера для проверки готовности
-	createdTempCert := &certmanagerv1.Certificate{}
-	if err := r.Get(ctx, client.ObjectKey{
-		Name:      tempCertName,
-		Namespace: cert.Namespace,
-	}, createdTempCert); err == nil {
-		// Проверяем готовность временного сертификата и обновляем Gateway, если готов
-		// Если не готов, обновление произойдет при следующей реконсиляции
-		if r.isCertificateReady(createdTempCert) {
-			if err := r.updateGatewayWithTemporarySecret(ctx, gateway, cert, cert.Spec.SecretName, tempSecretName, cert.Namespace); err != nil {
-				logger.Error(err, "failed to update Gateway with temporary secret",
-					"gatewayName", gateway.Name,
-					"gatewayNamespace", gateway.Namespace,
-				)
-			}
+	// Создаем Issuer
+	if err := r.Create(ctx, issuer); err != nil {
+		if !strings.Contains(err.Error(), "already exists") {
+			return nil, fmt.Errorf("failed to create self-signed issuer: %w", err)
 		}
+		logger.V(1).Info("Self-signed issuer already exists",
+			"issuerName", issuerName,
+			"namespace", cert.Namespace,
+		)
 	}
 
-	return nil
+	return &certmanagermetav1.ObjectReference{
+		Name:  issuerName,
+		Kind:  "Issuer",
+		Group: "cert-manager.io",
+	}, nil
 }
 
-// deleteTemporarySelfSignedCertificate удаляет временный самоподписанный сертификат и issuer
+// deleteTemporarySelfSignedCertificate удаляет временный сертификат, self-signed issuer
+// и временный секрет, скопированный из источника Secret
 func (r *CertificateReconciler) deleteTemporarySelfSignedCertificate(ctx context.Context, cert *certmanagerv1.Certificate) error {
 	logger := log.FromContext(ctx)
 
+	// Скопированный секрет удаляется только с меткой оператора: секрет временного Certificate принадлежит cert-manager
+	tempSecret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{
+		Name:      fmt.Sprintf("%s-temp", cert.Spec.SecretName),
+		Namespace: cert.Namespace,
+	}, tempSecret); err == nil &&
+		tempSecret.Labels["istio-http01.rieset.io/temp"] == tempLabelValue &&
+		tempSecret.Labels["istio-http01.rieset.io/original-cert"] == cert.Name {
+		if err := r.Delete(ctx, tempSecret); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete temporary secret: %w", err)
+		}
+		logger.Info("Deleted temporary secret copied from fallback secret",
+			"secretName", tempSecret.Name,
+		)
+	}
+
 	tempCertName := fmt.Sprintf("%s-temp-selfsigned", cert.Name)
 	tempCert := &certmanagerv1.Certificate{}
 	if err := r.Get(ctx, client.ObjectKey{
@@ -275,25 +358,39 @@ func (r *CertificateReconciler) deleteTemporarySelfSignedCertificate(ctx context
 func (r *CertificateReconciler) ensureTemporaryCertificateSetup(ctx context.Context, cert *certmanagerv1.Certificate, gateway *istionetworkingv1beta1.Gateway) error {
 	logger := log.FromContext(ctx)
 
-	tempCertName := fmt.Sprintf("%s-temp-selfsigned", cert.Name)
 	tempSecretName := fmt.Sprintf("%s-temp", cert.Spec.SecretName)
-	envoyFilterName := fmt.Sprintf("disable-hsts-%s-%s", gateway.Namespace, gateway.Name)
+	envoyFilterName := r.adoptHSTSEnvoyFilter(ctx, gateway)
 
-	// 1. Проверяем наличие временного сертификата
-	tempCert := &certmanagerv1.Certificate{}
-	tempCertExists := r.Get(ctx, client.ObjectKey{
-		Name:      tempCertName,
-		Namespace: cert.Namespace,
-	}, tempCert) == nil
+	// 0. Определяем настройки Http01Policy для Gateway
+	policy, err := resolveHTTP01Policy(ctx, r.Client, gateway)
+	if err != nil {
+		return err
+	}
+	if !policy.TemporaryCertificateEnabled {
+		// Временный сертификат запрещен политикой - только отключаем httpsRedirect для прохождения challenge
+		logger.V(1).Info("Temporary certificate disabled by Http01Policy",
+			"certificateName", cert.Name,
+			"gatewayName", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+			"policy", policy.PolicyName,
+		)
+		return r.disableHTTPSRedirectForHTTP01(ctx, gateway, cert)
+	}
 
-	if !tempCertExists {
+	// 1. Проверяем наличие временного сертификата (Certificate или скопированного секрета)
+	credential, err := r.getTemporaryCredential(ctx, cert)
+	if err != nil {
+		return err
+	}
+
+	if credential == nil {
 		// Временный сертификат не существует - создаем его
 		logger.Info("Temporary certificate not found, creating it",
 			"certificateName", cert.Name,
 			"gatewayName", gateway.Name,
 			"gatewayNamespace", gateway.Namespace,
 		)
-		if err := r.createSelfSignedCertificate(ctx, cert, gateway); err != nil {
+		if err := r.createTemporaryCertificate(ctx, cert, gateway); err != nil {
 			return fmt.Errorf("failed to create temporary certificate: %w", err)
 		}
 		// После создания сертификата нужно подождать его готовности
@@ -301,10 +398,10 @@ func (r *CertificateReconciler) ensureTemporaryCertificateSetup(ctx context.Cont
 	}
 
 	// 2. Проверяем готовность временного сертификата
-	if !r.isCertificateReady(tempCert) {
+	if !credential.Ready {
 		logger.V(1).Info("Temporary certificate not ready yet, waiting",
 			"certificateName", cert.Name,
-			"tempCertName", tempCertName,
+			"tempSecretName", credential.SecretName,
 		)
 		return nil
 	}
@@ -320,14 +417,8 @@ func (r *CertificateReconciler) ensureTemporaryCertificateSetup(ctx context.Cont
 	}
 	updatedGateway := &istionetworkingv1beta1.Gateway{}
 	if err := r.Get(ctx, gatewayKey, updatedGateway); err == nil {
-		for _, server := range updatedGateway.Spec.Servers {
-			if server.Port != nil && server.Port.Number == 80 && server.Tls != nil {
-				if !server.Tls.HttpsRedirect {
-					httpsRedirectDisabled = true
-					break
-				}
-			}
-		}
+		// Ни на одном HTTP сервере доменов сертификата httpsRedirect не включен
+		httpsRedirectDisabled = !r.hasHTTPSRedirect(updatedGateway, certificateHosts(cert))
 	}
 
 	// 5. Проверяем наличие EnvoyFilter
@@ -347,8 +438,7 @@ func (r *CertificateReconciler) ensureTemporaryCertificateSetup(ctx context.Cont
 		"certificateName", cert.Name,
 		"gatewayName", gateway.Name,
 		"gatewayNamespace", gateway.Namespace,
-		"tempCertExists", tempCertExists,
-		"tempCertReady", r.isCertificateReady(tempCert),
+		"tempCertReady", credential.Ready,
 		"usesTempSecret", usesTempSecret,
 		"httpsRedirectDisabled", httpsRedirectDisabled,
 		"envoyFilterExists", envoyFilterExists,
@@ -369,28 +459,31 @@ func (r *CertificateReconciler) ensureTemporaryCertificateSetup(ctx context.Cont
 		needsUpdate = true
 	}
 
-	// Если httpRedirect не отключен
-	if !httpsRedirectDisabled {
+	// Если httpRedirect не отключен и политика разрешает его менять
+	if !httpsRedirectDisabled && policy.ManageHTTPSRedirect {
 		logger.Info("httpsRedirect not disabled, disabling it",
 			"gatewayName", gateway.Name,
 			"gatewayNamespace", gateway.Namespace,
 		)
-		if err := r.disableHTTPSRedirectForHTTP01(ctx, gateway, cert.Spec.SecretName, cert.Namespace); err != nil {
+		if err := r.disableHTTPSRedirectForHTTP01(ctx, gateway, cert); err != nil {
 			return fmt.Errorf("failed to disable httpsRedirect: %w", err)
 		}
 		needsUpdate = true
 	}
 
-	// Если EnvoyFilter не существует
-	if !envoyFilterExists {
-		logger.Info("EnvoyFilter not found, creating it",
-			"gatewayName", gateway.Name,
-			"gatewayNamespace", gateway.Namespace,
-		)
-		if err := r.createEnvoyFilterToDisableHSTS(ctx, gateway, cert.Spec.SecretName); err != nil {
+	// Если политика разрешает отключать HSTS, EnvoyFilter создается или приводится
+	// в соответствие с аннотациями hsts-mode и hsts-scope Gateway (в режиме keep удаляется)
+	if policy.DisableHSTS {
+		if hsts, _ := gatewayHSTSSettings(gateway); !envoyFilterExists && hsts.Mode != hstsModeKeep {
+			logger.Info("EnvoyFilter not found, creating it",
+				"gatewayName", gateway.Name,
+				"gatewayNamespace", gateway.Namespace,
+			)
+			needsUpdate = true
+		}
+		if err := r.createEnvoyFilterToDisableHSTS(ctx, gateway, cert); err != nil {
 			return fmt.Errorf("failed to create EnvoyFilter: %w", err)
 		}
-		needsUpdate = true
 	}
 
 	if needsUpdate {
@@ -0,0 +1,168 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) fallbackSecretRef(cert, policy) (*TemporaryCertificateSecretRef, error)
+ *   Возвращает secretRef источника Secret, если секрет находится в namespace политики
+ *
+ * - (r *CertificateReconciler) copyFallbackSecret(ctx, cert, gateway, ref) error
+ *   Копирует существующий TLS секрет во временный секрет сертификата
+ *
+ * - (r *CertificateReconciler) refreshFallbackSecret(ctx, cert, gateway, policy) error
+ *   Обновляет скопированный временный секрет после ротации секрета источника
+ *
+ * - (r *CertificateReconciler) updateFallbackSecretCopy(ctx, cert, secret) (bool, error)
+ *   Обновляет данные существующей копии секрета, если они отличаются
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+// fallbackSecretRef возвращает secretRef источника Secret политики
+// Секрет копируется только из namespace политики: иначе владелец политики мог бы
+// подставить в свой Gateway ключевую пару из чужого namespace
+func (r *CertificateReconciler) fallbackSecretRef(cert *certmanagerv1.Certificate, policy http01PolicySettings) (*http01v1alpha1.TemporaryCertificateSecretRef, error) {
+	ref := policy.TemporaryCertificateSource.SecretRef
+	if ref == nil {
+		return nil, fmt.Errorf("temporary certificate source Secret of policy %s has no secretRef", policy.PolicyName)
+	}
+	if ref.Namespace != policy.PolicyNamespace {
+		recordEvent(r.Recorder, cert, corev1.EventTypeWarning, eventReasonTemporarySourceFailed,
+			"Fallback secret %s/%s is outside the namespace of policy %s", ref.Namespace, ref.Name, policy.PolicyName)
+		return nil, fmt.Errorf("fallback secret %s/%s of policy %s must be in namespace %s", ref.Namespace, ref.Name, policy.PolicyName, policy.PolicyNamespace)
+	}
+	return ref, nil
+}
+
+// copyFallbackSecret копирует tls.crt, tls.key и ca.crt существующего секрета во временный секрет сертификата
+// Копия создается в namespace Certificate, чтобы Gateway ссылался на нее так же, как на выпущенный временный секрет.
+// Существующая копия обновляется, если секрет источника изменился (например, после ротации)
+func (r *CertificateReconciler) copyFallbackSecret(ctx context.Context, cert *certmanagerv1.Certificate, gateway client.Object, ref *http01v1alpha1.TemporaryCertificateSecretRef) error {
+	logger := log.FromContext(ctx)
+
+	source := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: ref.Namespace}, source); err != nil {
+		recordEvent(r.Recorder, cert, corev1.EventTypeWarning, eventReasonTemporarySourceFailed,
+			"Fallback secret %s/%s for the temporary certificate is not available: %v", ref.Namespace, ref.Name, err)
+		return fmt.Errorf("failed to get fallback secret %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+	if len(source.Data[corev1.TLSCertKey]) == 0 || len(source.Data[corev1.TLSPrivateKeyKey]) == 0 {
+		recordEvent(r.Recorder, cert, corev1.EventTypeWarning, eventReasonTemporarySourceFailed,
+			"Fallback secret %s/%s has no %s and %s", ref.Namespace, ref.Name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		return fmt.Errorf("fallback secret %s/%s has no TLS key pair", ref.Namespace, ref.Name)
+	}
+
+	data := make(map[string][]byte, 3)
+	for _, key := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, "ca.crt"} {
+		if value, ok := source.Data[key]; ok {
+			data[key] = value
+		}
+	}
+
+	tempSecretName := fmt.Sprintf("%s-temp", cert.Spec.SecretName)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tempSecretName,
+			Namespace: cert.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by":         "istio-http01",
+				"istio-http01.rieset.io/temp":          tempLabelValue,
+				"istio-http01.rieset.io/original-cert": cert.Name,
+			},
+			Annotations: map[string]string{
+				"istio-http01.rieset.io/source-secret": fmt.Sprintf("%s/%s", ref.Namespace, ref.Name),
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: data,
+	}
+	if err := controllerutil.SetControllerReference(cert, secret, r.Scheme); err != nil {
+		return fmt.Errorf("failed to set owner reference on temporary secret: %w", err)
+	}
+
+	if err := r.Create(ctx, secret); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create temporary secret: %w", err)
+		}
+		updated, err := r.updateFallbackSecretCopy(ctx, cert, secret)
+		if err != nil || !updated {
+			return err
+		}
+		recordEvent(r.Recorder, cert, corev1.EventTypeNormal, eventReasonTemporaryCertificateIssued,
+			"Updated temporary secret %s from changed fallback secret %s/%s", tempSecretName, ref.Namespace, ref.Name)
+		logger.Info("Updated temporary secret from changed fallback secret",
+			"sourceSecret", fmt.Sprintf("%s/%s", ref.Namespace, ref.Name),
+			"tempSecretName", tempSecretName,
+			"certificateName", cert.Name,
+		)
+		return nil
+	}
+
+	temporaryCertificatesIssued.WithLabelValues(gateway.GetName(), gateway.GetNamespace()).Inc()
+	recordEvent(r.Recorder, cert, corev1.EventTypeNormal, eventReasonTemporaryCertificateIssued,
+		"Copied fallback secret %s/%s to temporary secret %s for Gateway %s/%s", ref.Namespace, ref.Name, tempSecretName, gateway.GetNamespace(), gateway.GetName())
+	logger.Info("Copied fallback secret to temporary secret",
+		"sourceSecret", fmt.Sprintf("%s/%s", ref.Namespace, ref.Name),
+		"tempSecretName", tempSecretName,
+		"certificateName", cert.Name,
+	)
+	return nil
+}
+
+// refreshFallbackSecret повторно копирует секрет источника Secret в уже созданный временный секрет
+// Для остальных источников ничего не делает: временный Certificate обновляет cert-manager
+func (r *CertificateReconciler) refreshFallbackSecret(ctx context.Context, cert *certmanagerv1.Certificate, gateway client.Object, policy http01PolicySettings) error {
+	if policy.TemporaryCertificateSource.Type != http01v1alpha1.TemporaryCertificateSourceSecret {
+		return nil
+	}
+	ref, err := r.fallbackSecretRef(cert, policy)
+	if err != nil {
+		return err
+	}
+	return r.copyFallbackSecret(ctx, cert, gateway, ref)
+}
+
+// updateFallbackSecretCopy приводит существующую копию к данным и аннотации секрета источника
+// Возвращает true, если копия обновлена. Секрет без меток оператора не изменяется
+func (r *CertificateReconciler) updateFallbackSecretCopy(ctx context.Context, cert *certmanagerv1.Certificate, secret *corev1.Secret) (bool, error) {
+	existing := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(secret), existing); err != nil {
+		return false, fmt.Errorf("failed to get temporary secret: %w", err)
+	}
+	if existing.Labels["istio-http01.rieset.io/temp"] != tempLabelValue || existing.Labels["istio-http01.rieset.io/original-cert"] != cert.Name {
+		log.FromContext(ctx).V(1).Info("Temporary secret already exists and is not managed by the operator",
+			"secretName", secret.Name,
+			"namespace", secret.Namespace,
+		)
+		return false, nil
+	}
+
+	const sourceAnnotation = "istio-http01.rieset.io/source-secret"
+	if equality.Semantic.DeepEqual(existing.Data, secret.Data) &&
+		existing.Annotations[sourceAnnotation] == secret.Annotations[sourceAnnotation] {
+		return false, nil
+	}
+	existing.Data = secret.Data
+	if existing.Annotations == nil {
+		existing.Annotations = make(map[string]string)
+	}
+	existing.Annotations[sourceAnnotation] = secret.Annotations[sourceAnnotation]
+	if err := r.Update(ctx, existing); err != nil {
+		return false, fmt.Errorf("failed to update temporary secret: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,138 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) getTemporaryCredential(ctx, cert) (*temporaryCredential, error)
+ *   Возвращает состояние временного сертификата: Certificate cert-manager или скопированный секрет
+ *
+ * - (r *CertificateReconciler) provisionTemporaryCredential(ctx, cert, gateway, extraDomains, policy) error
+ *   Выпускает временный сертификат из источника Http01Policy: self-signed, Issuer/ClusterIssuer или секрет
+ *
+ * - temporaryIssuerRef(source) *ObjectReference
+ *   Возвращает issuer временного Certificate или nil для одноразового self-signed Issuer
+ *
+ * - secretDNSNames(secret) []string
+ *   Возвращает DNS имена сертификата из tls.crt секрета
+ *
+ * Копирование секрета источника Secret находится в certificate_temporary_fallback.go
+ */
+
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	certmanagermetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+// temporaryCredential состояние временного сертификата независимо от его источника
+type temporaryCredential struct {
+	// SecretName имя временного секрета в namespace Certificate
+	SecretName string
+	// DNSNames домены временного сертификата (для проверки через HTTPS)
+	DNSNames []string
+	// Ready временный секрет можно подставлять в Gateway
+	Ready bool
+	// CreatedAt время создания временного Certificate или секрета
+	CreatedAt time.Time
+}
+
+// getTemporaryCredential возвращает состояние временного сертификата или nil, если он еще не создан
+// Источники SelfSigned и Issuer создают Certificate <cert>-temp-selfsigned, источник Secret - копию секрета
+// <secretName>-temp с меткой istio-http01.rieset.io/temp
+func (r *CertificateReconciler) getTemporaryCredential(ctx context.Context, cert *certmanagerv1.Certificate) (*temporaryCredential, error) {
+	tempCert := &certmanagerv1.Certificate{}
+	err := r.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-temp-selfsigned", cert.Name), Namespace: cert.Namespace}, tempCert)
+	if err == nil {
+		return &temporaryCredential{
+			SecretName: tempCert.Spec.SecretName,
+			DNSNames:   tempCert.Spec.DNSNames,
+			Ready:      r.isCertificateReady(tempCert),
+			CreatedAt:  tempCert.CreationTimestamp.Time,
+		}, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get temporary certificate: %w", err)
+	}
+
+	secret := &corev1.Secret{}
+	tempSecretName := fmt.Sprintf("%s-temp", cert.Spec.SecretName)
+	err = r.Get(ctx, client.ObjectKey{Name: tempSecretName, Namespace: cert.Namespace}, secret)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get temporary secret: %w", err)
+	}
+	// Секрет без метки оператора (например, оставшийся от удаленного временного Certificate) не используется
+	if secret.Labels["istio-http01.rieset.io/temp"] != tempLabelValue || secret.Labels["istio-http01.rieset.io/original-cert"] != cert.Name {
+		return nil, nil
+	}
+	return &temporaryCredential{
+		SecretName: secret.Name,
+		DNSNames:   secretDNSNames(secret),
+		Ready:      len(secret.Data[corev1.TLSCertKey]) > 0 && len(secret.Data[corev1.TLSPrivateKeyKey]) > 0,
+		CreatedAt:  secret.CreationTimestamp.Time,
+	}, nil
+}
+
+// provisionTemporaryCredential выпускает временный сертификат из источника, заданного Http01Policy Gateway
+func (r *CertificateReconciler) provisionTemporaryCredential(ctx context.Context, cert *certmanagerv1.Certificate, gateway client.Object, extraDomains []string, policy http01PolicySettings) error {
+	source := policy.TemporaryCertificateSource
+	if source.Type == http01v1alpha1.TemporaryCertificateSourceSecret {
+		ref, err := r.fallbackSecretRef(cert, policy)
+		if err != nil {
+			return err
+		}
+		return r.copyFallbackSecret(ctx, cert, gateway, ref)
+	}
+	if source.Type == http01v1alpha1.TemporaryCertificateSourceIssuer && source.IssuerRef == nil {
+		return fmt.Errorf("temporary certificate source Issuer of policy %s has no issuerRef", policy.PolicyName)
+	}
+	return r.createTemporaryCertificateResources(ctx, cert, gateway, extraDomains, policy.TemporaryCertificateDuration, temporaryIssuerRef(source))
+}
+
+// temporaryIssuerRef возвращает issuer временного Certificate для источника Issuer
+// Для источника SelfSigned возвращает nil - оператор создает одноразовый self-signed Issuer
+func temporaryIssuerRef(source http01v1alpha1.TemporaryCertificateSource) *certmanagermetav1.ObjectReference {
+	if source.Type != http01v1alpha1.TemporaryCertificateSourceIssuer || source.IssuerRef == nil {
+		return nil
+	}
+	ref := &certmanagermetav1.ObjectReference{
+		Name:  source.IssuerRef.Name,
+		Kind:  source.IssuerRef.Kind,
+		Group: source.IssuerRef.Group,
+	}
+	if ref.Kind == "" {
+		ref.Kind = "Issuer"
+	}
+	if ref.Group == "" {
+		ref.Group = "cert-manager.io"
+	}
+	return ref
+}
+
+// secretDNSNames возвращает DNS имена (и CommonName, если DNS имен нет) первого сертификата из tls.crt
+func secretDNSNames(secret *corev1.Secret) []string {
+	block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if block == nil {
+		return nil
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	if len(certificate.DNSNames) == 0 && certificate.Subject.CommonName != "" {
+		return []string{certificate.Subject.CommonName}
+	}
+	return certificate.DNSNames
+}
@@ -0,0 +1,167 @@
+/*
+ * Тесты источника временного сертификата (certificate_temporary_source.go):
+ *
+ * - temporaryIssuerRef: self-signed без issuer, Issuer и ClusterIssuer со значениями по умолчанию
+ * - settingsFromHTTP01Policy: namespace secretRef по умолчанию - namespace политики
+ * - copyFallbackSecret (certificate_temporary_fallback.go): секрет вне namespace политики не копируется,
+ *   копия обновляется после ротации секрета источника
+ * - secretDNSNames: DNS имена и CommonName из tls.crt, пустой результат для неразбираемого секрета
+ */
+
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+// newTestTLSSecret возвращает секрет с самоподписанным сертификатом для commonName и dnsNames
+func newTestTLSSecret(commonName string, dnsNames ...string) *corev1.Secret {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	return &corev1.Secret{
+		Data: map[string][]byte{
+			corev1.TLSCertKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		},
+	}
+}
+
+var _ = Describe("Temporary certificate source", func() {
+	It("uses the one-off self-signed Issuer without an issuerRef", func() {
+		Expect(temporaryIssuerRef(http01v1alpha1.TemporaryCertificateSource{
+			Type: http01v1alpha1.TemporaryCertificateSourceSelfSigned,
+		})).To(BeNil())
+		Expect(temporaryIssuerRef(http01v1alpha1.TemporaryCertificateSource{
+			Type: http01v1alpha1.TemporaryCertificateSourceIssuer,
+		})).To(BeNil())
+	})
+
+	It("references the configured Issuer or ClusterIssuer", func() {
+		ref := temporaryIssuerRef(http01v1alpha1.TemporaryCertificateSource{
+			Type:      http01v1alpha1.TemporaryCertificateSourceIssuer,
+			IssuerRef: &http01v1alpha1.TemporaryCertificateIssuerRef{Name: "internal-ca"},
+		})
+		Expect(ref.Name).To(Equal("internal-ca"))
+		Expect(ref.Kind).To(Equal("Issuer"))
+		Expect(ref.Group).To(Equal("cert-manager.io"))
+
+		ref = temporaryIssuerRef(http01v1alpha1.TemporaryCertificateSource{
+			Type:      http01v1alpha1.TemporaryCertificateSourceIssuer,
+			IssuerRef: &http01v1alpha1.TemporaryCertificateIssuerRef{Name: "internal-ca", Kind: "ClusterIssuer"},
+		})
+		Expect(ref.Kind).To(Equal("ClusterIssuer"))
+	})
+
+	It("looks up the fallback secret in the policy namespace by default", func() {
+		policy := &http01v1alpha1.Http01Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "istio-system"},
+		}
+		policy.Spec.TemporaryCertificate = http01v1alpha1.TemporaryCertificatePolicy{
+			Source: http01v1alpha1.TemporaryCertificateSource{
+				Type:      http01v1alpha1.TemporaryCertificateSourceSecret,
+				SecretRef: &http01v1alpha1.TemporaryCertificateSecretRef{Name: "wildcard-tls"},
+			},
+		}
+
+		settings := settingsFromHTTP01Policy(policy)
+		Expect(settings.TemporaryCertificateSource.SecretRef.Namespace).To(Equal("istio-system"))
+		Expect(policy.Spec.TemporaryCertificate.Source.SecretRef.Namespace).To(BeEmpty())
+	})
+
+	Context("with a Secret source", func() {
+		var (
+			cert    *certmanagerv1.Certificate
+			gateway *istionetworkingv1beta1.Gateway
+			source  *corev1.Secret
+		)
+
+		BeforeEach(func() {
+			cert = &certmanagerv1.Certificate{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "app"},
+				Spec:       certmanagerv1.CertificateSpec{SecretName: "app-tls"},
+			}
+			gateway = newTestGateway("app", "public", "example.com", "app-tls")
+			source = newTestTLSSecret("example.com", "example.com")
+			source.ObjectMeta = metav1.ObjectMeta{Name: "wildcard-tls", Namespace: "app"}
+			source.Data[corev1.TLSPrivateKeyKey] = []byte("key")
+		})
+
+		policyFor := func(namespace string) http01PolicySettings {
+			policy := defaultHTTP01PolicySettings()
+			policy.PolicyName = "app/policy"
+			policy.PolicyNamespace = "app"
+			policy.TemporaryCertificateSource = http01v1alpha1.TemporaryCertificateSource{
+				Type:      http01v1alpha1.TemporaryCertificateSourceSecret,
+				SecretRef: &http01v1alpha1.TemporaryCertificateSecretRef{Name: source.Name, Namespace: namespace},
+			}
+			return policy
+		}
+
+		newReconciler := func(objects ...client.Object) (*CertificateReconciler, *record.FakeRecorder) {
+			c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(objects...).Build()
+			recorder := record.NewFakeRecorder(10)
+			return &CertificateReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder}, recorder
+		}
+
+		It("refuses a fallback secret outside the policy namespace", func() {
+			source.Namespace = "istio-system"
+			r, recorder := newReconciler(cert, source)
+
+			Expect(r.provisionTemporaryCredential(testCtx, cert, gateway, nil, policyFor("istio-system"))).NotTo(Succeed())
+			err := r.Get(testCtx, client.ObjectKey{Namespace: "app", Name: "app-tls-temp"}, &corev1.Secret{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			Expect(recorder.Events).To(Receive(ContainSubstring(eventReasonTemporarySourceFailed)))
+		})
+
+		It("updates the copy after the fallback secret is rotated", func() {
+			r, _ := newReconciler(cert, source)
+			policy := policyFor("app")
+			Expect(r.provisionTemporaryCredential(testCtx, cert, gateway, nil, policy)).To(Succeed())
+
+			rotated := newTestTLSSecret("example.com", "example.com", "www.example.com")
+			source.Data[corev1.TLSCertKey] = rotated.Data[corev1.TLSCertKey]
+			Expect(r.Update(testCtx, source)).To(Succeed())
+			Expect(r.refreshFallbackSecret(testCtx, cert, gateway, policy)).To(Succeed())
+
+			credential, err := r.getTemporaryCredential(testCtx, cert)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credential.DNSNames).To(Equal([]string{"example.com", "www.example.com"}))
+		})
+	})
+
+	It("reads DNS names of the copied certificate", func() {
+		Expect(secretDNSNames(newTestTLSSecret("example.com", "example.com", "www.example.com"))).
+			To(Equal([]string{"example.com", "www.example.com"}))
+		Expect(secretDNSNames(newTestTLSSecret("legacy.example.com"))).To(Equal([]string{"legacy.example.com"}))
+		Expect(secretDNSNames(&corev1.Secret{Data: map[string][]byte{corev1.TLSCertKey: []byte("invalid")}})).To(BeEmpty())
+	})
+})
@@ -7,6 +7,9 @@
  * - (r *CertificateReconciler) getIngressGatewayIP(ctx, gateway) (string, error)
  *   Получает IP адрес ingress gateway для Gateway
  *
+ * - lookupIngressGatewayIP(ctx, c, gateway) (string, error)
+ *   Получает IP адрес ingress gateway по Service с селектором Gateway (без reconciler)
+ *
  * - (r *CertificateReconciler) verifyCertificateViaHTTPS(ctx, gateway, expectedDNSNames, ingressIP) error
  *   Проверяет сертификат через HTTPS запрос и сравнивает домены
  *
@@ -36,19 +39,13 @@ import (
 func (r *CertificateReconciler) getDomainsForGateway(ctx context.Context, gateway *istionetworkingv1beta1.Gateway) ([]string, error) {
 	logger := log.FromContext(ctx)
 
-	// Получение всех VirtualService во всех namespace
+	// Получение VirtualService, ссылающихся на Gateway (по индексу spec.gateways)
 	virtualServiceList := &istionetworkingv1beta1.VirtualServiceList{}
-	if err := r.List(ctx, virtualServiceList, client.InNamespace("")); err != nil {
+	gatewayRef := gateway.Namespace + "/" + gateway.Name
+	if err := r.List(ctx, virtualServiceList, client.MatchingFields{virtualServiceGatewayIndex: gatewayRef}); err != nil {
 		return nil, fmt.Errorf("failed to list VirtualServices: %w", err)
 	}
 
-	gatewayName := gateway.Name
-	gatewayNamespace := gateway.Namespace
-	gatewayRef := gatewayName
-	if gatewayNamespace != "" {
-		gatewayRef = gatewayNamespace + "/" + gatewayName
-	}
-
 	// Используем map для исключения дубликатов доменов
 	domainMap := make(map[string]bool)
 
@@ -71,20 +68,9 @@ func (r *CertificateReconciler) getDomainsForGateway(ctx context.Context, gatewa
 			continue
 		}
 
-		// Проверка, ссылается ли VirtualService на этот Gateway
-		linkedToGateway := false
-		for _, gw := range vs.Spec.Gateways {
-			if gw == gatewayName || gw == gatewayRef {
-				linkedToGateway = true
-				break
-			}
-		}
-
-		if linkedToGateway {
-			// Добавляем все домены из VirtualService
-			for _, host := range vs.Spec.Hosts {
-				domainMap[host] = true
-			}
+		// Добавляем все домены из VirtualService
+		for _, host := range vs.Spec.Hosts {
+			domainMap[host] = true
 		}
 	}
 
@@ -105,6 +91,12 @@ func (r *CertificateReconciler) getDomainsForGateway(ctx context.Context, gatewa
 
 // getIngressGatewayIP получает IP адрес ingress gateway для Gateway
 func (r *CertificateReconciler) getIngressGatewayIP(ctx context.Context, gateway *istionetworkingv1beta1.Gateway) (string, error) {
+	return lookupIngressGatewayIP(ctx, r.Client, gateway)
+}
+
+// lookupIngressGatewayIP получает IP адрес ingress gateway по Service с селектором Gateway
+// Используется проверкой сертификата и предварительной проверкой маршрута солвера
+func lookupIngressGatewayIP(ctx context.Context, c client.Reader, gateway *istionetworkingv1beta1.Gateway) (string, error) {
 	logger := log.FromContext(ctx)
 
 	// Получаем селектор из Gateway
@@ -118,7 +110,7 @@ func (r *CertificateReconciler) getIngressGatewayIP(ctx context.Context, gateway
 
 	// Ищем Service с соответствующим селектором
 	serviceList := &corev1.ServiceList{}
-	if err := r.List(ctx, serviceList, client.InNamespace("")); err != nil {
+	if err := c.List(ctx, serviceList, client.InNamespace("")); err != nil {
 		return "", fmt.Errorf("failed to list Services: %w", err)
 	}
 
@@ -0,0 +1,232 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *CertificateReconciler) certificatesForSecretName(ctx, secretName, secretNamespace) []reconcile.Request
+ *   Возвращает запросы на реконсиляцию Certificate, выпускающих секрет (оригинальный или временный)
+ *
+ * - (r *CertificateReconciler) certificatesForGateway(ctx, obj) []reconcile.Request
+ *   Находит Certificate, секреты которых используются в credentialName Istio Gateway
+ *
+ * - (r *CertificateReconciler) certificatesForGatewayAPI(ctx, obj) []reconcile.Request
+ *   Находит Certificate, секреты которых используются в certificateRefs Gateway API Gateway
+ *
+ * - (r *CertificateReconciler) certificatesForVirtualService(ctx, obj) []reconcile.Request
+ *   Находит Certificate Gateway, на которые ссылается VirtualService (домены временного сертификата)
+ *
+ * - (r *CertificateReconciler) certificatesForHTTPRoute(ctx, obj) []reconcile.Request
+ *   Находит Certificate Gateway API Gateway, к которым привязан HTTPRoute
+ *
+ * - (r *CertificateReconciler) certificatesForSecret(ctx, obj) []reconcile.Request
+ *   Находит Certificate, выпускающие секрет
+ *
+ * - (r *CertificateReconciler) certificatesForEnvoyFilter(ctx, obj) []reconcile.Request
+ *   Находит Certificate, для которого создан EnvoyFilter отключения HSTS
+ *
+ * - (r *CertificateReconciler) certificatesForIssuer(ctx, obj) []reconcile.Request
+ *   Находит Certificate, выпускаемые Issuer или ClusterIssuer (изменение solver'ов меняет обработку HTTP01)
+ *
+ * - originalCertificateForTemporary(ctx, obj) []reconcile.Request
+ *   Возвращает запрос на реконсиляцию оригинального Certificate для временного сертификата
+ *
+ * - isTemporaryObject(obj) bool
+ *   Проверяет, является ли объект временным ресурсом оператора
+ */
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+// certificatesForSecretName возвращает запросы на реконсиляцию Certificate, выпускающих секрет
+// Временный секрет (<secretName>-temp) сопоставляется с оригинальным сертификатом
+// Пустой secretNamespace означает поиск во всех namespace (credentialName без namespace)
+func (r *CertificateReconciler) certificatesForSecretName(ctx context.Context, secretName, secretNamespace string) []reconcile.Request {
+	var requests []reconcile.Request
+	names := []string{secretName}
+	if originalName, isTemp := strings.CutSuffix(secretName, "-temp"); isTemp {
+		names = append(names, originalName)
+	}
+
+	for _, name := range names {
+		certList := &certmanagerv1.CertificateList{}
+		if err := r.List(ctx, certList,
+			client.InNamespace(secretNamespace),
+			client.MatchingFields{certificateSecretNameIndex: name},
+		); err != nil {
+			log.FromContext(ctx).V(1).Info("Failed to list Certificates for secret",
+				"secretName", name,
+				"secretNamespace", secretNamespace,
+				"error", err.Error(),
+			)
+			continue
+		}
+		for _, cert := range certList.Items {
+			if isTemporaryObject(&cert) {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cert)})
+		}
+	}
+	return requests
+}
+
+// certificatesForGateway находит Certificate, секреты которых используются в credentialName Istio Gateway
+// Учитываются также аннотации с оригинальным секретом: после восстановления Gateway их уже нет в credentialName
+func (r *CertificateReconciler) certificatesForGateway(ctx context.Context, obj client.Object) []reconcile.Request {
+	gateway, ok := obj.(*istionetworkingv1beta1.Gateway)
+	if !ok {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, server := range gateway.Spec.Servers {
+		if server.Tls == nil || server.Tls.CredentialName == "" {
+			continue
+		}
+		// credentialName без namespace сопоставляется с сертификатами любого namespace (как в findGatewaysUsingCertificate)
+		namespace, name := splitCredentialName(server.Tls.CredentialName, "")
+		requests = append(requests, r.certificatesForSecretName(ctx, name, namespace)...)
+	}
+
+	for key, value := range gateway.Annotations {
+		if !strings.HasPrefix(key, "istio-http01.rieset.io/original-credential-name-") {
+			continue
+		}
+		namespace, name := splitCredentialName(value, "")
+		requests = append(requests, r.certificatesForSecretName(ctx, name, namespace)...)
+	}
+
+	return requests
+}
+
+// certificatesForGatewayAPI находит Certificate, секреты которых используются в certificateRefs Gateway API Gateway
+func (r *CertificateReconciler) certificatesForGatewayAPI(ctx context.Context, obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+	for _, ref := range gatewayAPICertificateRefs(obj) {
+		namespace, name := splitCredentialName(ref, obj.GetNamespace())
+		requests = append(requests, r.certificatesForSecretName(ctx, name, namespace)...)
+	}
+	return requests
+}
+
+// certificatesForVirtualService находит Certificate Gateway, на которые ссылается VirtualService
+// Домены VirtualService попадают во временный сертификат, поэтому их изменение требует реконсиляции
+// VirtualService солвера оператора пропускаются
+func (r *CertificateReconciler) certificatesForVirtualService(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetLabels()["app.kubernetes.io/managed-by"] == istioHTTP01ManagedByLabel ||
+		obj.GetLabels()["acme.cert-manager.io/http01-solver"] == http01SolverLabelValue {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, ref := range virtualServiceGatewayRefs(obj) {
+		namespace, name := splitCredentialName(ref, obj.GetNamespace())
+		gateway := &istionetworkingv1beta1.Gateway{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, gateway); err != nil {
+			continue
+		}
+		requests = append(requests, r.certificatesForGateway(ctx, gateway)...)
+	}
+	return requests
+}
+
+// certificatesForHTTPRoute находит Certificate Gateway API Gateway, к которым привязан HTTPRoute
+func (r *CertificateReconciler) certificatesForHTTPRoute(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetLabels()["app.kubernetes.io/managed-by"] == istioHTTP01ManagedByLabel {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, ref := range httpRouteParentRefs(obj) {
+		namespace, name := splitCredentialName(ref, obj.GetNamespace())
+		gateway := &gatewayapiv1.Gateway{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, gateway); err != nil {
+			continue
+		}
+		requests = append(requests, r.certificatesForGatewayAPI(ctx, gateway)...)
+	}
+	return requests
+}
+
+// certificatesForSecret находит Certificate, выпускающие секрет (используется с метаданными секрета)
+func (r *CertificateReconciler) certificatesForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.certificatesForSecretName(ctx, obj.GetName(), obj.GetNamespace())
+}
+
+// certificatesForEnvoyFilter находит Certificate, для которого создан EnvoyFilter отключения HSTS
+// Метка istio-http01.rieset.io/original-cert EnvoyFilter содержит имя оригинального секрета
+func (r *CertificateReconciler) certificatesForEnvoyFilter(ctx context.Context, obj client.Object) []reconcile.Request {
+	secretName := obj.GetLabels()["istio-http01.rieset.io/original-cert"]
+	if secretName == "" {
+		return nil
+	}
+	return r.certificatesForSecretName(ctx, secretName, "")
+}
+
+// certificatesForIssuer находит Certificate, выпускаемые Issuer или ClusterIssuer
+// Добавление или удаление HTTP01 solver'а меняет, обрабатывает ли оператор сертификат
+func (r *CertificateReconciler) certificatesForIssuer(ctx context.Context, obj client.Object) []reconcile.Request {
+	if isTemporaryObject(obj) {
+		return nil
+	}
+
+	var listOpts []client.ListOption
+	switch obj.(type) {
+	case *certmanagerv1.ClusterIssuer:
+		listOpts = append(listOpts, client.MatchingFields{
+			certificateIssuerRefIndex: issuerIndexKey(certmanagerv1.ClusterIssuerKind, obj.GetName()),
+		})
+	case *certmanagerv1.Issuer:
+		listOpts = append(listOpts, client.InNamespace(obj.GetNamespace()), client.MatchingFields{
+			certificateIssuerRefIndex: issuerIndexKey(certmanagerv1.IssuerKind, obj.GetName()),
+		})
+	default:
+		return nil
+	}
+
+	certList := &certmanagerv1.CertificateList{}
+	if err := r.List(ctx, certList, listOpts...); err != nil {
+		log.FromContext(ctx).V(1).Info("Failed to list Certificates for issuer",
+			"issuerName", obj.GetName(),
+			"issuerNamespace", obj.GetNamespace(),
+			"error", err.Error(),
+		)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cert := range certList.Items {
+		if isTemporaryObject(&cert) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cert)})
+	}
+	return requests
+}
+
+// originalCertificateForTemporary возвращает запрос на реконсиляцию оригинального Certificate для временного сертификата
+// Готовность временного сертификата - сигнал переключить Gateway на временный секрет
+func originalCertificateForTemporary(_ context.Context, obj client.Object) []reconcile.Request {
+	originalName := obj.GetLabels()["istio-http01.rieset.io/original-cert"]
+	if originalName == "" {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: client.ObjectKey{Name: originalName, Namespace: obj.GetNamespace()},
+	}}
+}
+
+// isTemporaryObject проверяет, является ли объект временным ресурсом оператора
+func isTemporaryObject(obj client.Object) bool {
+	return obj.GetLabels()["istio-http01.rieset.io/temp"] == tempLabelValue
+}
@@ -0,0 +1,235 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *ChallengeReconciler) Reconcile(ctx, req) (ctrl.Result, error)
+ *   Маршрутизирует HTTP01 Challenge на под и Service солвера, найденные по меткам cert-manager
+ *   (маршрут ведет на найденный Service, а не на Service, подобранный по поду)
+ *
+ * - (r *ChallengeReconciler) SetupWithManager(mgr) error
+ *   Настраивает контроллер и наблюдение за подами и Service солвера
+ *
+ * - (r *ChallengeReconciler) findSolverPodForChallenge(ctx, challenge) (*Pod, error)
+ *   Находит под солвера Challenge по меткам http-domain и http-token
+ *
+ * - (r *ChallengeReconciler) findSolverServiceForChallenge(ctx, challenge) (*Service, error)
+ *   Находит Service солвера Challenge по меткам http-domain и http-token
+ *
+ * - solverLabelsForChallenge(challenge) map[string]string
+ *   Возвращает метки, которые cert-manager ставит на под и Service солвера Challenge
+ *
+ * - solverPodMatchesChallenge(pod, challenge) bool
+ *   Проверяет, что токен и ключ в аргументах acmesolver совпадают с Challenge
+ *
+ * - isChallengeFinal(challenge) bool
+ *   Проверяет, завершен ли Challenge (valid, invalid, errored, expired)
+ *
+ * - challengeOwnerName(pod) string
+ *   Возвращает имя Challenge - владельца пода солвера
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/adler32"
+	"strings"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// ChallengeReconciler реконсилирует Challenge ресурсы cert-manager (acme.cert-manager.io/v1)
+// Домен и токен берутся из spec Challenge, а не из имени пода и аргументов контейнера
+type ChallengeReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Solver создает маршрут challenge на под солвера (общая логика с HTTP01SolverPodReconciler)
+	Solver *HTTP01SolverPodReconciler
+}
+
+// +kubebuilder:rbac:groups=acme.cert-manager.io,resources=challenges,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+
+// Reconcile обрабатывает Challenge ресурсы
+func (r *ChallengeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// Получение Challenge
+	// Удаленный Challenge не обрабатывается: маршрут удаляется вместе с подом солвера (HTTP01SolverPodReconciler)
+	challenge := &cmacme.Challenge{}
+	if err := r.Get(ctx, req.NamespacedName, challenge); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Обрабатываются только HTTP01 challenge
+	if challenge.Spec.Type != cmacme.ACMEChallengeTypeHTTP01 || challenge.Spec.Solver.HTTP01 == nil {
+		return ctrl.Result{}, nil
+	}
+
+	if isChallengeFinal(challenge) {
+		logger.V(1).Info("Challenge is finished, skipping",
+			"challenge", challenge.Name,
+			"namespace", challenge.Namespace,
+			"state", challenge.Status.State,
+		)
+		return ctrl.Result{}, nil
+	}
+
+	domain := challenge.Spec.DNSName
+	logger.Info("HTTP01 Challenge detected",
+		"challenge", challenge.Name,
+		"namespace", challenge.Namespace,
+		"domain", domain,
+		"token", challenge.Spec.Token,
+		"state", challenge.Status.State,
+	)
+
+	// Под и Service солвера создаются cert-manager после Challenge - их появление снова запустит реконсиляцию
+	pod, err := r.findSolverPodForChallenge(ctx, challenge)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if pod == nil {
+		logger.Info("Solver pod for Challenge not created yet",
+			"challenge", challenge.Name,
+			"namespace", challenge.Namespace,
+			"domain", domain,
+		)
+		return ctrl.Result{}, nil
+	}
+
+	service, err := r.findSolverServiceForChallenge(ctx, challenge)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if service == nil {
+		logger.Info("Solver Service for Challenge not created yet",
+			"challenge", challenge.Name,
+			"namespace", challenge.Namespace,
+			"domain", domain,
+			"pod", pod.Name,
+		)
+		return ctrl.Result{}, nil
+	}
+
+	logger.Info("Routing HTTP01 Challenge to solver",
+		"challenge", challenge.Name,
+		"namespace", challenge.Namespace,
+		"domain", domain,
+		"pod", pod.Name,
+		"service", service.Name,
+	)
+
+	return r.Solver.reconcileSolverRoute(ctx, pod, service, domain, challenge.Spec.Token)
+}
+
+// findSolverPodForChallenge находит под солвера Challenge по меткам http-domain и http-token
+// Из подов с совпадающими метками выбирается тот, чьи токен и ключ совпадают с Challenge
+func (r *ChallengeReconciler) findSolverPodForChallenge(ctx context.Context, challenge *cmacme.Challenge) (*corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList,
+		client.InNamespace(challenge.Namespace),
+		client.MatchingLabels(solverLabelsForChallenge(challenge)),
+	); err != nil {
+		return nil, fmt.Errorf("failed to list solver pods for Challenge %s/%s: %w", challenge.Namespace, challenge.Name, err)
+	}
+
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if solverPodMatchesChallenge(pod, challenge) {
+			return pod, nil
+		}
+	}
+	return nil, nil
+}
+
+// findSolverServiceForChallenge находит Service солвера Challenge по меткам http-domain и http-token
+func (r *ChallengeReconciler) findSolverServiceForChallenge(ctx context.Context, challenge *cmacme.Challenge) (*corev1.Service, error) {
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList,
+		client.InNamespace(challenge.Namespace),
+		client.MatchingLabels(solverLabelsForChallenge(challenge)),
+	); err != nil {
+		return nil, fmt.Errorf("failed to list solver services for Challenge %s/%s: %w", challenge.Namespace, challenge.Name, err)
+	}
+
+	for i := range serviceList.Items {
+		if serviceList.Items[i].DeletionTimestamp == nil {
+			return &serviceList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// solverLabelsForChallenge возвращает метки, которые cert-manager ставит на под и Service солвера
+// Домен и токен хешируются adler32 так же, как в cert-manager (pkg/issuer/acme/http)
+func solverLabelsForChallenge(challenge *cmacme.Challenge) map[string]string {
+	return map[string]string{
+		cmacme.DomainLabelKey:               fmt.Sprintf("%d", adler32.Checksum([]byte(challenge.Spec.DNSName))),
+		cmacme.TokenLabelKey:                fmt.Sprintf("%d", adler32.Checksum([]byte(challenge.Spec.Token))),
+		cmacme.SolverIdentificationLabelKey: http01SolverLabelValue,
+	}
+}
+
+// solverPodMatchesChallenge проверяет, что токен и ключ в аргументах acmesolver совпадают с Challenge
+// Хеши в метках могут совпасть у разных токенов; под без аргументов (другая версия cert-manager) считается подходящим
+func solverPodMatchesChallenge(pod *corev1.Pod, challenge *cmacme.Challenge) bool {
+	for _, container := range pod.Spec.Containers {
+		for _, arg := range container.Args {
+			if token, ok := strings.CutPrefix(arg, "--token="); ok && token != challenge.Spec.Token {
+				return false
+			}
+			if key, ok := strings.CutPrefix(arg, "--key="); ok && key != challenge.Spec.Key {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isChallengeFinal проверяет, завершен ли Challenge
+func isChallengeFinal(challenge *cmacme.Challenge) bool {
+	switch challenge.Status.State {
+	case cmacme.Valid, cmacme.Invalid, cmacme.Errored, cmacme.Expired:
+		return true
+	}
+	return false
+}
+
+// challengeOwnerName возвращает имя Challenge - владельца пода солвера
+// cert-manager создает под и Service солвера с controller reference на Challenge
+func challengeOwnerName(pod *corev1.Pod) string {
+	for _, ownerRef := range pod.OwnerReferences {
+		if ownerRef.Kind == "Challenge" && ownerRef.APIVersion == cmacme.SchemeGroupVersion.String() {
+			return ownerRef.Name
+		}
+	}
+	return ""
+}
+
+// SetupWithManager настраивает контроллер
+// Под и Service солвера появляются после Challenge, поэтому их создание ставит в очередь Challenge-владельца
+func (r *ChallengeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	solverObject := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetLabels()[cmacme.SolverIdentificationLabelKey] == http01SolverLabelValue
+	})
+	enqueueChallenge := handler.EnqueueRequestForOwner(mgr.GetScheme(), mgr.GetRESTMapper(), &cmacme.Challenge{}, handler.OnlyControllerOwner())
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cmacme.Challenge{}).
+		Watches(&corev1.Pod{}, enqueueChallenge, builder.WithPredicates(solverObject)).
+		Watches(&corev1.Service{}, enqueueChallenge, builder.WithPredicates(solverObject)).
+		Complete(r)
+}
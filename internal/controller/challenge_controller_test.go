@@ -0,0 +1,76 @@
+/*
+ * Тесты ChallengeReconciler (challenge_controller.go):
+ *
+ * - маршрут challenge ведет на Service солвера, найденный по меткам Challenge, а не на Service с именем пода
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("ChallengeReconciler", func() {
+	It("routes the challenge to the Service labelled for the Challenge", func() {
+		const host = "app.example.com"
+		challenge := &cmacme.Challenge{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-challenge", Namespace: "app"},
+			Spec: cmacme.ChallengeSpec{
+				Type:    cmacme.ACMEChallengeTypeHTTP01,
+				DNSName: host,
+				Token:   "token",
+				Key:     "token.key",
+				Solver:  cmacme.ACMEChallengeSolver{HTTP01: &cmacme.ACMEChallengeSolverHTTP01{}},
+			},
+		}
+		labels := solverLabelsForChallenge(challenge)
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "cm-acme-http-solver-abc", Namespace: "app", Labels: labels},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "acmesolver",
+				Args: []string{"--domain=" + host, "--token=token", "--key=token.key"},
+			}}},
+		}
+		// Service с именем пода, но без меток Challenge: findServiceForPod выбрал бы его первым
+		podNamedService := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: "app"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		}
+		solverService := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "cm-acme-http-solver-xyz", Namespace: "app", Labels: labels},
+			Spec: corev1.ServiceSpec{
+				Selector: labels,
+				Ports:    []corev1.ServicePort{{Port: 8089}},
+			},
+		}
+		gateway := newTestGateway("app", "public", host, "app-tls")
+
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+			WithObjects(challenge, pod, podNamedService, solverService, gateway,
+				newTestVirtualService("app", "app", host, gateway.Name)).
+			Build()
+		r := &ChallengeReconciler{
+			Client: c,
+			Scheme: c.Scheme(),
+			Solver: &HTTP01SolverPodReconciler{Client: c, Scheme: c.Scheme()},
+		}
+		_, err := r.Reconcile(testCtx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(challenge)})
+		Expect(err).NotTo(HaveOccurred())
+
+		vs := &istionetworkingv1beta1.VirtualService{}
+		Expect(c.Get(testCtx, client.ObjectKey{Namespace: "app", Name: solverVirtualServiceName(host)}, vs)).To(Succeed())
+		Expect(vs.Spec.Http).To(HaveLen(1))
+		destination := vs.Spec.Http[0].Route[0].Destination
+		Expect(destination.Host).To(Equal("cm-acme-http-solver-xyz.app.svc.cluster.local"))
+		Expect(destination.Port.Number).To(Equal(uint32(8089)))
+	})
+})
@@ -0,0 +1,50 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *ClusterIssuerReconciler) Reconcile(ctx, req) (ctrl.Result, error)
+ *   Обрабатывает изменения ClusterIssuer ресурсов и выводит информацию в логи
+ *
+ * - (r *ClusterIssuerReconciler) SetupWithManager(mgr) error
+ *   Настраивает контроллер для работы с менеджером
+ */
+
+package controller
+
+import (
+	"context"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterIssuerReconciler реконсилирует ClusterIssuer ресурсы
+type ClusterIssuerReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=cert-manager.io,resources=clusterissuers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=clusterissuers/status,verbs=get
+
+// Reconcile обрабатывает ClusterIssuer ресурсы
+func (r *ClusterIssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	// Получение ClusterIssuer (cluster-scoped ресурс, namespace не используется)
+	clusterIssuer := &certmanagerv1.ClusterIssuer{}
+	if err := r.Get(ctx, req.NamespacedName, clusterIssuer); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Вывод информации о ClusterIssuer
+	logIssuerSpec(ctx, certmanagerv1.ClusterIssuerKind, clusterIssuer.Name, "", &clusterIssuer.Spec, &clusterIssuer.Status)
+
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager настраивает контроллер
+func (r *ClusterIssuerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&certmanagerv1.ClusterIssuer{}).
+		Complete(r)
+}
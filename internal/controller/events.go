@@ -0,0 +1,73 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - recordEvent(recorder, obj, eventType, reason, messageFmt, args...)
+ *   Создает Kubernetes Event для объекта, если recorder задан
+ *
+ * - (r *CertificateReconciler) recordCertificateEvent(ctx, secretName, secretNamespace, eventType, reason, messageFmt, args...)
+ *   Создает Event на Certificate, выпускающем указанный секрет
+ */
+
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// eventRecorderName имя компонента в событиях оператора
+	eventRecorderName = "istio-http01"
+)
+
+// Причины событий на Gateway и Certificate
+const (
+	eventReasonTemporarySecretApplied     = "TemporarySecretApplied"
+	eventReasonOriginalSecretRestored     = "OriginalSecretRestored"
+	eventReasonHTTPSRedirectDisabled      = "HTTPSRedirectDisabled"
+	eventReasonHTTPSRedirectRestored      = "HTTPSRedirectRestored"
+	eventReasonHSTSEnvoyFilterCreated     = "HSTSEnvoyFilterCreated"
+	eventReasonHSTSEnvoyFilterDeleted     = "HSTSEnvoyFilterDeleted"
+	eventReasonTemporaryCertificateIssued = "TemporaryCertificateIssued"
+	eventReasonGatewayUpdateFailed        = "GatewayUpdateFailed"
+	eventReasonEnvoyFilterFailed          = "HSTSEnvoyFilterFailed"
+	eventReasonVerificationFailed         = "CertificateVerificationFailed"
+	eventReasonInvalidHSTSAnnotation      = "InvalidHSTSAnnotation"
+	eventReasonTemporarySourceFailed      = "TemporaryCertificateSourceFailed"
+	eventReasonChallengePathRefused       = "ChallengePathRedirectRefused"
+)
+
+// Причины событий на поде HTTP01 solver
+const (
+	eventReasonSolverRouteCreated      = "SolverRouteCreated"
+	eventReasonSolverRouteUpdated      = "SolverRouteUpdated"
+	eventReasonSolverRouteDeleted      = "SolverRouteDeleted"
+	eventReasonSolverRouteFailed       = "SolverRouteFailed"
+	eventReasonGatewayNotFound         = "GatewayNotFound"
+	eventReasonGatewayAmbiguous        = "GatewayAmbiguous"
+	eventReasonSolverServiceNotVisible = "SolverServiceNotVisible"
+	eventReasonSolverRouteReachable    = "SolverRouteReachable"
+	eventReasonSolverPreflightFailed   = "SolverRoutePreflightFailed"
+)
+
+// recordEvent создает Kubernetes Event для объекта
+// Recorder может быть не задан (например, в тестах) - тогда событие пропускается
+func recordEvent(recorder record.EventRecorder, obj runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil || obj == nil {
+		return
+	}
+	recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
+
+// recordCertificateEvent создает Event на Certificate, выпускающем указанный секрет
+// Используется там, где известен только секрет Gateway, а не сам Certificate
+func (r *CertificateReconciler) recordCertificateEvent(ctx context.Context, secretName, secretNamespace, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil {
+		return
+	}
+	if cert := r.findCertificateBySecretName(ctx, secretName, secretNamespace); cert != nil {
+		recordEvent(r.Recorder, cert, eventType, reason, messageFmt, args...)
+	}
+}
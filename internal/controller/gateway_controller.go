@@ -7,22 +7,32 @@
  * - (r *GatewayReconciler) SetupWithManager(mgr) error
  *   Настраивает контроллер для работы с менеджером
  *
+ * - (r *GatewayReconciler) gatewaysForVirtualService(ctx, obj) []reconcile.Request
+ *   Возвращает запросы на реконсиляцию Gateway, на которые ссылается VirtualService
+ *
+ * - (r *GatewayReconciler) gatewaysForCertificate(ctx, obj) []reconcile.Request
+ *   Возвращает запросы на реконсиляцию Gateway, использующих секрет Certificate
+ *
  * Дополнительные функции находятся в:
  * - gateway_virtualservice.go - работа с VirtualService и доменами Gateway
- * - gateway_status.go - обновление статуса пода оператора
+ * - gateway_status.go - обновление GatewayCertificateStatus Gateway
  */
 
 package controller
 
 import (
 	"context"
-	"time"
 
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
 )
 
 // GatewayReconciler реконсилирует Istio Gateway ресурсы
@@ -33,8 +43,9 @@ type GatewayReconciler struct {
 
 // +kubebuilder:rbac:groups=networking.istio.io,resources=gateways,verbs=get;list;watch
 // +kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices,verbs=get;list;watch
-// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;patch;update
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=http01.istio-http01.rieset.io,resources=gatewaycertificatestatuses,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=http01.istio-http01.rieset.io,resources=gatewaycertificatestatuses/status,verbs=get;update;patch
 
 // Reconcile обрабатывает Istio Gateway ресурсы
 func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -45,6 +56,10 @@ func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	if err := r.Get(ctx, req.NamespacedName, gateway); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	// overlay Gateway оператора не имеет собственного GatewayCertificateStatus
+	if isOverlayGateway(gateway) {
+		return ctrl.Result{}, nil
+	}
 
 	// Создаем контекстный логгер с информацией о Gateway
 	logger = logger.WithValues(
@@ -96,27 +111,67 @@ func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	domains, err := r.getDomainsForGateway(ctx, gateway)
 	if err != nil {
 		logger.Error(err, "failed to get domains for Gateway")
-	} else {
-		// Логирование доменов Gateway на основе VirtualService
-		ctrl.Log.WithValues(
-			"gatewayName", gateway.Name,
-			"gatewayNamespace", gateway.Namespace,
-			"domains", domains,
-		).Info("Gateway domains from VirtualService")
+		return ctrl.Result{}, err
 	}
 
-	// Обновление статуса пода оператора с информацией о Gateway и их доменах
-	if err := r.updateOperatorPodStatus(ctx); err != nil {
-		logger.Error(err, "failed to update operator pod status")
+	// Логирование доменов Gateway на основе VirtualService
+	ctrl.Log.WithValues(
+		"gatewayName", gateway.Name,
+		"gatewayNamespace", gateway.Namespace,
+		"domains", domains,
+	).Info("Gateway domains from VirtualService")
+
+	// Обновление GatewayCertificateStatus с состоянием доменов и сертификатов Gateway
+	if err := r.updateGatewayCertificateStatus(ctx, gateway, domains); err != nil {
+		logger.Error(err, "failed to update GatewayCertificateStatus")
+		return ctrl.Result{}, err
 	}
 
-	// Периодическая проверка ответственности Gateway за домены VirtualService
-	return ctrl.Result{RequeueAfter: 60 * time.Second}, nil
+	// Повторная реконсиляция запускается изменениями VirtualService и Certificate Gateway
+	return ctrl.Result{}, nil
 }
 
 // SetupWithManager настраивает контроллер
 func (r *GatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&istionetworkingv1beta1.Gateway{}).
+		Owns(&http01v1alpha1.GatewayCertificateStatus{}).
+		Watches(&istionetworkingv1beta1.VirtualService{}, handler.EnqueueRequestsFromMapFunc(r.gatewaysForVirtualService)).
+		Watches(&certmanagerv1.Certificate{}, handler.EnqueueRequestsFromMapFunc(r.gatewaysForCertificate)).
 		Complete(r)
 }
+
+// gatewaysForVirtualService возвращает запросы на реконсиляцию Gateway, на которые ссылается VirtualService
+// Хосты VirtualService определяют домены Gateway в GatewayCertificateStatus
+func (r *GatewayReconciler) gatewaysForVirtualService(_ context.Context, obj client.Object) []reconcile.Request {
+	refs := virtualServiceGatewayRefs(obj)
+	requests := make([]reconcile.Request, 0, len(refs))
+	for _, ref := range refs {
+		namespace, name := splitCredentialName(ref, obj.GetNamespace())
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{Name: name, Namespace: namespace},
+		})
+	}
+	return requests
+}
+
+// gatewaysForCertificate возвращает запросы на реконсиляцию Gateway, использующих секрет Certificate
+// Для временного сертификата учитываются Gateway, использующие временный секрет
+func (r *GatewayReconciler) gatewaysForCertificate(ctx context.Context, obj client.Object) []reconcile.Request {
+	cert, ok := obj.(*certmanagerv1.Certificate)
+	if !ok || cert.Spec.SecretName == "" {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, secretName := range []string{cert.Spec.SecretName, cert.Spec.SecretName + "-temp"} {
+		gatewayList := &istionetworkingv1beta1.GatewayList{}
+		if err := r.List(ctx, gatewayList, client.MatchingFields{gatewayCredentialNameIndex: secretName}); err != nil {
+			continue
+		}
+		for _, gateway := range gatewayList.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(gateway)})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,85 @@
+/*
+ * Интеграционные тесты GatewayReconciler (envtest):
+ *
+ * - GatewayCertificateStatus создается для Gateway, содержит домены VirtualService
+ *   и становится Ready после выпуска сертификата
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+var _ = Describe("GatewayReconciler", func() {
+	const (
+		host       = "app.example.com"
+		secretName = "app-tls"
+	)
+
+	BeforeEach(func() {
+		requireEnvtest()
+	})
+
+	It("reports domains and certificate readiness in GatewayCertificateStatus", func() {
+		namespace := createTestNamespace()
+
+		gateway := newTestGateway(namespace, "public", host, secretName)
+		Expect(k8sClient.Create(testCtx, gateway)).To(Succeed())
+		Expect(k8sClient.Create(testCtx, newTestVirtualService(namespace, "app", host, gateway.Name))).To(Succeed())
+
+		// SelfSigned issuer - Certificate не требует HTTP01 обработки и не меняет Gateway
+		issuer := &certmanagerv1.Issuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "selfsigned", Namespace: namespace},
+			Spec: certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{
+				SelfSigned: &certmanagerv1.SelfSignedIssuer{},
+			}},
+		}
+		Expect(k8sClient.Create(testCtx, issuer)).To(Succeed())
+		cert := &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace},
+			Spec: certmanagerv1.CertificateSpec{
+				SecretName: secretName,
+				DNSNames:   []string{host},
+				IssuerRef:  cmmeta.ObjectReference{Name: issuer.Name, Kind: certmanagerv1.IssuerKind},
+			},
+		}
+		Expect(k8sClient.Create(testCtx, cert)).To(Succeed())
+
+		statusKey := client.ObjectKeyFromObject(gateway)
+		By("creating GatewayCertificateStatus owned by the Gateway")
+		Eventually(func(g Gomega) {
+			status := &http01v1alpha1.GatewayCertificateStatus{}
+			g.Expect(k8sClient.Get(testCtx, statusKey, status)).To(Succeed())
+			g.Expect(status.Spec.GatewayRef.Name).To(Equal(gateway.Name))
+			g.Expect(metav1.GetControllerOf(status)).To(HaveField("Name", gateway.Name))
+
+			g.Expect(status.Status.Domains).To(HaveLen(1))
+			g.Expect(status.Status.Domains[0].Name).To(Equal(host))
+			g.Expect(status.Status.Certificates).To(HaveLen(1))
+			g.Expect(status.Status.Certificates[0].Name).To(Equal(cert.Name))
+
+			ready := meta.FindStatusCondition(status.Status.Conditions, http01v1alpha1.GatewayCertificateStatusConditionReady)
+			g.Expect(ready).NotTo(BeNil())
+			g.Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			g.Expect(ready.Reason).To(Equal("CertificatesNotReady"))
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+
+		By("becoming Ready once the certificate is issued")
+		setCertificateReady(client.ObjectKeyFromObject(cert), true)
+		Eventually(func(g Gomega) {
+			status := &http01v1alpha1.GatewayCertificateStatus{}
+			g.Expect(k8sClient.Get(testCtx, statusKey, status)).To(Succeed())
+			g.Expect(meta.IsStatusConditionTrue(status.Status.Conditions, http01v1alpha1.GatewayCertificateStatusConditionReady)).To(BeTrue())
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+	})
+})
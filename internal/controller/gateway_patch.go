@@ -0,0 +1,189 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - patchGateway(ctx, c, original, modified) error
+ *   Применяет изменения Gateway JSON patch'ем с test операциями от имени field manager istio-http01
+ *
+ * - gatewayJSONPatch(original, modified) ([]byte, error)
+ *   Формирует JSON patch от original к modified, защищая каждую операцию test операциями
+ *
+ * - gatewayPatchGuards(originalDoc, operation, tested) []jsonpatch.JsonPatchOperation
+ *   Возвращает test операции для операции patch: port и name сервера по индексу, исходное значение или отсутствие поля
+ *
+ * - retryGatewayPatch(fn) error
+ *   Повторяет чтение и изменение Gateway, если patch отклонен из-за конкурентного изменения
+ *
+ * - isGatewayPatchConflict(err) bool
+ *   Проверяет, отклонен ли patch из-за конфликта или проваленной test операции
+ *
+ * - jsonPointerValue(doc, pointer) (interface{}, bool)
+ *   Возвращает значение документа по JSON pointer (RFC 6901)
+ */
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gomodules.xyz/jsonpatch/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// gatewayFieldManager field manager изменений Gateway в managedFields
+	// GitOps инструменты могут игнорировать поля этого менеджера (Argo CD managedFieldsManagers)
+	gatewayFieldManager = "istio-http01"
+)
+
+// patchGateway применяет изменения modified относительно original JSON patch'ем
+// В отличие от Update, patch затрагивает только измененные поля (credentialName и httpsRedirect конкретных
+// серверов, аннотации оператора), а test операции отклоняют его, если эти поля изменены конкурентно.
+// Server-side apply не используется: списки servers и listeners атомарны, и apply забрал бы их целиком
+func patchGateway(ctx context.Context, c client.Client, original, modified client.Object) error {
+	data, err := gatewayJSONPatch(original, modified)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+	return c.Patch(ctx, modified, client.RawPatch(types.JSONPatchType, data), client.FieldOwner(gatewayFieldManager))
+}
+
+// gatewayJSONPatch формирует JSON patch от original к modified
+// Перед каждой операцией добавляются test операции (см. gatewayPatchGuards); возвращает nil без изменений
+func gatewayJSONPatch(original, modified client.Object) ([]byte, error) {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal original Gateway: %w", err)
+	}
+	modifiedJSON, err := json.Marshal(modified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal modified Gateway: %w", err)
+	}
+
+	operations, err := jsonpatch.CreatePatch(originalJSON, modifiedJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gateway patch: %w", err)
+	}
+	if len(operations) == 0 {
+		return nil, nil
+	}
+
+	var originalDoc interface{}
+	if err := json.Unmarshal(originalJSON, &originalDoc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal original Gateway: %w", err)
+	}
+
+	guarded := make([]jsonpatch.JsonPatchOperation, 0, 3*len(operations))
+	tested := make(map[string]bool)
+	for _, operation := range operations {
+		guarded = append(guarded, gatewayPatchGuards(originalDoc, operation, tested)...)
+		guarded = append(guarded, operation)
+	}
+
+	data, err := json.Marshal(guarded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Gateway patch: %w", err)
+	}
+	return data, nil
+}
+
+// gatewayPatchIdentityFields поля, по которым test операция узнает элемент списка servers или listeners
+// Gateway: операции адресуют элементы по индексу, а конкурентная вставка или перестановка серверов сдвигает
+// индексы. hosts не проверяются, чтобы конкурентное изменение хостов того же сервера не отклоняло patch
+var gatewayPatchIdentityFields = []string{"port", "name"}
+
+// gatewayPatchGuards возвращает test операции, которые отклоняют operation после конкурентного изменения Gateway:
+//   - для каждого элемента списка на пути операции - его поля идентификации из gatewayPatchIdentityFields
+//   - для replace и remove - исходное значение поля
+//   - для add - отсутствие поля (test со значением null проходит только для отсутствующего поля)
+//
+// tested содержит пути уже добавленных test операций, чтобы не повторять их в одном patch
+func gatewayPatchGuards(originalDoc interface{}, operation jsonpatch.JsonPatchOperation, tested map[string]bool) []jsonpatch.JsonPatchOperation {
+	var guards []jsonpatch.JsonPatchOperation
+	guard := func(path string, value interface{}) {
+		if !tested[path] {
+			tested[path] = true
+			guards = append(guards, jsonpatch.NewOperation("test", path, value))
+		}
+	}
+
+	tokens := strings.Split(strings.TrimPrefix(operation.Path, "/"), "/")
+	for i := 1; i < len(tokens); i++ {
+		parent, _ := jsonPointerValue(originalDoc, "/"+strings.Join(tokens[:i], "/"))
+		if _, isList := parent.([]interface{}); !isList || i+1 == len(tokens) {
+			continue
+		}
+		elementPath := "/" + strings.Join(tokens[:i+1], "/")
+		element, _ := jsonPointerValue(originalDoc, elementPath)
+		fields, _ := element.(map[string]interface{})
+		for _, field := range gatewayPatchIdentityFields {
+			if value, ok := fields[field]; ok {
+				guard(elementPath+"/"+field, value)
+			}
+		}
+	}
+
+	value, exists := jsonPointerValue(originalDoc, operation.Path)
+	switch operation.Operation {
+	case "replace", "remove":
+		if exists {
+			guard(operation.Path, value)
+		}
+	case "add":
+		// Вставка в список (индекс или "-") не проверяется: существующие элементы защищены полями идентификации
+		parent, _ := jsonPointerValue(originalDoc, operation.Path[:strings.LastIndex(operation.Path, "/")])
+		if _, isList := parent.([]interface{}); !exists && !isList {
+			guard(operation.Path, json.RawMessage("null"))
+		}
+	}
+	return guards
+}
+
+// retryGatewayPatch повторяет fn (чтение, изменение и patch Gateway), пока patch отклоняется
+// из-за конкурентного изменения тех же полей; прочие ошибки возвращаются сразу
+func retryGatewayPatch(fn func() error) error {
+	return retry.OnError(retry.DefaultRetry, isGatewayPatchConflict, fn)
+}
+
+// isGatewayPatchConflict проверяет, отклонен ли patch из-за конфликта версий или проваленной test операции
+// kube-apiserver возвращает ошибку test операции JSON patch как 422 Invalid
+func isGatewayPatchConflict(err error) bool {
+	return apierrors.IsConflict(err) || (apierrors.IsInvalid(err) && strings.Contains(err.Error(), "testing value"))
+}
+
+// jsonPointerValue возвращает значение документа по JSON pointer (RFC 6901)
+func jsonPointerValue(doc interface{}, pointer string) (interface{}, bool) {
+	if pointer == "" {
+		return doc, true
+	}
+	current := doc
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,189 @@
+/*
+ * Тесты изменения Gateway JSON patch'ем (gateway_patch.go):
+ *
+ * - gatewayJSONPatch: test операции перед replace, remove и add, пустой patch без изменений
+ * - patchGateway: конкурентные изменения других полей Gateway сохраняются
+ * - patchGateway: add отклоняется после вставки сервера и после конкурентного добавления аннотаций
+ * - isGatewayPatchConflict: конфликт версий и проваленная test операция
+ */
+
+package controller
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testPatchGateway возвращает Istio Gateway с HTTP и HTTPS серверами
+func testPatchGateway() *istionetworkingv1beta1.Gateway {
+	return &istionetworkingv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway", Namespace: "app"},
+		Spec: istioapinetworkingv1beta1.Gateway{
+			Servers: []*istioapinetworkingv1beta1.Server{
+				{
+					Port:  &istioapinetworkingv1beta1.Port{Number: 80, Name: "http", Protocol: "HTTP"},
+					Hosts: []string{"app.example.com"},
+					Tls:   &istioapinetworkingv1beta1.ServerTLSSettings{HttpsRedirect: true},
+				},
+				{
+					Port:  &istioapinetworkingv1beta1.Port{Number: 443, Name: "https", Protocol: "HTTPS"},
+					Hosts: []string{"app.example.com"},
+					Tls: &istioapinetworkingv1beta1.ServerTLSSettings{
+						Mode:           istioapinetworkingv1beta1.ServerTLSSettings_SIMPLE,
+						CredentialName: "app-tls",
+					},
+				},
+			},
+		},
+	}
+}
+
+// patchOperations разбирает JSON patch в список операций
+func patchOperations(data []byte) []map[string]interface{} {
+	var operations []map[string]interface{}
+	Expect(json.Unmarshal(data, &operations)).To(Succeed())
+	return operations
+}
+
+var _ = Describe("Gateway JSON patch", func() {
+	It("guards replaced fields with test operations", func() {
+		original := testPatchGateway()
+		modified := original.DeepCopy()
+		modified.Spec.Servers[1].Tls.CredentialName = "app-tls-temp"
+		modified.Annotations = map[string]string{"istio-http01.rieset.io/original-credential-name-app-tls": "app-tls"}
+
+		data, err := gatewayJSONPatch(original, modified)
+		Expect(err).NotTo(HaveOccurred())
+
+		operations := patchOperations(data)
+		Expect(operations).To(ContainElement(And(
+			HaveKeyWithValue("op", "test"),
+			HaveKeyWithValue("path", "/spec/servers/1/tls/credentialName"),
+			HaveKeyWithValue("value", "app-tls"),
+		)))
+		Expect(operations).To(ContainElement(And(
+			HaveKeyWithValue("op", "replace"),
+			HaveKeyWithValue("path", "/spec/servers/1/tls/credentialName"),
+			HaveKeyWithValue("value", "app-tls-temp"),
+		)))
+		Expect(operations).To(ContainElement(And(
+			HaveKeyWithValue("op", "test"),
+			HaveKeyWithValue("path", "/spec/servers/1/port"),
+		)))
+		Expect(operations).To(ContainElement(And(
+			HaveKeyWithValue("op", "test"),
+			HaveKeyWithValue("path", "/metadata/annotations"),
+			HaveKeyWithValue("value", BeNil()),
+		)))
+		Expect(operations).To(ContainElement(And(
+			HaveKeyWithValue("op", "add"),
+			HaveKeyWithValue("path", "/metadata/annotations"),
+		)))
+		for _, operation := range operations {
+			Expect(operation["path"]).NotTo(HavePrefix("/spec/servers/0"))
+		}
+	})
+
+	It("returns no patch when nothing changed", func() {
+		original := testPatchGateway()
+		data, err := gatewayJSONPatch(original, original.DeepCopy())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(BeNil())
+	})
+
+	It("keeps concurrent changes of other fields", func() {
+		gateway := testPatchGateway()
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(gateway).Build()
+
+		original := &istionetworkingv1beta1.Gateway{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(gateway), original)).To(Succeed())
+
+		By("changing the Gateway after it was read")
+		concurrent := original.DeepCopy()
+		concurrent.Labels = map[string]string{"team": "platform"}
+		concurrent.Spec.Servers[0].Hosts = append(concurrent.Spec.Servers[0].Hosts, "www.example.com")
+		Expect(c.Update(testCtx, concurrent)).To(Succeed())
+
+		modified := original.DeepCopy()
+		modified.Spec.Servers[0].Tls.HttpsRedirect = false
+		Expect(patchGateway(testCtx, c, original, modified)).To(Succeed())
+
+		result := &istionetworkingv1beta1.Gateway{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(gateway), result)).To(Succeed())
+		Expect(result.Labels).To(HaveKeyWithValue("team", "platform"))
+		Expect(result.Spec.Servers[0].Hosts).To(ContainElement("www.example.com"))
+		Expect(result.Spec.Servers[0].Tls.HttpsRedirect).To(BeFalse())
+		Expect(result.Spec.Servers[1].Tls.CredentialName).To(Equal("app-tls"))
+	})
+
+	It("rejects restoring httpsRedirect after a server was inserted before it", func() {
+		gateway := testPatchGateway()
+		gateway.Spec.Servers[0].Tls = nil
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(gateway).Build()
+
+		original := &istionetworkingv1beta1.Gateway{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(gateway), original)).To(Succeed())
+
+		By("inserting a server at the index of the HTTP server after the Gateway was read")
+		concurrent := original.DeepCopy()
+		concurrent.Spec.Servers = append([]*istioapinetworkingv1beta1.Server{{
+			Port:  &istioapinetworkingv1beta1.Port{Number: 8080, Name: "http-alt", Protocol: "HTTP"},
+			Hosts: []string{"internal.example.com"},
+		}}, concurrent.Spec.Servers...)
+		Expect(c.Update(testCtx, concurrent)).To(Succeed())
+
+		modified := original.DeepCopy()
+		modified.Spec.Servers[0].Tls = &istioapinetworkingv1beta1.ServerTLSSettings{HttpsRedirect: true}
+		// fake client возвращает ошибку json patch без обертки 422 Invalid kube-apiserver
+		Expect(patchGateway(testCtx, c, original, modified)).To(MatchError(ContainSubstring("testing value /spec/servers/0/port")))
+
+		result := &istionetworkingv1beta1.Gateway{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(gateway), result)).To(Succeed())
+		Expect(result.Spec.Servers[0].Port.Name).To(Equal("http-alt"))
+		Expect(result.Spec.Servers[0].Tls).To(BeNil())
+	})
+
+	It("rejects adding the annotations map after annotations were added concurrently", func() {
+		gateway := testPatchGateway()
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(gateway).Build()
+
+		original := &istionetworkingv1beta1.Gateway{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(gateway), original)).To(Succeed())
+		Expect(original.Annotations).To(BeEmpty())
+
+		By("adding annotations after the Gateway was read")
+		concurrent := original.DeepCopy()
+		concurrent.Annotations = map[string]string{"team": "platform"}
+		Expect(c.Update(testCtx, concurrent)).To(Succeed())
+
+		modified := original.DeepCopy()
+		modified.Spec.Servers[1].Tls.CredentialName = "app-tls-temp"
+		modified.Annotations = map[string]string{"istio-http01.rieset.io/original-credential-name-app-tls": "app-tls"}
+		Expect(patchGateway(testCtx, c, original, modified)).To(MatchError(ContainSubstring("testing value /metadata/annotations")))
+
+		result := &istionetworkingv1beta1.Gateway{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(gateway), result)).To(Succeed())
+		Expect(result.Annotations).To(Equal(map[string]string{"team": "platform"}))
+		Expect(result.Spec.Servers[1].Tls.CredentialName).To(Equal("app-tls"))
+	})
+
+	It("retries on conflicts and failed test operations only", func() {
+		gatewayResource := schema.GroupResource{Group: "networking.istio.io", Resource: "gateways"}
+		Expect(isGatewayPatchConflict(apierrors.NewConflict(gatewayResource, "gateway", nil))).To(BeTrue())
+		Expect(isGatewayPatchConflict(apierrors.NewInvalid(schema.GroupKind{Group: "networking.istio.io", Kind: "Gateway"}, "gateway",
+			field.ErrorList{field.Invalid(field.NewPath("spec"), nil, "the server rejected our request due to an error in our request: testing value /spec/servers/1/tls/credentialName failed")},
+		))).To(BeTrue())
+		Expect(isGatewayPatchConflict(apierrors.NewNotFound(gatewayResource, "gateway"))).To(BeFalse())
+	})
+})
@@ -0,0 +1,234 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - isTLSTerminatingServer(server) bool
+ *   Проверяет, терминирует ли сервер Istio Gateway TLS секретом из credentialName (HTTPS или TLS протокол)
+ *
+ * - isHTTPServer(server) bool
+ *   Проверяет, обслуживает ли сервер Istio Gateway открытый HTTP (протокол HTTP или HTTP2)
+ *
+ * - serverHostsOverlap(serverHosts, dnsNames) bool
+ *   Проверяет, пересекаются ли hosts сервера Gateway с DNS именами сертификата
+ *
+ * - hostsOverlap(a, b) bool
+ *   Проверяет, может ли один домен (с учетом wildcard) совпасть с другим
+ *
+ * - certificateHosts(cert) []string
+ *   Возвращает DNS имена и commonName сертификата
+ *
+ * - gatewayServerKey(server) string
+ *   Возвращает ключ сервера Gateway для аннотации с отключенными httpsRedirect
+ *
+ * - disableServerHTTPSRedirects(gateway, secretName, hosts) bool
+ *   Отключает httpsRedirect на HTTP серверах, hosts которых пересекаются с доменами сертификата, и записывает их ключи
+ *
+ * - restoreServerHTTPSRedirects(gateway, secretName) (bool, bool)
+ *   Включает httpsRedirect на серверах, записанных для секрета, и удаляет аннотацию
+ *
+ * - httpsRedirectServerKeys(gateway, exceptSecretName) map[string]bool
+ *   Возвращает ключи серверов, httpsRedirect которых отключен для других секретов
+ */
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+const (
+	// originalHTTPSRedirectAnnotationPrefix префикс аннотации Gateway с ключами серверов (JSON список),
+	// на которых оператор отключил httpsRedirect для секрета. Значение "true" (прежние версии) - все HTTP серверы
+	originalHTTPSRedirectAnnotationPrefix = "istio-http01.rieset.io/original-https-redirect-"
+)
+
+// isTLSTerminatingServer проверяет, терминирует ли сервер TLS секретом из credentialName
+// Сервер классифицируется по протоколу порта (HTTPS или TLS) и режиму TLS, а не по номеру порта:
+// PASSTHROUGH, AUTO_PASSTHROUGH и ISTIO_MUTUAL не используют credentialName
+func isTLSTerminatingServer(server *istioapinetworkingv1beta1.Server) bool {
+	if server.GetTls() == nil {
+		return false
+	}
+	switch strings.ToUpper(server.GetPort().GetProtocol()) {
+	case "HTTPS", "TLS":
+	default:
+		return false
+	}
+	switch server.GetTls().GetMode() {
+	case istioapinetworkingv1beta1.ServerTLSSettings_SIMPLE,
+		istioapinetworkingv1beta1.ServerTLSSettings_MUTUAL,
+		istioapinetworkingv1beta1.ServerTLSSettings_OPTIONAL_MUTUAL:
+		return true
+	default:
+		return false
+	}
+}
+
+// isHTTPServer проверяет, обслуживает ли сервер открытый HTTP, на котором может быть включен httpsRedirect
+func isHTTPServer(server *istioapinetworkingv1beta1.Server) bool {
+	switch strings.ToUpper(server.GetPort().GetProtocol()) {
+	case "HTTP", "HTTP2":
+		return true
+	default:
+		return false
+	}
+}
+
+// serverHostsOverlap проверяет, пересекаются ли hosts сервера ("namespace/domain" или "domain") с DNS именами
+// Пустой список dnsNames означает любой домен
+func serverHostsOverlap(serverHosts, dnsNames []string) bool {
+	if len(dnsNames) == 0 {
+		return true
+	}
+	for _, serverHost := range serverHosts {
+		// Namespace в hosts сервера ограничивает VirtualService, но не домены
+		if _, host, found := strings.Cut(serverHost, "/"); found {
+			serverHost = host
+		}
+		for _, dnsName := range dnsNames {
+			if hostsOverlap(serverHost, dnsName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hostsOverlap проверяет, может ли запрос к одному домену совпасть с другим
+// "*" совпадает с любым доменом, "*.example.com" - с любым поддоменом example.com
+func hostsOverlap(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a == b || a == "*" || b == "*" {
+		return true
+	}
+	suffixA, wildcardA := strings.CutPrefix(a, "*")
+	suffixB, wildcardB := strings.CutPrefix(b, "*")
+	switch {
+	case wildcardA && wildcardB:
+		return strings.HasSuffix(suffixA, suffixB) || strings.HasSuffix(suffixB, suffixA)
+	case wildcardA:
+		return strings.HasSuffix(b, suffixA)
+	case wildcardB:
+		return strings.HasSuffix(a, suffixB)
+	default:
+		return false
+	}
+}
+
+// certificateHosts возвращает DNS имена и commonName сертификата
+func certificateHosts(cert *certmanagerv1.Certificate) []string {
+	hosts := slices.Clone(cert.Spec.DNSNames)
+	if cert.Spec.CommonName != "" {
+		hosts = append(hosts, cert.Spec.CommonName)
+	}
+	return hosts
+}
+
+// gatewayServerKey возвращает ключ сервера: имя сервера или "<порт>/<hosts через запятую>"
+func gatewayServerKey(server *istioapinetworkingv1beta1.Server) string {
+	if server.GetName() != "" {
+		return server.GetName()
+	}
+	return fmt.Sprintf("%d/%s", server.GetPort().GetNumber(), strings.Join(server.GetHosts(), ","))
+}
+
+// disableServerHTTPSRedirects отключает httpsRedirect на HTTP серверах, hosts которых пересекаются с hosts,
+// и записывает ключи этих серверов в аннотацию секрета. Серверы, httpsRedirect которых уже отключен для
+// другого секрета, тоже записываются, чтобы восстановление первого секрета их не включило
+// Возвращает true, если httpsRedirect отключен хотя бы на одном сервере
+func disableServerHTTPSRedirects(gateway *istionetworkingv1beta1.Gateway, secretName string, hosts []string) bool {
+	annotationKey := originalHTTPSRedirectAnnotationPrefix + secretName
+	value, recorded := gateway.Annotations[annotationKey]
+	legacy := recorded && value == tempLabelValue
+
+	var keys []string
+	if recorded && !legacy {
+		_ = json.Unmarshal([]byte(value), &keys)
+	}
+	sharedKeys := httpsRedirectServerKeys(gateway, secretName)
+
+	disabled := false
+	for _, server := range gateway.Spec.Servers {
+		if !isHTTPServer(server) || server.Tls == nil || !serverHostsOverlap(server.Hosts, hosts) {
+			continue
+		}
+		key := gatewayServerKey(server)
+		switch {
+		case server.Tls.HttpsRedirect:
+			server.Tls.HttpsRedirect = false
+			disabled = true
+		case !sharedKeys[key]:
+			continue
+		}
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	// Аннотация прежних версий восстанавливает все HTTP серверы и не переписывается
+	if !legacy && len(keys) > 0 {
+		slices.Sort(keys)
+		data, _ := json.Marshal(keys)
+		if gateway.Annotations == nil {
+			gateway.Annotations = make(map[string]string)
+		}
+		gateway.Annotations[annotationKey] = string(data)
+	}
+	return disabled
+}
+
+// restoreServerHTTPSRedirects включает httpsRedirect на HTTP серверах, записанных в аннотации секрета,
+// кроме серверов, которые еще нужны другим секретам, и удаляет аннотацию
+// Возвращает, включен ли httpsRedirect хотя бы на одном сервере и была ли аннотация
+func restoreServerHTTPSRedirects(gateway *istionetworkingv1beta1.Gateway, secretName string) (restored, found bool) {
+	annotationKey := originalHTTPSRedirectAnnotationPrefix + secretName
+	value, found := gateway.Annotations[annotationKey]
+	if !found {
+		return false, false
+	}
+	legacy := value == tempLabelValue
+	var keys []string
+	if !legacy {
+		_ = json.Unmarshal([]byte(value), &keys)
+	}
+	sharedKeys := httpsRedirectServerKeys(gateway, secretName)
+
+	for _, server := range gateway.Spec.Servers {
+		if !isHTTPServer(server) || server.Tls == nil || server.Tls.HttpsRedirect {
+			continue
+		}
+		key := gatewayServerKey(server)
+		if sharedKeys[key] || (!legacy && !slices.Contains(keys, key)) {
+			continue
+		}
+		server.Tls.HttpsRedirect = true
+		restored = true
+	}
+	delete(gateway.Annotations, annotationKey)
+	return restored, true
+}
+
+// httpsRedirectServerKeys возвращает ключи серверов, httpsRedirect которых отключен для других секретов
+func httpsRedirectServerKeys(gateway *istionetworkingv1beta1.Gateway, exceptSecretName string) map[string]bool {
+	keys := make(map[string]bool)
+	for annotation, value := range gateway.Annotations {
+		secretName, ok := strings.CutPrefix(annotation, originalHTTPSRedirectAnnotationPrefix)
+		if !ok || secretName == exceptSecretName {
+			continue
+		}
+		var serverKeys []string
+		if err := json.Unmarshal([]byte(value), &serverKeys); err != nil {
+			continue
+		}
+		for _, key := range serverKeys {
+			keys[key] = true
+		}
+	}
+	return keys
+}
@@ -0,0 +1,112 @@
+/*
+ * Тесты классификации серверов Gateway (gateway_servers.go):
+ *
+ * - isTLSTerminatingServer / isHTTPServer: протокол и режим TLS вместо номера порта
+ * - hostsOverlap: точные домены, wildcard и namespace в hosts сервера
+ * - disableServerHTTPSRedirects / restoreServerHTTPSRedirects: только серверы доменов сертификата,
+ *   общие серверы нескольких сертификатов восстанавливаются последним из них
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testServersGateway возвращает Gateway с HTTP серверами на порту 8080 для двух доменов и HTTPS сервером на 8443
+func testServersGateway() *istionetworkingv1beta1.Gateway {
+	return &istionetworkingv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: "app"},
+		Spec: istioapinetworkingv1beta1.Gateway{
+			Servers: []*istioapinetworkingv1beta1.Server{
+				{
+					Name:  "app-http",
+					Port:  &istioapinetworkingv1beta1.Port{Number: 8080, Name: "http-app", Protocol: "HTTP"},
+					Hosts: []string{"app/app.example.com"},
+					Tls:   &istioapinetworkingv1beta1.ServerTLSSettings{HttpsRedirect: true},
+				},
+				{
+					Port:  &istioapinetworkingv1beta1.Port{Number: 8080, Name: "http-shop", Protocol: "HTTP"},
+					Hosts: []string{"shop.example.org"},
+					Tls:   &istioapinetworkingv1beta1.ServerTLSSettings{HttpsRedirect: true},
+				},
+				{
+					Port:  &istioapinetworkingv1beta1.Port{Number: 8443, Name: "https", Protocol: "HTTPS"},
+					Hosts: []string{"*.example.com"},
+					Tls: &istioapinetworkingv1beta1.ServerTLSSettings{
+						Mode:           istioapinetworkingv1beta1.ServerTLSSettings_SIMPLE,
+						CredentialName: "app-tls",
+					},
+				},
+			},
+		},
+	}
+}
+
+var _ = Describe("Gateway servers", func() {
+	It("classifies servers by protocol and TLS mode", func() {
+		gateway := testServersGateway()
+		Expect(isHTTPServer(gateway.Spec.Servers[0])).To(BeTrue())
+		Expect(isTLSTerminatingServer(gateway.Spec.Servers[0])).To(BeFalse())
+		Expect(isTLSTerminatingServer(gateway.Spec.Servers[2])).To(BeTrue())
+		Expect(isHTTPServer(gateway.Spec.Servers[2])).To(BeFalse())
+
+		By("skipping TLS passthrough servers")
+		passthrough := &istioapinetworkingv1beta1.Server{
+			Port: &istioapinetworkingv1beta1.Port{Number: 443, Name: "tls", Protocol: "TLS"},
+			Tls:  &istioapinetworkingv1beta1.ServerTLSSettings{Mode: istioapinetworkingv1beta1.ServerTLSSettings_PASSTHROUGH},
+		}
+		Expect(isTLSTerminatingServer(passthrough)).To(BeFalse())
+	})
+
+	It("matches exact and wildcard hosts", func() {
+		Expect(hostsOverlap("app.example.com", "APP.example.com")).To(BeTrue())
+		Expect(hostsOverlap("*", "app.example.com")).To(BeTrue())
+		Expect(hostsOverlap("*.example.com", "app.example.com")).To(BeTrue())
+		Expect(hostsOverlap("app.example.com", "*.example.com")).To(BeTrue())
+		Expect(hostsOverlap("*.example.com", "*.api.example.com")).To(BeTrue())
+		Expect(hostsOverlap("*.example.com", "example.com")).To(BeFalse())
+		Expect(hostsOverlap("shop.example.org", "app.example.com")).To(BeFalse())
+		Expect(serverHostsOverlap([]string{"app/app.example.com"}, []string{"app.example.com"})).To(BeTrue())
+	})
+
+	It("disables and restores httpsRedirect only on the servers of the certificate", func() {
+		gateway := testServersGateway()
+
+		Expect(disableServerHTTPSRedirects(gateway, "app-tls", []string{"app.example.com"})).To(BeTrue())
+		Expect(gateway.Spec.Servers[0].Tls.HttpsRedirect).To(BeFalse())
+		Expect(gateway.Spec.Servers[1].Tls.HttpsRedirect).To(BeTrue())
+		Expect(gateway.Annotations).To(HaveKeyWithValue(originalHTTPSRedirectAnnotationPrefix+"app-tls", `["app-http"]`))
+
+		By("not disabling anything twice")
+		Expect(disableServerHTTPSRedirects(gateway, "app-tls", []string{"app.example.com"})).To(BeFalse())
+
+		restored, found := restoreServerHTTPSRedirects(gateway, "app-tls")
+		Expect(restored).To(BeTrue())
+		Expect(found).To(BeTrue())
+		Expect(gateway.Spec.Servers[0].Tls.HttpsRedirect).To(BeTrue())
+		Expect(gateway.Annotations).NotTo(HaveKey(originalHTTPSRedirectAnnotationPrefix + "app-tls"))
+	})
+
+	It("keeps a shared server disabled until the last certificate is restored", func() {
+		gateway := testServersGateway()
+
+		Expect(disableServerHTTPSRedirects(gateway, "app-tls", []string{"app.example.com"})).To(BeTrue())
+		Expect(disableServerHTTPSRedirects(gateway, "www-tls", []string{"*.example.com"})).To(BeFalse())
+		Expect(gateway.Annotations).To(HaveKeyWithValue(originalHTTPSRedirectAnnotationPrefix+"www-tls", `["app-http"]`))
+
+		restored, _ := restoreServerHTTPSRedirects(gateway, "app-tls")
+		Expect(restored).To(BeFalse())
+		Expect(gateway.Spec.Servers[0].Tls.HttpsRedirect).To(BeFalse())
+
+		restored, _ = restoreServerHTTPSRedirects(gateway, "www-tls")
+		Expect(restored).To(BeTrue())
+		Expect(gateway.Spec.Servers[0].Tls.HttpsRedirect).To(BeTrue())
+		Expect(gateway.Spec.Servers[1].Tls.HttpsRedirect).To(BeTrue())
+	})
+})
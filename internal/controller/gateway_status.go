@@ -1,8 +1,126 @@
 /*
- * Функции Gateway status перенесены в отдельные модули:
+ * Функции, определенные в этом файле:
  *
- * - gateway_status_certificates.go - типы и функции для работы с сертификатами
- * - gateway_status_pod.go - функции для обновления статуса пода
+ * - (r *GatewayReconciler) updateGatewayCertificateStatus(ctx, gateway, domains) error
+ *   Создает или обновляет GatewayCertificateStatus Istio Gateway с состоянием доменов и сертификатов
+ *
+ * - (r *GatewayAPIReconciler) updateGatewayAPICertificateStatus(ctx, gateway, domains) error
+ *   Создает или обновляет GatewayCertificateStatus Gateway API Gateway
+ *
+ * - writeGatewayCertificateStatus(ctx, c, scheme, gateway, group, certificates, domains) error
+ *   Создает GatewayCertificateStatus Gateway (если его нет) и обновляет его статус
+ *
+ * Вспомогательные функции находятся в:
+ * - gateway_status_certificates.go - поиск сертификатов, используемых Gateway
+ * - gateway_status_build.go - формирование статуса и условий
+ * - gateway_status_match.go - сопоставление доменов с сертификатами
  */
 
 package controller
+
+import (
+	"context"
+	"fmt"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+// updateGatewayCertificateStatus создает или обновляет GatewayCertificateStatus для Istio Gateway
+func (r *GatewayReconciler) updateGatewayCertificateStatus(ctx context.Context, gateway *istionetworkingv1beta1.Gateway, domains []string) error {
+	certificates, err := r.getCertificatesForGateway(ctx, gateway)
+	if err != nil {
+		return err
+	}
+	return writeGatewayCertificateStatus(ctx, r.Client, r.Scheme, gateway, istionetworkingv1beta1.SchemeGroupVersion.Group, certificates, domains)
+}
+
+// updateGatewayAPICertificateStatus создает или обновляет GatewayCertificateStatus для Gateway API Gateway
+// Домены берутся из HTTPRoute, сертификаты - по certificateRefs listener'ов
+func (r *GatewayAPIReconciler) updateGatewayAPICertificateStatus(ctx context.Context, gateway *gatewayapiv1.Gateway, domains []string) error {
+	certificates, err := getCertificatesForGatewayAPI(ctx, r.Client, gateway)
+	if err != nil {
+		return err
+	}
+	return writeGatewayCertificateStatus(ctx, r.Client, r.Scheme, gateway, gatewayapiv1.GroupName, certificates, domains)
+}
+
+// writeGatewayCertificateStatus создает или обновляет GatewayCertificateStatus Gateway группы group
+// Ресурс имеет то же имя и namespace, что и Gateway, и принадлежит ему (удаляется вместе с Gateway).
+// Если ресурс уже описывает одноименный Gateway другой группы, он не изменяется
+func writeGatewayCertificateStatus(ctx context.Context, c client.Client, scheme *runtime.Scheme, gateway client.Object, group string, certificates []GatewayCertificate, domains []string) error {
+	logger := log.FromContext(ctx)
+
+	gatewayStatus := &http01v1alpha1.GatewayCertificateStatus{}
+	err := c.Get(ctx, client.ObjectKeyFromObject(gateway), gatewayStatus)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get GatewayCertificateStatus: %w", err)
+	}
+	if err == nil && gatewayStatus.Spec.GatewayRef.Group != "" && gatewayStatus.Spec.GatewayRef.Group != group {
+		logger.Info("GatewayCertificateStatus already describes a Gateway of another API group, skipping",
+			"gatewayName", gateway.GetName(),
+			"gatewayNamespace", gateway.GetNamespace(),
+			"group", group,
+			"statusGroup", gatewayStatus.Spec.GatewayRef.Group,
+		)
+		return nil
+	}
+	gatewayStatus.Name = gateway.GetName()
+	gatewayStatus.Namespace = gateway.GetNamespace()
+
+	// Создаем ресурс (или обновляем spec) - статус обновляется отдельно через subresource
+	if _, err := controllerutil.CreateOrUpdate(ctx, c, gatewayStatus, func() error {
+		if gatewayStatus.Labels == nil {
+			gatewayStatus.Labels = make(map[string]string)
+		}
+		gatewayStatus.Labels["app.kubernetes.io/managed-by"] = istioHTTP01ManagedByLabel
+		gatewayStatus.Spec.GatewayRef = http01v1alpha1.GatewayReference{
+			Group: group,
+			Kind:  "Gateway",
+			Name:  gateway.GetName(),
+		}
+		return ctrl.SetControllerReference(gateway, gatewayStatus, scheme)
+	}); err != nil {
+		return fmt.Errorf("failed to create or update GatewayCertificateStatus: %w", err)
+	}
+
+	generation := gateway.GetGeneration()
+	status := gatewayStatus.Status.DeepCopy()
+	status.ObservedGeneration = generation
+	status.Certificates = buildCertificateStatuses(certificates, gatewayStatus.Status.Certificates, generation)
+	status.Domains = buildDomainStatuses(domains, certificates, gatewayStatus.Status.Domains, generation)
+	meta.SetStatusCondition(&status.Conditions, buildGatewayReadyCondition(status.Domains, certificates, generation))
+
+	// Обновляем статус только при изменениях, чтобы не порождать лишние события
+	if equality.Semantic.DeepEqual(&gatewayStatus.Status, status) {
+		return nil
+	}
+
+	gatewayStatus.Status = *status
+	if err := c.Status().Update(ctx, gatewayStatus); err != nil {
+		return fmt.Errorf("failed to update GatewayCertificateStatus status: %w", err)
+	}
+
+	readyCondition := meta.FindStatusCondition(status.Conditions, http01v1alpha1.GatewayCertificateStatusConditionReady)
+	logger.Info("Updated GatewayCertificateStatus",
+		"gatewayName", gateway.GetName(),
+		"gatewayNamespace", gateway.GetNamespace(),
+		"group", group,
+		"domainCount", len(status.Domains),
+		"certificateCount", len(status.Certificates),
+		"ready", readyCondition.Status,
+		"reason", readyCondition.Reason,
+	)
+
+	return nil
+}
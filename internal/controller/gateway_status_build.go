@@ -0,0 +1,214 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - buildCertificateStatuses(certificates, existing, generation) []CertificateStatus
+ *   Формирует статус сертификатов Gateway с условиями Ready и TemporaryCertificateActive
+ *
+ * - buildDomainStatuses(domains, certificates, existing, generation) []DomainStatus
+ *   Формирует статус доменов Gateway с условиями Covered и CertificateReady
+ *
+ * - buildGatewayReadyCondition(domains, certificates, generation) metav1.Condition
+ *   Формирует агрегированное условие Ready для Gateway
+ *
+ * Сопоставление доменов с сертификатами - в gateway_status_match.go
+ */
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+// buildCertificateStatuses формирует статус сертификатов Gateway
+// Условия переносятся из существующего статуса, чтобы lastTransitionTime менялся только при смене состояния
+func buildCertificateStatuses(certificates []GatewayCertificate, existing []http01v1alpha1.CertificateStatus, generation int64) []http01v1alpha1.CertificateStatus {
+	existingConditions := make(map[string][]metav1.Condition, len(existing))
+	for _, status := range existing {
+		existingConditions[fmt.Sprintf("%s/%s", status.Namespace, status.Name)] = status.Conditions
+	}
+
+	statuses := make([]http01v1alpha1.CertificateStatus, 0, len(certificates))
+	for _, gc := range certificates {
+		cert := gc.Certificate
+		status := http01v1alpha1.CertificateStatus{
+			Name:       cert.Name,
+			Namespace:  cert.Namespace,
+			SecretName: cert.Spec.SecretName,
+			DNSNames:   cert.Spec.DNSNames,
+			NotAfter:   cert.Status.NotAfter,
+		}
+		conditions := append([]metav1.Condition(nil), existingConditions[fmt.Sprintf("%s/%s", cert.Namespace, cert.Name)]...)
+
+		// Копия условия Ready из cert-manager
+		readyCondition := metav1.Condition{
+			Type:               http01v1alpha1.CertificateConditionReady,
+			Status:             metav1.ConditionUnknown,
+			ObservedGeneration: generation,
+			Reason:             "NotObserved",
+			Message:            "cert-manager has not reported the Ready condition yet",
+		}
+		for _, condition := range cert.Status.Conditions {
+			if condition.Type != certmanagerv1.CertificateConditionReady {
+				continue
+			}
+			readyCondition.Status = metav1.ConditionStatus(condition.Status)
+			if condition.Reason != "" {
+				readyCondition.Reason = condition.Reason
+			}
+			readyCondition.Message = condition.Message
+			break
+		}
+		meta.SetStatusCondition(&conditions, readyCondition)
+
+		// Использует ли Gateway временный секрет (хотя бы на одном сервере)
+		if gc.Temporary {
+			meta.SetStatusCondition(&conditions, metav1.Condition{
+				Type:               http01v1alpha1.CertificateConditionTemporary,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: generation,
+				Reason:             "TemporarySecretInUse",
+				Message: fmt.Sprintf("Gateway serves %s-temp on %d of %d servers until the certificate is issued",
+					cert.Spec.SecretName, gc.TemporaryServers, gc.Servers),
+			})
+		} else {
+			meta.SetStatusCondition(&conditions, metav1.Condition{
+				Type:               http01v1alpha1.CertificateConditionTemporary,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: generation,
+				Reason:             "OriginalSecretInUse",
+				Message:            fmt.Sprintf("Gateway serves %s", cert.Spec.SecretName),
+			})
+		}
+
+		status.Conditions = conditions
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// buildDomainStatuses формирует статус доменов Gateway
+// Домен считается покрытым, если он входит в dnsNames одного из сертификатов Gateway
+func buildDomainStatuses(domains []string, certificates []GatewayCertificate, existing []http01v1alpha1.DomainStatus, generation int64) []http01v1alpha1.DomainStatus {
+	existingConditions := make(map[string][]metav1.Condition, len(existing))
+	for _, status := range existing {
+		existingConditions[status.Name] = status.Conditions
+	}
+
+	sortedDomains := append([]string(nil), domains...)
+	sort.Strings(sortedDomains)
+
+	statuses := make([]http01v1alpha1.DomainStatus, 0, len(sortedDomains))
+	for _, domain := range sortedDomains {
+		status := http01v1alpha1.DomainStatus{Name: domain}
+		conditions := append([]metav1.Condition(nil), existingConditions[domain]...)
+
+		gc := findCertificateForDomain(certificates, domain)
+		if gc == nil {
+			meta.SetStatusCondition(&conditions, metav1.Condition{
+				Type:               http01v1alpha1.DomainConditionCovered,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: generation,
+				Reason:             "NoCertificate",
+				Message:            "No certificate used by the Gateway covers this domain",
+			})
+			meta.SetStatusCondition(&conditions, metav1.Condition{
+				Type:               http01v1alpha1.DomainConditionCertificateReady,
+				Status:             metav1.ConditionUnknown,
+				ObservedGeneration: generation,
+				Reason:             "NoCertificate",
+				Message:            "No certificate used by the Gateway covers this domain",
+			})
+			status.Conditions = conditions
+			statuses = append(statuses, status)
+			continue
+		}
+
+		certRef := fmt.Sprintf("%s/%s", gc.Certificate.Namespace, gc.Certificate.Name)
+		status.Certificate = certRef
+		meta.SetStatusCondition(&conditions, metav1.Condition{
+			Type:               http01v1alpha1.DomainConditionCovered,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: generation,
+			Reason:             "CertificateFound",
+			Message:            fmt.Sprintf("Domain is covered by certificate %s", certRef),
+		})
+		if isGatewayCertificateReady(gc.Certificate) {
+			meta.SetStatusCondition(&conditions, metav1.Condition{
+				Type:               http01v1alpha1.DomainConditionCertificateReady,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: generation,
+				Reason:             "CertificateIssued",
+				Message:            fmt.Sprintf("Certificate %s is ready", certRef),
+			})
+		} else {
+			meta.SetStatusCondition(&conditions, metav1.Condition{
+				Type:               http01v1alpha1.DomainConditionCertificateReady,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: generation,
+				Reason:             "CertificateNotReady",
+				Message:            fmt.Sprintf("Certificate %s is not ready", certRef),
+			})
+		}
+
+		status.Conditions = conditions
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// buildGatewayReadyCondition формирует агрегированное условие Ready для Gateway:
+// True, только если все домены покрыты и все сертификаты Gateway готовы
+func buildGatewayReadyCondition(domains []http01v1alpha1.DomainStatus, certificates []GatewayCertificate, generation int64) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               http01v1alpha1.GatewayCertificateStatusConditionReady,
+		ObservedGeneration: generation,
+	}
+
+	if len(certificates) == 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "NoCertificates"
+		condition.Message = "Gateway does not use secrets of any cert-manager Certificate"
+		return condition
+	}
+
+	var notReady []string
+	for _, gc := range certificates {
+		if !isGatewayCertificateReady(gc.Certificate) {
+			notReady = append(notReady, fmt.Sprintf("%s/%s", gc.Certificate.Namespace, gc.Certificate.Name))
+		}
+	}
+	if len(notReady) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "CertificatesNotReady"
+		condition.Message = fmt.Sprintf("Certificates not ready: %s", strings.Join(notReady, ", "))
+		return condition
+	}
+
+	var uncovered []string
+	for _, domain := range domains {
+		if !meta.IsStatusConditionTrue(domain.Conditions, http01v1alpha1.DomainConditionCovered) {
+			uncovered = append(uncovered, domain.Name)
+		}
+	}
+	if len(uncovered) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "DomainsNotCovered"
+		condition.Message = fmt.Sprintf("Domains not covered by any certificate: %s", strings.Join(uncovered, ", "))
+		return condition
+	}
+
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = "AllCertificatesReady"
+	condition.Message = fmt.Sprintf("%d certificate(s) ready for %d domain(s)", len(certificates), len(domains))
+	return condition
+}
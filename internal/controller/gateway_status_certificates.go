@@ -2,10 +2,13 @@
  * Функции, определенные в этом файле:
  *
  * - (r *GatewayReconciler) getCertificatesForGateway(ctx, gateway) ([]GatewayCertificate, error)
- *   Получает список сертификатов, используемых в Gateway
+ *   Получает список сертификатов, секреты которых (оригинальные или временные) используются в Gateway
  *
- * - (r *GatewayReconciler) getAllGatewaysWithCertificates(ctx) (map[string]GatewayInfo, error)
- *   Получает все Gateway с их доменами и сертификатами
+ * - getCertificatesForGatewayAPI(ctx, c, gateway) ([]GatewayCertificate, error)
+ *   Получает список сертификатов, секреты которых используются в certificateRefs Gateway API Gateway
+ *
+ * - getCertificatesForSecrets(ctx, c, secrets) ([]GatewayCertificate, error)
+ *   Находит сертификаты секретов серверов (listener'ов) Gateway и считает серверы с временным секретом
  */
 
 package controller
@@ -13,149 +16,117 @@ package controller
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
-	certmanagermetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
 )
 
-// GatewayCertificate содержит информацию о сертификате, используемом в Gateway
+// GatewayCertificate содержит сертификат, используемый в Gateway
 type GatewayCertificate struct {
-	Name      string   `json:"name"`
-	Namespace string   `json:"namespace"`
-	DNSNames  []string `json:"dnsNames"`
-	Ready     bool     `json:"ready"`
+	Certificate *certmanagerv1.Certificate
+	// Temporary - хотя бы один сервер Gateway сейчас использует временный секрет сертификата (<secretName>-temp)
+	Temporary bool
+	// Servers - число серверов Gateway с оригинальным или временным секретом сертификата
+	Servers int
+	// TemporaryServers - число серверов Gateway с временным секретом сертификата
+	TemporaryServers int
 }
 
-// GatewayInfo содержит информацию о Gateway, его доменах и сертификатах
-type GatewayInfo struct {
-	Domains      []string             `json:"domains"`
-	Certificates []GatewayCertificate `json:"certificates"`
+// gatewaySecretUsage использование секрета серверами Gateway
+type gatewaySecretUsage struct {
+	servers          int
+	temporaryServers int
 }
 
 // getCertificatesForGateway получает список сертификатов, используемых в Gateway
+// Учитывает как оригинальные секреты, так и временные (с суффиксом -temp), подставленные оператором
 func (r *GatewayReconciler) getCertificatesForGateway(ctx context.Context, gateway *istionetworkingv1beta1.Gateway) ([]GatewayCertificate, error) {
-	var certificates []GatewayCertificate
-	seenCertificates := make(map[string]bool) // Для исключения дубликатов
-
-	// Получение всех Certificate во всех namespace
-	certList := &certmanagerv1.CertificateList{}
-	if err := r.List(ctx, certList, client.InNamespace("")); err != nil {
-		return nil, fmt.Errorf("failed to list Certificates: %w", err)
-	}
-
-	// Собираем все credentialName из Gateway
-	credentialNames := make(map[string]string) // credentialName -> namespace
+	// Секрет каждого сервера; credentialName в формате "name" или "namespace/name"
+	var secrets []client.ObjectKey
 	for _, server := range gateway.Spec.Servers {
-		if server.Tls == nil {
-			continue
-		}
-		credentialName := server.Tls.CredentialName
-		if credentialName == "" {
+		if server.Tls == nil || server.Tls.CredentialName == "" {
 			continue
 		}
+		secretNamespace, credentialName := splitCredentialName(server.Tls.CredentialName, gateway.Namespace)
+		secrets = append(secrets, client.ObjectKey{Namespace: secretNamespace, Name: credentialName})
+	}
+	return getCertificatesForSecrets(ctx, r.Client, secrets)
+}
 
-		// Определяем namespace для credentialName
-		var secretNamespace string
-		if strings.Contains(credentialName, "/") {
-			// Формат "namespace/name"
-			parts := strings.Split(credentialName, "/")
-			if len(parts) == 2 {
-				secretNamespace = parts[0]
-				credentialName = parts[1]
-			}
-		} else {
-			// Формат "name" - секрет в том же namespace, что и Gateway
-			secretNamespace = gateway.Namespace
-		}
-
-		credentialNames[credentialName] = secretNamespace
+// getCertificatesForGatewayAPI получает список сертификатов, используемых в certificateRefs Gateway API Gateway
+// Namespace в certificateRef по умолчанию совпадает с namespace Gateway
+func getCertificatesForGatewayAPI(ctx context.Context, c client.Reader, gateway *gatewayapiv1.Gateway) ([]GatewayCertificate, error) {
+	var secrets []client.ObjectKey
+	for _, ref := range gatewayAPICertificateRefs(gateway) {
+		secretNamespace, secretName := splitCredentialName(ref, gateway.Namespace)
+		secrets = append(secrets, client.ObjectKey{Namespace: secretNamespace, Name: secretName})
 	}
+	return getCertificatesForSecrets(ctx, c, secrets)
+}
 
-	// Ищем Certificate, которые создают секреты с этими именами
-	for i := range certList.Items {
-		cert := certList.Items[i]
-		secretName := cert.Spec.SecretName
-		if secretName == "" {
-			continue
+// getCertificatesForSecrets находит сертификаты, создающие секреты серверов (listener'ов) Gateway
+// secrets содержит секрет каждого сервера. Признак временного секрета считается по серверам:
+// результат не зависит от порядка серверов в Gateway
+func getCertificatesForSecrets(ctx context.Context, c client.Reader, secrets []client.ObjectKey) ([]GatewayCertificate, error) {
+	// "namespace/name" -> число серверов с секретом и с временным секретом
+	usages := make(map[client.ObjectKey]*gatewaySecretUsage)
+	use := func(key client.ObjectKey, temporary bool) {
+		usage, ok := usages[key]
+		if !ok {
+			usage = &gatewaySecretUsage{}
+			usages[key] = usage
 		}
-
-		// Проверяем, совпадает ли secretName с одним из credentialName
-		for credName, credNamespace := range credentialNames {
-			if secretName == credName {
-				// Проверяем namespace
-				if cert.Namespace == credNamespace || credNamespace == "" {
-					// Проверяем, не добавляли ли мы уже этот сертификат
-					certKey := fmt.Sprintf("%s/%s", cert.Namespace, cert.Name)
-					if !seenCertificates[certKey] {
-						// Проверяем готовность сертификата
-						isReady := false
-						for _, condition := range cert.Status.Conditions {
-							if condition.Type == certmanagerv1.CertificateConditionReady {
-								isReady = condition.Status == certmanagermetav1.ConditionTrue
-								break
-							}
-						}
-
-						certificates = append(certificates, GatewayCertificate{
-							Name:      cert.Name,
-							Namespace: cert.Namespace,
-							DNSNames:  cert.Spec.DNSNames,
-							Ready:     isReady,
-						})
-						seenCertificates[certKey] = true
-					}
-					break
-				}
-			}
+		usage.servers++
+		if temporary {
+			usage.temporaryServers++
 		}
 	}
-
-	return certificates, nil
-}
-
-// getAllGatewaysWithCertificates получает все Gateway с их доменами и сертификатами
-func (r *GatewayReconciler) getAllGatewaysWithCertificates(ctx context.Context) (map[string]GatewayInfo, error) {
-	// Получение всех Gateway во всех namespace
-	gatewayList := &istionetworkingv1beta1.GatewayList{}
-	if err := r.List(ctx, gatewayList, client.InNamespace("")); err != nil {
-		return nil, err
+	for _, secret := range secrets {
+		use(secret, false)
+		// Временный секрет оператора ссылается на оригинальный сертификат
+		if originalName, isTemp := strings.CutSuffix(secret.Name, "-temp"); isTemp {
+			use(client.ObjectKey{Namespace: secret.Namespace, Name: originalName}, true)
+		}
 	}
 
-	gatewayInfoMap := make(map[string]GatewayInfo)
-
-	// Для каждого Gateway получаем домены и сертификаты
-	for i := range gatewayList.Items {
-		gateway := gatewayList.Items[i]
-
-		// Получаем домены
-		domains, err := r.getDomainsForGateway(ctx, gateway)
-		if err != nil {
-			continue // Пропускаем Gateway с ошибками
+	// Ищем Certificate, которые создают секреты с этими именами (по индексу spec.secretName)
+	var certificates []GatewayCertificate
+	for secretKey, usage := range usages {
+		certList := &certmanagerv1.CertificateList{}
+		if err := c.List(ctx, certList,
+			client.InNamespace(secretKey.Namespace),
+			client.MatchingFields{certificateSecretNameIndex: secretKey.Name},
+		); err != nil {
+			return nil, fmt.Errorf("failed to list Certificates: %w", err)
 		}
 
-		// Получаем сертификаты
-		certificates, err := r.getCertificatesForGateway(ctx, gateway)
-		if err != nil {
-			// Логируем ошибку, но продолжаем обработку
-			log.FromContext(ctx).Error(err, "failed to get certificates for Gateway",
-				"gateway", gateway.Name,
-				"gatewayNamespace", gateway.Namespace,
-			)
-			certificates = []GatewayCertificate{} // Используем пустой список при ошибке
+		for i := range certList.Items {
+			cert := &certList.Items[i]
+			// Временные сертификаты оператора не отражаются в статусе отдельно
+			if cert.Labels["istio-http01.rieset.io/temp"] == tempLabelValue {
+				continue
+			}
+			certificates = append(certificates, GatewayCertificate{
+				Certificate:      cert,
+				Temporary:        usage.temporaryServers > 0,
+				Servers:          usage.servers,
+				TemporaryServers: usage.temporaryServers,
+			})
 		}
+	}
 
-		// Используем формат "namespace/name" как ключ
-		gatewayKey := fmt.Sprintf("%s/%s", gateway.Namespace, gateway.Name)
-		gatewayInfoMap[gatewayKey] = GatewayInfo{
-			Domains:      domains,
-			Certificates: certificates,
+	sort.Slice(certificates, func(i, j int) bool {
+		a, b := certificates[i].Certificate, certificates[j].Certificate
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
 		}
-	}
+		return a.Name < b.Name
+	})
 
-	return gatewayInfoMap, nil
+	return certificates, nil
 }
@@ -0,0 +1,59 @@
+/*
+ * Тесты поиска сертификатов Gateway для GatewayCertificateStatus (gateway_status_certificates.go):
+ *
+ * - getCertificatesForGateway: признак временного секрета не зависит от порядка серверов Gateway
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Gateway certificates for GatewayCertificateStatus", func() {
+	It("counts servers on the temporary secret regardless of server order", func() {
+		cert := &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "app"},
+			Spec:       certmanagerv1.CertificateSpec{SecretName: "app-tls", DNSNames: []string{"app.example.com"}},
+		}
+		httpsServer := func(name, credentialName string) *istioapinetworkingv1beta1.Server {
+			return &istioapinetworkingv1beta1.Server{
+				Port:  &istioapinetworkingv1beta1.Port{Number: 443, Name: name, Protocol: "HTTPS"},
+				Hosts: []string{"app.example.com"},
+				Tls: &istioapinetworkingv1beta1.ServerTLSSettings{
+					Mode:           istioapinetworkingv1beta1.ServerTLSSettings_SIMPLE,
+					CredentialName: credentialName,
+				},
+			}
+		}
+
+		for _, servers := range [][]*istioapinetworkingv1beta1.Server{
+			{httpsServer("original", "app-tls"), httpsServer("temporary", "app-tls-temp")},
+			{httpsServer("temporary", "app-tls-temp"), httpsServer("original", "app-tls")},
+		} {
+			gateway := &istionetworkingv1beta1.Gateway{
+				ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: "app"},
+				Spec:       istioapinetworkingv1beta1.Gateway{Servers: servers},
+			}
+			c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+				WithObjects(cert).
+				WithIndex(&certmanagerv1.Certificate{}, certificateSecretNameIndex, certificateSecretName).
+				Build()
+			r := &GatewayReconciler{Client: c, Scheme: c.Scheme()}
+
+			certificates, err := r.getCertificatesForGateway(testCtx, gateway)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(certificates).To(HaveLen(1))
+			Expect(certificates[0].Temporary).To(BeTrue())
+			Expect(certificates[0].Servers).To(Equal(2))
+			Expect(certificates[0].TemporaryServers).To(Equal(1))
+		}
+	})
+})
@@ -0,0 +1,70 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - findCertificateForDomain(certificates, domain) *GatewayCertificate
+ *   Находит сертификат, DNS имена которого покрывают домен (предпочитая готовый)
+ *
+ * - dnsNameMatchesDomain(dnsName, domain) bool
+ *   Проверяет, покрывает ли DNS имя сертификата домен (с учетом wildcard)
+ *
+ * - isGatewayCertificateReady(cert) bool
+ *   Проверяет условие Ready сертификата cert-manager
+ */
+
+package controller
+
+import (
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	certmanagermetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+)
+
+// findCertificateForDomain находит сертификат, DNS имена которого покрывают домен
+// Если домен покрывают несколько сертификатов, предпочитается готовый
+func findCertificateForDomain(certificates []GatewayCertificate, domain string) *GatewayCertificate {
+	var found *GatewayCertificate
+	for i := range certificates {
+		gc := &certificates[i]
+		for _, dnsName := range gc.Certificate.Spec.DNSNames {
+			if !dnsNameMatchesDomain(dnsName, domain) {
+				continue
+			}
+			if isGatewayCertificateReady(gc.Certificate) {
+				return gc
+			}
+			if found == nil {
+				found = gc
+			}
+			break
+		}
+	}
+	return found
+}
+
+// dnsNameMatchesDomain проверяет, покрывает ли DNS имя сертификата домен
+// Wildcard "*.example.com" покрывает ровно один уровень поддомена ("app.example.com")
+func dnsNameMatchesDomain(dnsName, domain string) bool {
+	dnsName = strings.ToLower(dnsName)
+	domain = strings.ToLower(domain)
+	if dnsName == domain {
+		return true
+	}
+
+	suffix, isWildcard := strings.CutPrefix(dnsName, "*.")
+	if !isWildcard {
+		return false
+	}
+	label, rest, found := strings.Cut(domain, ".")
+	return found && label != "" && label != "*" && rest == suffix
+}
+
+// isGatewayCertificateReady проверяет условие Ready сертификата cert-manager
+func isGatewayCertificateReady(cert *certmanagerv1.Certificate) bool {
+	for _, condition := range cert.Status.Conditions {
+		if condition.Type == certmanagerv1.CertificateConditionReady {
+			return condition.Status == certmanagermetav1.ConditionTrue
+		}
+	}
+	return false
+}
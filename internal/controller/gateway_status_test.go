@@ -0,0 +1,115 @@
+/*
+ * Тесты GatewayCertificateStatus Gateway API Gateway (gateway_status.go):
+ *
+ * - GatewayAPIReconciler: статус с доменами HTTPRoute и сертификатами certificateRefs
+ * - одноименный GatewayCertificateStatus Istio Gateway не перезаписывается
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+var _ = Describe("GatewayCertificateStatus of Gateway API Gateways", func() {
+	var (
+		gateway *gatewayapiv1.Gateway
+		route   *gatewayapiv1.HTTPRoute
+		cert    *certmanagerv1.Certificate
+	)
+
+	BeforeEach(func() {
+		gateway = &gatewayapiv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: "app", UID: "gateway-uid", Generation: 2},
+			Spec: gatewayapiv1.GatewaySpec{
+				GatewayClassName: "istio",
+				Listeners: []gatewayapiv1.Listener{{
+					Name:     "https",
+					Port:     443,
+					Protocol: gatewayapiv1.HTTPSProtocolType,
+					TLS: &gatewayapiv1.GatewayTLSConfig{
+						CertificateRefs: []gatewayapiv1.SecretObjectReference{{Name: "app-tls-temp"}},
+					},
+				}},
+			},
+		}
+		route = &gatewayapiv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "app"},
+			Spec: gatewayapiv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayapiv1.CommonRouteSpec{
+					ParentRefs: []gatewayapiv1.ParentReference{{Name: "public"}},
+				},
+				Hostnames: []gatewayapiv1.Hostname{"app.example.com"},
+			},
+		}
+		cert = &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "app"},
+			Spec: certmanagerv1.CertificateSpec{
+				SecretName: "app-tls",
+				DNSNames:   []string{"app.example.com"},
+				IssuerRef:  cmmeta.ObjectReference{Name: "letsencrypt"},
+			},
+		}
+	})
+
+	reconcile := func(objects ...client.Object) client.Client {
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+			WithObjects(objects...).
+			WithStatusSubresource(&http01v1alpha1.GatewayCertificateStatus{}).
+			WithIndex(&certmanagerv1.Certificate{}, certificateSecretNameIndex, certificateSecretName).
+			WithIndex(&gatewayapiv1.HTTPRoute{}, httpRouteParentIndex, httpRouteParentRefs).
+			Build()
+		r := &GatewayAPIReconciler{Client: c, Scheme: c.Scheme()}
+		_, err := r.Reconcile(testCtx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(gateway)})
+		Expect(err).NotTo(HaveOccurred())
+		return c
+	}
+
+	It("reports HTTPRoute domains and certificateRefs certificates", func() {
+		c := reconcile(gateway, route, cert)
+
+		status := &http01v1alpha1.GatewayCertificateStatus{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(gateway), status)).To(Succeed())
+		Expect(status.Spec.GatewayRef).To(Equal(http01v1alpha1.GatewayReference{
+			Group: gatewayapiv1.GroupName,
+			Kind:  "Gateway",
+			Name:  gateway.Name,
+		}))
+		Expect(metav1.GetControllerOf(status)).To(HaveField("Name", gateway.Name))
+		Expect(status.Status.ObservedGeneration).To(Equal(int64(2)))
+		Expect(status.Status.Domains).To(HaveLen(1))
+		Expect(status.Status.Domains[0].Certificate).To(Equal("app/app"))
+		Expect(status.Status.Certificates).To(HaveLen(1))
+		Expect(meta.IsStatusConditionTrue(status.Status.Certificates[0].Conditions, http01v1alpha1.CertificateConditionTemporary)).To(BeTrue())
+	})
+
+	It("leaves the status of an Istio Gateway with the same name alone", func() {
+		istioStatus := &http01v1alpha1.GatewayCertificateStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: gateway.Name, Namespace: gateway.Namespace},
+			Spec: http01v1alpha1.GatewayCertificateStatusSpec{GatewayRef: http01v1alpha1.GatewayReference{
+				Group: istionetworkingv1beta1.SchemeGroupVersion.Group,
+				Kind:  "Gateway",
+				Name:  gateway.Name,
+			}},
+		}
+		c := reconcile(gateway, route, cert, istioStatus)
+
+		status := &http01v1alpha1.GatewayCertificateStatus{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(gateway), status)).To(Succeed())
+		Expect(status.Spec.GatewayRef.Group).To(Equal(istionetworkingv1beta1.SchemeGroupVersion.Group))
+		Expect(status.Status.Certificates).To(BeEmpty())
+	})
+})
@@ -26,15 +26,14 @@ const (
 
 // getVirtualServicesForGateway получает все VirtualService, связанные с Gateway
 func (r *GatewayReconciler) getVirtualServicesForGateway(ctx context.Context, gateway *istionetworkingv1beta1.Gateway) ([]*istionetworkingv1beta1.VirtualService, error) {
-	// Получение всех VirtualService во всех namespace
+	// Получение VirtualService, ссылающихся на Gateway (по индексу spec.gateways)
 	virtualServiceList := &istionetworkingv1beta1.VirtualServiceList{}
-	if err := r.List(ctx, virtualServiceList, client.InNamespace("")); err != nil {
+	gatewayRef := gateway.Namespace + "/" + gateway.Name
+	if err := r.List(ctx, virtualServiceList, client.MatchingFields{virtualServiceGatewayIndex: gatewayRef}); err != nil {
 		return nil, err
 	}
 
 	var matchingVS []*istionetworkingv1beta1.VirtualService
-	gatewayName := gateway.Name
-	gatewayNamespace := gateway.Namespace
 
 	for i := range virtualServiceList.Items {
 		vsItem := virtualServiceList.Items[i] // vsItem это *VirtualService
@@ -51,16 +50,8 @@ func (r *GatewayReconciler) getVirtualServicesForGateway(ctx context.Context, ga
 			continue
 		}
 
-		// Проверка, ссылается ли VirtualService на этот Gateway
-		for _, gw := range vsItem.Spec.Gateways {
-			// Gateway может быть указан как "namespace/gateway" или просто "gateway"
-			if gw == gatewayName || gw == gatewayNamespace+"/"+gatewayName {
-				// Добавляем указатель (не копируем структуру с мьютексом)
-				matchingVS = append(matchingVS, vsItem)
-				// Убрали избыточное логирование - информация о VirtualService будет в основном логе
-				break
-			}
-		}
+		// Добавляем указатель (не копируем структуру с мьютексом)
+		matchingVS = append(matchingVS, vsItem)
 	}
 
 	return matchingVS, nil
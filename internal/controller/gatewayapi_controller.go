@@ -0,0 +1,147 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *GatewayAPIReconciler) Reconcile(ctx, req) (ctrl.Result, error)
+ *   Обрабатывает изменения Gateway API (gateway.networking.k8s.io) Gateway ресурсов и обновляет их GatewayCertificateStatus
+ *
+ * - (r *GatewayAPIReconciler) SetupWithManager(mgr) error
+ *   Настраивает контроллер для работы с менеджером
+ *
+ * - (r *GatewayAPIReconciler) gatewaysForHTTPRoute(ctx, obj) []reconcile.Request
+ *   Возвращает запросы на реконсиляцию Gateway API Gateway, к которым привязан HTTPRoute
+ *
+ * - (r *GatewayAPIReconciler) gatewaysForCertificate(ctx, obj) []reconcile.Request
+ *   Возвращает запросы на реконсиляцию Gateway API Gateway, certificateRefs которых ссылаются на секрет Certificate
+ *
+ * Дополнительные функции находятся в:
+ * - gatewayapi_routes.go - работа с HTTPRoute и доменами Gateway API Gateway
+ * - gateway_status.go - обновление GatewayCertificateStatus Gateway
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+// GatewayAPIReconciler реконсилирует Gateway ресурсы Kubernetes Gateway API
+type GatewayAPIReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=http01.istio-http01.rieset.io,resources=gatewaycertificatestatuses,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=http01.istio-http01.rieset.io,resources=gatewaycertificatestatuses/status,verbs=get;update;patch
+
+// Reconcile обрабатывает Gateway API Gateway ресурсы
+func (r *GatewayAPIReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// Получение Gateway
+	gateway := &gatewayapiv1.Gateway{}
+	if err := r.Get(ctx, req.NamespacedName, gateway); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Создаем контекстный логгер с информацией о Gateway
+	logger = logger.WithValues(
+		"gateway", gateway.Name,
+		"gatewayNamespace", gateway.Namespace,
+		"gatewayClassName", gateway.Spec.GatewayClassName,
+	)
+
+	logger.Info("Gateway API Gateway detected")
+
+	// Информация о listener'ах (логируем только сводку)
+	if len(gateway.Spec.Listeners) > 0 {
+		tlsListeners := 0
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.TLS != nil && len(listener.TLS.CertificateRefs) > 0 {
+				tlsListeners++
+			}
+		}
+		logger.Info("Gateway listeners",
+			"listenerCount", len(gateway.Spec.Listeners),
+			"tlsListenerCount", tlsListeners,
+		)
+	}
+
+	// Получение доменов, за которые отвечает Gateway на основе HTTPRoute
+	domains, err := getDomainsForGatewayAPI(ctx, r.Client, gateway)
+	if err != nil {
+		logger.Error(err, "failed to get domains for Gateway API Gateway")
+		return ctrl.Result{}, err
+	}
+	logger.Info("Gateway domains from HTTPRoute",
+		"domains", domains,
+	)
+
+	// Обновление GatewayCertificateStatus с состоянием доменов и сертификатов Gateway
+	if err := r.updateGatewayAPICertificateStatus(ctx, gateway, domains); err != nil {
+		logger.Error(err, "failed to update GatewayCertificateStatus")
+		return ctrl.Result{}, err
+	}
+
+	// Повторная реконсиляция запускается изменениями HTTPRoute и Certificate Gateway
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager настраивает контроллер
+func (r *GatewayAPIReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&gatewayapiv1.Gateway{}).
+		Owns(&http01v1alpha1.GatewayCertificateStatus{}).
+		Watches(&gatewayapiv1.HTTPRoute{}, handler.EnqueueRequestsFromMapFunc(r.gatewaysForHTTPRoute)).
+		Watches(&certmanagerv1.Certificate{}, handler.EnqueueRequestsFromMapFunc(r.gatewaysForCertificate)).
+		Named("gatewayapi-gateway").
+		Complete(r)
+}
+
+// gatewaysForHTTPRoute возвращает запросы на реконсиляцию Gateway API Gateway, к которым привязан HTTPRoute
+func (r *GatewayAPIReconciler) gatewaysForHTTPRoute(_ context.Context, obj client.Object) []reconcile.Request {
+	refs := httpRouteParentRefs(obj)
+	requests := make([]reconcile.Request, 0, len(refs))
+	for _, ref := range refs {
+		namespace, name := splitCredentialName(ref, obj.GetNamespace())
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{Name: name, Namespace: namespace},
+		})
+	}
+	return requests
+}
+
+// gatewaysForCertificate возвращает запросы на реконсиляцию Gateway API Gateway, использующих секрет Certificate
+// Для временного сертификата учитываются Gateway, использующие временный секрет
+func (r *GatewayAPIReconciler) gatewaysForCertificate(ctx context.Context, obj client.Object) []reconcile.Request {
+	cert, ok := obj.(*certmanagerv1.Certificate)
+	if !ok || cert.Spec.SecretName == "" {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, secretName := range []string{cert.Spec.SecretName, cert.Spec.SecretName + "-temp"} {
+		gatewayList := &gatewayapiv1.GatewayList{}
+		if err := r.List(ctx, gatewayList, client.MatchingFields{gatewayAPICertificateRefIndex: fmt.Sprintf("%s/%s", cert.Namespace, secretName)}); err != nil {
+			continue
+		}
+		for i := range gatewayList.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&gatewayList.Items[i])})
+		}
+	}
+	return requests
+}
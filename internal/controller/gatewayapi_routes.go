@@ -0,0 +1,123 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - getHTTPRoutesForGatewayAPI(ctx, c, gateway) ([]*HTTPRoute, error)
+ *   Получает все HTTPRoute, привязанные к Gateway API Gateway, исключая созданные оператором istio-http01
+ *
+ * - getDomainsForGatewayAPI(ctx, c, gateway) ([]string, error)
+ *   Получает список доменов Gateway API Gateway из hostnames привязанных HTTPRoute
+ *
+ * - hasGatewayAPIHTTPSRedirect(ctx, c, gateway) (bool, error)
+ *   Проверяет, есть ли у Gateway HTTPRoute с редиректом на https (аналог httpsRedirect в Istio Gateway)
+ *
+ * - isHTTPRouteParentOf(route, gateway) bool
+ *   Проверяет, ссылается ли HTTPRoute на указанный Gateway через parentRefs
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// getHTTPRoutesForGatewayAPI получает все HTTPRoute, привязанные к Gateway API Gateway
+// Исключает HTTPRoute, созданные оператором istio-http01
+func getHTTPRoutesForGatewayAPI(ctx context.Context, c client.Reader, gateway *gatewayapiv1.Gateway) ([]*gatewayapiv1.HTTPRoute, error) {
+	// Получение HTTPRoute, ссылающихся на Gateway (по индексу parentRefs)
+	routeList := &gatewayapiv1.HTTPRouteList{}
+	if err := c.List(ctx, routeList, client.MatchingFields{httpRouteParentIndex: gateway.Namespace + "/" + gateway.Name}); err != nil {
+		return nil, fmt.Errorf("failed to list HTTPRoutes: %w", err)
+	}
+
+	var matchingRoutes []*gatewayapiv1.HTTPRoute
+	for i := range routeList.Items {
+		route := &routeList.Items[i]
+
+		// Исключаем HTTPRoute, созданные оператором istio-http01
+		if route.Labels["app.kubernetes.io/managed-by"] == istioHTTP01ManagedByLabel ||
+			route.Labels["acme.cert-manager.io/http01-solver"] == http01SolverLabelValue {
+			continue
+		}
+
+		if isHTTPRouteParentOf(route, gateway) {
+			matchingRoutes = append(matchingRoutes, route)
+		}
+	}
+
+	return matchingRoutes, nil
+}
+
+// getDomainsForGatewayAPI получает список доменов Gateway API Gateway из hostnames привязанных HTTPRoute
+func getDomainsForGatewayAPI(ctx context.Context, c client.Reader, gateway *gatewayapiv1.Gateway) ([]string, error) {
+	routes, err := getHTTPRoutesForGatewayAPI(ctx, c, gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	// Используем map для исключения дубликатов доменов
+	domainMap := make(map[string]bool)
+	for _, route := range routes {
+		for _, hostname := range route.Spec.Hostnames {
+			domainMap[string(hostname)] = true
+		}
+	}
+
+	// Преобразуем map в slice
+	domains := make([]string, 0, len(domainMap))
+	for domain := range domainMap {
+		domains = append(domains, domain)
+	}
+
+	return domains, nil
+}
+
+// hasGatewayAPIHTTPSRedirect проверяет, есть ли у Gateway HTTPRoute с редиректом на https
+// В Gateway API редирект задается фильтром RequestRedirect в HTTPRoute, а не в самом Gateway
+func hasGatewayAPIHTTPSRedirect(ctx context.Context, c client.Reader, gateway *gatewayapiv1.Gateway) (bool, error) {
+	routes, err := getHTTPRoutesForGatewayAPI(ctx, c, gateway)
+	if err != nil {
+		return false, err
+	}
+
+	for _, route := range routes {
+		for _, rule := range route.Spec.Rules {
+			for _, filter := range rule.Filters {
+				if filter.Type != gatewayapiv1.HTTPRouteFilterRequestRedirect || filter.RequestRedirect == nil {
+					continue
+				}
+				if filter.RequestRedirect.Scheme != nil && *filter.RequestRedirect.Scheme == "https" {
+					return true, nil
+				}
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// isHTTPRouteParentOf проверяет, ссылается ли HTTPRoute на указанный Gateway через parentRefs
+// Namespace в parentRef по умолчанию совпадает с namespace HTTPRoute
+func isHTTPRouteParentOf(route *gatewayapiv1.HTTPRoute, gateway *gatewayapiv1.Gateway) bool {
+	for _, parentRef := range route.Spec.ParentRefs {
+		if parentRef.Group != nil && string(*parentRef.Group) != gatewayapiv1.GroupName {
+			continue
+		}
+		if parentRef.Kind != nil && string(*parentRef.Kind) != "Gateway" {
+			continue
+		}
+
+		parentNamespace := route.Namespace
+		if parentRef.Namespace != nil {
+			parentNamespace = string(*parentRef.Namespace)
+		}
+
+		if string(parentRef.Name) == gateway.Name && parentNamespace == gateway.Namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - generatedName(prefix, value) string
+ *   Формирует имя объекта оператора: читаемый префикс и стабильный хэш значения, не длиннее 63 символов
+ *
+ * - solverVirtualServiceName(domain) string / legacySolverVirtualServiceName(domain) string
+ *   Имя VirtualService (и HTTPRoute) хоста для HTTP01 challenge и имя прежних версий
+ *
+ * - hstsEnvoyFilterName(gateway) string / legacyHSTSEnvoyFilterName(gateway) string
+ *   Имя EnvoyFilter отключения HSTS для Gateway и имя прежних версий
+ *
+ * - adoptLegacySolverVirtualService(ctx, c, namespace, domain) error
+ *   Переименовывает VirtualService хоста, созданный прежней версией, в solverVirtualServiceName
+ *
+ * - (r *CertificateReconciler) adoptHSTSEnvoyFilter(ctx, gateway) string
+ *   Переименовывает EnvoyFilter Gateway, созданный прежней версией, и возвращает имя EnvoyFilter
+ *
+ * - renameManagedObject(ctx, c, obj, name) error
+ *   Создает копию объекта с новым именем и удаляет исходный объект
+ *
+ * Прежние версии обрезали имя http01-solver-<домен> до 63 символов (длинные домены с общим префиксом
+ * получали одно имя), а имя disable-hsts-<namespace>-<gateway> могло превышать ограничения.
+ * Kubernetes не переименовывает объекты, поэтому объекты со старыми именами пересоздаются под новыми
+ */
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// generatedNameMaxLength ограничение длины имени (DNS label), подходящее для любых объектов оператора
+	generatedNameMaxLength = 63
+	// generatedNameHashLength длина хэш-суффикса имени (hex)
+	generatedNameHashLength = 10
+
+	// hstsGatewayAnnotation аннотация EnvoyFilter отключения HSTS с именем его Gateway
+	// Имя EnvoyFilter содержит хэш, поэтому Gateway нельзя получить из имени
+	hstsGatewayAnnotation = "istio-http01.rieset.io/hsts-gateway"
+)
+
+// generatedName формирует имя объекта оператора из читаемого префикса и стабильного хэша значения
+// Читаемая часть (prefix-значение, "." и "/" заменены на "-", "*" - на "wildcard") обрезается так, чтобы
+// имя с суффиксом -<хэш> помещалось в 63 символа. Хэш берется от исходного значения, поэтому
+// разные значения с одинаковой читаемой частью получают разные имена
+func generatedName(prefix, value string) string {
+	readable := prefix + "-" + strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-':
+			return c
+		case c >= 'A' && c <= 'Z':
+			return c + ('a' - 'A')
+		default:
+			return '-'
+		}
+	}, strings.ReplaceAll(value, "*", "wildcard"))
+
+	sum := sha256.Sum256([]byte(value))
+	suffix := hex.EncodeToString(sum[:])[:generatedNameHashLength]
+
+	if maxReadable := generatedNameMaxLength - len(suffix) - 1; len(readable) > maxReadable {
+		readable = readable[:maxReadable]
+	}
+	return strings.TrimRight(readable, "-") + "-" + suffix
+}
+
+// solverVirtualServiceName формирует имя VirtualService хоста для HTTP01 challenge
+// Например, app.example.com -> http01-solver-app-example-com-<хэш>
+func solverVirtualServiceName(domain string) string {
+	return generatedName("http01-solver", domain)
+}
+
+// legacySolverVirtualServiceName возвращает имя VirtualService хоста, которое формировали прежние версии
+func legacySolverVirtualServiceName(domain string) string {
+	vsName := fmt.Sprintf("http01-solver-%s", strings.ReplaceAll(strings.ReplaceAll(domain, ".", "-"), "*", "wildcard"))
+	if len(vsName) > 63 {
+		vsName = vsName[:63]
+	}
+	return vsName
+}
+
+// hstsEnvoyFilterName формирует имя EnvoyFilter отключения HSTS для Gateway
+func hstsEnvoyFilterName(gateway *istionetworkingv1beta1.Gateway) string {
+	return generatedName("disable-hsts", gateway.Namespace+"/"+gateway.Name)
+}
+
+// legacyHSTSEnvoyFilterName возвращает имя EnvoyFilter отключения HSTS, которое формировали прежние версии
+func legacyHSTSEnvoyFilterName(gateway *istionetworkingv1beta1.Gateway) string {
+	return fmt.Sprintf("disable-hsts-%s-%s", gateway.Namespace, gateway.Name)
+}
+
+// adoptLegacySolverVirtualService переименовывает VirtualService хоста, созданный прежней версией оператора
+// Переименовывается только VirtualService оператора, в hosts которого есть домен: обрезанное старое имя
+// могло принадлежать другому домену с тем же префиксом
+func adoptLegacySolverVirtualService(ctx context.Context, c client.Client, namespace, domain string) error {
+	legacyName := legacySolverVirtualServiceName(domain)
+	if legacyName == solverVirtualServiceName(domain) {
+		return nil
+	}
+
+	vs := &istionetworkingv1beta1.VirtualService{}
+	err := c.Get(ctx, client.ObjectKey{Name: legacyName, Namespace: namespace}, vs)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get VirtualService %s/%s: %w", namespace, legacyName, err)
+	}
+	if vs.Labels["app.kubernetes.io/managed-by"] != istioHTTP01ManagedByLabel ||
+		vs.Labels["acme.cert-manager.io/http01-solver"] != http01SolverLabelValue ||
+		!slices.Contains(vs.Spec.Hosts, domain) {
+		return nil
+	}
+	return renameManagedObject(ctx, c, vs, solverVirtualServiceName(domain))
+}
+
+// adoptHSTSEnvoyFilter переименовывает EnvoyFilter отключения HSTS, созданный прежней версией оператора,
+// и возвращает имя EnvoyFilter Gateway. Ошибка переименования логируется: EnvoyFilter со старым именем
+// продолжит работать, а его удалит sweepOrphanedEnvoyFilters или GC вместе с Certificate
+func (r *CertificateReconciler) adoptHSTSEnvoyFilter(ctx context.Context, gateway *istionetworkingv1beta1.Gateway) string {
+	name := hstsEnvoyFilterName(gateway)
+
+	envoyFilter := &unstructured.Unstructured{}
+	envoyFilter.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "networking.istio.io",
+		Version: "v1alpha3",
+		Kind:    "EnvoyFilter",
+	})
+	if err := r.Get(ctx, client.ObjectKey{Name: legacyHSTSEnvoyFilterName(gateway), Namespace: gateway.Namespace}, envoyFilter); err != nil {
+		return name
+	}
+	if envoyFilter.GetLabels()["istio-http01.rieset.io/temp"] != tempLabelValue {
+		return name
+	}
+
+	annotations := envoyFilter.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[hstsGatewayAnnotation] = gateway.Name
+	envoyFilter.SetAnnotations(annotations)
+	if err := renameManagedObject(ctx, r.Client, envoyFilter, name); err != nil {
+		log.FromContext(ctx).Error(err, "failed to adopt HSTS EnvoyFilter created by a previous version",
+			"envoyFilterName", envoyFilter.GetName(),
+			"gatewayName", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+		)
+	}
+	return name
+}
+
+// renameManagedObject создает копию объекта с новым именем и удаляет исходный объект
+// Если объект с новым именем уже существует, он считается актуальным и исходный объект просто удаляется
+func renameManagedObject(ctx context.Context, c client.Client, obj client.Object, name string) error {
+	renamed, ok := obj.DeepCopyObject().(client.Object)
+	if !ok {
+		return fmt.Errorf("failed to copy %s/%s", obj.GetNamespace(), obj.GetName())
+	}
+	renamed.SetName(name)
+	renamed.SetResourceVersion("")
+	renamed.SetUID("")
+	renamed.SetGeneration(0)
+	renamed.SetCreationTimestamp(metav1.Time{})
+	renamed.SetManagedFields(nil)
+
+	if err := c.Create(ctx, renamed); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create %s/%s: %w", obj.GetNamespace(), name, err)
+	}
+	if err := c.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+
+	log.FromContext(ctx).Info("Renamed object created by a previous version",
+		"namespace", obj.GetNamespace(),
+		"oldName", obj.GetName(),
+		"newName", name,
+	)
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+ * Тесты имен объектов оператора (generated_names.go):
+ *
+ * - generatedName: читаемый префикс, стабильный хэш, ограничение 63 символа, разные имена длинных доменов
+ * - adoptLegacySolverVirtualService: переименование VirtualService прежних версий только для своего домена
+ * - adoptHSTSEnvoyFilter: переименование EnvoyFilter прежних версий с аннотацией Gateway
+ */
+
+package controller
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testLegacySolverVirtualService возвращает VirtualService хоста с именем прежних версий
+func testLegacySolverVirtualService(namespace, domain string) *istionetworkingv1beta1.VirtualService {
+	return &istionetworkingv1beta1.VirtualService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      legacySolverVirtualServiceName(domain),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by":       istioHTTP01ManagedByLabel,
+				"acme.cert-manager.io/http01-solver": http01SolverLabelValue,
+			},
+		},
+		Spec: istioapinetworkingv1beta1.VirtualService{
+			Hosts: []string{domain},
+			Http:  []*istioapinetworkingv1beta1.HTTPRoute{testSolverRoute("cm-acme-http-solver-a", "token-a")},
+		},
+	}
+}
+
+var _ = Describe("Generated object names", func() {
+	It("keeps a readable prefix and a stable hash suffix", func() {
+		name := solverVirtualServiceName("app.example.com")
+		Expect(name).To(HavePrefix("http01-solver-app-example-com-"))
+		Expect(name).To(HaveLen(len("http01-solver-app-example-com-") + generatedNameHashLength))
+		Expect(solverVirtualServiceName("app.example.com")).To(Equal(name))
+		Expect(solverVirtualServiceName("*.example.com")).To(HavePrefix("http01-solver-wildcard-example-com-"))
+	})
+
+	It("does not collide for long domains with a common prefix", func() {
+		prefix := strings.Repeat("service", 8) + "."
+		first := solverVirtualServiceName(prefix + "first.example.com")
+		second := solverVirtualServiceName(prefix + "second.example.com")
+		Expect(legacySolverVirtualServiceName(prefix + "first.example.com")).
+			To(Equal(legacySolverVirtualServiceName(prefix + "second.example.com")))
+		Expect(first).NotTo(Equal(second))
+		Expect(len(first)).To(BeNumerically("<=", 63))
+		Expect(first).NotTo(ContainSubstring("--"))
+
+		gateway := newTestGateway(strings.Repeat("namespace", 6), strings.Repeat("gateway", 6), "app.example.com", "app-tls")
+		Expect(len(hstsEnvoyFilterName(gateway))).To(BeNumerically("<=", 63))
+		Expect(len(legacyHSTSEnvoyFilterName(gateway))).To(BeNumerically(">", 63))
+	})
+
+	It("adopts the solver VirtualService created with the old name", func() {
+		domain := strings.Repeat("service", 8) + ".first.example.com"
+		legacy := testLegacySolverVirtualService("istio-system", domain)
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(legacy).Build()
+
+		By("skipping the old name of another domain with the same prefix")
+		Expect(adoptLegacySolverVirtualService(testCtx, c, "istio-system", strings.Repeat("service", 8)+".second.example.com")).To(Succeed())
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(legacy), &istionetworkingv1beta1.VirtualService{})).To(Succeed())
+
+		Expect(adoptLegacySolverVirtualService(testCtx, c, "istio-system", domain)).To(Succeed())
+		err := c.Get(testCtx, client.ObjectKeyFromObject(legacy), &istionetworkingv1beta1.VirtualService{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		adopted := &istionetworkingv1beta1.VirtualService{}
+		Expect(c.Get(testCtx, client.ObjectKey{Name: solverVirtualServiceName(domain), Namespace: "istio-system"}, adopted)).To(Succeed())
+		Expect(adopted.Spec.Hosts).To(Equal([]string{domain}))
+		Expect(routeNames(adopted)).To(Equal([]string{"cm-acme-http-solver-a"}))
+	})
+
+	It("adopts the HSTS EnvoyFilter created with the old name", func() {
+		gateway := newTestGateway("app", "public", "app.example.com", "app-tls")
+		legacy := &unstructured.Unstructured{}
+		legacy.SetGroupVersionKind(schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1alpha3", Kind: "EnvoyFilter"})
+		legacy.SetName(legacyHSTSEnvoyFilterName(gateway))
+		legacy.SetNamespace(gateway.Namespace)
+		legacy.SetLabels(map[string]string{"istio-http01.rieset.io/temp": tempLabelValue})
+		setHSTSSecretRefs(legacy, []string{"app/app-tls"})
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(gateway, legacy).Build()
+		r := &CertificateReconciler{Client: c, Scheme: c.Scheme()}
+
+		Expect(r.adoptHSTSEnvoyFilter(testCtx, gateway)).To(Equal(hstsEnvoyFilterName(gateway)))
+
+		adopted := &unstructured.Unstructured{}
+		adopted.SetGroupVersionKind(legacy.GroupVersionKind())
+		Expect(c.Get(testCtx, client.ObjectKey{Name: hstsEnvoyFilterName(gateway), Namespace: gateway.Namespace}, adopted)).To(Succeed())
+		Expect(adopted.GetAnnotations()).To(HaveKeyWithValue(hstsGatewayAnnotation, "public"))
+		Expect(hstsSecretRefs(adopted.GetAnnotations())).To(Equal([]string{"app/app-tls"}))
+		err := c.Get(testCtx, client.ObjectKeyFromObject(legacy), legacy.DeepCopy())
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
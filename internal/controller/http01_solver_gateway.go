@@ -4,15 +4,25 @@
  * - (r *HTTP01SolverPodReconciler) getDomainsForGateway(ctx, gateway) ([]string, error)
  *   Получает список доменов, за которые отвечает Gateway на основе связанных VirtualService, исключая созданные оператором istio-http01
  *
- * - (r *HTTP01SolverPodReconciler) findGatewayForDomain(ctx, domain) (*Gateway, error)
- *   Находит Gateway, который резолвит указанный домен через домены, закрепленные за Gateway через VirtualService.
- *   НЕ использует поле hosts в Gateway, так как оно содержит данные для внутренней сети, а не внешние домены.
+ * - (r *HTTP01SolverPodReconciler) findGatewayForDomain(ctx, domain) (*gatewayMatch, error)
+ *   Находит Gateway, который резолвит указанный домен, с наивысшим приоритетом совпадения (matchGatewaysForDomain),
+ *   и равнозначные Gateway с HTTP сервером домена, к которым также привязывается VirtualService солвера
+ *
+ * - (m *gatewayMatch) solverGateways() []*Gateway
+ *   Возвращает все Gateway, к которым привязывается VirtualService солвера
+ *
+ * - gatewayRefsString(gateways) string
+ *   Формирует список Gateway "namespace/name" через запятую для событий
+ *
+ * Ранжирование Gateway по совпадению с доменом (matchGatewaysForDomain) и сопоставление hosts - в
+ * http01_solver_gateway_rank.go
  */
 
 package controller
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -21,6 +31,53 @@ import (
 	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
 )
 
+// gatewayMatchReason способ, которым Gateway сопоставлен домену солвера
+type gatewayMatchReason string
+
+const (
+	// gatewayMatchSolverAnnotation Gateway из аннотации podTemplate solver'а
+	gatewayMatchSolverAnnotation gatewayMatchReason = "solver_pod_annotation"
+	// gatewayMatchCertificateAnnotation Gateway из аннотации Certificate домена
+	gatewayMatchCertificateAnnotation gatewayMatchReason = "certificate_annotation"
+	// gatewayMatchSolverIngressName Gateway из ingress.name solver'а
+	gatewayMatchSolverIngressName gatewayMatchReason = "solver_ingress_name"
+	// gatewayMatchSolverIngressClass Gateway с меткой класса ingress solver'а
+	gatewayMatchSolverIngressClass gatewayMatchReason = "solver_ingress_class"
+	// gatewayMatchVirtualServiceExact домен совпадает с host VirtualService Gateway
+	gatewayMatchVirtualServiceExact gatewayMatchReason = "virtualservice_exact"
+	// gatewayMatchVirtualServiceWildcard домен покрывается wildcard host VirtualService Gateway
+	gatewayMatchVirtualServiceWildcard gatewayMatchReason = "virtualservice_wildcard"
+	// gatewayMatchServerHost домен покрывается hosts HTTP сервера Gateway
+	gatewayMatchServerHost gatewayMatchReason = "gateway_server_host"
+	// gatewayMatchCredentialName Gateway терминирует TLS секретом сертификата домена
+	gatewayMatchCredentialName gatewayMatchReason = "certificate_credential_name"
+)
+
+// gatewayMatchAnnotation аннотация VirtualService солвера со способом выбора Gateway ("<reason>:<host>")
+const gatewayMatchAnnotation = "istio-http01.rieset.io/gateway-match"
+
+// gatewayMatch Gateway, выбранный для домена солвера, и причина выбора
+type gatewayMatch struct {
+	Gateway *istionetworkingv1beta1.Gateway
+	Reason  gatewayMatchReason
+	// Host host VirtualService или сервера Gateway, секрет или значение настройки solver'а, давшие совпадение
+	Host string
+	// Ambiguous другие Gateway с тем же приоритетом совпадения
+	Ambiguous []*istionetworkingv1beta1.Gateway
+	// Attached равнозначные Gateway с HTTP сервером домена: VirtualService солвера привязывается и к ним
+	Attached []*istionetworkingv1beta1.Gateway
+}
+
+// solverGateways возвращает выбранный Gateway и Gateway из Attached
+func (m *gatewayMatch) solverGateways() []*istionetworkingv1beta1.Gateway {
+	return append([]*istionetworkingv1beta1.Gateway{m.Gateway}, m.Attached...)
+}
+
+// String возвращает значение аннотации gatewayMatchAnnotation
+func (m *gatewayMatch) String() string {
+	return fmt.Sprintf("%s:%s", m.Reason, m.Host)
+}
+
 // getDomainsForGateway получает список доменов, за которые отвечает Gateway на основе связанных VirtualService
 // Исключает VirtualService, созданные оператором istio-http01
 func (r *HTTP01SolverPodReconciler) getDomainsForGateway(ctx context.Context, gateway *istionetworkingv1beta1.Gateway) ([]string, error) {
@@ -86,9 +143,10 @@ func (r *HTTP01SolverPodReconciler) getDomainsForGateway(ctx context.Context, ga
 }
 
 // findGatewayForDomain находит Gateway, который резолвит указанный домен
-// Определяет Gateway только через домены, закрепленные за Gateway через VirtualService
-// НЕ использует поле hosts в Gateway, так как оно содержит данные для внутренней сети, а не внешние домены
-func (r *HTTP01SolverPodReconciler) findGatewayForDomain(ctx context.Context, domain string) (*istionetworkingv1beta1.Gateway, error) {
+// Из Gateway с наивысшим приоритетом совпадения выбирается первый по namespace/name; остальные попадают в Ambiguous.
+// Если домен обслуживают несколько Gateway (внутренний и внешний, blue/green), challenge может прийти через любой
+// из них, поэтому VirtualService солвера привязывается ко всем, у которых есть HTTP сервер домена (Attached)
+func (r *HTTP01SolverPodReconciler) findGatewayForDomain(ctx context.Context, domain string) (*gatewayMatch, error) {
 	// Получение всех Gateway во всех namespace
 	gatewayList := &istionetworkingv1beta1.GatewayList{}
 	if err := r.List(ctx, gatewayList, client.InNamespace("")); err != nil {
@@ -100,53 +158,42 @@ func (r *HTTP01SolverPodReconciler) findGatewayForDomain(ctx context.Context, do
 		"gatewayCount", len(gatewayList.Items),
 	)
 
-	// Проверяем домены, закрепленные за Gateway через VirtualService
-	for i := range gatewayList.Items {
-		gateway := gatewayList.Items[i]
-
-		// Получаем домены, закрепленные за этим Gateway
-		domains, err := r.getDomainsForGateway(ctx, gateway)
-		if err != nil {
-			continue
-		}
-
-		ctrl.Log.Info("Checking Gateway for domain match",
+	matches, err := r.matchGatewaysForDomain(ctx, gatewayList.Items, domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		ctrl.Log.Info("No Gateway found for domain",
 			"domain", domain,
-			"gateway", gateway.Name,
-			"gatewayNamespace", gateway.Namespace,
-			"gatewayDomains", domains,
 		)
+		return nil, nil
+	}
 
-		// Проверяем, есть ли искомый домен в списке доменов Gateway
-		// Используем только точное совпадение, чтобы избежать неправильного сопоставления
-		// (например, app-gamma.example.com не должен совпадать с app-alpha.example.com)
-		for _, gatewayDomain := range domains {
-			// Проверка точного совпадения
-			if gatewayDomain == domain {
-				ctrl.Log.Info("Gateway found via VirtualService domain match",
-					"domain", domain,
-					"gateway", gateway.Name,
-					"gatewayNamespace", gateway.Namespace,
-					"matchedDomain", gatewayDomain,
-					"method", "virtualservice_domain_match",
-				)
-				return gateway, nil
-			}
-			// Проверка wildcard (только если gatewayDomain == "*")
-			if gatewayDomain == "*" {
-				ctrl.Log.Info("Gateway found via VirtualService wildcard",
-					"domain", domain,
-					"gateway", gateway.Name,
-					"gatewayNamespace", gateway.Namespace,
-					"method", "virtualservice_wildcard",
-				)
-				return gateway, nil
-			}
+	match := matches[0]
+	for _, other := range matches[1:] {
+		match.Ambiguous = append(match.Ambiguous, other.Gateway)
+		// VirtualService солвера создается в namespace выбранного Gateway
+		if _, ok := matchGatewayServerHosts(other.Gateway, match.Gateway.Namespace, domain); ok {
+			match.Attached = append(match.Attached, other.Gateway)
 		}
 	}
-
-	ctrl.Log.Info("No Gateway found for domain",
+	ctrl.Log.Info("Gateway found for domain",
 		"domain", domain,
+		"gateway", match.Gateway.Name,
+		"gatewayNamespace", match.Gateway.Namespace,
+		"matchedHost", match.Host,
+		"method", match.Reason,
+		"ambiguousCandidates", len(match.Ambiguous),
+		"attachedGateways", len(match.Attached),
 	)
-	return nil, nil
+	return &match, nil
+}
+
+// gatewayRefsString формирует список Gateway "namespace/name" через запятую для событий
+func gatewayRefsString(gateways []*istionetworkingv1beta1.Gateway) string {
+	refs := make([]string, 0, len(gateways))
+	for _, gateway := range gateways {
+		refs = append(refs, gateway.Namespace+"/"+gateway.Name)
+	}
+	return strings.Join(refs, ", ")
 }
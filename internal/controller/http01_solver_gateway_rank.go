@@ -0,0 +1,193 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *HTTP01SolverPodReconciler) matchGatewaysForDomain(ctx, gateways, domain) ([]gatewayMatch, error)
+ *   Ранжирует Gateway по совпадению с доменом и возвращает все Gateway с наивысшим приоритетом
+ *
+ * - (r *HTTP01SolverPodReconciler) certificateSecretsForDomain(ctx, domain) ([]client.ObjectKey, error)
+ *   Возвращает секреты Certificate, DNS имена которых покрывают домен
+ *
+ * - matchVirtualServiceHosts(domain, hosts) (gatewayMatchReason, string, bool)
+ *   Сопоставляет домен с hosts VirtualService: точное совпадение, затем wildcard
+ *
+ * - matchGatewayServerHosts(gateway, namespace, domain) (string, bool)
+ *   Сопоставляет домен с hosts HTTP серверов Gateway, доступными VirtualService из namespace ("namespace/host")
+ *
+ * - matchGatewayCredentialName(gateway, secrets) (string, bool)
+ *   Проверяет, терминирует ли Gateway TLS одним из секретов
+ *
+ * - gatewayMatchRank(reason) int
+ *   Возвращает приоритет способа сопоставления (меньше - выше)
+ *
+ * Приоритет сопоставления домена: точный host VirtualService, wildcard host VirtualService, hosts HTTP серверов
+ * Gateway, credentialName сертификата домена. hosts Gateway проверяются после VirtualService, так как часто
+ * содержат широкие шаблоны или внутренние имена, а не внешние домены.
+ * Выбор Gateway домена (findGatewayForDomain) и gatewayMatch - в http01_solver_gateway.go
+ */
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+// matchGatewaysForDomain ранжирует Gateway по совпадению с доменом и возвращает Gateway с наивысшим приоритетом,
+// отсортированные по namespace/name, чтобы выбор не зависел от порядка списка.
+// Сертификаты домена запрашиваются, только если ни один Gateway не совпал по hosts
+func (r *HTTP01SolverPodReconciler) matchGatewaysForDomain(ctx context.Context, gateways []*istionetworkingv1beta1.Gateway, domain string) ([]gatewayMatch, error) {
+	var best []gatewayMatch
+	bestRank := -1
+	consider := func(match gatewayMatch) {
+		rank := gatewayMatchRank(match.Reason)
+		switch {
+		case bestRank == -1 || rank < bestRank:
+			best, bestRank = []gatewayMatch{match}, rank
+		case rank == bestRank:
+			best = append(best, match)
+		}
+	}
+
+	candidates := make([]*istionetworkingv1beta1.Gateway, 0, len(gateways))
+	for _, gateway := range gateways {
+		// overlay Gateway оператора не выбирается как Gateway solver'а
+		if isOverlayGateway(gateway) {
+			continue
+		}
+		candidates = append(candidates, gateway)
+
+		domains, err := r.getDomainsForGateway(ctx, gateway)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get domains for Gateway %s/%s: %w", gateway.Namespace, gateway.Name, err)
+		}
+		if reason, host, ok := matchVirtualServiceHosts(domain, domains); ok {
+			consider(gatewayMatch{Gateway: gateway, Reason: reason, Host: host})
+			continue
+		}
+		if host, ok := matchGatewayServerHosts(gateway, gateway.Namespace, domain); ok {
+			consider(gatewayMatch{Gateway: gateway, Reason: gatewayMatchServerHost, Host: host})
+		}
+	}
+	if len(best) == 0 {
+		secrets, err := r.certificateSecretsForDomain(ctx, domain)
+		if err != nil {
+			return nil, err
+		}
+		for _, gateway := range candidates {
+			if secret, ok := matchGatewayCredentialName(gateway, secrets); ok {
+				consider(gatewayMatch{Gateway: gateway, Reason: gatewayMatchCredentialName, Host: secret})
+			}
+		}
+	}
+
+	slices.SortFunc(best, func(a, b gatewayMatch) int {
+		return cmp.Or(cmp.Compare(a.Gateway.Namespace, b.Gateway.Namespace), cmp.Compare(a.Gateway.Name, b.Gateway.Name))
+	})
+	return best, nil
+}
+
+// certificateSecretsForDomain возвращает секреты Certificate, DNS имена или commonName которых покрывают домен
+func (r *HTTP01SolverPodReconciler) certificateSecretsForDomain(ctx context.Context, domain string) ([]client.ObjectKey, error) {
+	certList := &certmanagerv1.CertificateList{}
+	if err := r.List(ctx, certList); err != nil {
+		return nil, fmt.Errorf("failed to list Certificates: %w", err)
+	}
+
+	var secrets []client.ObjectKey
+	for i := range certList.Items {
+		cert := &certList.Items[i]
+		if isTemporaryObject(cert) || cert.Spec.SecretName == "" {
+			continue
+		}
+		for _, host := range certificateHosts(cert) {
+			if hostsOverlap(host, domain) {
+				secrets = append(secrets, client.ObjectKey{Name: cert.Spec.SecretName, Namespace: cert.Namespace})
+				break
+			}
+		}
+	}
+	return secrets, nil
+}
+
+// matchVirtualServiceHosts сопоставляет домен с hosts VirtualService Gateway
+// Точное совпадение приоритетнее wildcard; из wildcard выбирается самый длинный (самый конкретный)
+func matchVirtualServiceHosts(domain string, hosts []string) (gatewayMatchReason, string, bool) {
+	wildcard := ""
+	for _, host := range hosts {
+		if strings.EqualFold(host, domain) {
+			return gatewayMatchVirtualServiceExact, host, true
+		}
+		if strings.HasPrefix(host, "*") && hostsOverlap(host, domain) && len(host) > len(wildcard) {
+			wildcard = host
+		}
+	}
+	if wildcard != "" {
+		return gatewayMatchVirtualServiceWildcard, wildcard, true
+	}
+	return "", "", false
+}
+
+// matchGatewayServerHosts сопоставляет домен с hosts HTTP серверов Gateway ("namespace/host" или "host")
+// namespace - namespace VirtualService солвера: hosts, ограниченные другим namespace, не подходят
+func matchGatewayServerHosts(gateway *istionetworkingv1beta1.Gateway, namespace, domain string) (string, bool) {
+	for _, server := range gateway.Spec.Servers {
+		if !isHTTPServer(server) {
+			continue
+		}
+		for _, serverHost := range server.GetHosts() {
+			host := serverHost
+			if hostNamespace, name, found := strings.Cut(serverHost, "/"); found {
+				switch {
+				case hostNamespace == "*", hostNamespace == namespace:
+				case hostNamespace == "." && namespace == gateway.Namespace:
+				default:
+					continue
+				}
+				host = name
+			}
+			if hostsOverlap(host, domain) {
+				return serverHost, true
+			}
+		}
+	}
+	return "", false
+}
+
+// matchGatewayCredentialName проверяет, терминирует ли Gateway TLS одним из секретов
+// credentialName без namespace ссылается на секрет в namespace Gateway
+func matchGatewayCredentialName(gateway *istionetworkingv1beta1.Gateway, secrets []client.ObjectKey) (string, bool) {
+	for _, server := range gateway.Spec.Servers {
+		if !isTLSTerminatingServer(server) || server.GetTls().GetCredentialName() == "" {
+			continue
+		}
+		namespace, name := splitCredentialName(server.GetTls().GetCredentialName(), gateway.Namespace)
+		for _, secret := range secrets {
+			if secret.Namespace == namespace && secret.Name == name {
+				return fmt.Sprintf("%s/%s", namespace, name), true
+			}
+		}
+	}
+	return "", false
+}
+
+// gatewayMatchRank возвращает приоритет способа сопоставления домена (меньше - выше)
+func gatewayMatchRank(reason gatewayMatchReason) int {
+	switch reason {
+	case gatewayMatchVirtualServiceExact:
+		return 0
+	case gatewayMatchVirtualServiceWildcard:
+		return 1
+	case gatewayMatchServerHost:
+		return 2
+	default:
+		return 3
+	}
+}
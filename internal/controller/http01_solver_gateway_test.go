@@ -0,0 +1,152 @@
+/*
+ * Тесты выбора Gateway для домена солвера (http01_solver_gateway.go, http01_solver_gateway_rank.go):
+ *
+ * - matchVirtualServiceHosts: точный host приоритетнее wildcard, из wildcard выбирается самый конкретный
+ * - matchGatewayServerHosts: только HTTP серверы, hosts с чужим namespace не подходят
+ * - findGatewayForDomain: приоритет VirtualService, hosts Gateway и credentialName
+ * - findGatewayForDomain: равнозначные Gateway - выбор по namespace/name и привязка к Gateway с HTTP сервером домена
+ * - findGatewayForSolver: Gateway из аннотации Certificate
+ */
+
+package controller
+
+import (
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Gateway for solver domain", func() {
+	It("prefers exact VirtualService hosts over wildcards", func() {
+		reason, host, ok := matchVirtualServiceHosts("app.example.com", []string{"*.example.com", "app.example.com"})
+		Expect(ok).To(BeTrue())
+		Expect(reason).To(Equal(gatewayMatchVirtualServiceExact))
+		Expect(host).To(Equal("app.example.com"))
+
+		reason, host, ok = matchVirtualServiceHosts("api.eu.example.com", []string{"*", "*.example.com", "*.eu.example.com"})
+		Expect(ok).To(BeTrue())
+		Expect(reason).To(Equal(gatewayMatchVirtualServiceWildcard))
+		Expect(host).To(Equal("*.eu.example.com"))
+
+		_, _, ok = matchVirtualServiceHosts("app.example.org", []string{"*.example.com", "app-alpha.example.org"})
+		Expect(ok).To(BeFalse())
+	})
+
+	It("matches Gateway server hosts the solver VirtualService can bind to", func() {
+		gateway := testServersGateway()
+
+		host, ok := matchGatewayServerHosts(gateway, gateway.Namespace, "app.example.com")
+		Expect(ok).To(BeTrue())
+		Expect(host).To(Equal("app/app.example.com"))
+
+		By("ignoring HTTPS servers")
+		_, ok = matchGatewayServerHosts(gateway, gateway.Namespace, "www.example.com")
+		Expect(ok).To(BeFalse())
+
+		By("ignoring hosts restricted to another namespace")
+		_, ok = matchGatewayServerHosts(gateway, "edge", "app.example.com")
+		Expect(ok).To(BeFalse())
+		_, ok = matchGatewayServerHosts(gateway, "edge", "shop.example.org")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("ranks Gateways by VirtualService hosts, server hosts and certificate secrets", func() {
+		public := newTestGateway("istio-system", "public", "*.example.com", "wildcard-tls")
+		app := newTestGateway("app", "app", "app.example.com", "app-tls")
+		legacy := newTestGateway("legacy", "legacy", "legacy.internal", "legacy-tls")
+		legacyCert := &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "legacy"},
+			Spec: certmanagerv1.CertificateSpec{
+				SecretName: "legacy-tls",
+				DNSNames:   []string{"legacy.example.net"},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+			WithObjects(public, app, legacy, legacyCert,
+				newTestVirtualService("istio-system", "public", "*.example.com", "public"),
+				newTestVirtualService("app", "app", "app.example.com", "app"),
+			).
+			Build()
+		r := &HTTP01SolverPodReconciler{Client: c, Scheme: c.Scheme()}
+
+		match, err := r.findGatewayForDomain(testCtx, "app.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match.Gateway.Name).To(Equal("app"))
+		Expect(match.Reason).To(Equal(gatewayMatchVirtualServiceExact))
+		Expect(match.Ambiguous).To(BeEmpty())
+
+		match, err = r.findGatewayForDomain(testCtx, "foo.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match.Gateway.Name).To(Equal("public"))
+		Expect(match.String()).To(Equal("virtualservice_wildcard:*.example.com"))
+
+		match, err = r.findGatewayForDomain(testCtx, "legacy.internal")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match.Gateway.Name).To(Equal("legacy"))
+		Expect(match.Reason).To(Equal(gatewayMatchServerHost))
+
+		match, err = r.findGatewayForDomain(testCtx, "legacy.example.net")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match.Gateway.Name).To(Equal("legacy"))
+		Expect(match.String()).To(Equal("certificate_credential_name:legacy/legacy-tls"))
+
+		match, err = r.findGatewayForDomain(testCtx, "unknown.example.org")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match).To(BeNil())
+	})
+
+	It("attaches the solver route to every Gateway serving the domain equally", func() {
+		green := newTestGateway("istio-system", "green", "app.example.com", "app-tls")
+		blue := newTestGateway("istio-system", "blue", "app.example.com", "app-tls")
+		internal := newTestGateway("istio-system", "internal", "app.internal", "internal-tls")
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+			WithObjects(green, blue, internal,
+				newTestVirtualService("istio-system", "green", "app.example.com", "green"),
+				newTestVirtualService("istio-system", "blue", "app.example.com", "blue"),
+				newTestVirtualService("istio-system", "internal", "app.example.com", "internal"),
+			).
+			Build()
+		r := &HTTP01SolverPodReconciler{Client: c, Scheme: c.Scheme()}
+
+		match, err := r.findGatewayForDomain(testCtx, "app.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match.Reason).To(Equal(gatewayMatchVirtualServiceExact))
+		Expect(match.Gateway.Name).To(Equal("blue"))
+		Expect(gatewayRefsString(match.Ambiguous)).To(Equal("istio-system/green, istio-system/internal"))
+
+		By("skipping Gateways without an HTTP server for the domain")
+		Expect(gatewayRefsString(match.solverGateways())).To(Equal("istio-system/blue, istio-system/green"))
+		Expect(r.solverGatewayRefs(testCtx, match.solverGateways(), "istio-system")).To(Equal([]string{"blue", "green"}))
+	})
+
+	It("uses the Gateway from the Certificate annotation", func() {
+		green := newTestGateway("istio-system", "green", "app.example.com", "app-tls")
+		blue := newTestGateway("istio-system", "blue", "app.example.com", "app-tls")
+		cert := &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "app",
+				Namespace:   "app",
+				Annotations: map[string]string{solverGatewayAnnotation: "istio-system/green"},
+			},
+			Spec: certmanagerv1.CertificateSpec{SecretName: "app-tls", DNSNames: []string{"app.example.com"}},
+		}
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cm-acme-http-solver-abcde", Namespace: "app"}}
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+			WithObjects(green, blue, cert,
+				newTestVirtualService("istio-system", "green", "app.example.com", "green"),
+				newTestVirtualService("istio-system", "blue", "app.example.com", "blue"),
+			).
+			Build()
+		r := &HTTP01SolverPodReconciler{Client: c, Scheme: c.Scheme()}
+
+		match, err := r.findGatewayForSolver(testCtx, pod, "app.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match.Gateway.Name).To(Equal("green"))
+		Expect(match.Reason).To(Equal(gatewayMatchCertificateAnnotation))
+		Expect(match.Ambiguous).To(BeEmpty())
+		Expect(match.solverGateways()).To(HaveLen(1))
+	})
+})
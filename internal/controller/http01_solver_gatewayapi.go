@@ -0,0 +1,118 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *HTTP01SolverPodReconciler) reconcileGatewayAPISolver(ctx, pod, service, domain, token) (bool, error)
+ *   Добавляет правило токена HTTP01 solver пода в HTTPRoute хоста, если домен обслуживается Gateway API Gateway
+ *
+ * - (r *HTTP01SolverPodReconciler) findGatewayAPIForDomain(ctx, domain) (*Gateway, error)
+ *   Находит Gateway API Gateway, который обслуживает домен через hostnames привязанных HTTPRoute
+ *
+ * - (r *HTTP01SolverPodReconciler) findHTTPRouteForDomain(ctx, gateway, domain) (*HTTPRoute, error)
+ *   Проверяет наличие HTTPRoute оператора для Gateway и домена
+ */
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// reconcileGatewayAPISolver добавляет правило токена HTTP01 solver пода в HTTPRoute хоста,
+// если домен обслуживается Gateway API Gateway. Один HTTPRoute на хост содержит по правилу на каждый токен challenge.
+// Возвращает true, если Gateway API Gateway для домена найден
+func (r *HTTP01SolverPodReconciler) reconcileGatewayAPISolver(ctx context.Context, pod *corev1.Pod, service *corev1.Service, domain, token string) (bool, error) {
+	gateway, err := r.findGatewayAPIForDomain(ctx, domain)
+	if err != nil {
+		return false, err
+	}
+	if gateway == nil {
+		return false, nil
+	}
+
+	existingRoute, err := r.findHTTPRouteForDomain(ctx, gateway, domain)
+	if err != nil {
+		return true, err
+	}
+	if existingRoute == nil {
+		if err := r.createHTTPRouteForSolver(ctx, pod, service, gateway, domain, token); err != nil {
+			return true, err
+		}
+		ctrl.Log.Info("Created HTTPRoute for HTTP01 solver",
+			"pod", pod.Name,
+			"domain", domain,
+			"gateway", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+		)
+		return true, nil
+	}
+
+	// Добавляем или обновляем правило токена; правила других challenge этого хоста сохраняются
+	updated, err := r.updateHTTPRouteForSolver(ctx, pod, service, existingRoute, gateway, token)
+	if err != nil {
+		return true, err
+	}
+	if updated {
+		recordEvent(r.Recorder, pod, corev1.EventTypeNormal, eventReasonSolverRouteUpdated,
+			"Routed challenge for %s to this pod in HTTPRoute %s/%s", domain, existingRoute.Namespace, existingRoute.Name)
+	}
+	return true, nil
+}
+
+// findGatewayAPIForDomain находит Gateway API Gateway, который обслуживает домен
+// Как и для Istio Gateway, определяет Gateway только через hostnames привязанных маршрутов (HTTPRoute)
+func (r *HTTP01SolverPodReconciler) findGatewayAPIForDomain(ctx context.Context, domain string) (*gatewayapiv1.Gateway, error) {
+	gatewayList := &gatewayapiv1.GatewayList{}
+	if err := r.List(ctx, gatewayList, client.InNamespace("")); err != nil {
+		return nil, err
+	}
+
+	for i := range gatewayList.Items {
+		gateway := &gatewayList.Items[i]
+
+		domains, err := getDomainsForGatewayAPI(ctx, r.Client, gateway)
+		if err != nil {
+			continue
+		}
+
+		for _, gatewayDomain := range domains {
+			if gatewayDomain == domain {
+				ctrl.Log.Info("Gateway API Gateway found via HTTPRoute hostname match",
+					"domain", domain,
+					"gateway", gateway.Name,
+					"gatewayNamespace", gateway.Namespace,
+					"method", "httproute_hostname_match",
+				)
+				return gateway, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// findHTTPRouteForDomain проверяет наличие HTTPRoute оператора для Gateway и домена
+func (r *HTTP01SolverPodReconciler) findHTTPRouteForDomain(ctx context.Context, gateway *gatewayapiv1.Gateway, domain string) (*gatewayapiv1.HTTPRoute, error) {
+	routeList := &gatewayapiv1.HTTPRouteList{}
+	if err := r.List(ctx, routeList, client.InNamespace(gateway.Namespace), client.MatchingLabels{
+		"app.kubernetes.io/managed-by":       istioHTTP01ManagedByLabel,
+		"acme.cert-manager.io/http01-solver": http01SolverLabelValue,
+	}); err != nil {
+		return nil, err
+	}
+
+	for i := range routeList.Items {
+		route := &routeList.Items[i]
+		for _, hostname := range route.Spec.Hostnames {
+			if string(hostname) == domain {
+				return route, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,206 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *HTTP01SolverPodReconciler) createHTTPRouteForSolver(ctx, pod, service, gateway, domain, token) error
+ *   Создает HTTPRoute хоста с правилом токена пода HTTP01 solver на Gateway API Gateway
+ *
+ * - (r *HTTP01SolverPodReconciler) ensureReferenceGrantForSolver(ctx, service, gateway) error
+ *   Создает ReferenceGrant, разрешающий HTTPRoute из namespace Gateway ссылаться на Service солвера
+ *
+ * - (r *HTTP01SolverPodReconciler) deleteHTTPRoutesForPod(ctx, podName, podNamespace) error
+ *   Удаляет правила указанного пода из HTTPRoute; HTTPRoute без правил удаляются
+ *
+ * Правила HTTPRoute - в http01_solver_httproute_rules.go, добавление правила в HTTPRoute - в
+ * http01_solver_httproute_update.go
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// createHTTPRouteForSolver создает HTTPRoute хоста с правилом токена пода HTTP01 solver на Gateway API Gateway
+// HTTPRoute создается в namespace Gateway; правила следующих challenge хоста добавляет updateHTTPRouteForSolver
+func (r *HTTP01SolverPodReconciler) createHTTPRouteForSolver(ctx context.Context, pod *corev1.Pod, service *corev1.Service, gateway *gatewayapiv1.Gateway, domain, token string) error {
+	logger := log.FromContext(ctx)
+
+	// Service солвера Challenge или найденный по поду
+	service, err := r.solverServiceForPod(ctx, pod, service)
+	if err != nil {
+		return err
+	}
+
+	// Имя HTTPRoute на основе домена (как у VirtualService). HTTPRoute прежних версий находит
+	// findHTTPRouteForDomain по hostnames, и в него добавляются правила следующих подов
+	gatewayNamespace := gatewayapiv1.Namespace(gateway.Namespace)
+	rule := buildSolverHTTPRouteRule(service, token)
+	route := &gatewayapiv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      solverVirtualServiceName(domain),
+			Namespace: gateway.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by":       istioHTTP01ManagedByLabel,
+				"acme.cert-manager.io/http01-solver": http01SolverLabelValue,
+			},
+		},
+		Spec: gatewayapiv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayapiv1.CommonRouteSpec{
+				ParentRefs: []gatewayapiv1.ParentReference{
+					{
+						Name:      gatewayapiv1.ObjectName(gateway.Name),
+						Namespace: &gatewayNamespace,
+					},
+				},
+			},
+			Hostnames: []gatewayapiv1.Hostname{gatewayapiv1.Hostname(domain)},
+			Rules:     []gatewayapiv1.HTTPRouteRule{rule},
+		},
+	}
+	path, _ := solverHTTPRouteRulePath(rule)
+	setSolverHTTPRoutePods(route, map[string]string{path: pod.Namespace + "/" + pod.Name})
+
+	// Owner reference на Service солвера: GC удалит HTTPRoute, когда удалены Service всех правил
+	// Kubernetes не позволяет cross-namespace owner references - для Service из другого namespace нужен ReferenceGrant
+	if _, err := setSharedOwnerReference(service, route, r.Scheme, true); err != nil {
+		return fmt.Errorf("failed to set owner reference on HTTPRoute: %w", err)
+	}
+	if service.Namespace != gateway.Namespace {
+		if err := r.ensureReferenceGrantForSolver(ctx, service, gateway); err != nil {
+			return err
+		}
+	}
+
+	if err := r.Create(ctx, route); err != nil {
+		return fmt.Errorf("failed to create HTTPRoute: %w", err)
+	}
+	recordEvent(r.Recorder, pod, corev1.EventTypeNormal, eventReasonSolverRouteCreated,
+		"Created HTTPRoute %s/%s on Gateway %s/%s for %s", route.Namespace, route.Name, gateway.Namespace, gateway.Name, domain)
+
+	_, _, solverPort := solverHTTPRouteRuleBackend(rule)
+	logger.Info("Created HTTPRoute for HTTP01 solver",
+		"httpRoute", route.Name,
+		"path", path,
+		"solverService", service.Name,
+		"solverPort", solverPort,
+	)
+
+	return nil
+}
+
+// ensureReferenceGrantForSolver создает ReferenceGrant, разрешающий HTTPRoute из namespace Gateway
+// ссылаться на Service солвера в другом namespace. ReferenceGrant принадлежит Service и удаляется вместе с ним.
+// Если ReferenceGrant уже существует (домен обслуживают Gateway из нескольких namespace), namespace Gateway
+// добавляется в spec.from
+func (r *HTTP01SolverPodReconciler) ensureReferenceGrantForSolver(ctx context.Context, service *corev1.Service, gateway *gatewayapiv1.Gateway) error {
+	serviceName := gatewayapiv1.ObjectName(service.Name)
+	grant := &gatewayapiv1beta1.ReferenceGrant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      service.Name,
+			Namespace: service.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by":       istioHTTP01ManagedByLabel,
+				"acme.cert-manager.io/http01-solver": http01SolverLabelValue,
+			},
+		},
+		Spec: gatewayapiv1beta1.ReferenceGrantSpec{
+			From: []gatewayapiv1beta1.ReferenceGrantFrom{
+				{
+					Group:     gatewayapiv1.GroupName,
+					Kind:      "HTTPRoute",
+					Namespace: gatewayapiv1.Namespace(gateway.Namespace),
+				},
+			},
+			To: []gatewayapiv1beta1.ReferenceGrantTo{
+				{
+					Group: "",
+					Kind:  "Service",
+					Name:  &serviceName,
+				},
+			},
+		},
+	}
+
+	if err := ctrl.SetControllerReference(service, grant, r.Scheme); err != nil {
+		return fmt.Errorf("failed to set controller reference: %w", err)
+	}
+
+	err := r.Create(ctx, grant)
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create ReferenceGrant: %w", err)
+	}
+
+	existing := &gatewayapiv1beta1.ReferenceGrant{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(grant), existing); err != nil {
+		return fmt.Errorf("failed to get ReferenceGrant: %w", err)
+	}
+	for _, from := range existing.Spec.From {
+		if from.Group == gatewayapiv1.GroupName && from.Kind == "HTTPRoute" && string(from.Namespace) == gateway.Namespace {
+			return nil
+		}
+	}
+	existing.Spec.From = append(existing.Spec.From, grant.Spec.From[0])
+	if err := r.Update(ctx, existing); err != nil {
+		return fmt.Errorf("failed to update ReferenceGrant: %w", err)
+	}
+	return nil
+}
+
+// deleteHTTPRoutesForPod удаляет правила указанного пода из HTTPRoute хостов
+// HTTPRoute удаляется целиком, только если в нем не осталось правил других challenge
+func (r *HTTP01SolverPodReconciler) deleteHTTPRoutesForPod(ctx context.Context, podName, podNamespace string) error {
+	logger := log.FromContext(ctx)
+
+	routeList := &gatewayapiv1.HTTPRouteList{}
+	if err := r.List(ctx, routeList, client.MatchingLabels{
+		"app.kubernetes.io/managed-by":       istioHTTP01ManagedByLabel,
+		"acme.cert-manager.io/http01-solver": http01SolverLabelValue,
+	}); err != nil {
+		return fmt.Errorf("failed to list HTTPRoutes: %w", err)
+	}
+
+	for i := range routeList.Items {
+		route := &routeList.Items[i]
+		if removeSolverHTTPRouteRules(route, podNamespace+"/"+podName) == 0 {
+			continue
+		}
+
+		var err error
+		if len(route.Spec.Rules) == 0 {
+			err = client.IgnoreNotFound(r.Delete(ctx, route))
+		} else {
+			err = r.Update(ctx, route)
+		}
+		if err != nil {
+			logger.Error(err, "failed to remove rule from HTTPRoute",
+				"httpRoute", route.Name,
+				"httpRouteNamespace", route.Namespace,
+				"pod", podName,
+			)
+			continue
+		}
+
+		logger.Info("Removed rule of deleted pod from HTTPRoute",
+			"httpRoute", route.Name,
+			"httpRouteNamespace", route.Namespace,
+			"pod", podName,
+			"podNamespace", podNamespace,
+			"httpRouteDeleted", len(route.Spec.Rules) == 0,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - buildSolverHTTPRouteRule(service, token) HTTPRouteRule
+ *   Формирует правило HTTPRoute с точным путем /.well-known/acme-challenge/<token> на Service солвера
+ *
+ * - solverHTTPRouteRulePath(rule) (string, bool)
+ *   Возвращает путь правила и признак точного совпадения
+ *
+ * - solverHTTPRouteRuleBackend(rule) (string, string, PortNumber)
+ *   Возвращает имя, namespace и порт Service солвера правила
+ *
+ * - solverHTTPRouteRulePod(route, rule) string
+ *   Возвращает под солвера правила ("namespace/name") из аннотации или метки solver-pod HTTPRoute прежних версий
+ *
+ * - upsertSolverHTTPRouteRule(route, pod, rule) bool
+ *   Добавляет или заменяет правило пода в HTTPRoute хоста
+ *
+ * - removeSolverHTTPRouteRules(route, podRef) int
+ *   Удаляет правила пода из HTTPRoute хоста и снимает owner reference на Service без правил
+ *
+ * - solverHTTPRoutePods(route) map[string]string / setSolverHTTPRoutePods(route, pods)
+ *   Читают и записывают аннотацию solverHTTPRoutePodsAnnotation
+ *
+ * Правила HTTPRoute повторяют маршруты VirtualService хоста (http01_solver_vs_routes.go)
+ */
+
+package controller
+
+import (
+	"encoding/json"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// solverHTTPRoutePodsAnnotation аннотация HTTPRoute хоста с подами солвера правил в виде JSON
+// {"<путь правила>": "<namespace>/<имя пода>"}: правила HTTPRoute (Gateway API v1.1) не имеют имени
+const solverHTTPRoutePodsAnnotation = "istio-http01.rieset.io/solver-pods"
+
+// buildSolverHTTPRouteRule формирует правило HTTPRoute challenge на Service солвера
+// Правило совпадает только с путем своего токена; без токена (под без аргумента --token) правило
+// охватывает весь префикс challenge. Точный путь по спецификации Gateway API приоритетнее префикса
+func buildSolverHTTPRouteRule(service *corev1.Service, token string) gatewayapiv1.HTTPRouteRule {
+	// Определение порта из Service
+	solverPort := gatewayapiv1.PortNumber(8089) // Порт по умолчанию
+	if len(service.Spec.Ports) > 0 {
+		solverPort = gatewayapiv1.PortNumber(service.Spec.Ports[0].Port)
+	}
+
+	pathType := gatewayapiv1.PathMatchPathPrefix
+	pathValue := acmeChallengePathPrefix
+	if token != "" {
+		pathType = gatewayapiv1.PathMatchExact
+		pathValue = acmeChallengePathPrefix + token
+	}
+	serviceNamespace := gatewayapiv1.Namespace(service.Namespace)
+
+	return gatewayapiv1.HTTPRouteRule{
+		Matches: []gatewayapiv1.HTTPRouteMatch{
+			{
+				Path: &gatewayapiv1.HTTPPathMatch{
+					Type:  &pathType,
+					Value: &pathValue,
+				},
+			},
+		},
+		BackendRefs: []gatewayapiv1.HTTPBackendRef{
+			{
+				BackendRef: gatewayapiv1.BackendRef{
+					BackendObjectReference: gatewayapiv1.BackendObjectReference{
+						Name:      gatewayapiv1.ObjectName(service.Name),
+						Namespace: &serviceNamespace,
+						Port:      &solverPort,
+					},
+				},
+			},
+		},
+	}
+}
+
+// solverHTTPRouteRulePath возвращает путь правила (точный путь токена или префикс) и признак точного совпадения
+func solverHTTPRouteRulePath(rule gatewayapiv1.HTTPRouteRule) (string, bool) {
+	if len(rule.Matches) == 0 || rule.Matches[0].Path == nil || rule.Matches[0].Path.Value == nil {
+		return "", false
+	}
+	path := rule.Matches[0].Path
+	return *path.Value, path.Type != nil && *path.Type == gatewayapiv1.PathMatchExact
+}
+
+// solverHTTPRouteRuleBackend возвращает имя, namespace и порт Service солвера правила
+// backendRef без namespace ссылается на Service в namespace HTTPRoute (возвращается пустой namespace)
+func solverHTTPRouteRuleBackend(rule gatewayapiv1.HTTPRouteRule) (string, string, gatewayapiv1.PortNumber) {
+	if len(rule.BackendRefs) == 0 {
+		return "", "", 0
+	}
+	backend := rule.BackendRefs[0].BackendObjectReference
+	var namespace string
+	if backend.Namespace != nil {
+		namespace = string(*backend.Namespace)
+	}
+	var port gatewayapiv1.PortNumber
+	if backend.Port != nil {
+		port = *backend.Port
+	}
+	return string(backend.Name), namespace, port
+}
+
+// solverHTTPRouteRulePod возвращает под солвера правила в виде "namespace/name"
+// HTTPRoute прежних версий содержат одно правило без аннотации, а под указан в метке solver-pod:
+// namespace пода берется из backendRef (Service солвера создается в namespace пода)
+func solverHTTPRouteRulePod(route *gatewayapiv1.HTTPRoute, rule gatewayapiv1.HTTPRouteRule) string {
+	path, _ := solverHTTPRouteRulePath(rule)
+	if pod := solverHTTPRoutePods(route)[path]; pod != "" {
+		return pod
+	}
+	podName := route.Labels["acme.cert-manager.io/solver-pod"]
+	if podName == "" {
+		return ""
+	}
+	namespace := route.Namespace
+	if _, backendNamespace, _ := solverHTTPRouteRuleBackend(rule); backendNamespace != "" {
+		namespace = backendNamespace
+	}
+	return namespace + "/" + podName
+}
+
+// upsertSolverHTTPRouteRule добавляет или заменяет правило пода в HTTPRoute хоста
+// Заменяются правило того же пода и правило того же пути (предыдущий под challenge);
+// правила других challenge этого хоста сохраняются. Возвращает true, если HTTPRoute изменился
+func upsertSolverHTTPRouteRule(route *gatewayapiv1.HTTPRoute, pod *corev1.Pod, rule gatewayapiv1.HTTPRouteRule) bool {
+	podRef := pod.Namespace + "/" + pod.Name
+	path, exact := solverHTTPRouteRulePath(rule)
+	service, serviceNamespace, port := solverHTTPRouteRuleBackend(rule)
+
+	_, legacy := route.Labels["acme.cert-manager.io/solver-pod"]
+	for _, existing := range route.Spec.Rules {
+		existingPath, existingExact := solverHTTPRouteRulePath(existing)
+		existingService, existingNamespace, existingPort := solverHTTPRouteRuleBackend(existing)
+		if !legacy && solverHTTPRouteRulePod(route, existing) == podRef && existingPath == path && existingExact == exact &&
+			existingService == service && existingNamespace == serviceNamespace && existingPort == port {
+			return false
+		}
+	}
+
+	pods := map[string]string{path: podRef}
+	rules := make([]gatewayapiv1.HTTPRouteRule, 0, len(route.Spec.Rules)+1)
+	for _, existing := range route.Spec.Rules {
+		existingPod := solverHTTPRouteRulePod(route, existing)
+		existingPath, _ := solverHTTPRouteRulePath(existing)
+		if existingPod == podRef || existingPath == path {
+			continue
+		}
+		rules = append(rules, existing)
+		pods[existingPath] = existingPod
+	}
+	route.Spec.Rules = append(rules, rule)
+	setSolverHTTPRoutePods(route, pods)
+
+	// Правила записаны в аннотации по подам - метки одного пода больше не описывают HTTPRoute
+	delete(route.Labels, "acme.cert-manager.io/solver-pod")
+	delete(route.Labels, "acme.cert-manager.io/solver-service")
+	return true
+}
+
+// removeSolverHTTPRouteRules удаляет правила пода podRef ("namespace/name") из HTTPRoute хоста
+// Owner reference на Service и поды (HTTPRoute прежних версий), правил которых больше нет, снимаются.
+// Возвращает количество удаленных правил
+func removeSolverHTTPRouteRules(route *gatewayapiv1.HTTPRoute, podRef string) int {
+	pods := make(map[string]string, len(route.Spec.Rules))
+	podNames := make(map[string]bool, len(route.Spec.Rules))
+	services := make(map[string]bool, len(route.Spec.Rules))
+	rules := make([]gatewayapiv1.HTTPRouteRule, 0, len(route.Spec.Rules))
+	for _, rule := range route.Spec.Rules {
+		pod := solverHTTPRouteRulePod(route, rule)
+		if pod == podRef {
+			continue
+		}
+		path, _ := solverHTTPRouteRulePath(rule)
+		service, _, _ := solverHTTPRouteRuleBackend(rule)
+		rules = append(rules, rule)
+		pods[path] = pod
+		podNames[pod] = true
+		services[service] = true
+	}
+	removed := len(route.Spec.Rules) - len(rules)
+	if removed == 0 {
+		return 0
+	}
+
+	route.Spec.Rules = rules
+	setSolverHTTPRoutePods(route, pods)
+	delete(route.Labels, "acme.cert-manager.io/solver-pod")
+	delete(route.Labels, "acme.cert-manager.io/solver-service")
+	route.OwnerReferences = slices.DeleteFunc(route.OwnerReferences, func(ref metav1.OwnerReference) bool {
+		return (ref.Kind == "Service" && !services[ref.Name]) || (ref.Kind == "Pod" && !podNames[route.Namespace+"/"+ref.Name])
+	})
+	return removed
+}
+
+// solverHTTPRoutePods читает аннотацию solverHTTPRoutePodsAnnotation; неразбираемая аннотация считается пустой
+func solverHTTPRoutePods(route *gatewayapiv1.HTTPRoute) map[string]string {
+	pods := map[string]string{}
+	if value := route.Annotations[solverHTTPRoutePodsAnnotation]; value != "" {
+		_ = json.Unmarshal([]byte(value), &pods)
+	}
+	return pods
+}
+
+// setSolverHTTPRoutePods записывает аннотацию solverHTTPRoutePodsAnnotation (json.Marshal сортирует ключи)
+func setSolverHTTPRoutePods(route *gatewayapiv1.HTTPRoute, pods map[string]string) {
+	if len(pods) == 0 {
+		delete(route.Annotations, solverHTTPRoutePodsAnnotation)
+		return
+	}
+	value, err := json.Marshal(pods)
+	if err != nil {
+		return
+	}
+	if route.Annotations == nil {
+		route.Annotations = map[string]string{}
+	}
+	route.Annotations[solverHTTPRoutePodsAnnotation] = string(value)
+}
@@ -0,0 +1,155 @@
+/*
+ * Тесты HTTPRoute солвера для Gateway API (http01_solver_httproute.go, http01_solver_httproute_rules.go,
+ * http01_solver_httproute_update.go):
+ *
+ * - ensureReferenceGrantForSolver: создание ReferenceGrant и добавление namespace второго Gateway в spec.from
+ * - правило Exact на каждый токен хоста; удаление пода снимает только его правило, HTTPRoute без правил удаляется
+ * - HTTPRoute прежней версии (PathPrefix, под в метке solver-pod): правило нового пода добавляется, старое
+ *   снимается при удалении своего пода
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// testSolverPodAndService возвращает под солвера и его Service в namespace app
+func testSolverPodAndService(name string) (*corev1.Pod, *corev1.Service) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "app"}}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name + "-svc", Namespace: "app"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 8089}}},
+	}
+	return pod, service
+}
+
+// solverHTTPRoutePaths возвращает пути правил HTTPRoute и признак точного совпадения
+func solverHTTPRoutePaths(route *gatewayapiv1.HTTPRoute) map[string]bool {
+	paths := map[string]bool{}
+	for _, rule := range route.Spec.Rules {
+		path, exact := solverHTTPRouteRulePath(rule)
+		paths[path] = exact
+	}
+	return paths
+}
+
+var _ = Describe("Solver HTTPRoute", func() {
+	It("grants every Gateway namespace access to the solver Service", func() {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Name:      "cm-acme-http-solver-abcde",
+			Namespace: "app",
+			UID:       "service-uid",
+		}}
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(service).Build()
+		r := &HTTP01SolverPodReconciler{Client: c, Scheme: c.Scheme()}
+
+		first := &gatewayapiv1.Gateway{ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: "gateway-a"}}
+		second := &gatewayapiv1.Gateway{ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: "gateway-b"}}
+
+		Expect(r.ensureReferenceGrantForSolver(testCtx, service, first)).To(Succeed())
+		Expect(r.ensureReferenceGrantForSolver(testCtx, service, second)).To(Succeed())
+		Expect(r.ensureReferenceGrantForSolver(testCtx, service, first)).To(Succeed())
+
+		grant := &gatewayapiv1beta1.ReferenceGrant{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(service), grant)).To(Succeed())
+		var namespaces []string
+		for _, from := range grant.Spec.From {
+			namespaces = append(namespaces, string(from.Namespace))
+		}
+		Expect(namespaces).To(Equal([]string{"gateway-a", "gateway-b"}))
+	})
+
+	const domain = "app.example.com"
+	gateway := &gatewayapiv1.Gateway{ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: "gateway"}}
+
+	getRoute := func(c client.Client) (*gatewayapiv1.HTTPRoute, error) {
+		route := &gatewayapiv1.HTTPRoute{}
+		err := c.Get(testCtx, client.ObjectKey{Namespace: gateway.Namespace, Name: solverVirtualServiceName(domain)}, route)
+		return route, err
+	}
+
+	It("keeps one Exact rule per token and removes only the rule of a deleted pod", func() {
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).Build()
+		r := &HTTP01SolverPodReconciler{Client: c, Scheme: c.Scheme()}
+		first, firstService := testSolverPodAndService("cm-acme-http-solver-first")
+		second, secondService := testSolverPodAndService("cm-acme-http-solver-second")
+
+		Expect(r.createHTTPRouteForSolver(testCtx, first, firstService, gateway, domain, "token-a")).To(Succeed())
+		route, err := getRoute(c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.updateHTTPRouteForSolver(testCtx, second, secondService, route, gateway, "token-b")).To(BeTrue())
+
+		route, err = getRoute(c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.updateHTTPRouteForSolver(testCtx, second, secondService, route, gateway, "token-b")).To(BeFalse())
+		Expect(solverHTTPRoutePaths(route)).To(Equal(map[string]bool{
+			acmeChallengePathPrefix + "token-a": true,
+			acmeChallengePathPrefix + "token-b": true,
+		}))
+
+		By("deleting the first pod")
+		Expect(r.deleteHTTPRoutesForPod(testCtx, first.Name, first.Namespace)).To(Succeed())
+		route, err = getRoute(c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(solverHTTPRoutePaths(route)).To(Equal(map[string]bool{acmeChallengePathPrefix + "token-b": true}))
+		name, _, _ := solverHTTPRouteRuleBackend(route.Spec.Rules[0])
+		Expect(name).To(Equal(secondService.Name))
+
+		By("deleting the last pod")
+		Expect(r.deleteHTTPRoutesForPod(testCtx, second.Name, second.Namespace)).To(Succeed())
+		_, err = getRoute(c)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("adds rules to a HTTPRoute of a previous version without recreating it", func() {
+		legacyPod, legacyService := testSolverPodAndService("cm-acme-http-solver-legacy")
+		legacy := &gatewayapiv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      solverVirtualServiceName(domain),
+				Namespace: gateway.Namespace,
+				Labels: map[string]string{
+					"app.kubernetes.io/managed-by":        istioHTTP01ManagedByLabel,
+					"acme.cert-manager.io/http01-solver":  http01SolverLabelValue,
+					"acme.cert-manager.io/solver-pod":     legacyPod.Name,
+					"acme.cert-manager.io/solver-service": legacyService.Name,
+				},
+			},
+			Spec: gatewayapiv1.HTTPRouteSpec{
+				Hostnames: []gatewayapiv1.Hostname{domain},
+				Rules:     []gatewayapiv1.HTTPRouteRule{buildSolverHTTPRouteRule(legacyService, "")},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(legacy).Build()
+		r := &HTTP01SolverPodReconciler{Client: c, Scheme: c.Scheme()}
+		pod, service := testSolverPodAndService("cm-acme-http-solver-next")
+
+		route, err := getRoute(c)
+		Expect(err).NotTo(HaveOccurred())
+		uid := route.UID
+		Expect(r.updateHTTPRouteForSolver(testCtx, pod, service, route, gateway, "token")).To(BeTrue())
+
+		route, err = getRoute(c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(route.UID).To(Equal(uid))
+		Expect(route.Labels).NotTo(HaveKey("acme.cert-manager.io/solver-pod"))
+		Expect(solverHTTPRoutePaths(route)).To(Equal(map[string]bool{
+			acmeChallengePathPrefix:           false,
+			acmeChallengePathPrefix + "token": true,
+		}))
+
+		By("deleting the pod of the previous version")
+		Expect(r.deleteHTTPRoutesForPod(testCtx, legacyPod.Name, legacyPod.Namespace)).To(Succeed())
+		route, err = getRoute(c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(solverHTTPRoutePaths(route)).To(Equal(map[string]bool{acmeChallengePathPrefix + "token": true}))
+	})
+})
@@ -0,0 +1,57 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *HTTP01SolverPodReconciler) updateHTTPRouteForSolver(ctx, pod, service, existingRoute, gateway, token) (bool, error)
+ *   Добавляет или обновляет правило токена пода HTTP01 solver в HTTPRoute хоста
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// updateHTTPRouteForSolver добавляет или обновляет правило токена пода в HTTPRoute хоста
+// Правила других challenge этого хоста (несколько Certificate, перекрытие продления) сохраняются,
+// поэтому HTTPRoute не пересоздается для нового пода. Возвращает true, если HTTPRoute был изменен
+func (r *HTTP01SolverPodReconciler) updateHTTPRouteForSolver(ctx context.Context, pod *corev1.Pod, service *corev1.Service, existingRoute *gatewayapiv1.HTTPRoute, gateway *gatewayapiv1.Gateway, token string) (bool, error) {
+	// Service солвера Challenge или найденный по поду
+	service, err := r.solverServiceForPod(ctx, pod, service)
+	if err != nil {
+		return false, err
+	}
+
+	rule := buildSolverHTTPRouteRule(service, token)
+	if !upsertSolverHTTPRouteRule(existingRoute, pod, rule) {
+		return false, nil
+	}
+
+	// Owner reference на Service солвера: GC удалит HTTPRoute, когда удалены Service всех правил
+	// Владелец-под не используется - его удаление удалило бы правила остальных подов
+	if _, err := setSharedOwnerReference(service, existingRoute, r.Scheme, len(existingRoute.Spec.Rules) == 1); err != nil {
+		return false, fmt.Errorf("failed to set owner reference on HTTPRoute: %w", err)
+	}
+	if service.Namespace != gateway.Namespace {
+		if err := r.ensureReferenceGrantForSolver(ctx, service, gateway); err != nil {
+			return false, err
+		}
+	}
+
+	if err := r.Update(ctx, existingRoute); err != nil {
+		return false, fmt.Errorf("failed to update HTTPRoute: %w", err)
+	}
+
+	path, _ := solverHTTPRouteRulePath(rule)
+	log.FromContext(ctx).Info("Updated HTTPRoute for HTTP01 solver",
+		"httpRoute", existingRoute.Name,
+		"path", path,
+		"rules", len(existingRoute.Spec.Rules),
+		"solverService", service.Name,
+	)
+	return true, nil
+}
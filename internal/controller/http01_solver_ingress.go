@@ -0,0 +1,239 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *HTTP01SolverPodReconciler) findGatewayForSolver(ctx, pod, domain) (*gatewayMatch, error)
+ *   Определяет Istio Gateway для пода солвера по настройкам ingress HTTP01 solver'а issuer,
+ *   а если они не заданы - по доменам VirtualService (findGatewayForDomain)
+ *
+ * - (r *HTTP01SolverPodReconciler) certificateGatewayForDomain(ctx, namespace, domain) (string, error)
+ *   Возвращает Gateway из аннотации istio-http01.rieset.io/gateway Certificate, выпускающего домен
+ *
+ * - (r *HTTP01SolverPodReconciler) findGatewayByName(ctx, value, defaultNamespace, domain) (*Gateway, error)
+ *   Находит Istio Gateway по имени в формате "name" или "namespace/name"
+ *
+ * - (r *HTTP01SolverPodReconciler) findGatewayByClass(ctx, class, domain) (*Gateway, error)
+ *   Находит Istio Gateway с меткой istio-http01.rieset.io/ingress-class, равной классу solver'а
+ *
+ * - (r *HTTP01SolverPodReconciler) selectGatewayForDomain(ctx, gateways, domain) *Gateway
+ *   Выбирает среди кандидатов Gateway с наивысшим приоритетом совпадения с доменом или единственный кандидат
+ *
+ * Поиск HTTP01 solver'а пода (Challenge или issuer Certificate) - в http01_solver_issuer.go
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+const (
+	// solverGatewayAnnotation аннотация пода солвера или Certificate с Gateway ("name" или "namespace/name")
+	// На под задается в podTemplate.metadata.annotations HTTP01 solver'а issuer - cert-manager копирует ее на под
+	solverGatewayAnnotation = "istio-http01.rieset.io/gateway"
+
+	// gatewayIngressClassLabel метка Istio Gateway, сопоставляемая с class или ingressClassName HTTP01 solver'а
+	gatewayIngressClassLabel = "istio-http01.rieset.io/ingress-class"
+)
+
+// findGatewayForSolver определяет Istio Gateway для пода солвера
+// Порядок: аннотация podTemplate, аннотация Certificate, ingress.name, ingress.class/ingressClassName,
+// затем домены VirtualService
+// Явно указанный Gateway (аннотация или name) обязателен: если он не найден, маршрут не создается
+func (r *HTTP01SolverPodReconciler) findGatewayForSolver(ctx context.Context, pod *corev1.Pod, domain string) (*gatewayMatch, error) {
+	if value := pod.Annotations[solverGatewayAnnotation]; value != "" {
+		ctrl.Log.Info("Determining Gateway from solver podTemplate annotation",
+			"pod", pod.Name,
+			"domain", domain,
+			"annotation", value,
+			"method", gatewayMatchSolverAnnotation,
+		)
+		gateway, err := r.findGatewayByName(ctx, value, pod.Namespace, domain)
+		if gateway == nil || err != nil {
+			return nil, err
+		}
+		return &gatewayMatch{Gateway: gateway, Reason: gatewayMatchSolverAnnotation, Host: value}, nil
+	}
+
+	// Аннотация Certificate выбирает Gateway, когда домен обслуживают несколько Gateway
+	value, err := r.certificateGatewayForDomain(ctx, pod.Namespace, domain)
+	if err != nil {
+		return nil, err
+	}
+	if value != "" {
+		ctrl.Log.Info("Determining Gateway from Certificate annotation",
+			"pod", pod.Name,
+			"domain", domain,
+			"annotation", value,
+			"method", gatewayMatchCertificateAnnotation,
+		)
+		gateway, err := r.findGatewayByName(ctx, value, pod.Namespace, domain)
+		if gateway == nil || err != nil {
+			return nil, err
+		}
+		return &gatewayMatch{Gateway: gateway, Reason: gatewayMatchCertificateAnnotation, Host: value}, nil
+	}
+
+	ingress, err := r.solverIngressForPod(ctx, pod, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if ingress != nil {
+		if ingress.Name != "" {
+			ctrl.Log.Info("Determining Gateway from solver ingress name",
+				"pod", pod.Name,
+				"domain", domain,
+				"ingressName", ingress.Name,
+				"method", gatewayMatchSolverIngressName,
+			)
+			gateway, err := r.findGatewayByName(ctx, ingress.Name, pod.Namespace, domain)
+			if gateway == nil || err != nil {
+				return nil, err
+			}
+			return &gatewayMatch{Gateway: gateway, Reason: gatewayMatchSolverIngressName, Host: ingress.Name}, nil
+		}
+
+		for _, class := range []*string{ingress.IngressClassName, ingress.Class} {
+			if class == nil || *class == "" {
+				continue
+			}
+			gateway, err := r.findGatewayByClass(ctx, *class, domain)
+			if err != nil {
+				return nil, err
+			}
+			if gateway != nil {
+				ctrl.Log.Info("Gateway found via solver ingress class",
+					"pod", pod.Name,
+					"domain", domain,
+					"ingressClass", *class,
+					"gateway", gateway.Name,
+					"gatewayNamespace", gateway.Namespace,
+					"method", gatewayMatchSolverIngressClass,
+				)
+				return &gatewayMatch{Gateway: gateway, Reason: gatewayMatchSolverIngressClass, Host: *class}, nil
+			}
+			// Ни один Gateway не помечен классом (например, class: istio) - используем домены VirtualService
+			ctrl.Log.V(1).Info("No Gateway labeled with solver ingress class, falling back to domain match",
+				"domain", domain,
+				"ingressClass", *class,
+				"label", gatewayIngressClassLabel,
+			)
+		}
+	}
+
+	return r.findGatewayForDomain(ctx, domain)
+}
+
+// certificateGatewayForDomain возвращает значение аннотации istio-http01.rieset.io/gateway Certificate, выпускающего домен
+// Поды солвера создаются в namespace Certificate; из нескольких Certificate домена берется первый по имени с аннотацией
+func (r *HTTP01SolverPodReconciler) certificateGatewayForDomain(ctx context.Context, namespace, domain string) (string, error) {
+	certList := &certmanagerv1.CertificateList{}
+	if err := r.List(ctx, certList, client.InNamespace(namespace)); err != nil {
+		return "", fmt.Errorf("failed to list Certificates in namespace %s: %w", namespace, err)
+	}
+	slices.SortFunc(certList.Items, func(a, b certmanagerv1.Certificate) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	for i := range certList.Items {
+		cert := &certList.Items[i]
+		if isTemporaryObject(cert) || cert.Annotations[solverGatewayAnnotation] == "" {
+			continue
+		}
+		if slices.Contains(certificateHosts(cert), domain) {
+			return cert.Annotations[solverGatewayAnnotation], nil
+		}
+	}
+	return "", nil
+}
+
+// findGatewayByName находит Istio Gateway по имени в формате "name" или "namespace/name"
+// Имя без namespace ищется сначала в namespace пода, затем во всех namespace
+func (r *HTTP01SolverPodReconciler) findGatewayByName(ctx context.Context, value, defaultNamespace, domain string) (*istionetworkingv1beta1.Gateway, error) {
+	namespace, name := splitCredentialName(value, defaultNamespace)
+	gateway := &istionetworkingv1beta1.Gateway{}
+	err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, gateway)
+	if err == nil {
+		return gateway, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get Gateway %s/%s: %w", namespace, name, err)
+	}
+
+	// Namespace указан явно - другие namespace не проверяем
+	if value != name {
+		ctrl.Log.Info("Gateway from solver settings not found",
+			"gateway", name,
+			"gatewayNamespace", namespace,
+		)
+		return nil, nil
+	}
+
+	gatewayList := &istionetworkingv1beta1.GatewayList{}
+	if err := r.List(ctx, gatewayList); err != nil {
+		return nil, fmt.Errorf("failed to list Gateways: %w", err)
+	}
+	var candidates []*istionetworkingv1beta1.Gateway
+	for _, gw := range gatewayList.Items {
+		if gw.Name == name {
+			candidates = append(candidates, gw)
+		}
+	}
+	return r.selectGatewayForDomain(ctx, candidates, domain), nil
+}
+
+// findGatewayByClass находит Istio Gateway с меткой istio-http01.rieset.io/ingress-class, равной классу solver'а
+func (r *HTTP01SolverPodReconciler) findGatewayByClass(ctx context.Context, class, domain string) (*istionetworkingv1beta1.Gateway, error) {
+	gatewayList := &istionetworkingv1beta1.GatewayList{}
+	if err := r.List(ctx, gatewayList, client.MatchingLabels{gatewayIngressClassLabel: class}); err != nil {
+		return nil, fmt.Errorf("failed to list Gateways with ingress class %s: %w", class, err)
+	}
+	return r.selectGatewayForDomain(ctx, gatewayList.Items, domain), nil
+}
+
+// selectGatewayForDomain выбирает среди кандидатов Gateway с наивысшим приоритетом совпадения с доменом
+// Если домен не совпал ни с одним кандидатом, выбирается единственный кандидат; при неоднозначности - nil
+func (r *HTTP01SolverPodReconciler) selectGatewayForDomain(ctx context.Context, gateways []*istionetworkingv1beta1.Gateway, domain string) *istionetworkingv1beta1.Gateway {
+	// overlay Gateway оператора не выбирается как Gateway solver'а
+	gateways = slices.DeleteFunc(slices.Clone(gateways), func(gateway *istionetworkingv1beta1.Gateway) bool {
+		return isOverlayGateway(gateway)
+	})
+	matches, err := r.matchGatewaysForDomain(ctx, gateways, domain)
+	if err != nil {
+		ctrl.Log.Error(err, "failed to match Gateways for domain",
+			"domain", domain,
+		)
+	}
+	if len(matches) > 0 {
+		if len(matches) > 1 {
+			ctrl.Log.Info("Several Gateways match solver settings and the domain equally, using the first",
+				"domain", domain,
+				"method", matches[0].Reason,
+				"candidates", len(matches),
+			)
+		}
+		return matches[0].Gateway
+	}
+
+	if len(gateways) == 1 {
+		return gateways[0]
+	}
+	if len(gateways) > 1 {
+		ctrl.Log.Info("Several Gateways match solver settings and none serves the domain",
+			"domain", domain,
+			"candidates", len(gateways),
+		)
+	}
+	return nil
+}
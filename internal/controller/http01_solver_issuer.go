@@ -0,0 +1,91 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *HTTP01SolverPodReconciler) solverIngressForPod(ctx, pod, domain) (*ACMEChallengeSolverHTTP01Ingress, error)
+ *   Возвращает настройки ingress HTTP01 solver'а, которым cert-manager решает challenge пода
+ *
+ * - (r *HTTP01SolverPodReconciler) solverFromChallenge(ctx, pod) (*ACMEChallengeSolver, error)
+ *   Возвращает solver из Challenge, которому принадлежит под
+ *
+ * - (r *HTTP01SolverPodReconciler) solverFromIssuer(ctx, pod, domain) (*ACMEChallengeSolver, error)
+ *   Выбирает solver issuer'а Certificate, выпускающего домен в namespace пода
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// solverIngressForPod возвращает настройки ingress HTTP01 solver'а, которым cert-manager решает challenge пода
+// Solver берется из Challenge - владельца пода, а если Challenge недоступен - выбирается из issuer сертификата
+func (r *HTTP01SolverPodReconciler) solverIngressForPod(ctx context.Context, pod *corev1.Pod, domain string) (*cmacme.ACMEChallengeSolverHTTP01Ingress, error) {
+	solver, err := r.solverFromChallenge(ctx, pod)
+	if err != nil {
+		return nil, err
+	}
+	if solver == nil {
+		if solver, err = r.solverFromIssuer(ctx, pod, domain); err != nil {
+			return nil, err
+		}
+	}
+	if solver == nil || solver.HTTP01 == nil {
+		return nil, nil
+	}
+	return solver.HTTP01.Ingress, nil
+}
+
+// solverFromChallenge возвращает solver из Challenge, которому принадлежит под
+// cert-manager копирует в spec.solver Challenge solver issuer'а, выбранный для домена
+func (r *HTTP01SolverPodReconciler) solverFromChallenge(ctx context.Context, pod *corev1.Pod) (*cmacme.ACMEChallengeSolver, error) {
+	challengeName := challengeOwnerName(pod)
+	if challengeName == "" {
+		return nil, nil
+	}
+	challenge := &cmacme.Challenge{}
+	if err := r.Get(ctx, client.ObjectKey{Name: challengeName, Namespace: pod.Namespace}, challenge); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get Challenge %s/%s: %w", pod.Namespace, challengeName, err)
+	}
+	return &challenge.Spec.Solver, nil
+}
+
+// solverFromIssuer выбирает solver issuer'а Certificate, выпускающего домен
+// Поды солвера создаются в namespace Certificate, поэтому поиск ограничен namespace пода
+func (r *HTTP01SolverPodReconciler) solverFromIssuer(ctx context.Context, pod *corev1.Pod, domain string) (*cmacme.ACMEChallengeSolver, error) {
+	certList := &certmanagerv1.CertificateList{}
+	if err := r.List(ctx, certList, client.InNamespace(pod.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list Certificates in namespace %s: %w", pod.Namespace, err)
+	}
+
+	for i := range certList.Items {
+		cert := &certList.Items[i]
+		if isTemporaryObject(cert) {
+			continue
+		}
+		if !slices.Contains(cert.Spec.DNSNames, domain) && cert.Spec.CommonName != domain {
+			continue
+		}
+		spec, err := getIssuerSpec(ctx, r.Client, cert.Spec.IssuerRef, cert.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if spec == nil || spec.ACME == nil {
+			continue
+		}
+		if solver := selectACMESolver(spec.ACME.Solvers, cert, domain); solver != nil {
+			return solver, nil
+		}
+	}
+	return nil, nil
+}
@@ -4,28 +4,31 @@
  * - (r *HTTP01SolverPodReconciler) Reconcile(ctx, req) (ctrl.Result, error)
  *   Обрабатывает изменения подов cm-acme-http-solver-* и выводит информацию в логи
  *
- * - (r *HTTP01SolverPodReconciler) extractDomainFromPod(pod) (string, error)
- *   Извлекает домен из аргументов контейнера acmesolver
- *
  * - (r *HTTP01SolverPodReconciler) SetupWithManager(mgr) error
  *   Настраивает контроллер для работы с менеджером
  *
  * Дополнительные функции находятся в:
+ * - http01_solver_route.go - маршрут challenge на под солвера (общий для контроллера подов и Challenge)
+ * - http01_solver_pod_extract.go - домен и токен из аргументов контейнера acmesolver
  * - http01_solver_gateway.go - поиск Gateway для домена
+ * - http01_solver_ingress.go - выбор Gateway по настройкам ingress HTTP01 solver'а issuer
+ * - challenge_controller.go - маршрутизация по ресурсам Challenge cert-manager
  * - http01_solver_virtualservice.go - работа с VirtualService
  * - http01_solver_service.go - поиск Service для пода
+ * - http01_solver_preflight.go - предварительная проверка маршрута challenge через ingress gateway
+ * - http01_solver_gatewayapi.go, http01_solver_httproute.go - маршрутизация через Gateway API (HTTPRoute)
  */
 
 package controller
 
 import (
 	"context"
-	"fmt"
 	"strings"
-	"time"
+	"sync"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -35,12 +38,31 @@ import (
 type HTTP01SolverPodReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// GatewayAPIEnabled включает поиск Gateway API Gateway, если домен не обслуживается Istio Gateway
+	GatewayAPIEnabled bool
+	// Recorder создает события на поде солвера
+	Recorder record.EventRecorder
+	// ChallengeControllerEnabled передает поды, принадлежащие Challenge, в ChallengeReconciler
+	ChallengeControllerEnabled bool
+	// PreflightEnabled включает предварительную проверку маршрута challenge через ingress gateway
+	PreflightEnabled bool
+
+	// preflightPassed токены, проверка которых прошла успешно (ключ - namespace/имя пода)
+	preflightPassed sync.Map
 }
 
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
 // +kubebuilder:rbac:groups=networking.istio.io,resources=gateways,verbs=get;list;watch
 // +kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices,verbs=get;list;watch;create;patch;update;delete
+// +kubebuilder:rbac:groups=networking.istio.io,resources=sidecars,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
+// +kubebuilder:rbac:groups=acme.cert-manager.io,resources=challenges,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=issuers;clusterissuers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=referencegrants,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile обрабатывает HTTP01 solver поды
 func (r *HTTP01SolverPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -50,6 +72,7 @@ func (r *HTTP01SolverPodReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		// Если под не найден (удален), удаляем связанные VirtualService
 		if client.IgnoreNotFound(err) == nil {
 			// Под был удален - удаляем связанные VirtualService
+			r.forgetSolverPreflight(req.Namespace, req.Name)
 			if err := r.deleteVirtualServicesForPod(ctx, req.Name, req.Namespace); err != nil {
 				ctrl.Log.Error(err, "failed to delete VirtualServices for removed pod",
 					"pod", req.Name,
@@ -57,6 +80,14 @@ func (r *HTTP01SolverPodReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 				)
 				// Продолжаем выполнение, даже если не удалось удалить VirtualService
 			}
+			if r.GatewayAPIEnabled {
+				if err := r.deleteHTTPRoutesForPod(ctx, req.Name, req.Namespace); err != nil {
+					ctrl.Log.Error(err, "failed to delete HTTPRoutes for removed pod",
+						"pod", req.Name,
+						"namespace", req.Namespace,
+					)
+				}
+			}
 		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
@@ -66,146 +97,21 @@ func (r *HTTP01SolverPodReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, nil
 	}
 
-	// Извлечение домена из аргументов контейнера
-	domain := r.extractDomainFromPod(pod)
-
-	if domain == "" {
+	// Поды, принадлежащие Challenge, маршрутизирует ChallengeReconciler (домен берется из spec.dnsName)
+	// Разбор аргументов контейнера остается запасным путем для подов без Challenge
+	if r.ChallengeControllerEnabled && challengeOwnerName(pod) != "" {
 		return ctrl.Result{}, nil
 	}
 
-	// Поиск Gateway для этого домена
-	gateway, err := r.findGatewayForDomain(ctx, domain)
-	if err != nil {
-		ctrl.Log.Error(err, "failed to find Gateway for domain",
-			"pod", pod.Name,
-			"namespace", pod.Namespace,
-			"domain", domain,
-		)
-		return ctrl.Result{}, nil
-	}
-
-	if gateway == nil {
-		err := fmt.Errorf("no Gateway found for domain %s", domain)
-		ctrl.Log.Error(err, "Gateway not found for HTTP01 solver domain",
-			"pod", pod.Name,
-			"namespace", pod.Namespace,
-			"domain", domain,
-		)
-		return ctrl.Result{}, err
-	}
+	// Извлечение домена из аргументов контейнера
+	domain := r.extractDomainFromPod(pod)
 
-	// Проверка наличия VirtualService для этого домена и Gateway
-	existingVS, err := r.findVirtualServiceForDomain(ctx, gateway, domain)
-	if err != nil {
-		ctrl.Log.Error(err, "failed to check for existing VirtualService",
-			"pod", pod.Name,
-			"domain", domain,
-			"gateway", gateway.Name,
-			"gatewayNamespace", gateway.Namespace,
-		)
+	if domain == "" {
 		return ctrl.Result{}, nil
 	}
 
-	// Если VirtualService не найден по домену, проверяем все VirtualService оператора в namespace Gateway
-	// на актуальность и удаляем неактуальные
-	if existingVS == nil {
-		if err := r.cleanupOrphanedVirtualServicesInNamespace(ctx, gateway.Namespace); err != nil {
-			ctrl.Log.Error(err, "failed to cleanup orphaned VirtualServices in namespace",
-				"namespace", gateway.Namespace,
-			)
-			// Продолжаем выполнение, даже если не удалось очистить
-		}
-	}
-
-	if existingVS != nil {
-		// Проверяем актуальность VirtualService - существуют ли связанные под и сервис
-		isValid := r.isVirtualServiceValid(ctx, existingVS)
-		if !isValid {
-			// VirtualService неактуален - удаляем его и создадим новый
-			ctrl.Log.Info("VirtualService is not valid, deleting it",
-				"virtualService", existingVS.Name,
-				"virtualServiceNamespace", existingVS.Namespace,
-				"pod", pod.Name,
-			)
-			if err := r.Delete(ctx, existingVS); err != nil {
-				ctrl.Log.Error(err, "failed to delete invalid VirtualService",
-					"virtualService", existingVS.Name,
-					"virtualServiceNamespace", existingVS.Namespace,
-				)
-				// Продолжаем выполнение, попробуем создать новый VirtualService
-			} else {
-				ctrl.Log.Info("Deleted invalid VirtualService",
-					"virtualService", existingVS.Name,
-					"virtualServiceNamespace", existingVS.Namespace,
-				)
-				// Продолжаем выполнение, чтобы создать новый VirtualService
-				existingVS = nil
-			}
-		}
-
-		// Если VirtualService был удален как неактуальный, создаем новый
-		if existingVS == nil {
-			// Продолжаем выполнение для создания нового VirtualService
-		} else {
-			// Проверяем, что VirtualService принадлежит текущему поду
-			vsPodName := existingVS.Labels["acme.cert-manager.io/solver-pod"]
-			if vsPodName != pod.Name {
-				// Обновляем VirtualService для нового пода
-				if err := r.updateVirtualServiceForSolver(ctx, pod, existingVS); err != nil {
-					ctrl.Log.Error(err, "failed to update VirtualService for solver",
-						"pod", pod.Name,
-						"domain", domain,
-						"gateway", gateway.Name,
-						"virtualService", existingVS.Name,
-					)
-					return ctrl.Result{}, err
-				}
-				ctrl.Log.Info("Updated VirtualService for HTTP01 solver",
-					"pod", pod.Name,
-					"domain", domain,
-					"gateway", gateway.Name,
-					"virtualService", existingVS.Name,
-				)
-				return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
-			}
-
-			// VirtualService уже существует и принадлежит текущему поду
-			// Периодически проверяем и очищаем orphaned VirtualService
-			if err := r.cleanupOrphanedVirtualServices(ctx); err != nil {
-				ctrl.Log.Error(err, "failed to cleanup orphaned VirtualServices")
-				// Продолжаем выполнение, даже если не удалось очистить
-			}
-			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
-		}
-	}
-
-	// Создание VirtualService для доступа к поду солвера
-	if err := r.createVirtualServiceForSolver(ctx, pod, gateway, domain); err != nil {
-		ctrl.Log.Error(err, "failed to create VirtualService for solver",
-			"pod", pod.Name,
-			"domain", domain,
-			"gateway", gateway.Name,
-			"gatewayNamespace", gateway.Namespace,
-		)
-		return ctrl.Result{}, err
-	}
-
-	ctrl.Log.Info("Created VirtualService for HTTP01 solver",
-		"pod", pod.Name,
-		"domain", domain,
-		"gateway", gateway.Name,
-		"gatewayNamespace", gateway.Namespace,
-	)
-
-	// Периодически проверяем и очищаем orphaned VirtualService
-	if err := r.cleanupOrphanedVirtualServices(ctx); err != nil {
-		ctrl.Log.Error(err, "failed to cleanup orphaned VirtualServices")
-		// Продолжаем выполнение, даже если не удалось очистить
-	}
-
-	// Перепроверка через 30 секунд для убеждения что VirtualService существует
-	// и на случай если он был удален пользователем
-	return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	// Service солвера подбирается по поду (findServiceForPod)
+	return r.reconcileSolverRoute(ctx, pod, nil, domain, r.extractTokenFromPod(pod))
 }
 
 // SetupWithManager настраивает контроллер
@@ -223,5 +129,3 @@ func (r *HTTP01SolverPodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		WithEventFilter(http01SolverPredicate).
 		Complete(r)
 }
-
-// extractDomainFromPod перенесена в http01_solver_pod_extract.go
@@ -0,0 +1,130 @@
+/*
+ * Интеграционные тесты HTTP01SolverPodReconciler (envtest):
+ *
+ * - под солвера получает маршрут с точным путем токена в VirtualService хоста
+ * - одновременные challenge одного хоста делят VirtualService, маршрут удаляется вместе с подом
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// createTestSolver создает под солвера и Service с тем же именем, как это делает cert-manager
+func createTestSolver(namespace, name, domain, token string) *corev1.Pod {
+	labels := map[string]string{"acme.cert-manager.io/http01-solver": http01SolverLabelValue}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 8089}},
+		},
+	}
+	Expect(k8sClient.Create(testCtx, service)).To(Succeed())
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "acmesolver",
+				Image: "quay.io/jetstack/cert-manager-acmesolver:v1.16.3",
+				Args: []string{
+					"--listen-port=8089",
+					"--domain=" + domain,
+					"--token=" + token,
+					"--key=" + token + ".key",
+				},
+			}},
+		},
+	}
+	Expect(k8sClient.Create(testCtx, pod)).To(Succeed())
+	return pod
+}
+
+// solverRoutePaths возвращает пути маршрутов VirtualService хоста по именам подов
+func solverRoutePaths(key client.ObjectKey) (map[string]string, error) {
+	vs := &istionetworkingv1beta1.VirtualService{}
+	if err := k8sClient.Get(testCtx, key, vs); err != nil {
+		return nil, err
+	}
+	paths := make(map[string]string, len(vs.Spec.Http))
+	for _, route := range vs.Spec.Http {
+		paths[route.Name], _ = solverRoutePath(route)
+	}
+	return paths, nil
+}
+
+var _ = Describe("HTTP01SolverPodReconciler", func() {
+	const host = "app.example.com"
+
+	var (
+		namespace string
+		vsKey     client.ObjectKey
+	)
+
+	BeforeEach(func() {
+		requireEnvtest()
+		namespace = createTestNamespace()
+
+		gateway := newTestGateway(namespace, "public", host, "app-tls")
+		Expect(k8sClient.Create(testCtx, gateway)).To(Succeed())
+		Expect(k8sClient.Create(testCtx, newTestVirtualService(namespace, "app", host, gateway.Name))).To(Succeed())
+		vsKey = client.ObjectKey{Name: solverVirtualServiceName(host), Namespace: namespace}
+	})
+
+	It("routes every challenge of a host through its own token path", func() {
+		first := createTestSolver(namespace, "cm-acme-http-solver-first", host, "token-first")
+
+		By("creating the host VirtualService on the Gateway serving the domain")
+		Eventually(func(g Gomega) {
+			paths, err := solverRoutePaths(vsKey)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(paths).To(Equal(map[string]string{
+				first.Name: acmeChallengePathPrefix + "token-first",
+			}))
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+
+		vs := &istionetworkingv1beta1.VirtualService{}
+		Expect(k8sClient.Get(testCtx, vsKey, vs)).To(Succeed())
+		Expect(vs.Spec.Hosts).To(Equal([]string{host}))
+		Expect(vs.Spec.Gateways).To(Equal([]string{"public"}))
+		Expect(vs.Labels).To(HaveKeyWithValue("app.kubernetes.io/managed-by", istioHTTP01ManagedByLabel))
+		Expect(ownerNames(vs.OwnerReferences)).To(Equal([]string{first.Name}))
+
+		By("adding a route for a concurrent challenge of the same host")
+		second := createTestSolver(namespace, "cm-acme-http-solver-second", host, "token-second")
+		Eventually(func(g Gomega) {
+			paths, err := solverRoutePaths(vsKey)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(paths).To(Equal(map[string]string{
+				first.Name:  acmeChallengePathPrefix + "token-first",
+				second.Name: acmeChallengePathPrefix + "token-second",
+			}))
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+
+		By("removing only the route of a finished challenge")
+		Expect(k8sClient.Delete(testCtx, first)).To(Succeed())
+		Eventually(func(g Gomega) {
+			paths, err := solverRoutePaths(vsKey)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(paths).To(Equal(map[string]string{
+				second.Name: acmeChallengePathPrefix + "token-second",
+			}))
+		}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+
+		By("deleting the VirtualService with its last route")
+		Expect(k8sClient.Delete(testCtx, second)).To(Succeed())
+		Eventually(func() bool {
+			return apierrors.IsNotFound(k8sClient.Get(testCtx, vsKey, &istionetworkingv1beta1.VirtualService{}))
+		}, eventuallyTimeout, eventuallyInterval).Should(BeTrue())
+	})
+})
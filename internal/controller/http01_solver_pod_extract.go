@@ -3,6 +3,12 @@
  *
  * - (r *HTTP01SolverPodReconciler) extractDomainFromPod(pod) string
  *   Извлекает домен из аргументов контейнера acmesolver
+ *
+ * - (r *HTTP01SolverPodReconciler) extractTokenFromPod(pod) string
+ *   Извлекает токен challenge из аргументов контейнера acmesolver
+ *
+ * - (r *HTTP01SolverPodReconciler) extractKeyFromPod(pod) string
+ *   Извлекает key authorization challenge из аргументов контейнера acmesolver
  */
 
 package controller
@@ -26,3 +32,31 @@ func (r *HTTP01SolverPodReconciler) extractDomainFromPod(pod *corev1.Pod) string
 	}
 	return ""
 }
+
+// extractTokenFromPod извлекает токен challenge из аргументов контейнера acmesolver
+func (r *HTTP01SolverPodReconciler) extractTokenFromPod(pod *corev1.Pod) string {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == "acmesolver" {
+			for _, arg := range container.Args {
+				if strings.HasPrefix(arg, "--token=") {
+					return strings.TrimPrefix(arg, "--token=")
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// extractKeyFromPod извлекает key authorization, которую acmesolver отдает по пути токена
+func (r *HTTP01SolverPodReconciler) extractKeyFromPod(pod *corev1.Pod) string {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == "acmesolver" {
+			for _, arg := range container.Args {
+				if strings.HasPrefix(arg, "--key=") {
+					return strings.TrimPrefix(arg, "--key=")
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,240 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *HTTP01SolverPodReconciler) preflightSolverRoute(ctx, pod, gateways, domain, token)
+ *   Запрашивает путь токена challenge через ingress gateway каждого Gateway солвера и сообщает о маршрутизации событием на поде
+ *
+ * - (r *HTTP01SolverPodReconciler) reportSolverPreflightFailure(ctx, pod, gateway, ingressIP, domain, token, result, message, skippedNote)
+ *   Логирует неудачную проверку Gateway или, после solverPreflightGracePeriod, создает Warning событие
+ *
+ * - (r *HTTP01SolverPodReconciler) forgetSolverPreflight(namespace, name)
+ *   Забывает успешную проверку удаленного пода солвера
+ *
+ * - probeSolverChallenge(ctx, addr, domain, token, keyAuth) (solverPreflightResult, string)
+ *   Выполняет HTTP запрос challenge на адрес ingress gateway с заголовком Host домена
+ *
+ * - classifySolverResponse(statusCode, location, body, keyAuth) (solverPreflightResult, string)
+ *   Определяет по ответу, дошел ли запрос до пода солвера, и причину, если нет
+ *
+ * Проверка выполняется после создания или обновления VirtualService солвера, до того как ACME сервер
+ * запросит challenge: неправильный Gateway, 404 от другого VirtualService или включенный httpsRedirect
+ * видны в событиях пода, а не в отказах Let's Encrypt (с их rate limits)
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+// solverPreflightResult результат предварительной проверки маршрута солвера (метка result метрики)
+type solverPreflightResult string
+
+const (
+	// solverPreflightReachable ingress gateway вернул key authorization пода солвера
+	solverPreflightReachable solverPreflightResult = "reachable"
+	// solverPreflightRedirect ingress gateway перенаправил запрос (httpsRedirect или маршрут редиректа)
+	solverPreflightRedirect solverPreflightResult = "redirect"
+	// solverPreflightNotFound ingress gateway вернул 404: маршрут не применен или запрос обработал другой VirtualService
+	solverPreflightNotFound solverPreflightResult = "not_found"
+	// solverPreflightWrongResponse ответ получен не от пода солвера
+	solverPreflightWrongResponse solverPreflightResult = "wrong_response"
+	// solverPreflightUnreachable ingress gateway не ответил
+	solverPreflightUnreachable solverPreflightResult = "unreachable"
+
+	// solverPreflightGracePeriod время от создания пода, в течение которого неудачная проверка только логируется:
+	// Istio применяет новый VirtualService на ingress gateway за несколько секунд
+	solverPreflightGracePeriod = 20 * time.Second
+
+	// solverPreflightTimeout таймаут HTTP запроса проверки
+	solverPreflightTimeout = 5 * time.Second
+)
+
+// preflightSolverRoute запрашивает http://<domain>/.well-known/acme-challenge/<token> через адрес ingress gateway
+// (getIngressGatewayIP) каждого Gateway VirtualService солвера (выбранного и Attached) с заголовком Host домена
+// и сравнивает ответ с key authorization из аргумента --key пода. Gateway с неизвестным адресом пропускаются
+// и перечисляются в событиях. Проверка, прошедшая для всех проверенных Gateway, запоминается для пода
+// и токена и не повторяется. Неудачная проверка после solverPreflightGracePeriod создает Warning событие;
+// маршрут при этом не меняется, проверка повторится при следующей реконсиляции (через 30 секунд)
+func (r *HTTP01SolverPodReconciler) preflightSolverRoute(ctx context.Context, pod *corev1.Pod, gateways []*istionetworkingv1beta1.Gateway, domain, token string) {
+	logger := log.FromContext(ctx)
+
+	if !r.PreflightEnabled || token == "" {
+		return
+	}
+	keyAuth := r.extractKeyFromPod(pod)
+	if keyAuth == "" {
+		return
+	}
+	podKey := pod.Namespace + "/" + pod.Name
+	if passed, ok := r.preflightPassed.Load(podKey); ok && passed == token {
+		return
+	}
+
+	ingressIPs := make(map[*istionetworkingv1beta1.Gateway]string, len(gateways))
+	var probed, skipped []*istionetworkingv1beta1.Gateway
+	for _, gateway := range gateways {
+		ingressIP, err := lookupIngressGatewayIP(ctx, r.Client, gateway)
+		if err != nil {
+			logger.V(1).Info("Skipping HTTP01 pre-flight check of Gateway: ingress gateway address is unknown",
+				"pod", pod.Name,
+				"gatewayName", gateway.Name,
+				"gatewayNamespace", gateway.Namespace,
+				"reason", err.Error(),
+			)
+			skipped = append(skipped, gateway)
+			continue
+		}
+		ingressIPs[gateway] = ingressIP
+		probed = append(probed, gateway)
+	}
+	if len(probed) == 0 {
+		return
+	}
+	skippedNote := ""
+	if len(skipped) > 0 {
+		skippedNote = fmt.Sprintf("; not checked, ingress gateway address is unknown: %s", gatewayRefsString(skipped))
+	}
+
+	// Gateway одного ingress gateway (с одним адресом) проверяются одним запросом
+	type probe struct {
+		result  solverPreflightResult
+		message string
+	}
+	probes := make(map[string]probe, len(probed))
+	reachable := true
+	targets := make([]string, 0, len(probed))
+	for _, gateway := range probed {
+		ingressIP := ingressIPs[gateway]
+		p, ok := probes[ingressIP]
+		if !ok {
+			p.result, p.message = probeSolverChallenge(ctx, net.JoinHostPort(ingressIP, "80"), domain, token, keyAuth)
+			probes[ingressIP] = p
+		}
+		solverPreflightChecks.WithLabelValues(gateway.Name, gateway.Namespace, string(p.result)).Inc()
+		targets = append(targets, fmt.Sprintf("%s/%s (%s)", gateway.Namespace, gateway.Name, ingressIP))
+		if p.result != solverPreflightReachable {
+			reachable = false
+			r.reportSolverPreflightFailure(ctx, pod, gateway, ingressIP, domain, token, p.result, p.message, skippedNote)
+		}
+	}
+	if !reachable {
+		return
+	}
+
+	r.preflightPassed.Store(podKey, token)
+	recordEvent(r.Recorder, pod, corev1.EventTypeNormal, eventReasonSolverRouteReachable,
+		"HTTP01 challenge for %s is served by this pod via Gateway %s%s", domain, strings.Join(targets, ", "), skippedNote)
+	logger.Info("HTTP01 pre-flight check passed",
+		"pod", pod.Name,
+		"domain", domain,
+		"gateways", strings.Join(targets, ", "),
+		"skippedGateways", gatewayRefsString(skipped),
+	)
+}
+
+// reportSolverPreflightFailure сообщает о неудачной проверке Gateway: в течение solverPreflightGracePeriod
+// от создания пода только логирует ее, затем создает Warning событие на поде
+func (r *HTTP01SolverPodReconciler) reportSolverPreflightFailure(ctx context.Context, pod *corev1.Pod, gateway *istionetworkingv1beta1.Gateway, ingressIP, domain, token string, result solverPreflightResult, message, skippedNote string) {
+	logger := log.FromContext(ctx)
+
+	if time.Since(pod.CreationTimestamp.Time) < solverPreflightGracePeriod {
+		logger.V(1).Info("HTTP01 pre-flight check failed, waiting for Istio to apply the route",
+			"pod", pod.Name,
+			"domain", domain,
+			"gatewayName", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+			"result", result,
+			"reason", message,
+		)
+		return
+	}
+
+	recordEvent(r.Recorder, pod, corev1.EventTypeWarning, eventReasonSolverPreflightFailed,
+		"Pre-flight request http://%s%s%s via Gateway %s/%s (%s) %s%s", domain, acmeChallengePathPrefix, token, gateway.Namespace, gateway.Name, ingressIP, message, skippedNote)
+	logger.Info("HTTP01 pre-flight check failed",
+		"pod", pod.Name,
+		"domain", domain,
+		"gatewayName", gateway.Name,
+		"gatewayNamespace", gateway.Namespace,
+		"ingressIP", ingressIP,
+		"result", result,
+		"reason", message,
+	)
+}
+
+// forgetSolverPreflight забывает успешную проверку удаленного пода солвера
+func (r *HTTP01SolverPodReconciler) forgetSolverPreflight(namespace, name string) {
+	r.preflightPassed.Delete(namespace + "/" + name)
+}
+
+// probeSolverChallenge выполняет GET запрос пути токена на addr (адрес ingress gateway) с заголовком Host домена
+// Редиректы не выполняются: редирект сам по себе означает, что challenge не дойдет до солвера по HTTP.
+// Transport создается на каждый запрос без keep-alive, чтобы соединения не оставались открытыми после проверки
+func probeSolverChallenge(ctx context.Context, addr, domain, token, keyAuth string) (solverPreflightResult, string) {
+	httpClient := &http.Client{
+		Timeout: solverPreflightTimeout,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				dialer := &net.Dialer{Timeout: solverPreflightTimeout}
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s%s", domain, acmeChallengePathPrefix, token), nil)
+	if err != nil {
+		return solverPreflightUnreachable, fmt.Sprintf("could not be built: %v", err)
+	}
+	req.Host = domain
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return solverPreflightUnreachable, "timed out: the ingress gateway did not answer"
+		}
+		return solverPreflightUnreachable, fmt.Sprintf("failed: %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return solverPreflightUnreachable, fmt.Sprintf("failed to read the response: %v", err)
+	}
+	return classifySolverResponse(resp.StatusCode, resp.Header.Get("Location"), string(body), keyAuth)
+}
+
+// classifySolverResponse определяет, ответил ли под солвера, и описывает вероятную ошибку маршрутизации Istio
+func classifySolverResponse(statusCode int, location, body, keyAuth string) (solverPreflightResult, string) {
+	switch {
+	case statusCode == http.StatusOK && strings.TrimSpace(body) == keyAuth:
+		return solverPreflightReachable, "returned the key authorization"
+	case statusCode >= 300 && statusCode < 400:
+		return solverPreflightRedirect, fmt.Sprintf("was redirected with %d to %q: httpsRedirect or a redirect route is still active for the domain", statusCode, location)
+	case statusCode == http.StatusNotFound:
+		return solverPreflightNotFound, "returned 404: the route is not applied yet, the Gateway does not serve the domain or another VirtualService matched the path"
+	case statusCode == http.StatusOK:
+		return solverPreflightWrongResponse, "returned 200 without the key authorization: the request was served by another backend"
+	default:
+		return solverPreflightWrongResponse, fmt.Sprintf("returned %d instead of the key authorization", statusCode)
+	}
+}
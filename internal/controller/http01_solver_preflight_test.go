@@ -0,0 +1,116 @@
+/*
+ * Тесты предварительной проверки маршрута солвера (http01_solver_preflight.go):
+ *
+ * - classifySolverResponse: key authorization, редирект, 404 и ответ другого backend
+ * - probeSolverChallenge: запрос на адрес ingress gateway с заголовком Host домена, редирект не выполняется
+ * - preflightSolverRoute: проверяются и Attached Gateway, Gateway без адреса ingress gateway перечисляются в событии
+ */
+
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Solver route pre-flight check", func() {
+	It("classifies ingress gateway responses", func() {
+		result, _ := classifySolverResponse(http.StatusOK, "", "token-a.thumbprint\n", "token-a.thumbprint")
+		Expect(result).To(Equal(solverPreflightReachable))
+
+		result, message := classifySolverResponse(http.StatusMovedPermanently, "https://app.example.com/", "", "token-a.thumbprint")
+		Expect(result).To(Equal(solverPreflightRedirect))
+		Expect(message).To(ContainSubstring("https://app.example.com/"))
+
+		result, _ = classifySolverResponse(http.StatusNotFound, "", "", "token-a.thumbprint")
+		Expect(result).To(Equal(solverPreflightNotFound))
+
+		result, _ = classifySolverResponse(http.StatusOK, "", "<html>app</html>", "token-a.thumbprint")
+		Expect(result).To(Equal(solverPreflightWrongResponse))
+
+		result, message = classifySolverResponse(http.StatusServiceUnavailable, "", "", "token-a.thumbprint")
+		Expect(result).To(Equal(solverPreflightWrongResponse))
+		Expect(message).To(ContainSubstring("503"))
+	})
+
+	It("requests the challenge path through the ingress address with the domain Host header", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case req.Host == "app.example.com" && req.URL.Path == acmeChallengePathPrefix+"token-a":
+				_, _ = w.Write([]byte("token-a.thumbprint"))
+			case req.Host == "redirect.example.com":
+				http.Redirect(w, req, "https://redirect.example.com"+req.URL.Path, http.StatusMovedPermanently)
+			default:
+				http.NotFound(w, req)
+			}
+		}))
+		defer server.Close()
+		addr := strings.TrimPrefix(server.URL, "http://")
+
+		result, _ := probeSolverChallenge(testCtx, addr, "app.example.com", "token-a", "token-a.thumbprint")
+		Expect(result).To(Equal(solverPreflightReachable))
+
+		result, _ = probeSolverChallenge(testCtx, addr, "redirect.example.com", "token-a", "token-a.thumbprint")
+		Expect(result).To(Equal(solverPreflightRedirect))
+
+		result, _ = probeSolverChallenge(testCtx, addr, "other.example.com", "token-a", "token-a.thumbprint")
+		Expect(result).To(Equal(solverPreflightNotFound))
+	})
+
+	It("reports an unreachable ingress gateway", func() {
+		server := httptest.NewServer(http.NotFoundHandler())
+		addr := strings.TrimPrefix(server.URL, "http://")
+		server.Close()
+
+		result, _ := probeSolverChallenge(testCtx, addr, "app.example.com", "token-a", "token-a.thumbprint")
+		Expect(result).To(Equal(solverPreflightUnreachable))
+	})
+
+	It("probes attached Gateways and names the ones without an ingress address", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "cm-acme-http-solver-abc",
+				Namespace:         "app",
+				CreationTimestamp: metav1.NewTime(metav1.Now().AddDate(0, 0, -1)),
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "acmesolver",
+				Args: []string{"--key=token-a.thumbprint"},
+			}}},
+		}
+		// У выбранного Gateway нет Service ingress gateway, у Attached - есть
+		primary := newTestGateway("app", "public", "app.example.com", "app-tls")
+		attached := newTestGateway("app", "internal", "app.example.com", "app-tls")
+		attached.Spec.Selector = map[string]string{"istio": "internal-gateway"}
+		ingress := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "internal-gateway", Namespace: "istio-system"},
+			Spec: corev1.ServiceSpec{
+				Selector:    attached.Spec.Selector,
+				ExternalIPs: []string{"127.0.0.2"},
+			},
+		}
+
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(ingress).Build()
+		recorder := record.NewFakeRecorder(10)
+		r := &HTTP01SolverPodReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder, PreflightEnabled: true}
+		r.preflightSolverRoute(testCtx, pod, []*istionetworkingv1beta1.Gateway{primary, attached}, "app.example.com", "token-a")
+
+		Expect(recorder.Events).To(Receive(And(
+			ContainSubstring(eventReasonSolverPreflightFailed),
+			ContainSubstring("via Gateway app/internal (127.0.0.2)"),
+			ContainSubstring("ingress gateway address is unknown: app/public"),
+		)))
+		_, passed := r.preflightPassed.Load("app/cm-acme-http-solver-abc")
+		Expect(passed).To(BeFalse())
+	})
+})
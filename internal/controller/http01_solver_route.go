@@ -0,0 +1,161 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *HTTP01SolverPodReconciler) reconcileSolverRoute(ctx, pod, service, domain, token) (ctrl.Result, error)
+ *   Создает или обновляет маршрут challenge на под солвера (общий для контроллера подов и Challenge)
+ *
+ * Под солвера передают Reconcile (http01_solver_pod_controller.go) и ChallengeReconciler (challenge_controller.go)
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// reconcileSolverRoute создает или обновляет маршрут challenge (VirtualService или HTTPRoute) на под солвера
+// Используется контроллером подов и ChallengeReconciler; пустой token означает маршрут на весь префикс challenge.
+// service - Service солвера, найденный по меткам Challenge; nil - Service подбирается по поду (findServiceForPod)
+func (r *HTTP01SolverPodReconciler) reconcileSolverRoute(ctx context.Context, pod *corev1.Pod, service *corev1.Service, domain, token string) (ctrl.Result, error) {
+	// Поиск Gateway для этого домена (с учетом настроек ingress HTTP01 solver'а issuer)
+	match, err := r.findGatewayForSolver(ctx, pod, domain)
+	if err != nil {
+		ctrl.Log.Error(err, "failed to find Gateway for domain",
+			"pod", pod.Name,
+			"namespace", pod.Namespace,
+			"domain", domain,
+		)
+		return ctrl.Result{}, nil
+	}
+
+	if match == nil && r.GatewayAPIEnabled {
+		// Istio Gateway не найден - проверяем Gateway API Gateway (Istio в режиме Gateway API)
+		found, err := r.reconcileGatewayAPISolver(ctx, pod, service, domain, token)
+		if err != nil {
+			recordEvent(r.Recorder, pod, corev1.EventTypeWarning, eventReasonSolverRouteFailed,
+				"Failed to route HTTP01 challenge for %s via HTTPRoute: %v", domain, err)
+			ctrl.Log.Error(err, "failed to reconcile HTTPRoute for solver",
+				"pod", pod.Name,
+				"namespace", pod.Namespace,
+				"domain", domain,
+			)
+			return ctrl.Result{}, err
+		}
+		if found {
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+		}
+	}
+
+	if match == nil {
+		err := fmt.Errorf("no Gateway found for domain %s", domain)
+		recordEvent(r.Recorder, pod, corev1.EventTypeWarning, eventReasonGatewayNotFound,
+			"No Gateway serves %s, the HTTP01 challenge cannot be routed to this pod", domain)
+		ctrl.Log.Error(err, "Gateway not found for HTTP01 solver domain",
+			"pod", pod.Name,
+			"namespace", pod.Namespace,
+			"domain", domain,
+		)
+		return ctrl.Result{}, err
+	}
+	gateway := match.Gateway
+	if len(match.Ambiguous) > 0 {
+		recordEvent(r.Recorder, pod, corev1.EventTypeWarning, eventReasonGatewayAmbiguous,
+			"Several Gateways serve %s (%s): %s/%s, %s; the challenge route is attached to %s. Set annotation %s on the Certificate to choose one Gateway",
+			domain, match.Reason, gateway.Namespace, gateway.Name, gatewayRefsString(match.Ambiguous),
+			gatewayRefsString(match.solverGateways()), solverGatewayAnnotation)
+	}
+
+	// VirtualService хоста, созданный прежней версией, переименовывается в solverVirtualServiceName
+	if err := adoptLegacySolverVirtualService(ctx, r.Client, gateway.Namespace, domain); err != nil {
+		ctrl.Log.Error(err, "failed to adopt VirtualService created by a previous version",
+			"pod", pod.Name,
+			"domain", domain,
+			"gatewayNamespace", gateway.Namespace,
+		)
+	}
+
+	// Проверка наличия VirtualService хоста для этого домена и Gateway
+	// Один VirtualService на хост содержит по маршруту на каждый токен challenge
+	existingVS, err := r.findVirtualServiceForDomain(ctx, gateway, domain)
+	if err != nil {
+		ctrl.Log.Error(err, "failed to check for existing VirtualService",
+			"pod", pod.Name,
+			"domain", domain,
+			"gateway", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+		)
+		return ctrl.Result{}, nil
+	}
+
+	if existingVS == nil {
+		// VirtualService хоста не найден - удаляем неактуальные маршруты оператора в namespace Gateway
+		if err := r.cleanupOrphanedVirtualServicesInNamespace(ctx, gateway.Namespace); err != nil {
+			ctrl.Log.Error(err, "failed to cleanup orphaned VirtualServices in namespace",
+				"namespace", gateway.Namespace,
+			)
+			// Продолжаем выполнение, даже если не удалось очистить
+		}
+
+		// Создание VirtualService хоста с маршрутом на под солвера
+		if err := r.createVirtualServiceForSolver(ctx, pod, service, match, domain, token); err != nil {
+			recordEvent(r.Recorder, pod, corev1.EventTypeWarning, eventReasonSolverRouteFailed,
+				"Failed to create VirtualService on Gateway %s/%s for %s: %v", gateway.Namespace, gateway.Name, domain, err)
+			ctrl.Log.Error(err, "failed to create VirtualService for solver",
+				"pod", pod.Name,
+				"domain", domain,
+				"gateway", gateway.Name,
+				"gatewayNamespace", gateway.Namespace,
+			)
+			return ctrl.Result{}, err
+		}
+
+		ctrl.Log.Info("Created VirtualService for HTTP01 solver",
+			"pod", pod.Name,
+			"domain", domain,
+			"gateway", gateway.Name,
+			"gatewayNamespace", gateway.Namespace,
+		)
+	} else {
+		// Добавляем или обновляем маршрут токена; маршруты других challenge этого хоста сохраняются
+		updated, err := r.updateVirtualServiceForSolver(ctx, pod, service, existingVS, match.solverGateways(), token)
+		if err != nil {
+			recordEvent(r.Recorder, pod, corev1.EventTypeWarning, eventReasonSolverRouteFailed,
+				"Failed to add route for this pod to VirtualService %s/%s: %v", existingVS.Namespace, existingVS.Name, err)
+			ctrl.Log.Error(err, "failed to update VirtualService for solver",
+				"pod", pod.Name,
+				"domain", domain,
+				"gateway", gateway.Name,
+				"virtualService", existingVS.Name,
+			)
+			return ctrl.Result{}, err
+		}
+		if updated {
+			recordEvent(r.Recorder, pod, corev1.EventTypeNormal, eventReasonSolverRouteUpdated,
+				"Routed challenge for %s to this pod in VirtualService %s/%s", domain, existingVS.Namespace, existingVS.Name)
+			ctrl.Log.Info("Updated VirtualService for HTTP01 solver",
+				"pod", pod.Name,
+				"domain", domain,
+				"gateway", gateway.Name,
+				"virtualService", existingVS.Name,
+			)
+		}
+	}
+
+	// Проверяем, что ingress gateway каждого Gateway солвера отдает key authorization пода, до запроса ACME сервера
+	r.preflightSolverRoute(ctx, pod, match.solverGateways(), domain, token)
+
+	// Периодически проверяем и очищаем orphaned VirtualService
+	if err := r.cleanupOrphanedVirtualServices(ctx); err != nil {
+		ctrl.Log.Error(err, "failed to cleanup orphaned VirtualServices")
+		// Продолжаем выполнение, даже если не удалось очистить
+	}
+
+	// Перепроверка через 30 секунд для убеждения что VirtualService существует
+	// и на случай если он был удален пользователем
+	return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+}
@@ -3,6 +3,9 @@
  *
  * - (r *HTTP01SolverPodReconciler) findServiceForPod(ctx, pod) (*Service, error)
  *   Находит Service для HTTP01 solver пода по имени или по селектору (http-domain и http-token метки)
+ *
+ * - (r *HTTP01SolverPodReconciler) solverServiceForPod(ctx, pod, service) (*Service, error)
+ *   Возвращает Service солвера Challenge, а без него - Service, найденный по поду
  */
 
 package controller
@@ -45,37 +48,47 @@ func (r *HTTP01SolverPodReconciler) findServiceForPod(ctx context.Context, pod *
 		return service, nil
 	}
 
-	// Если не нашли по имени, ищем по меткам и селектору
-	// cert-manager создает Service с меткой acme.cert-manager.io/http01-solver: "true"
-	// и селектором по меткам http-domain и http-token пода
+	// Если не нашли по имени, ищем по меткам и селектору в namespace пода
+	// cert-manager создает Service с меткой acme.cert-manager.io/http01-solver: "true" рядом с подом
+	// (в namespace Certificate) и селектором по меткам пода, включая http-domain и http-token
 	for i := range serviceList.Items {
 		svc := &serviceList.Items[i]
-		// Проверка метки
-		if svc.Labels["acme.cert-manager.io/http01-solver"] == "true" {
-			// Проверка селектора - должен соответствовать меткам пода
-			if svc.Spec.Selector != nil {
-				podDomain := pod.Labels["acme.cert-manager.io/http-domain"]
-				podToken := pod.Labels["acme.cert-manager.io/http-token"]
-
-				svcDomain := svc.Spec.Selector["acme.cert-manager.io/http-domain"]
-				svcToken := svc.Spec.Selector["acme.cert-manager.io/http-token"]
-
-				// Service должен иметь селектор по http-domain и http-token
-				// и они должны совпадать с метками пода
-				if podDomain != "" && podToken != "" &&
-					svcDomain == podDomain && svcToken == podToken {
-					service = svc
-					logger.Info("Found Service by selector match",
-						"serviceName", service.Name,
-						"pod", pod.Name,
-						"httpDomain", podDomain,
-						"httpToken", podToken,
-					)
-					return service, nil
-				}
+		if svc.Labels["acme.cert-manager.io/http01-solver"] != "true" || len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		// Service должен иметь селектор по http-domain и http-token, а весь селектор - совпадать с метками пода
+		if svc.Spec.Selector["acme.cert-manager.io/http-domain"] == "" || svc.Spec.Selector["acme.cert-manager.io/http-token"] == "" {
+			continue
+		}
+		matches := true
+		for key, value := range svc.Spec.Selector {
+			if pod.Labels[key] != value {
+				matches = false
+				break
 			}
 		}
+		if matches {
+			service = svc
+			logger.Info("Found Service by selector match",
+				"serviceName", service.Name,
+				"serviceNamespace", service.Namespace,
+				"pod", pod.Name,
+				"httpDomain", pod.Labels["acme.cert-manager.io/http-domain"],
+				"httpToken", pod.Labels["acme.cert-manager.io/http-token"],
+			)
+			return service, nil
+		}
 	}
 
 	return nil, fmt.Errorf("service not found for solver pod %s: cert-manager may not have created the service yet", pod.Name)
 }
+
+// solverServiceForPod возвращает Service, на который ведет маршрут challenge пода
+// service - Service солвера, найденный ChallengeReconciler по меткам Challenge; для подов без Challenge
+// (nil) Service подбирается по поду
+func (r *HTTP01SolverPodReconciler) solverServiceForPod(ctx context.Context, pod *corev1.Pod, service *corev1.Service) (*corev1.Service, error) {
+	if service != nil {
+		return service, nil
+	}
+	return r.findServiceForPod(ctx, pod)
+}
@@ -5,7 +5,9 @@
  * - http01_solver_vs_create.go - создание VirtualService
  * - http01_solver_vs_update.go - обновление VirtualService
  * - http01_solver_vs_cleanup.go - удаление и очистка VirtualService
- * - http01_solver_vs_validation.go - валидация VirtualService
+ * - http01_solver_vs_validation.go - валидация маршрутов VirtualService
+ * - http01_solver_vs_routes.go - маршруты токенов challenge в VirtualService хоста
+ * - http01_solver_visibility.go - видимость Service солвера для Gateway (exportTo, Sidecar)
  */
 
 package controller
@@ -13,6 +15,4 @@ package controller
 const (
 	// http01SolverLabelValue is the value for the HTTP01 solver label
 	http01SolverLabelValue = "true"
-	// defaultCertManagerNamespace is the default namespace for cert-manager pods
-	defaultCertManagerNamespace = "istio-system"
 )
@@ -0,0 +1,195 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *HTTP01SolverPodReconciler) warnSolverServiceVisibility(ctx, pod, gateways, service)
+ *   Создает событие на поде, если Service солвера не виден workload'ам Gateway
+ *
+ * - (r *HTTP01SolverPodReconciler) checkSolverServiceVisibility(ctx, gateways, service) error
+ *   Проверяет exportTo Service солвера и egress Sidecar в namespace workload'ов Gateway
+ *
+ * - (r *HTTP01SolverPodReconciler) gatewayWorkloadNamespaces(ctx, gateway) ([]string, error)
+ *   Возвращает namespace workload'ов Gateway по Service с селектором Gateway
+ *
+ * - (r *HTTP01SolverPodReconciler) gatewaySidecar(ctx, namespace) (*Sidecar, error)
+ *   Возвращает Sidecar без workloadSelector, действующий на Gateway в namespace
+ *
+ * - serviceExportedTo(service, namespace) bool
+ *   Проверяет, экспортирован ли Service в namespace (аннотация networking.istio.io/exportTo)
+ *
+ * - sidecarAllowsService(sidecar, service) bool
+ *   Проверяет, разрешает ли egress Sidecar доступ к Service
+ *
+ * Cert-manager создает поды солвера в namespace Certificate, а VirtualService солвера создается в namespace
+ * Gateway, поэтому маршрут почти всегда межнамспейсный. Istio применяет к Gateway только Sidecar без
+ * workloadSelector (namespace workload'а или корневой namespace), а exportTo Service может скрыть его от Gateway
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+const (
+	// serviceExportToAnnotation аннотация Service, ограничивающая namespace, которым Istio показывает Service
+	serviceExportToAnnotation = "networking.istio.io/exportTo"
+
+	// istioRootNamespace корневой namespace Istio: Sidecar без workloadSelector в нем действует на весь mesh
+	istioRootNamespace = "istio-system"
+)
+
+// warnSolverServiceVisibility создает Warning событие на поде, если Service солвера не виден workload'ам Gateway
+// Маршрут все равно создается: ограничения могут быть сняты позже, а cert-manager повторит проверку
+func (r *HTTP01SolverPodReconciler) warnSolverServiceVisibility(ctx context.Context, pod *corev1.Pod, gateways []*istionetworkingv1beta1.Gateway, service *corev1.Service) {
+	logger := log.FromContext(ctx)
+
+	err := r.checkSolverServiceVisibility(ctx, gateways, service)
+	if err == nil {
+		return
+	}
+	recordEvent(r.Recorder, pod, corev1.EventTypeWarning, eventReasonSolverServiceNotVisible,
+		"HTTP01 challenge will not reach this pod: %v", err)
+	logger.Info("Solver Service is not visible to Gateway workloads",
+		"pod", pod.Name,
+		"podNamespace", pod.Namespace,
+		"service", service.Name,
+		"reason", err.Error(),
+	)
+}
+
+// checkSolverServiceVisibility проверяет, видит ли каждый Gateway Service солвера
+// Ошибки чтения Sidecar и Service не считаются ограничением видимости
+func (r *HTTP01SolverPodReconciler) checkSolverServiceVisibility(ctx context.Context, gateways []*istionetworkingv1beta1.Gateway, service *corev1.Service) error {
+	for _, gateway := range gateways {
+		namespaces, err := r.gatewayWorkloadNamespaces(ctx, gateway)
+		if err != nil {
+			return nil
+		}
+		for _, namespace := range namespaces {
+			if !serviceExportedTo(service, namespace) {
+				return fmt.Errorf("Service %s/%s is exported to %q, Gateway %s/%s runs in namespace %s",
+					service.Namespace, service.Name, service.Annotations[serviceExportToAnnotation], gateway.Namespace, gateway.Name, namespace)
+			}
+			sidecar, err := r.gatewaySidecar(ctx, namespace)
+			if err != nil || sidecar == nil {
+				continue
+			}
+			if !sidecarAllowsService(sidecar, service) {
+				return fmt.Errorf("Sidecar %s/%s does not allow egress to Service %s/%s for Gateway %s/%s",
+					sidecar.Namespace, sidecar.Name, service.Namespace, service.Name, gateway.Namespace, gateway.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// gatewayWorkloadNamespaces возвращает namespace workload'ов Gateway
+// Workload определяется так же, как в getIngressGatewayIP: по Service с селектором, включающим селектор Gateway.
+// Если такой Service не найден, используется namespace Gateway
+func (r *HTTP01SolverPodReconciler) gatewayWorkloadNamespaces(ctx context.Context, gateway *istionetworkingv1beta1.Gateway) ([]string, error) {
+	selector := gateway.Spec.Selector
+	if len(selector) == 0 {
+		selector = map[string]string{"istio": "ingressgateway"}
+	}
+
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(ctx, serviceList); err != nil {
+		return nil, fmt.Errorf("failed to list Services: %w", err)
+	}
+
+	var namespaces []string
+	for i := range serviceList.Items {
+		svc := &serviceList.Items[i]
+		matches := len(svc.Spec.Selector) > 0
+		for key, value := range selector {
+			if svc.Spec.Selector[key] != value {
+				matches = false
+				break
+			}
+		}
+		if matches && !slices.Contains(namespaces, svc.Namespace) {
+			namespaces = append(namespaces, svc.Namespace)
+		}
+	}
+	if len(namespaces) == 0 {
+		namespaces = []string{gateway.Namespace}
+	}
+	return namespaces, nil
+}
+
+// gatewaySidecar возвращает Sidecar без workloadSelector в namespace workload'а Gateway,
+// а если его нет - в корневом namespace Istio. Sidecar с workloadSelector на Gateway не действуют
+func (r *HTTP01SolverPodReconciler) gatewaySidecar(ctx context.Context, namespace string) (*istionetworkingv1beta1.Sidecar, error) {
+	for _, ns := range []string{namespace, istioRootNamespace} {
+		sidecarList := &istionetworkingv1beta1.SidecarList{}
+		if err := r.List(ctx, sidecarList, client.InNamespace(ns)); err != nil {
+			return nil, fmt.Errorf("failed to list Sidecars in namespace %s: %w", ns, err)
+		}
+		for _, sidecar := range sidecarList.Items {
+			if sidecar.Spec.GetWorkloadSelector() == nil {
+				return sidecar, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// serviceExportedTo проверяет, экспортирован ли Service в namespace
+// Без аннотации Service экспортирован во все namespace; "." - только в свой, "~" - никуда
+func serviceExportedTo(service *corev1.Service, namespace string) bool {
+	value, ok := service.Annotations[serviceExportToAnnotation]
+	if !ok || strings.TrimSpace(value) == "" {
+		return true
+	}
+	for _, entry := range strings.Split(value, ",") {
+		switch entry = strings.TrimSpace(entry); entry {
+		case "*":
+			return true
+		case ".":
+			if service.Namespace == namespace {
+				return true
+			}
+		default:
+			if entry == namespace {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sidecarAllowsService проверяет, разрешает ли egress Sidecar доступ к Service
+// Hosts egress имеют вид "namespace/dnsName": namespace "*" - любой, "." - namespace Sidecar, "~" - ни один
+func sidecarAllowsService(sidecar *istionetworkingv1beta1.Sidecar, service *corev1.Service) bool {
+	if len(sidecar.Spec.GetEgress()) == 0 {
+		return true
+	}
+	fqdn := fmt.Sprintf("%s.%s.svc.cluster.local", service.Name, service.Namespace)
+	for _, listener := range sidecar.Spec.GetEgress() {
+		for _, egressHost := range listener.GetHosts() {
+			namespace, host, found := strings.Cut(egressHost, "/")
+			if !found {
+				continue
+			}
+			switch {
+			case namespace == "*", namespace == service.Namespace:
+			case namespace == "." && sidecar.Namespace == service.Namespace:
+			default:
+				continue
+			}
+			if host == "*" || hostsOverlap(host, fqdn) || host == service.Name+"."+service.Namespace {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+/*
+ * Тесты видимости Service солвера для Gateway (http01_solver_visibility.go):
+ *
+ * - serviceExportedTo: без аннотации, ".", "~" и список namespace
+ * - sidecarAllowsService: Sidecar без egress, hosts по namespace и DNS имени
+ * - checkSolverServiceVisibility: Sidecar namespace workload'а Gateway, Sidecar с workloadSelector не учитывается
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+// testExportedSolverService возвращает Service солвера в namespace с аннотацией exportTo (если задана)
+func testExportedSolverService(namespace, exportTo string) *corev1.Service {
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "cm-acme-http-solver-abcde", Namespace: namespace}}
+	if exportTo != "" {
+		service.Annotations = map[string]string{serviceExportToAnnotation: exportTo}
+	}
+	return service
+}
+
+// testSidecar возвращает Sidecar с egress hosts
+func testSidecar(namespace, name string, hosts ...string) *istionetworkingv1beta1.Sidecar {
+	sidecar := &istionetworkingv1beta1.Sidecar{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	if len(hosts) > 0 {
+		sidecar.Spec.Egress = []*istioapinetworkingv1beta1.IstioEgressListener{{Hosts: hosts}}
+	}
+	return sidecar
+}
+
+var _ = Describe("Solver Service visibility", func() {
+	It("follows the exportTo annotation of the solver Service", func() {
+		Expect(serviceExportedTo(testExportedSolverService("app", ""), "istio-system")).To(BeTrue())
+		Expect(serviceExportedTo(testExportedSolverService("app", "*"), "istio-system")).To(BeTrue())
+		Expect(serviceExportedTo(testExportedSolverService("app", "."), "istio-system")).To(BeFalse())
+		Expect(serviceExportedTo(testExportedSolverService("app", "."), "app")).To(BeTrue())
+		Expect(serviceExportedTo(testExportedSolverService("app", "~"), "app")).To(BeFalse())
+		Expect(serviceExportedTo(testExportedSolverService("app", "., istio-system"), "istio-system")).To(BeTrue())
+	})
+
+	It("matches Sidecar egress hosts by namespace and DNS name", func() {
+		service := testExportedSolverService("app", "")
+
+		Expect(sidecarAllowsService(testSidecar("istio-system", "default"), service)).To(BeTrue())
+		Expect(sidecarAllowsService(testSidecar("istio-system", "default", "./*", "istio-system/*"), service)).To(BeFalse())
+		Expect(sidecarAllowsService(testSidecar("istio-system", "default", "app/*"), service)).To(BeTrue())
+		Expect(sidecarAllowsService(testSidecar("istio-system", "default", "*/*.app.svc.cluster.local"), service)).To(BeTrue())
+		Expect(sidecarAllowsService(testSidecar("istio-system", "default", "app/other.app.svc.cluster.local"), service)).To(BeFalse())
+		Expect(sidecarAllowsService(testSidecar("app", "default", "./*"), service)).To(BeTrue())
+	})
+
+	It("checks the Sidecar applied to the Gateway workload namespace", func() {
+		gateway := newTestGateway("istio-system", "public", "app.example.com", "app-tls")
+		ingress := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "istio-ingressgateway", Namespace: "ingress"},
+			Spec:       corev1.ServiceSpec{Selector: gateway.Spec.Selector},
+		}
+		selected := testSidecar("ingress", "selected", "./*")
+		selected.Spec.WorkloadSelector = &istioapinetworkingv1beta1.WorkloadSelector{Labels: gateway.Spec.Selector}
+		rootDefault := testSidecar("istio-system", "default", "./*")
+		service := testExportedSolverService("app", "")
+
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+			WithObjects(gateway, ingress, selected, rootDefault).
+			Build()
+		r := &HTTP01SolverPodReconciler{Client: c, Scheme: c.Scheme()}
+		gateways := []*istionetworkingv1beta1.Gateway{gateway}
+
+		By("ignoring Sidecars with a workloadSelector and falling back to the root namespace")
+		err := r.checkSolverServiceVisibility(testCtx, gateways, service)
+		Expect(err).To(MatchError(ContainSubstring("Sidecar istio-system/default")))
+
+		By("preferring the default Sidecar of the workload namespace")
+		Expect(c.Create(testCtx, testSidecar("ingress", "default", "app/*"))).To(Succeed())
+		Expect(r.checkSolverServiceVisibility(testCtx, gateways, service)).To(Succeed())
+
+		By("reporting a Service not exported to the workload namespace")
+		err = r.checkSolverServiceVisibility(testCtx, gateways, testExportedSolverService("app", "."))
+		Expect(err).To(MatchError(ContainSubstring("runs in namespace ingress")))
+	})
+})
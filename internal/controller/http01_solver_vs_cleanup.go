@@ -2,13 +2,19 @@
  * Функции, определенные в этом файле:
  *
  * - (r *HTTP01SolverPodReconciler) deleteVirtualServicesForPod(ctx, podName, podNamespace) error
- *   Удаляет все VirtualService, связанные с указанным подом
+ *   Удаляет маршруты указанного пода из VirtualService; VirtualService без маршрутов удаляются
  *
  * - (r *HTTP01SolverPodReconciler) cleanupOrphanedVirtualServices(ctx) error
- *   Удаляет VirtualService, которые ссылаются на несуществующие поды или сервисы
+ *   Удаляет маршруты, которые ссылаются на несуществующие поды или сервисы, во всех namespace
  *
  * - (r *HTTP01SolverPodReconciler) cleanupOrphanedVirtualServicesInNamespace(ctx, namespace) error
- *   Удаляет неактуальные VirtualService оператора в указанном namespace
+ *   Удаляет неактуальные маршруты VirtualService оператора в указанном namespace
+ *
+ * - (r *HTTP01SolverPodReconciler) pruneSolverVirtualServices(ctx, opts...) (int, error)
+ *   Удаляет неактуальные маршруты из VirtualService оператора, выбранных opts
+ *
+ * - (r *HTTP01SolverPodReconciler) saveSolverVirtualService(ctx, vs) (bool, error)
+ *   Сохраняет VirtualService после удаления маршрутов или удаляет его, если маршрутов не осталось
  */
 
 package controller
@@ -16,16 +22,16 @@ package controller
 import (
 	"context"
 	"fmt"
-	"strings"
 
-	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
 	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
 )
 
-// deleteVirtualServicesForPod удаляет все VirtualService, связанные с указанным подом
+// deleteVirtualServicesForPod удаляет маршруты указанного пода из VirtualService хостов
+// VirtualService удаляется целиком, только если в нем не осталось маршрутов других challenge
 func (r *HTTP01SolverPodReconciler) deleteVirtualServicesForPod(ctx context.Context, podName, podNamespace string) error {
 	logger := log.FromContext(ctx)
 
@@ -43,183 +49,127 @@ func (r *HTTP01SolverPodReconciler) deleteVirtualServicesForPod(ctx context.Cont
 	}
 
 	for _, vs := range virtualServices {
-		if err := r.Delete(ctx, vs); err != nil {
-			logger.Error(err, "failed to delete VirtualService",
+		removeSolverRoutes(vs, func(route *istioapinetworkingv1beta1.HTTPRoute) bool {
+			return solverRoutePodName(vs, route) == podName && solverRoutePodNamespace(vs, route) == podNamespace
+		})
+		deleted, err := r.saveSolverVirtualService(ctx, vs)
+		if err != nil {
+			logger.Error(err, "failed to remove route from VirtualService",
 				"virtualService", vs.Name,
 				"virtualServiceNamespace", vs.Namespace,
 				"pod", podName,
 			)
-			// Продолжаем удаление остальных, даже если один не удалился
+			// Продолжаем обработку остальных, даже если один не обновился
 			continue
 		}
 
-		logger.Info("Deleted VirtualService for removed pod",
+		logger.Info("Removed route of deleted pod from VirtualService",
 			"virtualService", vs.Name,
 			"virtualServiceNamespace", vs.Namespace,
 			"pod", podName,
 			"podNamespace", podNamespace,
+			"virtualServiceDeleted", deleted,
 		)
 	}
 
 	return nil
 }
 
-// cleanupOrphanedVirtualServicesInNamespace удаляет неактуальные VirtualService оператора в указанном namespace
+// cleanupOrphanedVirtualServicesInNamespace удаляет неактуальные маршруты VirtualService оператора в указанном namespace
 func (r *HTTP01SolverPodReconciler) cleanupOrphanedVirtualServicesInNamespace(ctx context.Context, namespace string) error {
-	logger := log.FromContext(ctx)
-
-	// Поиск всех VirtualService оператора в указанном namespace
-	virtualServiceList := &istionetworkingv1beta1.VirtualServiceList{}
-	if err := r.List(ctx, virtualServiceList, client.InNamespace(namespace), client.MatchingLabels{
-		"app.kubernetes.io/managed-by": "istio-http01",
-	}); err != nil {
-		return fmt.Errorf("failed to list VirtualServices in namespace: %w", err)
+	cleaned, err := r.pruneSolverVirtualServices(ctx, client.InNamespace(namespace))
+	if err != nil {
+		return err
 	}
 
-	var orphanedVS []*istionetworkingv1beta1.VirtualService
-
-	for i := range virtualServiceList.Items {
-		vsItem := virtualServiceList.Items[i] // vsItem это *VirtualService
-		// Проверяем только VirtualService для HTTP01 solver
-		if vsItem.Labels == nil || vsItem.Labels["acme.cert-manager.io/http01-solver"] != http01SolverLabelValue {
-			continue
-		}
-
-		// Проверяем актуальность VirtualService
-		isValid := r.isVirtualServiceValid(ctx, vsItem)
-
-		if !isValid {
-			orphanedVS = append(orphanedVS, vsItem)
-			logger.Info("Found orphaned VirtualService in namespace",
-				"virtualService", vsItem.Name,
-				"virtualServiceNamespace", vsItem.Namespace,
-				"namespace", namespace,
-			)
-		}
+	if cleaned > 0 {
+		log.FromContext(ctx).Info("Cleaned up orphaned VirtualService routes in namespace",
+			"namespace", namespace,
+			"count", cleaned,
+		)
 	}
 
-	// Удаляем orphaned VirtualService
-	for _, vs := range orphanedVS {
-		if err := r.Delete(ctx, vs); err != nil {
-			logger.Error(err, "failed to delete orphaned VirtualService",
-				"virtualService", vs.Name,
-				"virtualServiceNamespace", vs.Namespace,
-			)
-			continue
-		}
+	return nil
+}
 
-		logger.Info("Deleted orphaned VirtualService in namespace",
-			"virtualService", vs.Name,
-			"virtualServiceNamespace", vs.Namespace,
-			"namespace", namespace,
-		)
+// cleanupOrphanedVirtualServices удаляет маршруты, которые ссылаются на несуществующие поды или сервисы
+func (r *HTTP01SolverPodReconciler) cleanupOrphanedVirtualServices(ctx context.Context) error {
+	cleaned, err := r.pruneSolverVirtualServices(ctx)
+	if err != nil {
+		return err
 	}
 
-	if len(orphanedVS) > 0 {
-		logger.Info("Cleaned up orphaned VirtualServices in namespace",
-			"namespace", namespace,
-			"count", len(orphanedVS),
+	if cleaned > 0 {
+		log.FromContext(ctx).Info("Cleaned up orphaned VirtualService routes",
+			"count", cleaned,
 		)
 	}
 
 	return nil
 }
 
-// cleanupOrphanedVirtualServices удаляет VirtualService, которые ссылаются на несуществующие поды или сервисы
-func (r *HTTP01SolverPodReconciler) cleanupOrphanedVirtualServices(ctx context.Context) error {
+// pruneSolverVirtualServices удаляет неактуальные маршруты из VirtualService оператора, выбранных opts
+// Возвращает количество удаленных маршрутов
+func (r *HTTP01SolverPodReconciler) pruneSolverVirtualServices(ctx context.Context, opts ...client.ListOption) (int, error) {
 	logger := log.FromContext(ctx)
 
-	// Поиск всех VirtualService, созданных оператором
+	// Поиск всех VirtualService для HTTP01 solver, созданных оператором
 	virtualServiceList := &istionetworkingv1beta1.VirtualServiceList{}
-	if err := r.List(ctx, virtualServiceList, client.MatchingLabels{
+	opts = append(opts, client.MatchingLabels{
 		"app.kubernetes.io/managed-by":       "istio-http01",
 		"acme.cert-manager.io/http01-solver": http01SolverLabelValue,
-	}); err != nil {
-		return fmt.Errorf("failed to list VirtualServices: %w", err)
+	})
+	if err := r.List(ctx, virtualServiceList, opts...); err != nil {
+		return 0, fmt.Errorf("failed to list VirtualServices: %w", err)
 	}
 
-	var orphanedVS []*istionetworkingv1beta1.VirtualService
-
+	cleaned := 0
 	for i := range virtualServiceList.Items {
 		vsItem := virtualServiceList.Items[i] // vsItem это *VirtualService
-		if vsItem.Labels == nil {
-			continue
-		}
 
-		podName := vsItem.Labels["acme.cert-manager.io/solver-pod"]
-		serviceName := vsItem.Labels["acme.cert-manager.io/solver-service"]
-		if podName == "" || serviceName == "" {
+		removed := removeSolverRoutes(vsItem, func(route *istioapinetworkingv1beta1.HTTPRoute) bool {
+			return !r.isSolverRouteValid(ctx, vsItem, route)
+		})
+		if removed == 0 {
 			continue
 		}
 
-		// Определяем namespace пода из destination в VirtualService
-		podNamespace := ""
-		if len(vsItem.Spec.Http) > 0 && len(vsItem.Spec.Http[0].Route) > 0 {
-			destination := vsItem.Spec.Http[0].Route[0].Destination
-			if destination != nil && destination.Host != "" {
-				// Парсим host вида "service-name.namespace.svc.cluster.local"
-				parts := strings.Split(destination.Host, ".")
-				if len(parts) >= 2 {
-					podNamespace = parts[1]
-				}
-			}
-		}
-
-		// Если не удалось определить namespace из destination, используем istio-system по умолчанию
-		if podNamespace == "" {
-			podNamespace = defaultCertManagerNamespace // По умолчанию для cert-manager
-		}
-
-		// Проверяем существование пода
-		pod := &corev1.Pod{}
-		podKey := client.ObjectKey{
-			Name:      podName,
-			Namespace: podNamespace,
-		}
-		podExists := r.Get(ctx, podKey, pod) == nil
-
-		// Проверяем существование сервиса
-		service := &corev1.Service{}
-		serviceKey := client.ObjectKey{
-			Name:      serviceName,
-			Namespace: podNamespace,
-		}
-		serviceExists := r.Get(ctx, serviceKey, service) == nil
-
-		// Если под и сервис не существуют, VirtualService считается orphaned
-		if !podExists && !serviceExists {
-			orphanedVS = append(orphanedVS, vsItem)
-			logger.Info("Found orphaned VirtualService",
+		logger.Info("Found orphaned routes in VirtualService",
+			"virtualService", vsItem.Name,
+			"virtualServiceNamespace", vsItem.Namespace,
+			"orphanedRoutes", removed,
+			"remainingRoutes", len(vsItem.Spec.Http),
+		)
+		if _, err := r.saveSolverVirtualService(ctx, vsItem); err != nil {
+			logger.Error(err, "failed to remove orphaned routes from VirtualService",
 				"virtualService", vsItem.Name,
 				"virtualServiceNamespace", vsItem.Namespace,
-				"pod", podName,
-				"podNamespace", podNamespace,
-				"service", serviceName,
 			)
+			continue
 		}
+		cleaned += removed
 	}
 
-	// Удаляем orphaned VirtualService
-	for _, vs := range orphanedVS {
-		if err := r.Delete(ctx, vs); err != nil {
-			logger.Error(err, "failed to delete orphaned VirtualService",
-				"virtualService", vs.Name,
-				"virtualServiceNamespace", vs.Namespace,
-			)
-			continue
-		}
+	return cleaned, nil
+}
 
-		logger.Info("Deleted orphaned VirtualService",
-			"virtualService", vs.Name,
-			"virtualServiceNamespace", vs.Namespace,
-		)
+// saveSolverVirtualService сохраняет VirtualService после удаления маршрутов
+// VirtualService без маршрутов удаляется; возвращает true, если VirtualService удален
+func (r *HTTP01SolverPodReconciler) saveSolverVirtualService(ctx context.Context, vs *istionetworkingv1beta1.VirtualService) (bool, error) {
+	if len(vs.Spec.Http) > 0 {
+		if err := r.Update(ctx, vs); err != nil {
+			return false, fmt.Errorf("failed to update VirtualService: %w", err)
+		}
+		return false, nil
 	}
 
-	if len(orphanedVS) > 0 {
-		logger.Info("Cleaned up orphaned VirtualServices",
-			"count", len(orphanedVS),
-		)
+	if err := r.Delete(ctx, vs); client.IgnoreNotFound(err) != nil {
+		return false, fmt.Errorf("failed to delete VirtualService: %w", err)
 	}
-
-	return nil
+	recordSolverVirtualServiceDeleted(vs)
+	log.FromContext(ctx).Info("Deleted VirtualService without remaining challenge routes",
+		"virtualService", vs.Name,
+		"virtualServiceNamespace", vs.Namespace,
+	)
+	return true, nil
 }
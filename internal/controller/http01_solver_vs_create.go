@@ -1,8 +1,11 @@
 /*
  * Функции, определенные в этом файле:
  *
- * - (r *HTTP01SolverPodReconciler) createVirtualServiceForSolver(ctx, pod, gateway, domain) error
- *   Создает VirtualService для доступа к поду HTTP01 solver через Gateway
+ * - (r *HTTP01SolverPodReconciler) createVirtualServiceForSolver(ctx, pod, service, match, domain, token) error
+ *   Создает VirtualService хоста с маршрутом токена на под HTTP01 solver через выбранный Gateway
+ *
+ * - (r *HTTP01SolverPodReconciler) solverGatewayRefs(ctx, gateways, namespace) ([]string, error)
+ *   Формирует spec.gateways VirtualService солвера (с overlay Gateway в режиме Overlay)
  */
 
 package controller
@@ -10,23 +13,26 @@ package controller
 import (
 	"context"
 	"fmt"
-	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
 	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
 )
 
-// createVirtualServiceForSolver создает VirtualService для доступа к поду HTTP01 solver через Gateway
-func (r *HTTP01SolverPodReconciler) createVirtualServiceForSolver(ctx context.Context, pod *corev1.Pod, gateway *istionetworkingv1beta1.Gateway, domain string) error {
+// createVirtualServiceForSolver создает VirtualService хоста для доступа к поду HTTP01 solver через Gateway
+// VirtualService общий для всех challenge хоста: маршруты следующих токенов добавляет updateVirtualServiceForSolver.
+// Способ выбора Gateway записывается в аннотацию gatewayMatchAnnotation
+func (r *HTTP01SolverPodReconciler) createVirtualServiceForSolver(ctx context.Context, pod *corev1.Pod, service *corev1.Service, match *gatewayMatch, domain, token string) error {
 	logger := log.FromContext(ctx)
+	gateway := match.Gateway
 
-	// Поиск Service для этого пода
-	service, err := r.findServiceForPod(ctx, pod)
+	// Service солвера Challenge или найденный по поду
+	service, err := r.solverServiceForPod(ctx, pod, service)
 	if err != nil {
 		logger.Error(err, "Service not found for solver pod",
 			"pod", pod.Name,
@@ -35,87 +41,78 @@ func (r *HTTP01SolverPodReconciler) createVirtualServiceForSolver(ctx context.Co
 		return err
 	}
 
-	// Определение порта из Service
-	solverPort := uint32(8089) // Порт по умолчанию
-	if len(service.Spec.Ports) > 0 {
-		solverPort = uint32(service.Spec.Ports[0].Port)
-	}
-
-	// Service найден, продолжаем создание VirtualService
-
-	// Имя VirtualService на основе домена и пода
-	vsName := fmt.Sprintf("http01-solver-%s", strings.ReplaceAll(strings.ReplaceAll(domain, ".", "-"), "*", "wildcard"))
-	if len(vsName) > 63 {
-		// Kubernetes имена ограничены 63 символами
-		vsName = vsName[:63]
-	}
-
-	// Gateway reference
-	gatewayRef := gateway.Name
-	if gateway.Namespace != pod.Namespace {
-		gatewayRef = fmt.Sprintf("%s/%s", gateway.Namespace, gateway.Name)
+	// VirtualService привязывается к выбранному Gateway и равнозначным Gateway с HTTP сервером домена
+	gatewayRefs, err := r.solverGatewayRefs(ctx, match.solverGateways(), gateway.Namespace)
+	if err != nil {
+		return err
 	}
 
 	// Создание VirtualService
+	// Owner reference на под не устанавливается: VirtualService содержит маршруты нескольких подов.
+	// Вместо этого ставится ссылка на Service солвера (если он в namespace Gateway), которую
+	// дополняют Service следующих маршрутов - GC удаляет VirtualService вместе с последним из них
+	route := buildSolverRoute(pod, service, token)
 	virtualService := &istionetworkingv1beta1.VirtualService{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      vsName,
+			Name:      solverVirtualServiceName(domain),
 			Namespace: gateway.Namespace,
 			Labels: map[string]string{
-				"app.kubernetes.io/managed-by":        "istio-http01",
-				"acme.cert-manager.io/http01-solver":  http01SolverLabelValue,
-				"acme.cert-manager.io/solver-pod":     pod.Name,
-				"acme.cert-manager.io/solver-service": service.Name,
+				"app.kubernetes.io/managed-by":       "istio-http01",
+				"acme.cert-manager.io/http01-solver": http01SolverLabelValue,
+			},
+			Annotations: map[string]string{
+				gatewayMatchAnnotation: match.String(),
 			},
 		},
 		Spec: istioapinetworkingv1beta1.VirtualService{
 			Hosts:    []string{domain},
-			Gateways: []string{gatewayRef},
-			Http: []*istioapinetworkingv1beta1.HTTPRoute{
-				{
-					Match: []*istioapinetworkingv1beta1.HTTPMatchRequest{
-						{
-							Uri: &istioapinetworkingv1beta1.StringMatch{
-								MatchType: &istioapinetworkingv1beta1.StringMatch_Prefix{
-									Prefix: "/.well-known/acme-challenge/",
-								},
-							},
-						},
-					},
-					Route: []*istioapinetworkingv1beta1.HTTPRouteDestination{
-						{
-							Destination: &istioapinetworkingv1beta1.Destination{
-								Host: fmt.Sprintf("%s.%s.svc.cluster.local", service.Name, service.Namespace),
-								Port: &istioapinetworkingv1beta1.PortSelector{
-									Number: solverPort,
-								},
-							},
-						},
-					},
-				},
-			},
+			Gateways: gatewayRefs,
+			Http:     []*istioapinetworkingv1beta1.HTTPRoute{route},
 		},
 	}
-
-	// Установка owner reference только если под и VirtualService в одном namespace
-	// Kubernetes не позволяет cross-namespace owner references
-	if pod.Namespace == gateway.Namespace {
-		if err := ctrl.SetControllerReference(pod, virtualService, r.Scheme); err != nil {
-			return fmt.Errorf("failed to set controller reference: %w", err)
-		}
+	recordSolverPodNamespace(virtualService, pod)
+	if _, err := setSharedOwnerReference(service, virtualService, r.Scheme, true); err != nil {
+		return fmt.Errorf("failed to set owner reference on VirtualService: %w", err)
 	}
 
 	// Создание VirtualService
 	if err := r.Create(ctx, virtualService); err != nil {
 		return fmt.Errorf("failed to create VirtualService: %w", err)
 	}
+	solverVirtualServicesCreated.WithLabelValues(gateway.Name, gateway.Namespace).Inc()
+	recordEvent(r.Recorder, pod, corev1.EventTypeNormal, eventReasonSolverRouteCreated,
+		"Created VirtualService %s/%s on Gateway %s/%s for %s (matched by %s)", virtualService.Namespace, virtualService.Name, gateway.Namespace, gateway.Name, domain, match)
 
+	path, _ := solverRoutePath(route)
 	logger.Info("Created VirtualService for HTTP01 solver",
 		"virtualService", virtualService.Name,
-		"path", "/.well-known/acme-challenge/",
+		"path", path,
 		"solverService", service.Name,
-		"solverPort", solverPort,
+		"solverPort", route.Route[0].Destination.Port.GetNumber(),
 	)
 
+	r.warnSolverServiceVisibility(ctx, pod, match.solverGateways(), service)
 	return nil
 }
+
+// solverGatewayRefs формирует spec.gateways VirtualService солвера, создаваемого в namespace
+// В режиме Overlay Http01Policy Gateway пользователя перенаправляет HTTP на HTTPS,
+// и challenge обслуживает HTTP сервер overlay Gateway. Если Http01Policy не удалось прочитать, возвращается ошибка
+func (r *HTTP01SolverPodReconciler) solverGatewayRefs(ctx context.Context, gateways []*istionetworkingv1beta1.Gateway, namespace string) ([]string, error) {
+	refs := make([]string, 0, len(gateways))
+	for _, gateway := range gateways {
+		gatewayRef := gateway.Name
+		if gateway.Namespace != namespace {
+			gatewayRef = fmt.Sprintf("%s/%s", gateway.Namespace, gateway.Name)
+		}
+		refs = append(refs, gatewayRef)
+		policy, err := resolveHTTP01Policy(ctx, r.Client, gateway)
+		if err != nil {
+			return nil, err
+		}
+		if policy.GatewayMode == http01v1alpha1.GatewayModeOverlay {
+			refs = append(refs, overlayGatewayName(gatewayRef))
+		}
+	}
+	return refs, nil
+}
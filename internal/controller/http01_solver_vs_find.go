@@ -5,7 +5,7 @@
  *   Проверяет наличие VirtualService для Gateway и домена
  *
  * - (r *HTTP01SolverPodReconciler) findVirtualServicesForPod(ctx, podName, podNamespace) ([]*VirtualService, error)
- *   Находит все VirtualService, связанные с указанным подом
+ *   Находит все VirtualService, содержащие маршрут указанного пода
  */
 
 package controller
@@ -93,15 +93,15 @@ func (r *HTTP01SolverPodReconciler) findVirtualServiceForDomain(ctx context.Cont
 	return nil, nil
 }
 
-// findVirtualServicesForPod находит все VirtualService, связанные с указанным подом
+// findVirtualServicesForPod находит все VirtualService, содержащие маршрут указанного пода
 func (r *HTTP01SolverPodReconciler) findVirtualServicesForPod(ctx context.Context, podName, podNamespace string) ([]*istionetworkingv1beta1.VirtualService, error) {
 	logger := log.FromContext(ctx)
 
-	// Поиск всех VirtualService во всех namespace с меткой solver-pod
+	// Поиск всех VirtualService для HTTP01 solver, созданных оператором, во всех namespace
 	virtualServiceList := &istionetworkingv1beta1.VirtualServiceList{}
 	if err := r.List(ctx, virtualServiceList, client.MatchingLabels{
-		"acme.cert-manager.io/solver-pod": podName,
-		"app.kubernetes.io/managed-by":    "istio-http01",
+		"app.kubernetes.io/managed-by":       "istio-http01",
+		"acme.cert-manager.io/http01-solver": http01SolverLabelValue,
 	}); err != nil {
 		return nil, fmt.Errorf("failed to list VirtualServices: %w", err)
 	}
@@ -109,11 +109,12 @@ func (r *HTTP01SolverPodReconciler) findVirtualServicesForPod(ctx context.Contex
 	var matchingVS []*istionetworkingv1beta1.VirtualService
 	for i := range virtualServiceList.Items {
 		vsItem := virtualServiceList.Items[i] // vsItem это *VirtualService
-		// Проверяем, что это VirtualService для HTTP01 solver
-		if vsItem.Labels != nil && vsItem.Labels["acme.cert-manager.io/http01-solver"] == http01SolverLabelValue {
-			// Проверяем, что метка solver-pod совпадает
-			if vsItem.Labels["acme.cert-manager.io/solver-pod"] == podName {
+		// Маршруты называются по имени пода (в VirtualService прежних версий под указан в метке solver-pod),
+		// namespace пода сравнивается, так как поды солвера разных Certificate живут в разных namespace
+		for _, route := range vsItem.Spec.Http {
+			if solverRoutePodName(vsItem, route) == podName && solverRoutePodNamespace(vsItem, route) == podNamespace {
 				matchingVS = append(matchingVS, vsItem)
+				break
 			}
 		}
 	}
@@ -0,0 +1,96 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - recordSolverPodNamespace(vs, pod) bool
+ *   Записывает namespace пода маршрута в аннотацию solverPodNamespacesAnnotation VirtualService
+ *
+ * - pruneSolverPodNamespaces(vs)
+ *   Удаляет из аннотации solverPodNamespacesAnnotation поды, маршрутов которых больше нет
+ *
+ * - solverRoutePodNamespace(vs, route) string
+ *   Возвращает namespace пода солвера маршрута: из аннотации, destination или namespace VirtualService
+ *
+ * - solverPodNamespaces(vs) map[string]string / setSolverPodNamespaces(vs, namespaces)
+ *   Читают и записывают аннотацию solverPodNamespacesAnnotation
+ */
+
+package controller
+
+import (
+	"encoding/json"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+// solverPodNamespacesAnnotation аннотация VirtualService хоста с namespace подов солвера
+// в виде JSON {"<имя пода>": "<namespace>"}: cert-manager создает поды в namespace Certificate
+const solverPodNamespacesAnnotation = "istio-http01.rieset.io/solver-pod-namespaces"
+
+// recordSolverPodNamespace записывает namespace пода маршрута в аннотацию solverPodNamespacesAnnotation
+// Записи подов, маршруты которых заменены (upsertSolverRoute), удаляются. Возвращает true, если аннотация изменилась
+func recordSolverPodNamespace(vs *istionetworkingv1beta1.VirtualService, pod *corev1.Pod) bool {
+	before := vs.Annotations[solverPodNamespacesAnnotation]
+	namespaces := solverPodNamespaces(vs)
+	namespaces[pod.Name] = pod.Namespace
+	setSolverPodNamespaces(vs, namespaces)
+	pruneSolverPodNamespaces(vs)
+	return vs.Annotations[solverPodNamespacesAnnotation] != before
+}
+
+// pruneSolverPodNamespaces удаляет из аннотации solverPodNamespacesAnnotation поды, маршрутов которых больше нет
+func pruneSolverPodNamespaces(vs *istionetworkingv1beta1.VirtualService) {
+	if _, ok := vs.Annotations[solverPodNamespacesAnnotation]; !ok {
+		return
+	}
+	namespaces := solverPodNamespaces(vs)
+	for podName := range namespaces {
+		if !slices.ContainsFunc(vs.Spec.Http, func(route *istioapinetworkingv1beta1.HTTPRoute) bool {
+			return solverRoutePodName(vs, route) == podName
+		}) {
+			delete(namespaces, podName)
+		}
+	}
+	setSolverPodNamespaces(vs, namespaces)
+}
+
+// solverRoutePodNamespace возвращает namespace пода солвера, на который указывает маршрут
+// VirtualService прежних версий не содержат аннотации: namespace берется из destination (Service солвера
+// создается в namespace пода), а для destination без namespace - namespace VirtualService
+func solverRoutePodNamespace(vs *istionetworkingv1beta1.VirtualService, route *istioapinetworkingv1beta1.HTTPRoute) string {
+	if namespace := solverPodNamespaces(vs)[solverRoutePodName(vs, route)]; namespace != "" {
+		return namespace
+	}
+	if _, namespace := solverRouteService(route); namespace != "" {
+		return namespace
+	}
+	return vs.Namespace
+}
+
+// solverPodNamespaces читает аннотацию solverPodNamespacesAnnotation; неразбираемая аннотация считается пустой
+func solverPodNamespaces(vs *istionetworkingv1beta1.VirtualService) map[string]string {
+	namespaces := map[string]string{}
+	if value := vs.Annotations[solverPodNamespacesAnnotation]; value != "" {
+		_ = json.Unmarshal([]byte(value), &namespaces)
+	}
+	return namespaces
+}
+
+// setSolverPodNamespaces записывает аннотацию solverPodNamespacesAnnotation (json.Marshal сортирует ключи)
+func setSolverPodNamespaces(vs *istionetworkingv1beta1.VirtualService, namespaces map[string]string) {
+	if len(namespaces) == 0 {
+		delete(vs.Annotations, solverPodNamespacesAnnotation)
+		return
+	}
+	value, err := json.Marshal(namespaces)
+	if err != nil {
+		return
+	}
+	if vs.Annotations == nil {
+		vs.Annotations = map[string]string{}
+	}
+	vs.Annotations[solverPodNamespacesAnnotation] = string(value)
+}
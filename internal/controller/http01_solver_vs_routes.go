@@ -0,0 +1,203 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - buildSolverRoute(pod, service, token) *HTTPRoute
+ *   Формирует HTTP маршрут challenge с точным совпадением пути /.well-known/acme-challenge/<token>
+ *
+ * - solverRoutePodName(vs, route) string
+ *   Возвращает имя пода солвера, на который указывает маршрут VirtualService
+ *
+ * - solverRouteService(route) (string, string)
+ *   Возвращает имя и namespace Service солвера из destination маршрута
+ *
+ * - solverRoutePath(route) (string, bool)
+ *   Возвращает путь маршрута и признак точного совпадения
+ *
+ * - upsertSolverRoute(vs, route) bool
+ *   Добавляет или заменяет маршрут пода в VirtualService хоста
+ *
+ * - removeSolverRoutes(vs, remove) int
+ *   Удаляет из VirtualService маршруты, для которых remove возвращает true (маршруты редиректа сохраняются)
+ *
+ * - solverRouteRank(route) int
+ *   Возвращает порядок маршрута в VirtualService: точный путь, префикс, редирект на HTTPS
+ *
+ * - pruneSolverServiceOwners(vs)
+ *   Снимает owner reference на Service солверов, на которые не указывает ни один маршрут
+ *
+ * Namespace подов солвера маршрутов (аннотация solverPodNamespacesAnnotation) - в http01_solver_vs_pod_namespaces.go
+ */
+
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+// acmeChallengePathPrefix префикс пути HTTP01 challenge
+const acmeChallengePathPrefix = "/.well-known/acme-challenge/"
+
+// buildSolverRoute формирует HTTP маршрут challenge на Service солвера
+// Маршрут называется по имени пода солвера и совпадает только с путем своего токена;
+// без токена (под без аргумента --token) маршрут охватывает весь префикс challenge
+func buildSolverRoute(pod *corev1.Pod, service *corev1.Service, token string) *istioapinetworkingv1beta1.HTTPRoute {
+	// Определение порта из Service
+	solverPort := uint32(8089) // Порт по умолчанию
+	if len(service.Spec.Ports) > 0 {
+		solverPort = uint32(service.Spec.Ports[0].Port)
+	}
+
+	uri := &istioapinetworkingv1beta1.StringMatch{
+		MatchType: &istioapinetworkingv1beta1.StringMatch_Prefix{Prefix: acmeChallengePathPrefix},
+	}
+	if token != "" {
+		uri.MatchType = &istioapinetworkingv1beta1.StringMatch_Exact{Exact: acmeChallengePathPrefix + token}
+	}
+
+	return &istioapinetworkingv1beta1.HTTPRoute{
+		Name:  pod.Name,
+		Match: []*istioapinetworkingv1beta1.HTTPMatchRequest{{Uri: uri}},
+		Route: []*istioapinetworkingv1beta1.HTTPRouteDestination{
+			{
+				Destination: &istioapinetworkingv1beta1.Destination{
+					Host: fmt.Sprintf("%s.%s.svc.cluster.local", service.Name, service.Namespace),
+					Port: &istioapinetworkingv1beta1.PortSelector{
+						Number: solverPort,
+					},
+				},
+			},
+		},
+	}
+}
+
+// solverRoutePodName возвращает имя пода солвера, на который указывает маршрут
+// VirtualService прежних версий содержат один безымянный маршрут, а под указан в метке solver-pod
+func solverRoutePodName(vs *istionetworkingv1beta1.VirtualService, route *istioapinetworkingv1beta1.HTTPRoute) string {
+	if route.Name != "" {
+		return route.Name
+	}
+	return vs.Labels["acme.cert-manager.io/solver-pod"]
+}
+
+// solverRouteService возвращает имя и namespace Service солвера из destination маршрута
+// Host имеет вид "service-name.namespace.svc.cluster.local"
+func solverRouteService(route *istioapinetworkingv1beta1.HTTPRoute) (string, string) {
+	if len(route.Route) == 0 || route.Route[0].Destination == nil {
+		return "", ""
+	}
+	parts := strings.Split(route.Route[0].Destination.Host, ".")
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// solverRoutePath возвращает путь маршрута (точный путь токена или префикс) и признак точного совпадения
+func solverRoutePath(route *istioapinetworkingv1beta1.HTTPRoute) (string, bool) {
+	if len(route.Match) == 0 || route.Match[0].Uri == nil {
+		return "", false
+	}
+	if exact := route.Match[0].Uri.GetExact(); exact != "" {
+		return exact, true
+	}
+	return route.Match[0].Uri.GetPrefix(), false
+}
+
+// upsertSolverRoute добавляет или заменяет маршрут пода в VirtualService хоста
+// Заменяются маршрут с тем же именем пода и маршрут того же токена (предыдущий под challenge).
+// Маршруты с точным путем размещаются перед префиксными, иначе префикс перехватит запросы других токенов;
+// маршрут редиректа на HTTPS (режим ChallengePath) всегда последний.
+// Возвращает true, если VirtualService изменился
+func upsertSolverRoute(vs *istionetworkingv1beta1.VirtualService, route *istioapinetworkingv1beta1.HTTPRoute) bool {
+	path, exact := solverRoutePath(route)
+	host := route.Route[0].Destination.Host
+	port := route.Route[0].Destination.Port.GetNumber()
+
+	for _, existing := range vs.Spec.Http {
+		existingPath, existingExact := solverRoutePath(existing)
+		if existing.Name == route.Name && existingPath == path && existingExact == exact &&
+			len(existing.Route) > 0 && existing.Route[0].Destination.GetHost() == host &&
+			existing.Route[0].Destination.GetPort().GetNumber() == port {
+			return false
+		}
+	}
+
+	routes := make([]*istioapinetworkingv1beta1.HTTPRoute, 0, len(vs.Spec.Http)+1)
+	for _, existing := range vs.Spec.Http {
+		existingPath, existingExact := solverRoutePath(existing)
+		if solverRoutePodName(vs, existing) == route.Name || (exact && existingExact && existingPath == path) {
+			continue
+		}
+		// Безымянный маршрут прежней версии получает имя пода из метки
+		if existing.Name == "" {
+			existing.Name = solverRoutePodName(vs, existing)
+		}
+		routes = append(routes, existing)
+	}
+	routes = append(routes, route)
+	slices.SortStableFunc(routes, func(a, b *istioapinetworkingv1beta1.HTTPRoute) int {
+		return solverRouteRank(a) - solverRouteRank(b)
+	})
+	vs.Spec.Http = routes
+
+	// Маршруты именованы по подам - метки одного пода больше не описывают VirtualService
+	delete(vs.Labels, "acme.cert-manager.io/solver-pod")
+	delete(vs.Labels, "acme.cert-manager.io/solver-service")
+	return true
+}
+
+// removeSolverRoutes удаляет из VirtualService маршруты, для которых remove возвращает true
+// Маршруты редиректа на HTTPS не удаляются: их снимает Certificate при восстановлении httpsRedirect
+// Возвращает количество удаленных маршрутов
+func removeSolverRoutes(vs *istionetworkingv1beta1.VirtualService, remove func(route *istioapinetworkingv1beta1.HTTPRoute) bool) int {
+	routes := make([]*istioapinetworkingv1beta1.HTTPRoute, 0, len(vs.Spec.Http))
+	for _, route := range vs.Spec.Http {
+		if !isHTTPSRedirectRoute(route) && remove(route) {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	removed := len(vs.Spec.Http) - len(routes)
+	vs.Spec.Http = routes
+	if removed > 0 {
+		pruneSolverServiceOwners(vs)
+		pruneSolverPodNamespaces(vs)
+	}
+	return removed
+}
+
+// solverRouteRank возвращает порядок маршрута в VirtualService хоста
+// Точный путь токена - 0, префикс challenge - 1, редирект на HTTPS - 2
+func solverRouteRank(route *istioapinetworkingv1beta1.HTTPRoute) int {
+	if isHTTPSRedirectRoute(route) {
+		return 2
+	}
+	if _, exact := solverRoutePath(route); exact {
+		return 0
+	}
+	return 1
+}
+
+// pruneSolverServiceOwners снимает owner reference на Service солверов, маршрутов которых больше нет
+// Owner reference на Service ставятся только в namespace VirtualService (см. setSharedOwnerReference)
+func pruneSolverServiceOwners(vs *istionetworkingv1beta1.VirtualService) {
+	if len(vs.OwnerReferences) == 0 {
+		return
+	}
+	services := make(map[string]bool, len(vs.Spec.Http))
+	for _, route := range vs.Spec.Http {
+		name, _ := solverRouteService(route)
+		services[name] = true
+	}
+	vs.OwnerReferences = slices.DeleteFunc(vs.OwnerReferences, func(ref metav1.OwnerReference) bool {
+		return ref.Kind == "Service" && !services[ref.Name]
+	})
+}
@@ -0,0 +1,168 @@
+/*
+ * Тесты маршрутов challenge в VirtualService хоста (http01_solver_vs_routes.go):
+ *
+ * - buildSolverRoute: точный путь токена и префикс без токена
+ * - upsertSolverRoute: добавление, замена по поду и по токену, порядок маршрутов, миграция VirtualService прежних версий
+ * - removeSolverRoutes: удаление маршрутов пода, маршрут редиректа на HTTPS сохраняется
+ * - recordSolverPodNamespace: namespace подов в аннотации, очистка записей удаленных маршрутов
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testSolverRoute формирует маршрут пода солвера с Service того же имени
+func testSolverRoute(podName, token string) *istioapinetworkingv1beta1.HTTPRoute {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: podName, Namespace: "app"}}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: podName, Namespace: "app"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 8089}}},
+	}
+	return buildSolverRoute(pod, service, token)
+}
+
+// routeNames возвращает имена маршрутов VirtualService по порядку
+func routeNames(vs *istionetworkingv1beta1.VirtualService) []string {
+	names := make([]string, 0, len(vs.Spec.Http))
+	for _, route := range vs.Spec.Http {
+		names = append(names, route.Name)
+	}
+	return names
+}
+
+var _ = Describe("Solver VirtualService routes", func() {
+	Describe("buildSolverRoute", func() {
+		It("matches the exact token path and routes to the solver Service", func() {
+			route := testSolverRoute("cm-acme-http-solver-a", "token-a")
+
+			Expect(route.Name).To(Equal("cm-acme-http-solver-a"))
+			path, exact := solverRoutePath(route)
+			Expect(exact).To(BeTrue())
+			Expect(path).To(Equal("/.well-known/acme-challenge/token-a"))
+			Expect(route.Route[0].Destination.Host).To(Equal("cm-acme-http-solver-a.app.svc.cluster.local"))
+			Expect(route.Route[0].Destination.Port.Number).To(Equal(uint32(8089)))
+
+			name, namespace := solverRouteService(route)
+			Expect(name).To(Equal("cm-acme-http-solver-a"))
+			Expect(namespace).To(Equal("app"))
+		})
+
+		It("falls back to the challenge prefix without a token", func() {
+			path, exact := solverRoutePath(testSolverRoute("cm-acme-http-solver-a", ""))
+			Expect(exact).To(BeFalse())
+			Expect(path).To(Equal(acmeChallengePathPrefix))
+		})
+	})
+
+	Describe("upsertSolverRoute", func() {
+		var vs *istionetworkingv1beta1.VirtualService
+
+		BeforeEach(func() {
+			vs = &istionetworkingv1beta1.VirtualService{}
+			Expect(upsertSolverRoute(vs, testSolverRoute("cm-acme-http-solver-a", "token-a"))).To(BeTrue())
+		})
+
+		It("keeps routes of other challenges for the same host", func() {
+			Expect(upsertSolverRoute(vs, testSolverRoute("cm-acme-http-solver-b", "token-b"))).To(BeTrue())
+			Expect(routeNames(vs)).To(Equal([]string{"cm-acme-http-solver-a", "cm-acme-http-solver-b"}))
+		})
+
+		It("reports no change for an identical route", func() {
+			Expect(upsertSolverRoute(vs, testSolverRoute("cm-acme-http-solver-a", "token-a"))).To(BeFalse())
+			Expect(vs.Spec.Http).To(HaveLen(1))
+		})
+
+		It("replaces the route of a previous pod serving the same token", func() {
+			Expect(upsertSolverRoute(vs, testSolverRoute("cm-acme-http-solver-c", "token-a"))).To(BeTrue())
+			Expect(routeNames(vs)).To(Equal([]string{"cm-acme-http-solver-c"}))
+		})
+
+		It("keeps the HTTPS redirect route after challenge routes", func() {
+			vs.Spec.Http = append([]*istioapinetworkingv1beta1.HTTPRoute{buildHTTPSRedirectRoute("app-tls")}, vs.Spec.Http...)
+			Expect(upsertSolverRoute(vs, testSolverRoute("cm-acme-http-solver-p", ""))).To(BeTrue())
+			Expect(routeNames(vs)).To(Equal([]string{"cm-acme-http-solver-a", "cm-acme-http-solver-p", httpsRedirectRouteName("app-tls")}))
+		})
+
+		It("places exact token routes before prefix routes", func() {
+			Expect(upsertSolverRoute(vs, testSolverRoute("cm-acme-http-solver-p", ""))).To(BeTrue())
+			Expect(upsertSolverRoute(vs, testSolverRoute("cm-acme-http-solver-b", "token-b"))).To(BeTrue())
+			Expect(routeNames(vs)).To(Equal([]string{"cm-acme-http-solver-a", "cm-acme-http-solver-b", "cm-acme-http-solver-p"}))
+		})
+	})
+
+	It("migrates a VirtualService of previous versions to named routes", func() {
+		legacy := testSolverRoute("cm-acme-http-solver-old", "")
+		legacy.Name = ""
+		vs := &istionetworkingv1beta1.VirtualService{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+				"acme.cert-manager.io/solver-pod":     "cm-acme-http-solver-old",
+				"acme.cert-manager.io/solver-service": "cm-acme-http-solver-old",
+			}},
+			Spec: istioapinetworkingv1beta1.VirtualService{Http: []*istioapinetworkingv1beta1.HTTPRoute{legacy}},
+		}
+		Expect(solverRoutePodName(vs, legacy)).To(Equal("cm-acme-http-solver-old"))
+
+		Expect(upsertSolverRoute(vs, testSolverRoute("cm-acme-http-solver-new", "token-new"))).To(BeTrue())
+		Expect(routeNames(vs)).To(Equal([]string{"cm-acme-http-solver-new", "cm-acme-http-solver-old"}))
+		Expect(vs.Labels).NotTo(HaveKey("acme.cert-manager.io/solver-pod"))
+		Expect(vs.Labels).NotTo(HaveKey("acme.cert-manager.io/solver-service"))
+	})
+
+	It("removes only the routes selected for removal", func() {
+		vs := &istionetworkingv1beta1.VirtualService{}
+		upsertSolverRoute(vs, testSolverRoute("cm-acme-http-solver-a", "token-a"))
+		upsertSolverRoute(vs, testSolverRoute("cm-acme-http-solver-b", "token-b"))
+
+		removed := removeSolverRoutes(vs, func(route *istioapinetworkingv1beta1.HTTPRoute) bool {
+			return solverRoutePodName(vs, route) == "cm-acme-http-solver-a"
+		})
+		Expect(removed).To(Equal(1))
+		Expect(routeNames(vs)).To(Equal([]string{"cm-acme-http-solver-b"}))
+	})
+
+	It("keeps the HTTPS redirect route when pruning challenge routes", func() {
+		vs := &istionetworkingv1beta1.VirtualService{}
+		upsertSolverRoute(vs, testSolverRoute("cm-acme-http-solver-a", "token-a"))
+		vs.Spec.Http = append(vs.Spec.Http, buildHTTPSRedirectRoute("app-tls"))
+
+		removed := removeSolverRoutes(vs, func(*istioapinetworkingv1beta1.HTTPRoute) bool { return true })
+		Expect(removed).To(Equal(1))
+		Expect(routeNames(vs)).To(Equal([]string{httpsRedirectRouteName("app-tls")}))
+		Expect(vs.Spec.Http[0].Match[0].Scheme.GetExact()).To(Equal("http"))
+		Expect(vs.Spec.Http[0].Redirect.Scheme).To(Equal("https"))
+	})
+
+	It("records solver pod namespaces on the VirtualService", func() {
+		vs := &istionetworkingv1beta1.VirtualService{ObjectMeta: metav1.ObjectMeta{Namespace: "istio-system"}}
+		podA := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cm-acme-http-solver-a", Namespace: "app"}}
+		podB := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cm-acme-http-solver-b", Namespace: "shop"}}
+		upsertSolverRoute(vs, testSolverRoute(podA.Name, "token-a"))
+		Expect(recordSolverPodNamespace(vs, podA)).To(BeTrue())
+		upsertSolverRoute(vs, testSolverRoute(podB.Name, "token-b"))
+		Expect(recordSolverPodNamespace(vs, podB)).To(BeTrue())
+		Expect(recordSolverPodNamespace(vs, podB)).To(BeFalse())
+		Expect(vs.Annotations[solverPodNamespacesAnnotation]).
+			To(Equal(`{"cm-acme-http-solver-a":"app","cm-acme-http-solver-b":"shop"}`))
+
+		By("preferring the annotation over the destination namespace")
+		Expect(solverRoutePodNamespace(vs, vs.Spec.Http[1])).To(Equal("shop"))
+
+		By("dropping namespaces of removed routes")
+		removeSolverRoutes(vs, func(route *istioapinetworkingv1beta1.HTTPRoute) bool {
+			return route.Name == podB.Name
+		})
+		Expect(vs.Annotations[solverPodNamespacesAnnotation]).To(Equal(`{"cm-acme-http-solver-a":"app"}`))
+
+		By("falling back to the destination namespace without the annotation")
+		delete(vs.Annotations, solverPodNamespacesAnnotation)
+		Expect(solverRoutePodNamespace(vs, vs.Spec.Http[0])).To(Equal("app"))
+	})
+})
@@ -1,8 +1,8 @@
 /*
  * Функции, определенные в этом файле:
  *
- * - (r *HTTP01SolverPodReconciler) updateVirtualServiceForSolver(ctx, pod, existingVS) error
- *   Обновляет существующий VirtualService для нового пода HTTP01 solver
+ * - (r *HTTP01SolverPodReconciler) updateVirtualServiceForSolver(ctx, pod, service, existingVS, gateways, token) (bool, error)
+ *   Добавляет или обновляет маршрут токена пода HTTP01 solver в VirtualService хоста и привязывает его к Gateway домена
  */
 
 package controller
@@ -10,80 +10,76 @@ package controller
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
-	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
 	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
 )
 
-// updateVirtualServiceForSolver обновляет существующий VirtualService для нового пода HTTP01 solver
-func (r *HTTP01SolverPodReconciler) updateVirtualServiceForSolver(ctx context.Context, pod *corev1.Pod, existingVS *istionetworkingv1beta1.VirtualService) error {
+// updateVirtualServiceForSolver добавляет или обновляет маршрут токена пода в VirtualService хоста
+// Маршруты других challenge этого хоста (несколько Certificate, перекрытие продления) сохраняются.
+// Недостающие Gateway домена добавляются в spec.gateways; ранее добавленные Gateway не удаляются
+// Возвращает true, если VirtualService был изменен
+func (r *HTTP01SolverPodReconciler) updateVirtualServiceForSolver(ctx context.Context, pod *corev1.Pod, service *corev1.Service, existingVS *istionetworkingv1beta1.VirtualService, gateways []*istionetworkingv1beta1.Gateway, token string) (bool, error) {
 	logger := log.FromContext(ctx)
 
-	// Поиск Service для этого пода
-	service, err := r.findServiceForPod(ctx, pod)
+	// Service солвера Challenge или найденный по поду
+	service, err := r.solverServiceForPod(ctx, pod, service)
 	if err != nil {
 		logger.Error(err, "Service not found for solver pod",
 			"pod", pod.Name,
 			"podNamespace", pod.Namespace,
 		)
-		return err
+		return false, err
 	}
 
-	// Определение порта из Service
-	solverPort := uint32(8089) // Порт по умолчанию
-	if len(service.Spec.Ports) > 0 {
-		solverPort = uint32(service.Spec.Ports[0].Port)
+	route := buildSolverRoute(pod, service, token)
+	changed := upsertSolverRoute(existingVS, route)
+	if recordSolverPodNamespace(existingVS, pod) {
+		changed = true
 	}
-
-	// Обновление меток VirtualService
-	if existingVS.Labels == nil {
-		existingVS.Labels = make(map[string]string)
+	gatewayRefs, err := r.solverGatewayRefs(ctx, gateways, existingVS.Namespace)
+	if err != nil {
+		return false, err
 	}
-	existingVS.Labels["acme.cert-manager.io/solver-pod"] = pod.Name
-	existingVS.Labels["acme.cert-manager.io/solver-service"] = service.Name
-
-	// Обновление owner reference только если под и VirtualService в одном namespace
-	// Kubernetes не позволяет cross-namespace owner references
-	if pod.Namespace == existingVS.Namespace {
-		existingVS.OwnerReferences = []metav1.OwnerReference{
-			{
-				APIVersion: "v1",
-				Kind:       "Pod",
-				Name:       pod.Name,
-				UID:        pod.UID,
-				Controller: func() *bool { b := true; return &b }(),
-			},
+	for _, gatewayRef := range gatewayRefs {
+		// "name" и "<namespace VirtualService>/name" ссылаются на один Gateway
+		namespace, name := splitCredentialName(gatewayRef, existingVS.Namespace)
+		if !slices.ContainsFunc(existingVS.Spec.Gateways, func(existing string) bool {
+			existingNamespace, existingName := splitCredentialName(existing, existingVS.Namespace)
+			return existingNamespace == namespace && existingName == name
+		}) {
+			existingVS.Spec.Gateways = append(existingVS.Spec.Gateways, gatewayRef)
+			changed = true
 		}
-	} else {
-		// Если в разных namespace, удаляем owner reference если он был установлен
-		existingVS.OwnerReferences = nil
+	}
+	if !changed {
+		return false, nil
 	}
 
-	// Обновление destination в HTTP route
-	if len(existingVS.Spec.Http) > 0 && len(existingVS.Spec.Http[0].Route) > 0 {
-		existingVS.Spec.Http[0].Route[0].Destination = &istioapinetworkingv1beta1.Destination{
-			Host: fmt.Sprintf("%s.%s.svc.cluster.local", service.Name, service.Namespace),
-			Port: &istioapinetworkingv1beta1.PortSelector{
-				Number: solverPort,
-			},
-		}
+	// Owner reference на Service солвера: GC удалит VirtualService, когда удалены Service всех маршрутов
+	// Владелец-под не используется - его удаление удалило бы маршруты остальных подов
+	if _, err := setSharedOwnerReference(service, existingVS, r.Scheme, len(existingVS.Spec.Http) == 1); err != nil {
+		return false, fmt.Errorf("failed to set owner reference on VirtualService: %w", err)
 	}
 
 	// Обновление VirtualService
 	if err := r.Update(ctx, existingVS); err != nil {
-		return fmt.Errorf("failed to update VirtualService: %w", err)
+		return false, fmt.Errorf("failed to update VirtualService: %w", err)
 	}
 
+	path, _ := solverRoutePath(route)
 	logger.Info("Updated VirtualService for HTTP01 solver",
 		"virtualService", existingVS.Name,
-		"path", "/.well-known/acme-challenge/",
+		"path", path,
+		"routes", len(existingVS.Spec.Http),
+		"gateways", existingVS.Spec.Gateways,
 		"solverService", service.Name,
-		"solverPort", solverPort,
+		"solverPort", route.Route[0].Destination.Port.GetNumber(),
 	)
 
-	return nil
+	r.warnSolverServiceVisibility(ctx, pod, gateways, service)
+	return true, nil
 }
@@ -0,0 +1,219 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - (r *Http01PolicyReconciler) Reconcile(ctx, req) (ctrl.Result, error)
+ *   Определяет Gateway, выбранные Http01Policy, и обновляет статус политики
+ *
+ * - (r *Http01PolicyReconciler) findGatewaysForPolicy(ctx, policy) ([]client.Object, error)
+ *   Находит Istio и Gateway API Gateway в namespace политики, выбранные ее селектором
+ *
+ * - (r *Http01PolicyReconciler) policiesInNamespace(ctx, obj) []reconcile.Request
+ *   Возвращает запросы на реконсиляцию всех Http01Policy в namespace объекта
+ *
+ * - (r *Http01PolicyReconciler) SetupWithManager(mgr) error
+ *   Настраивает контроллер для работы с менеджером
+ *
+ * - gatewayReference(gateway) string
+ *   Формирует ссылку на Gateway в формате "<group>/<name>" для статуса политики
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+// Http01PolicyReconciler реконсилирует Http01Policy ресурсы
+type Http01PolicyReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// GatewayAPIEnabled включает учет Gateway API (gateway.networking.k8s.io) Gateway
+	GatewayAPIEnabled bool
+}
+
+// +kubebuilder:rbac:groups=http01.istio-http01.rieset.io,resources=http01policies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=http01.istio-http01.rieset.io,resources=http01policies/status,verbs=get;update;patch
+
+// Reconcile определяет Gateway, выбранные Http01Policy, и обновляет статус политики
+func (r *Http01PolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	policy := &http01v1alpha1.Http01Policy{}
+	if err := r.Get(ctx, req.NamespacedName, policy); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	status := policy.Status.DeepCopy()
+	status.ObservedGeneration = policy.Generation
+
+	gateways, err := r.findGatewaysForPolicy(ctx, policy)
+	if err != nil {
+		// Некорректный селектор - ошибка пользователя, повторная реконсиляция не поможет
+		status.MatchedGateways = nil
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               http01v1alpha1.Http01PolicyConditionReady,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: policy.Generation,
+			Reason:             "InvalidSelector",
+			Message:            err.Error(),
+		})
+		meta.RemoveStatusCondition(&status.Conditions, http01v1alpha1.Http01PolicyConditionConflicted)
+	} else {
+		// Для каждого Gateway проверяем, не перекрыт ли он более старой политикой
+		matched := make([]string, 0, len(gateways))
+		var conflicts []string
+		for _, gateway := range gateways {
+			matched = append(matched, gatewayReference(gateway))
+
+			policies, err := listHTTP01PoliciesForGateway(ctx, r.Client, gateway)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if len(policies) > 0 && policies[0].Name != policy.Name {
+				conflicts = append(conflicts, fmt.Sprintf("%s (governed by %s)", gatewayReference(gateway), policies[0].Name))
+			}
+		}
+		sort.Strings(matched)
+		sort.Strings(conflicts)
+		status.MatchedGateways = matched
+
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               http01v1alpha1.Http01PolicyConditionReady,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: policy.Generation,
+			Reason:             "Accepted",
+			Message:            fmt.Sprintf("Policy selects %d Gateway(s)", len(matched)),
+		})
+
+		if len(conflicts) > 0 {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               http01v1alpha1.Http01PolicyConditionConflicted,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: policy.Generation,
+				Reason:             "OlderPolicyTakesPrecedence",
+				Message:            strings.Join(conflicts, ", "),
+			})
+		} else {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               http01v1alpha1.Http01PolicyConditionConflicted,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: policy.Generation,
+				Reason:             "NoConflict",
+				Message:            "No other policy selects the same Gateways",
+			})
+		}
+	}
+
+	// Обновляем статус только при изменениях, чтобы не порождать лишние события
+	if equality.Semantic.DeepEqual(&policy.Status, status) {
+		return ctrl.Result{}, nil
+	}
+
+	policy.Status = *status
+	if err := r.Status().Update(ctx, policy); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update Http01Policy status: %w", err)
+	}
+
+	logger.Info("Http01Policy status updated",
+		"policy", policy.Name,
+		"policyNamespace", policy.Namespace,
+		"matchedGateways", status.MatchedGateways,
+	)
+
+	return ctrl.Result{}, nil
+}
+
+// findGatewaysForPolicy находит Istio и Gateway API Gateway в namespace политики, выбранные ее селектором
+func (r *Http01PolicyReconciler) findGatewaysForPolicy(ctx context.Context, policy *http01v1alpha1.Http01Policy) ([]client.Object, error) {
+	var candidates []client.Object
+
+	gatewayList := &istionetworkingv1beta1.GatewayList{}
+	if err := r.List(ctx, gatewayList, client.InNamespace(policy.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list Gateways: %w", err)
+	}
+	for _, gateway := range gatewayList.Items {
+		if !isOverlayGateway(gateway) {
+			candidates = append(candidates, gateway)
+		}
+	}
+
+	if r.GatewayAPIEnabled {
+		gatewayAPIList := &gatewayapiv1.GatewayList{}
+		if err := r.List(ctx, gatewayAPIList, client.InNamespace(policy.Namespace)); err != nil {
+			return nil, fmt.Errorf("failed to list Gateway API Gateways: %w", err)
+		}
+		for i := range gatewayAPIList.Items {
+			candidates = append(candidates, &gatewayAPIList.Items[i])
+		}
+	}
+
+	var matching []client.Object
+	for _, gateway := range candidates {
+		matches, err := policyMatchesGateway(policy, gateway)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			matching = append(matching, gateway)
+		}
+	}
+
+	return matching, nil
+}
+
+// policiesInNamespace возвращает запросы на реконсиляцию всех Http01Policy в namespace объекта
+// Используется при изменении Gateway или другой политики: набор выбранных Gateway и конфликты могут измениться
+func (r *Http01PolicyReconciler) policiesInNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	policyList := &http01v1alpha1.Http01PolicyList{}
+	if err := r.List(ctx, policyList, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(policyList.Items))
+	for _, policy := range policyList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{Name: policy.Name, Namespace: policy.Namespace},
+		})
+	}
+	return requests
+}
+
+// SetupWithManager настраивает контроллер
+func (r *Http01PolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	builder := ctrl.NewControllerManagedBy(mgr).
+		For(&http01v1alpha1.Http01Policy{}).
+		Watches(&http01v1alpha1.Http01Policy{}, handler.EnqueueRequestsFromMapFunc(r.policiesInNamespace)).
+		Watches(&istionetworkingv1beta1.Gateway{}, handler.EnqueueRequestsFromMapFunc(r.policiesInNamespace))
+
+	if r.GatewayAPIEnabled {
+		builder = builder.Watches(&gatewayapiv1.Gateway{}, handler.EnqueueRequestsFromMapFunc(r.policiesInNamespace))
+	}
+
+	return builder.Complete(r)
+}
+
+// gatewayReference формирует ссылку на Gateway в формате "<group>/<name>" для статуса политики
+func gatewayReference(gateway client.Object) string {
+	group := istionetworkingv1beta1.SchemeGroupVersion.Group
+	if _, ok := gateway.(*gatewayapiv1.Gateway); ok {
+		group = gatewayapiv1.GroupName
+	}
+	return fmt.Sprintf("%s/%s", group, gateway.GetName())
+}
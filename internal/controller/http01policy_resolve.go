@@ -0,0 +1,166 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - defaultHTTP01PolicySettings() http01PolicySettings
+ *   Возвращает настройки по умолчанию, действующие для Gateway без Http01Policy
+ *
+ * - settingsFromHTTP01Policy(policy) http01PolicySettings
+ *   Преобразует spec Http01Policy в настройки с учетом значений по умолчанию
+ *
+ * - listHTTP01PoliciesForGateway(ctx, c, gateway) ([]*Http01Policy, error)
+ *   Находит все Http01Policy, селектор которых выбирает Gateway (старшая политика первой)
+ *
+ * - resolveHTTP01Policy(ctx, c, gateway) (http01PolicySettings, error)
+ *   Определяет действующие для Gateway настройки HTTP01 challenge
+ *
+ * - policyMatchesGateway(policy, gateway) (bool, error)
+ *   Проверяет, выбирает ли селектор политики указанный Gateway
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+const (
+	// defaultTemporaryCertificateDuration срок действия временного сертификата по умолчанию
+	defaultTemporaryCertificateDuration = 24 * time.Hour
+)
+
+// http01PolicySettings действующие для Gateway настройки HTTP01 challenge
+type http01PolicySettings struct {
+	// PolicyName имя политики в формате namespace/name, пустое для настроек по умолчанию
+	PolicyName string
+	// PolicyNamespace namespace политики: единственный namespace, из которого копируется секрет secretRef
+	PolicyNamespace              string
+	TemporaryCertificateEnabled  bool
+	TemporaryCertificateDuration time.Duration
+	// TemporaryCertificateSource источник временного сертификата; namespace secretRef заполнен
+	TemporaryCertificateSource http01v1alpha1.TemporaryCertificateSource
+	ManageHTTPSRedirect        bool
+	HTTPSRedirectMode          http01v1alpha1.HTTPSRedirectMode
+	DisableHSTS                bool
+	GatewayMode                http01v1alpha1.GatewayMode
+}
+
+// defaultHTTP01PolicySettings возвращает настройки по умолчанию (поведение оператора без Http01Policy)
+func defaultHTTP01PolicySettings() http01PolicySettings {
+	return http01PolicySettings{
+		TemporaryCertificateEnabled:  true,
+		TemporaryCertificateDuration: defaultTemporaryCertificateDuration,
+		TemporaryCertificateSource: http01v1alpha1.TemporaryCertificateSource{
+			Type: http01v1alpha1.TemporaryCertificateSourceSelfSigned,
+		},
+		ManageHTTPSRedirect: true,
+		HTTPSRedirectMode:   http01v1alpha1.HTTPSRedirectModeServer,
+		DisableHSTS:         true,
+		GatewayMode:         http01v1alpha1.GatewayModePatch,
+	}
+}
+
+// settingsFromHTTP01Policy преобразует spec Http01Policy в настройки
+// Незаданные поля получают значения по умолчанию
+func settingsFromHTTP01Policy(policy *http01v1alpha1.Http01Policy) http01PolicySettings {
+	settings := defaultHTTP01PolicySettings()
+	settings.PolicyName = fmt.Sprintf("%s/%s", policy.Namespace, policy.Name)
+	settings.PolicyNamespace = policy.Namespace
+
+	if policy.Spec.TemporaryCertificate.Enabled != nil {
+		settings.TemporaryCertificateEnabled = *policy.Spec.TemporaryCertificate.Enabled
+	}
+	if policy.Spec.TemporaryCertificate.Duration != nil && policy.Spec.TemporaryCertificate.Duration.Duration > 0 {
+		settings.TemporaryCertificateDuration = policy.Spec.TemporaryCertificate.Duration.Duration
+	}
+	if source := policy.Spec.TemporaryCertificate.Source; source.Type != "" {
+		settings.TemporaryCertificateSource = *source.DeepCopy()
+		// Секрет без namespace ищется в namespace политики
+		if ref := settings.TemporaryCertificateSource.SecretRef; ref != nil && ref.Namespace == "" {
+			ref.Namespace = policy.Namespace
+		}
+	}
+	if policy.Spec.ManageHTTPSRedirect != nil {
+		settings.ManageHTTPSRedirect = *policy.Spec.ManageHTTPSRedirect
+	}
+	if policy.Spec.HTTPSRedirectMode != "" {
+		settings.HTTPSRedirectMode = policy.Spec.HTTPSRedirectMode
+	}
+	if policy.Spec.DisableHSTS != nil {
+		settings.DisableHSTS = *policy.Spec.DisableHSTS
+	}
+	if policy.Spec.GatewayMode != "" {
+		settings.GatewayMode = policy.Spec.GatewayMode
+	}
+
+	return settings
+}
+
+// listHTTP01PoliciesForGateway находит все Http01Policy в namespace Gateway, селектор которых выбирает Gateway
+// Политики отсортированы по времени создания: первой идет старшая, она и применяется к Gateway
+func listHTTP01PoliciesForGateway(ctx context.Context, c client.Reader, gateway client.Object) ([]*http01v1alpha1.Http01Policy, error) {
+	policyList := &http01v1alpha1.Http01PolicyList{}
+	if err := c.List(ctx, policyList, client.InNamespace(gateway.GetNamespace())); err != nil {
+		return nil, fmt.Errorf("failed to list Http01Policies: %w", err)
+	}
+
+	var matchingPolicies []*http01v1alpha1.Http01Policy
+	for i := range policyList.Items {
+		policy := &policyList.Items[i]
+		matches, err := policyMatchesGateway(policy, gateway)
+		if err != nil || !matches {
+			continue
+		}
+		matchingPolicies = append(matchingPolicies, policy)
+	}
+
+	sort.Slice(matchingPolicies, func(i, j int) bool {
+		ti := matchingPolicies[i].CreationTimestamp
+		tj := matchingPolicies[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return matchingPolicies[i].Name < matchingPolicies[j].Name
+	})
+
+	return matchingPolicies, nil
+}
+
+// resolveHTTP01Policy определяет действующие для Gateway настройки HTTP01 challenge
+// Если политик нет, используются настройки по умолчанию. Ошибка чтения политик возвращается, а не заменяется
+// настройками по умолчанию: они самые инвазивные (временный сертификат, отключение httpsRedirect, EnvoyFilter HSTS),
+// и Gateway, политика которого их запрещает, не должен изменяться до повторной реконсиляции
+func resolveHTTP01Policy(ctx context.Context, c client.Reader, gateway client.Object) (http01PolicySettings, error) {
+	policies, err := listHTTP01PoliciesForGateway(ctx, c, gateway)
+	if err != nil {
+		return http01PolicySettings{}, fmt.Errorf("failed to resolve Http01Policy for Gateway %s/%s: %w",
+			gateway.GetNamespace(), gateway.GetName(), err)
+	}
+	if len(policies) == 0 {
+		return defaultHTTP01PolicySettings(), nil
+	}
+
+	return settingsFromHTTP01Policy(policies[0]), nil
+}
+
+// policyMatchesGateway проверяет, выбирает ли селектор политики указанный Gateway
+func policyMatchesGateway(policy *http01v1alpha1.Http01Policy, gateway client.Object) (bool, error) {
+	if policy.Namespace != gateway.GetNamespace() {
+		return false, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.GatewaySelector)
+	if err != nil {
+		return false, fmt.Errorf("invalid gatewaySelector: %w", err)
+	}
+
+	return selector.Matches(labels.Set(gateway.GetLabels())), nil
+}
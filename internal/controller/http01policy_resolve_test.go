@@ -0,0 +1,94 @@
+/*
+ * Тесты определения Http01Policy Gateway (http01policy_resolve.go):
+ *
+ * - resolveHTTP01Policy: ошибка чтения политик возвращается, а не заменяется настройками по умолчанию
+ * - CertificateReconciler: при ошибке чтения политик Gateway не изменяется, реконсиляция повторяется
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+// failingPolicyList возвращает ошибку при чтении Http01Policy, остальные запросы выполняются
+var failingPolicyList = interceptor.Funcs{
+	List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+		if _, ok := list.(*http01v1alpha1.Http01PolicyList); ok {
+			return errors.New("cache is not synced")
+		}
+		return c.List(ctx, list, opts...)
+	},
+}
+
+var _ = Describe("Http01Policy resolution", func() {
+	It("returns the error instead of the default settings", func() {
+		gateway := newTestGateway("istio-system", "public", "app.example.com", "app-tls")
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+			WithObjects(gateway).
+			WithInterceptorFuncs(failingPolicyList).
+			Build()
+
+		_, err := resolveHTTP01Policy(testCtx, c, gateway)
+		Expect(err).To(MatchError(ContainSubstring("cache is not synced")))
+	})
+
+	It("leaves the Gateway unchanged and requeues the certificate", func() {
+		gateway := newTestGateway("app", "public", "app.example.com", "app-tls")
+		class := "istio"
+		issuer := &certmanagerv1.Issuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "letsencrypt", Namespace: "app"},
+			Spec: certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{ACME: &cmacme.ACMEIssuer{
+				Solvers: []cmacme.ACMEChallengeSolver{{
+					HTTP01: &cmacme.ACMEChallengeSolverHTTP01{Ingress: &cmacme.ACMEChallengeSolverHTTP01Ingress{Class: &class}},
+				}},
+			}}},
+		}
+		cert := &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "app"},
+			Spec: certmanagerv1.CertificateSpec{
+				SecretName: "app-tls",
+				DNSNames:   []string{"app.example.com"},
+				IssuerRef:  cmmeta.ObjectReference{Name: issuer.Name, Kind: certmanagerv1.IssuerKind},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).
+			WithObjects(gateway, issuer, cert).
+			WithIndex(&istionetworkingv1beta1.Gateway{}, gatewayCredentialNameIndex, gatewayCredentialNames).
+			WithInterceptorFuncs(failingPolicyList).
+			Build()
+		r := &CertificateReconciler{Client: c, Scheme: c.Scheme()}
+
+		_, err := r.Reconcile(testCtx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cert)})
+		Expect(err).To(MatchError(ContainSubstring("cache is not synced")))
+
+		unchanged := &istionetworkingv1beta1.Gateway{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(gateway), unchanged)).To(Succeed())
+		Expect(unchanged.Spec.Servers).To(HaveLen(len(gateway.Spec.Servers)))
+		for i, server := range unchanged.Spec.Servers {
+			Expect(server.GetTls().GetCredentialName()).To(Equal(gateway.Spec.Servers[i].GetTls().GetCredentialName()))
+			Expect(server.GetTls().GetHttpsRedirect()).To(Equal(gateway.Spec.Servers[i].GetTls().GetHttpsRedirect()))
+		}
+		Expect(unchanged.Annotations).To(BeEmpty())
+
+		issued := &certmanagerv1.Certificate{}
+		Expect(c.Get(testCtx, client.ObjectKeyFromObject(cert), issued)).To(Succeed())
+		Expect(issued.Finalizers).To(BeEmpty())
+	})
+})
@@ -0,0 +1,214 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - setupFieldIndexes(ctx, mgr, gatewayAPIEnabled) error
+ *   Регистрирует field индексы кэша, по которым контроллеры ищут связанные ресурсы
+ *
+ * - gatewayCredentialNames(obj) []string
+ *   Возвращает имена секретов из credentialName серверов Istio Gateway
+ *
+ * - gatewayAPICertificateRefs(obj) []string
+ *   Возвращает ссылки "namespace/name" на секреты из certificateRefs Gateway API Gateway
+ *
+ * - certificateSecretName(obj) []string
+ *   Возвращает имя секрета, который выпускает Certificate
+ *
+ * - certificateIssuerRef(obj) []string
+ *   Возвращает ссылку "Kind/name" на Issuer или ClusterIssuer сертификата
+ *
+ * - virtualServiceGatewayRefs(obj) []string
+ *   Возвращает ссылки "namespace/name" на Gateway из spec.gateways VirtualService
+ *
+ * - httpRouteParentRefs(obj) []string
+ *   Возвращает ссылки "namespace/name" на Gateway из parentRefs HTTPRoute
+ *
+ * - splitCredentialName(value, defaultNamespace) (string, string)
+ *   Разбирает credentialName или ссылку на Gateway в формате "name" или "namespace/name"
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+const (
+	// gatewayCredentialNameIndex индекс Istio Gateway по имени секрета в credentialName (без namespace)
+	gatewayCredentialNameIndex = "spec.servers.tls.credentialName"
+
+	// gatewayAPICertificateRefIndex индекс Gateway API Gateway по секретам certificateRefs ("namespace/name")
+	gatewayAPICertificateRefIndex = "spec.listeners.tls.certificateRefs"
+
+	// certificateSecretNameIndex индекс Certificate по spec.secretName
+	certificateSecretNameIndex = "spec.secretName"
+
+	// certificateIssuerRefIndex индекс Certificate по issuerRef ("Issuer/name" или "ClusterIssuer/name")
+	certificateIssuerRefIndex = "spec.issuerRef"
+
+	// virtualServiceGatewayIndex индекс VirtualService по Gateway из spec.gateways ("namespace/name")
+	virtualServiceGatewayIndex = "spec.gateways"
+
+	// httpRouteParentIndex индекс HTTPRoute по Gateway из parentRefs ("namespace/name")
+	httpRouteParentIndex = "spec.parentRefs"
+)
+
+// setupFieldIndexes регистрирует field индексы кэша
+// Индексы позволяют находить Gateway по секрету и VirtualService по Gateway без перебора всех объектов кластера
+func setupFieldIndexes(ctx context.Context, mgr ctrl.Manager, gatewayAPIEnabled bool) error {
+	indexer := mgr.GetFieldIndexer()
+
+	if err := indexer.IndexField(ctx, &istionetworkingv1beta1.Gateway{}, gatewayCredentialNameIndex, gatewayCredentialNames); err != nil {
+		return fmt.Errorf("failed to index Gateway credentialName: %w", err)
+	}
+	if err := indexer.IndexField(ctx, &certmanagerv1.Certificate{}, certificateSecretNameIndex, certificateSecretName); err != nil {
+		return fmt.Errorf("failed to index Certificate secretName: %w", err)
+	}
+	if err := indexer.IndexField(ctx, &certmanagerv1.Certificate{}, certificateIssuerRefIndex, certificateIssuerRef); err != nil {
+		return fmt.Errorf("failed to index Certificate issuerRef: %w", err)
+	}
+	if err := indexer.IndexField(ctx, &istionetworkingv1beta1.VirtualService{}, virtualServiceGatewayIndex, virtualServiceGatewayRefs); err != nil {
+		return fmt.Errorf("failed to index VirtualService gateways: %w", err)
+	}
+
+	if gatewayAPIEnabled {
+		if err := indexer.IndexField(ctx, &gatewayapiv1.Gateway{}, gatewayAPICertificateRefIndex, gatewayAPICertificateRefs); err != nil {
+			return fmt.Errorf("failed to index Gateway API Gateway certificateRefs: %w", err)
+		}
+		if err := indexer.IndexField(ctx, &gatewayapiv1.HTTPRoute{}, httpRouteParentIndex, httpRouteParentRefs); err != nil {
+			return fmt.Errorf("failed to index HTTPRoute parentRefs: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// gatewayCredentialNames возвращает имена секретов из credentialName серверов Istio Gateway
+// Namespace не индексируется: credentialName без namespace сопоставляется с сертификатами любого namespace
+func gatewayCredentialNames(obj client.Object) []string {
+	gateway, ok := obj.(*istionetworkingv1beta1.Gateway)
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	for _, server := range gateway.Spec.Servers {
+		if server.Tls == nil || server.Tls.CredentialName == "" {
+			continue
+		}
+		_, name := splitCredentialName(server.Tls.CredentialName, gateway.Namespace)
+		names = append(names, name)
+	}
+	return names
+}
+
+// gatewayAPICertificateRefs возвращает ссылки "namespace/name" на секреты из certificateRefs Gateway API Gateway
+func gatewayAPICertificateRefs(obj client.Object) []string {
+	gateway, ok := obj.(*gatewayapiv1.Gateway)
+	if !ok {
+		return nil
+	}
+
+	var refs []string
+	for _, listener := range gateway.Spec.Listeners {
+		if listener.TLS == nil {
+			continue
+		}
+		for _, ref := range listener.TLS.CertificateRefs {
+			if ref.Kind != nil && *ref.Kind != "Secret" {
+				continue
+			}
+			if ref.Group != nil && *ref.Group != "" {
+				continue
+			}
+			namespace := gateway.Namespace
+			if ref.Namespace != nil {
+				namespace = string(*ref.Namespace)
+			}
+			refs = append(refs, fmt.Sprintf("%s/%s", namespace, ref.Name))
+		}
+	}
+	return refs
+}
+
+// certificateSecretName возвращает имя секрета, который выпускает Certificate
+func certificateSecretName(obj client.Object) []string {
+	cert, ok := obj.(*certmanagerv1.Certificate)
+	if !ok || cert.Spec.SecretName == "" {
+		return nil
+	}
+	return []string{cert.Spec.SecretName}
+}
+
+// certificateIssuerRef возвращает ссылку "Kind/name" на Issuer или ClusterIssuer сертификата
+// Сертификаты внешних issuer'ов (группа не cert-manager.io) не индексируются
+func certificateIssuerRef(obj client.Object) []string {
+	cert, ok := obj.(*certmanagerv1.Certificate)
+	if !ok || cert.Spec.IssuerRef.Name == "" {
+		return nil
+	}
+	if group := cert.Spec.IssuerRef.Group; group != "" && group != certmanagerv1.SchemeGroupVersion.Group {
+		return nil
+	}
+	return []string{issuerIndexKey(cert.Spec.IssuerRef.Kind, cert.Spec.IssuerRef.Name)}
+}
+
+// virtualServiceGatewayRefs возвращает ссылки "namespace/name" на Gateway из spec.gateways VirtualService
+// Gateway без namespace находится в namespace VirtualService; зарезервированный "mesh" пропускается
+func virtualServiceGatewayRefs(obj client.Object) []string {
+	vs, ok := obj.(*istionetworkingv1beta1.VirtualService)
+	if !ok {
+		return nil
+	}
+
+	var refs []string
+	for _, gw := range vs.Spec.Gateways {
+		if gw == "" || gw == "mesh" {
+			continue
+		}
+		namespace, name := splitCredentialName(gw, vs.Namespace)
+		refs = append(refs, fmt.Sprintf("%s/%s", namespace, name))
+	}
+	return refs
+}
+
+// httpRouteParentRefs возвращает ссылки "namespace/name" на Gateway из parentRefs HTTPRoute
+func httpRouteParentRefs(obj client.Object) []string {
+	route, ok := obj.(*gatewayapiv1.HTTPRoute)
+	if !ok {
+		return nil
+	}
+
+	var refs []string
+	for _, parentRef := range route.Spec.ParentRefs {
+		if parentRef.Group != nil && string(*parentRef.Group) != gatewayapiv1.GroupName {
+			continue
+		}
+		if parentRef.Kind != nil && *parentRef.Kind != "Gateway" {
+			continue
+		}
+		namespace := route.Namespace
+		if parentRef.Namespace != nil {
+			namespace = string(*parentRef.Namespace)
+		}
+		refs = append(refs, fmt.Sprintf("%s/%s", namespace, parentRef.Name))
+	}
+	return refs
+}
+
+// splitCredentialName разбирает значение в формате "name" или "namespace/name"
+// Для формата "name" возвращается namespace по умолчанию
+func splitCredentialName(value, defaultNamespace string) (string, string) {
+	if namespace, name, found := strings.Cut(value, "/"); found {
+		return namespace, name
+	}
+	return defaultNamespace, value
+}
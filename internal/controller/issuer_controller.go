@@ -4,6 +4,9 @@
  * - (r *IssuerReconciler) Reconcile(ctx, req) (ctrl.Result, error)
  *   Обрабатывает изменения Issuer ресурсов и выводит информацию в логи
  *
+ * - logIssuerSpec(ctx, kind, name, namespace, spec, status)
+ *   Выводит в логи конфигурацию Issuer или ClusterIssuer (общая для обоих контроллеров)
+ *
  * - (r *IssuerReconciler) SetupWithManager(mgr) error
  *   Настраивает контроллер для работы с менеджером
  */
@@ -31,48 +34,78 @@ type IssuerReconciler struct {
 
 // Reconcile обрабатывает Issuer ресурсы
 func (r *IssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	logger := log.FromContext(ctx)
-
 	// Получение Issuer
 	issuer := &certmanagerv1.Issuer{}
 	if err := r.Get(ctx, req.NamespacedName, issuer); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// Вывод информации о Issuer
-	logger.Info("Issuer detected",
-		"issuerName", issuer.Name,
-		"issuerNamespace", issuer.Namespace,
+	logIssuerSpec(ctx, certmanagerv1.IssuerKind, issuer.Name, issuer.Namespace, &issuer.Spec, &issuer.Status)
+
+	return ctrl.Result{}, nil
+}
+
+// logIssuerSpec выводит в логи конфигурацию Issuer или ClusterIssuer (тип, solver'ы и условия статуса)
+func logIssuerSpec(ctx context.Context, kind, name, namespace string, spec *certmanagerv1.IssuerSpec, status *certmanagerv1.IssuerStatus) {
+	logger := log.FromContext(ctx)
+
+	// Вывод информации об issuer
+	logger.Info(kind+" detected",
+		"issuerKind", kind,
+		"issuerName", name,
+		"issuerNamespace", namespace,
 	)
 
-	// Информация о типе Issuer
-	if issuer.Spec.ACME != nil {
+	// Информация о типе issuer
+	if spec.ACME != nil {
 		logger.Info("ACME Issuer",
-			"issuerName", issuer.Name,
-			"issuerNamespace", issuer.Namespace,
-			"server", issuer.Spec.ACME.Server,
-			"email", issuer.Spec.ACME.Email,
+			"issuerKind", kind,
+			"issuerName", name,
+			"issuerNamespace", namespace,
+			"server", spec.ACME.Server,
+			"email", spec.ACME.Email,
 		)
-		if issuer.Spec.ACME.Solvers != nil {
-			for i, solver := range issuer.Spec.ACME.Solvers {
+		if spec.ACME.Solvers != nil {
+			for i, solver := range spec.ACME.Solvers {
 				if solver.HTTP01 != nil {
 					logger.Info("HTTP01 Solver configured",
-						"issuerName", issuer.Name,
-						"issuerNamespace", issuer.Namespace,
+						"issuerKind", kind,
+						"issuerName", name,
+						"issuerNamespace", namespace,
 						"solverIndex", i,
 					)
 					if solver.HTTP01.Ingress != nil {
 						if solver.HTTP01.Ingress.Class != nil {
 							logger.Info("HTTP01 Ingress class",
-								"issuerName", issuer.Name,
-								"issuerNamespace", issuer.Namespace,
+								"issuerKind", kind,
+								"issuerName", name,
+								"issuerNamespace", namespace,
 								"ingressClass", *solver.HTTP01.Ingress.Class,
 							)
 						}
+						if solver.HTTP01.Ingress.IngressClassName != nil {
+							logger.Info("HTTP01 Ingress class name",
+								"issuerKind", kind,
+								"issuerName", name,
+								"issuerNamespace", namespace,
+								"ingressClassName", *solver.HTTP01.Ingress.IngressClassName,
+							)
+						}
+						if solver.HTTP01.Ingress.PodTemplate != nil {
+							if gateway := solver.HTTP01.Ingress.PodTemplate.Annotations[solverGatewayAnnotation]; gateway != "" {
+								logger.Info("HTTP01 solver Gateway from podTemplate",
+									"issuerKind", kind,
+									"issuerName", name,
+									"issuerNamespace", namespace,
+									"gateway", gateway,
+								)
+							}
+						}
 						if solver.HTTP01.Ingress.Name != "" {
 							logger.Info("HTTP01 Ingress name",
-								"issuerName", issuer.Name,
-								"issuerNamespace", issuer.Namespace,
+								"issuerKind", kind,
+								"issuerName", name,
+								"issuerNamespace", namespace,
 								"ingressName", solver.HTTP01.Ingress.Name,
 							)
 						}
@@ -82,36 +115,40 @@ func (r *IssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		}
 	}
 
-	if issuer.Spec.SelfSigned != nil {
+	if spec.SelfSigned != nil {
 		logger.Info("SelfSigned Issuer",
-			"issuerName", issuer.Name,
-			"issuerNamespace", issuer.Namespace,
+			"issuerKind", kind,
+			"issuerName", name,
+			"issuerNamespace", namespace,
 		)
 	}
 
-	if issuer.Spec.CA != nil {
+	if spec.CA != nil {
 		logger.Info("CA Issuer",
-			"issuerName", issuer.Name,
-			"issuerNamespace", issuer.Namespace,
-			"secretName", issuer.Spec.CA.SecretName,
+			"issuerKind", kind,
+			"issuerName", name,
+			"issuerNamespace", namespace,
+			"secretName", spec.CA.SecretName,
 		)
 	}
 
-	if issuer.Spec.Vault != nil {
+	if spec.Vault != nil {
 		logger.Info("Vault Issuer",
-			"issuerName", issuer.Name,
-			"issuerNamespace", issuer.Namespace,
-			"server", issuer.Spec.Vault.Server,
-			"path", issuer.Spec.Vault.Path,
+			"issuerKind", kind,
+			"issuerName", name,
+			"issuerNamespace", namespace,
+			"server", spec.Vault.Server,
+			"path", spec.Vault.Path,
 		)
 	}
 
-	// Статус Issuer
-	if len(issuer.Status.Conditions) > 0 {
-		for _, condition := range issuer.Status.Conditions {
+	// Статус issuer
+	if len(status.Conditions) > 0 {
+		for _, condition := range status.Conditions {
 			logger.Info("Issuer condition",
-				"issuerName", issuer.Name,
-				"issuerNamespace", issuer.Namespace,
+				"issuerKind", kind,
+				"issuerName", name,
+				"issuerNamespace", namespace,
 				"type", condition.Type,
 				"status", condition.Status,
 				"reason", condition.Reason,
@@ -119,8 +156,6 @@ func (r *IssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			)
 		}
 	}
-
-	return ctrl.Result{}, nil
 }
 
 // SetupWithManager настраивает контроллер
@@ -0,0 +1,183 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - issuerIndexKey(kind, name) string
+ *   Формирует значение индекса Certificate по issuerRef ("Issuer/<name>" или "ClusterIssuer/<name>")
+ *
+ * - (r *CertificateReconciler) certificateUsesHTTP01(ctx, cert) (bool, error)
+ *   Проверяет, решает ли Issuer или ClusterIssuer сертификата хотя бы один домен через ACME HTTP01
+ *
+ * - getIssuerSpec(ctx, c, issuerRef, namespace) (*IssuerSpec, error)
+ *   Получает spec Issuer или ClusterIssuer по ссылке issuerRef
+ *
+ * - issuerSupportsHTTP01(spec, cert) bool
+ *   Проверяет, выбирается ли HTTP01 solver ACME issuer хотя бы для одного DNS имени сертификата
+ *
+ * - selectACMESolver(solvers, cert, dnsName) *ACMEChallengeSolver
+ *   Выбирает solver для DNS имени по правилам приоритета селекторов cert-manager
+ *
+ * - solverSelectorScore(selector, cert, dnsName) (int, int, bool)
+ *   Вычисляет приоритет solver'а для DNS имени (уровень совпадения и его специфичность)
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Уровни совпадения селектора solver'а в порядке возрастания приоритета
+	solverMatchDefault = iota // селектор не задан - solver подходит для любых доменов
+	solverMatchLabels         // совпали только matchLabels
+	solverMatchDNSZone        // домен входит в одну из dnsZones
+	solverMatchDNSName        // домен явно указан в dnsNames
+)
+
+// issuerIndexKey формирует значение индекса Certificate по issuerRef
+// Пустой kind означает Issuer (значение по умолчанию в cert-manager)
+func issuerIndexKey(kind, name string) string {
+	if kind == "" {
+		kind = certmanagerv1.IssuerKind
+	}
+	return fmt.Sprintf("%s/%s", kind, name)
+}
+
+// certificateUsesHTTP01 проверяет, решает ли issuer сертификата хотя бы один домен через ACME HTTP01
+// Сертификаты внешних issuer'ов (не cert-manager.io), а также несуществующих issuer'ов не обрабатываются
+func (r *CertificateReconciler) certificateUsesHTTP01(ctx context.Context, cert *certmanagerv1.Certificate) (bool, error) {
+	spec, err := getIssuerSpec(ctx, r.Client, cert.Spec.IssuerRef, cert.Namespace)
+	if err != nil || spec == nil {
+		return false, err
+	}
+	return issuerSupportsHTTP01(spec, cert), nil
+}
+
+// getIssuerSpec получает spec Issuer (в указанном namespace) или ClusterIssuer по ссылке issuerRef
+// Для issuer'ов другой группы и несуществующих issuer'ов возвращает nil без ошибки
+func getIssuerSpec(ctx context.Context, c client.Client, issuerRef cmmeta.ObjectReference, namespace string) (*certmanagerv1.IssuerSpec, error) {
+	if issuerRef.Group != "" && issuerRef.Group != certmanagerv1.SchemeGroupVersion.Group {
+		return nil, nil
+	}
+
+	switch issuerRef.Kind {
+	case certmanagerv1.ClusterIssuerKind:
+		clusterIssuer := &certmanagerv1.ClusterIssuer{}
+		if err := c.Get(ctx, client.ObjectKey{Name: issuerRef.Name}, clusterIssuer); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to get ClusterIssuer %s: %w", issuerRef.Name, err)
+		}
+		return &clusterIssuer.Spec, nil
+	case "", certmanagerv1.IssuerKind:
+		issuer := &certmanagerv1.Issuer{}
+		if err := c.Get(ctx, client.ObjectKey{Name: issuerRef.Name, Namespace: namespace}, issuer); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to get Issuer %s/%s: %w", namespace, issuerRef.Name, err)
+		}
+		return &issuer.Spec, nil
+	default:
+		return nil, nil
+	}
+}
+
+// issuerSupportsHTTP01 проверяет, выбирается ли HTTP01 solver ACME issuer хотя бы для одного DNS имени сертификата
+// CA, SelfSigned, Vault и ACME issuer'ы только с DNS01 solver'ами не требуют маршрутизации challenge через Gateway
+func issuerSupportsHTTP01(spec *certmanagerv1.IssuerSpec, cert *certmanagerv1.Certificate) bool {
+	if spec == nil || spec.ACME == nil {
+		return false
+	}
+
+	dnsNames := cert.Spec.DNSNames
+	if len(dnsNames) == 0 && cert.Spec.CommonName != "" {
+		dnsNames = []string{cert.Spec.CommonName}
+	}
+	for _, dnsName := range dnsNames {
+		if solver := selectACMESolver(spec.ACME.Solvers, cert, dnsName); solver != nil && solver.HTTP01 != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// selectACMESolver выбирает solver для DNS имени по правилам cert-manager:
+// dnsNames важнее dnsZones (более длинная зона важнее), затем matchLabels, затем solver без селектора;
+// при равенстве выбирается solver с большим числом matchLabels, затем объявленный раньше
+func selectACMESolver(solvers []cmacme.ACMEChallengeSolver, cert *certmanagerv1.Certificate, dnsName string) *cmacme.ACMEChallengeSolver {
+	var selected *cmacme.ACMEChallengeSolver
+	bestLevel, bestSpecificity, bestLabels := -1, -1, -1
+
+	for i := range solvers {
+		solver := &solvers[i]
+		level, specificity, ok := solverSelectorScore(solver.Selector, cert, dnsName)
+		if !ok {
+			continue
+		}
+		labels := 0
+		if solver.Selector != nil {
+			labels = len(solver.Selector.MatchLabels)
+		}
+
+		better := level > bestLevel ||
+			(level == bestLevel && specificity > bestSpecificity) ||
+			(level == bestLevel && specificity == bestSpecificity && labels > bestLabels)
+		if better {
+			selected = solver
+			bestLevel, bestSpecificity, bestLabels = level, specificity, labels
+		}
+	}
+
+	return selected
+}
+
+// solverSelectorScore вычисляет приоритет solver'а для DNS имени
+// Возвращает уровень совпадения, специфичность (длину зоны для dnsZones) и признак того, что solver подходит
+func solverSelectorScore(selector *cmacme.CertificateDNSNameSelector, cert *certmanagerv1.Certificate, dnsName string) (int, int, bool) {
+	if selector == nil {
+		return solverMatchDefault, 0, true
+	}
+
+	for key, value := range selector.MatchLabels {
+		if cert.Labels[key] != value {
+			return 0, 0, false
+		}
+	}
+
+	if slices.Contains(selector.DNSNames, dnsName) {
+		return solverMatchDNSName, 0, true
+	}
+
+	// Для зон wildcard "*.example.com" сопоставляется как "example.com"
+	domain := strings.TrimPrefix(dnsName, "*.")
+	longestZone := -1
+	for _, zone := range selector.DNSZones {
+		if domain == zone || strings.HasSuffix(domain, "."+zone) {
+			longestZone = max(longestZone, len(zone))
+		}
+	}
+	if longestZone >= 0 {
+		return solverMatchDNSZone, longestZone, true
+	}
+
+	// Заданы dnsNames или dnsZones, но домен в них не входит
+	if len(selector.DNSNames) > 0 || len(selector.DNSZones) > 0 {
+		return 0, 0, false
+	}
+
+	if len(selector.MatchLabels) > 0 {
+		return solverMatchLabels, 0, true
+	}
+	return solverMatchDefault, 0, true
+}
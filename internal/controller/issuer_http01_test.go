@@ -0,0 +1,143 @@
+/*
+ * Тесты выбора ACME solver'а для сертификата (issuer_http01.go):
+ *
+ * - selectACMESolver: приоритет dnsNames, dnsZones, matchLabels и solver'а без селектора
+ * - issuerSupportsHTTP01: HTTP01 и DNS01 solver'ы, issuer'ы без ACME
+ * - issuerIndexKey: значение индекса Certificate по issuerRef
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testHTTP01Solver возвращает HTTP01 solver с ingress class и селектором
+func testHTTP01Solver(class string, selector *cmacme.CertificateDNSNameSelector) cmacme.ACMEChallengeSolver {
+	return cmacme.ACMEChallengeSolver{
+		Selector: selector,
+		HTTP01: &cmacme.ACMEChallengeSolverHTTP01{
+			Ingress: &cmacme.ACMEChallengeSolverHTTP01Ingress{Class: &class},
+		},
+	}
+}
+
+// testDNS01Solver возвращает DNS01 solver с селектором
+func testDNS01Solver(selector *cmacme.CertificateDNSNameSelector) cmacme.ACMEChallengeSolver {
+	return cmacme.ACMEChallengeSolver{
+		Selector: selector,
+		DNS01:    &cmacme.ACMEChallengeSolverDNS01{Webhook: &cmacme.ACMEIssuerDNS01ProviderWebhook{}},
+	}
+}
+
+// solverClass возвращает ingress class выбранного HTTP01 solver'а ("dns01" для DNS01)
+func solverClass(solver *cmacme.ACMEChallengeSolver) string {
+	if solver == nil {
+		return ""
+	}
+	if solver.HTTP01 == nil {
+		return "dns01"
+	}
+	return *solver.HTTP01.Ingress.Class
+}
+
+var _ = Describe("ACME solver selection", func() {
+	var cert *certmanagerv1.Certificate
+
+	BeforeEach(func() {
+		cert = &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Labels: map[string]string{"team": "web"}},
+			Spec:       certmanagerv1.CertificateSpec{DNSNames: []string{"app.example.com", "api.internal.example.com"}},
+		}
+	})
+
+	Describe("selectACMESolver", func() {
+		It("prefers dnsNames over dnsZones, matchLabels and the default solver", func() {
+			solvers := []cmacme.ACMEChallengeSolver{
+				testHTTP01Solver("default", nil),
+				testHTTP01Solver("labels", &cmacme.CertificateDNSNameSelector{MatchLabels: map[string]string{"team": "web"}}),
+				testHTTP01Solver("zone", &cmacme.CertificateDNSNameSelector{DNSZones: []string{"example.com"}}),
+				testHTTP01Solver("name", &cmacme.CertificateDNSNameSelector{DNSNames: []string{"app.example.com"}}),
+			}
+
+			Expect(solverClass(selectACMESolver(solvers, cert, "app.example.com"))).To(Equal("name"))
+			Expect(solverClass(selectACMESolver(solvers, cert, "api.internal.example.com"))).To(Equal("zone"))
+			Expect(solverClass(selectACMESolver(solvers[:2], cert, "app.example.com"))).To(Equal("labels"))
+			Expect(solverClass(selectACMESolver(solvers[:1], cert, "app.example.com"))).To(Equal("default"))
+		})
+
+		It("prefers the longest matching dnsZone", func() {
+			solvers := []cmacme.ACMEChallengeSolver{
+				testHTTP01Solver("short", &cmacme.CertificateDNSNameSelector{DNSZones: []string{"example.com"}}),
+				testHTTP01Solver("long", &cmacme.CertificateDNSNameSelector{DNSZones: []string{"internal.example.com"}}),
+			}
+			Expect(solverClass(selectACMESolver(solvers, cert, "api.internal.example.com"))).To(Equal("long"))
+			Expect(solverClass(selectACMESolver(solvers, cert, "*.internal.example.com"))).To(Equal("long"))
+		})
+
+		It("skips solvers whose matchLabels or zones do not match", func() {
+			solvers := []cmacme.ACMEChallengeSolver{
+				testHTTP01Solver("other-team", &cmacme.CertificateDNSNameSelector{MatchLabels: map[string]string{"team": "db"}}),
+				testHTTP01Solver("other-zone", &cmacme.CertificateDNSNameSelector{DNSZones: []string{"example.org"}}),
+			}
+			Expect(selectACMESolver(solvers, cert, "app.example.com")).To(BeNil())
+		})
+
+		It("keeps the first declared solver on a tie", func() {
+			solvers := []cmacme.ACMEChallengeSolver{
+				testHTTP01Solver("first", nil),
+				testHTTP01Solver("second", nil),
+			}
+			Expect(solverClass(selectACMESolver(solvers, cert, "app.example.com"))).To(Equal("first"))
+		})
+	})
+
+	Describe("issuerSupportsHTTP01", func() {
+		It("is true when HTTP01 is selected for at least one DNS name", func() {
+			spec := &certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{ACME: &cmacme.ACMEIssuer{
+				Solvers: []cmacme.ACMEChallengeSolver{
+					testDNS01Solver(nil),
+					testHTTP01Solver("istio", &cmacme.CertificateDNSNameSelector{DNSNames: []string{"app.example.com"}}),
+				},
+			}}}
+			Expect(issuerSupportsHTTP01(spec, cert)).To(BeTrue())
+		})
+
+		It("is false when every DNS name is solved via DNS01", func() {
+			spec := &certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{ACME: &cmacme.ACMEIssuer{
+				Solvers: []cmacme.ACMEChallengeSolver{
+					testHTTP01Solver("istio", &cmacme.CertificateDNSNameSelector{DNSZones: []string{"example.org"}}),
+					testDNS01Solver(nil),
+				},
+			}}}
+			Expect(issuerSupportsHTTP01(spec, cert)).To(BeFalse())
+		})
+
+		It("is false for issuers without ACME", func() {
+			spec := &certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{SelfSigned: &certmanagerv1.SelfSignedIssuer{}}}
+			Expect(issuerSupportsHTTP01(spec, cert)).To(BeFalse())
+			Expect(issuerSupportsHTTP01(nil, cert)).To(BeFalse())
+		})
+
+		It("uses the commonName when the certificate has no dnsNames", func() {
+			cert.Spec.DNSNames = nil
+			cert.Spec.CommonName = "app.example.com"
+			spec := &certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{ACME: &cmacme.ACMEIssuer{
+				Solvers: []cmacme.ACMEChallengeSolver{
+					testHTTP01Solver("istio", &cmacme.CertificateDNSNameSelector{DNSNames: []string{"app.example.com"}}),
+				},
+			}}}
+			Expect(issuerSupportsHTTP01(spec, cert)).To(BeTrue())
+		})
+	})
+
+	It("builds issuerRef index keys with Issuer as the default kind", func() {
+		Expect(issuerIndexKey("", "letsencrypt")).To(Equal("Issuer/letsencrypt"))
+		Expect(issuerIndexKey(certmanagerv1.ClusterIssuerKind, "letsencrypt")).To(Equal("ClusterIssuer/letsencrypt"))
+	})
+})
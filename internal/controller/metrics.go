@@ -0,0 +1,242 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - init()
+ *   Регистрирует метрики оператора в реестре controller-runtime (endpoint /metrics менеджера)
+ *
+ * - recordSolverVirtualServiceDeleted(vs)
+ *   Увеличивает счетчик удаленных VirtualService солвера для Gateway, на который ссылается VirtualService
+ *
+ * - recordVerificationFailure(gateway, method)
+ *   Увеличивает счетчик неудачных проверок сертификата через HTTPS или HTTP
+ *
+ * - markCertificatePending(cert)
+ *   Запоминает, что оператор видел Certificate в состоянии "не готов"
+ *
+ * - forgetCertificatePending(key)
+ *   Забывает удаленный Certificate, который так и не стал готовым
+ *
+ * - observeCertificateReady(cert, gateways)
+ *   Записывает время от создания Certificate до Ready, если оператор видел его неготовым
+ *
+ * - (r *CertificateReconciler) recordCertificateReadiness(ctx, cert, isReady)
+ *   Отмечает неготовый Certificate или записывает время до Ready для Gateway, использующих его секрет
+ *
+ * - certificateReadyTime(cert) (time.Time, bool)
+ *   Возвращает время перехода условия Ready сертификата в True
+ */
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	certmanagermetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+)
+
+const (
+	// metricsNamespace префикс имен метрик оператора
+	metricsNamespace = "istio_http01"
+
+	// verificationMethodHTTPS метка method для проверки сертификата через HTTPS
+	verificationMethodHTTPS = "https"
+
+	// verificationMethodHTTP метка method для проверки доступности через HTTP
+	verificationMethodHTTP = "http"
+)
+
+var (
+	// solverVirtualServicesCreated количество созданных VirtualService для HTTP01 solver
+	solverVirtualServicesCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "solver_virtualservices_created_total",
+		Help:      "Number of VirtualServices created to route HTTP01 challenges to solver pods.",
+	}, []string{"gateway", "namespace"})
+
+	// solverVirtualServicesDeleted количество удаленных VirtualService для HTTP01 solver
+	solverVirtualServicesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "solver_virtualservices_deleted_total",
+		Help:      "Number of HTTP01 solver VirtualServices deleted after the solver pod was removed or became orphaned.",
+	}, []string{"gateway", "namespace"})
+
+	// temporaryCertificatesIssued количество выпущенных временных сертификатов
+	temporaryCertificatesIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "temporary_certificates_issued_total",
+		Help:      "Number of temporary self-signed certificates created for Gateways while the real certificate is pending.",
+	}, []string{"gateway", "namespace"})
+
+	// temporaryCertificatesRestored количество восстановлений оригинального секрета в Gateway
+	temporaryCertificatesRestored = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "temporary_certificates_restored_total",
+		Help:      "Number of times a Gateway was switched back from the temporary secret to the issued certificate.",
+	}, []string{"gateway", "namespace"})
+
+	// certificateReadyDuration время от создания Certificate до его готовности
+	certificateReadyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "certificate_ready_duration_seconds",
+		Help:      "Time from Certificate creation until it became Ready.",
+		// От 30 секунд до ~4 часов
+		Buckets: prometheus.ExponentialBuckets(30, 2, 10),
+	}, []string{"gateway", "namespace"})
+
+	// hstsEnvoyFiltersActive EnvoyFilter для отключения HSTS, существующие в данный момент
+	hstsEnvoyFiltersActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "hsts_envoyfilters_active",
+		Help:      "HSTS-stripping EnvoyFilters currently managed by the operator (1 per Gateway).",
+	}, []string{"gateway", "namespace"})
+
+	// certificateVerificationFailures количество неудачных проверок сертификата
+	certificateVerificationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "certificate_verification_failures_total",
+		Help:      "Number of failed certificate verifications against the ingress gateway.",
+	}, []string{"gateway", "namespace", "method"})
+
+	// solverPreflightChecks результаты предварительной проверки маршрута challenge через ingress gateway
+	solverPreflightChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "solver_preflight_checks_total",
+		Help:      "Number of HTTP01 pre-flight requests through the ingress gateway by result (reachable, redirect, not_found, wrong_response, unreachable).",
+	}, []string{"gateway", "namespace", "result"})
+
+	// pendingCertificates Certificate, которые оператор видел неготовыми: UID -> namespace/name
+	// Имя нужно, чтобы забыть Certificate, удаленный до готовности (в NotFound известно только имя)
+	pendingCertificates   = make(map[types.UID]types.NamespacedName)
+	pendingCertificatesMu sync.Mutex
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		solverVirtualServicesCreated,
+		solverVirtualServicesDeleted,
+		temporaryCertificatesIssued,
+		temporaryCertificatesRestored,
+		certificateReadyDuration,
+		hstsEnvoyFiltersActive,
+		certificateVerificationFailures,
+		solverPreflightChecks,
+	)
+}
+
+// recordSolverVirtualServiceDeleted увеличивает счетчик удаленных VirtualService солвера
+// Gateway определяется по spec.gateways VirtualService ("name" или "namespace/name")
+func recordSolverVirtualServiceDeleted(vs *istionetworkingv1beta1.VirtualService) {
+	gatewayName := ""
+	gatewayNamespace := vs.Namespace
+	if len(vs.Spec.Gateways) > 0 {
+		gatewayName = vs.Spec.Gateways[0]
+		if namespace, name, found := strings.Cut(gatewayName, "/"); found {
+			gatewayNamespace = namespace
+			gatewayName = name
+		}
+	}
+	solverVirtualServicesDeleted.WithLabelValues(gatewayName, gatewayNamespace).Inc()
+}
+
+// recordVerificationFailure увеличивает счетчик неудачных проверок сертификата
+func recordVerificationFailure(gateway client.Object, method string) {
+	certificateVerificationFailures.WithLabelValues(gateway.GetName(), gateway.GetNamespace(), method).Inc()
+}
+
+// markCertificatePending запоминает, что оператор видел Certificate неготовым
+// Время готовности записывается только для таких сертификатов, чтобы после рестарта
+// оператора уже давно готовые сертификаты не попадали в гистограмму повторно
+func markCertificatePending(cert *certmanagerv1.Certificate) {
+	pendingCertificatesMu.Lock()
+	defer pendingCertificatesMu.Unlock()
+	pendingCertificates[cert.UID] = types.NamespacedName{Name: cert.Name, Namespace: cert.Namespace}
+}
+
+// forgetCertificatePending забывает Certificate, удаленный до перехода в Ready
+// Удаляются все записи с этим именем: Certificate мог быть пересоздан с новым UID
+func forgetCertificatePending(key types.NamespacedName) {
+	pendingCertificatesMu.Lock()
+	defer pendingCertificatesMu.Unlock()
+	for uid, pendingKey := range pendingCertificates {
+		if pendingKey == key {
+			delete(pendingCertificates, uid)
+		}
+	}
+}
+
+// observeCertificateReady записывает время от создания Certificate до Ready для каждого Gateway сертификата
+func observeCertificateReady(cert *certmanagerv1.Certificate, gateways []client.Object) {
+	pendingCertificatesMu.Lock()
+	_, pending := pendingCertificates[cert.UID]
+	delete(pendingCertificates, cert.UID)
+	pendingCertificatesMu.Unlock()
+	if !pending {
+		return
+	}
+
+	readyTime, ok := certificateReadyTime(cert)
+	if !ok {
+		return
+	}
+	duration := readyTime.Sub(cert.CreationTimestamp.Time).Seconds()
+
+	if len(gateways) == 0 {
+		certificateReadyDuration.WithLabelValues("", cert.Namespace).Observe(duration)
+		return
+	}
+	for _, gateway := range gateways {
+		certificateReadyDuration.WithLabelValues(gateway.GetName(), gateway.GetNamespace()).Observe(duration)
+	}
+}
+
+// recordCertificateReadiness отмечает неготовый Certificate или записывает время до Ready
+// для каждого Istio и Gateway API Gateway, использующего его секрет
+// Временные self-signed сертификаты оператора не учитываются
+func (r *CertificateReconciler) recordCertificateReadiness(ctx context.Context, cert *certmanagerv1.Certificate, isReady bool) {
+	if cert.Labels["istio-http01.rieset.io/temp"] == tempLabelValue {
+		return
+	}
+	if !isReady {
+		markCertificatePending(cert)
+		return
+	}
+
+	var gateways []client.Object
+	if istioGateways, err := r.findGatewaysUsingCertificate(ctx, cert.Spec.SecretName, cert.Namespace); err == nil {
+		for _, gateway := range istioGateways {
+			gateways = append(gateways, gateway)
+		}
+	}
+	if r.GatewayAPIEnabled {
+		if gatewayAPIGateways, err := r.findGatewayAPIGatewaysUsingCertificate(ctx, cert.Spec.SecretName, cert.Namespace); err == nil {
+			for _, gateway := range gatewayAPIGateways {
+				gateways = append(gateways, gateway)
+			}
+		}
+	}
+	observeCertificateReady(cert, gateways)
+}
+
+// certificateReadyTime возвращает время перехода условия Ready сертификата в True
+func certificateReadyTime(cert *certmanagerv1.Certificate) (time.Time, bool) {
+	for _, condition := range cert.Status.Conditions {
+		if condition.Type != certmanagerv1.CertificateConditionReady || condition.Status != certmanagermetav1.ConditionTrue {
+			continue
+		}
+		if condition.LastTransitionTime == nil {
+			return time.Time{}, false
+		}
+		return condition.LastTransitionTime.Time, true
+	}
+	return time.Time{}, false
+}
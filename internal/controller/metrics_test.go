@@ -0,0 +1,37 @@
+/*
+ * Тесты метрик оператора (metrics.go):
+ *
+ * - pendingCertificates: Certificate, удаленный до готовности, забывается в NotFound реконсиляции
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Certificate readiness metrics", func() {
+	It("forgets certificates deleted before they became ready", func() {
+		cert := &certmanagerv1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: "app", UID: "deleted-uid"},
+			Spec:       certmanagerv1.CertificateSpec{SecretName: "deleted-tls"},
+		}
+		markCertificatePending(cert)
+
+		c := fake.NewClientBuilder().WithScheme(newTestScheme()).Build()
+		r := &CertificateReconciler{Client: c, Scheme: c.Scheme()}
+		_, err := r.Reconcile(testCtx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cert)})
+		Expect(err).NotTo(HaveOccurred())
+
+		pendingCertificatesMu.Lock()
+		defer pendingCertificatesMu.Unlock()
+		Expect(pendingCertificates).NotTo(HaveKey(cert.UID))
+	})
+})
@@ -0,0 +1,47 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - setSharedOwnerReference(owner, obj, scheme, onlyOwner) (bool, error)
+ *   Добавляет owner reference в объект, который используют несколько владельцев (EnvoyFilter, VirtualService хоста)
+ */
+
+package controller
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// setSharedOwnerReference добавляет owner reference на owner в объект, общий для нескольких владельцев
+// GC удаляет объект, только когда удалены все владельцы из ownerReferences, поэтому ссылки ставятся,
+// пока все владельцы находятся в namespace объекта. Владелец из другого namespace (ссылка на него невозможна)
+// снимает все ссылки - такой объект удаляет sweeper по меткам.
+// onlyOwner - owner единственный пользователь объекта (новый объект), прежние ссылки отбрасываются.
+// Возвращает true, если ownerReferences изменились
+func setSharedOwnerReference(owner, obj client.Object, scheme *runtime.Scheme, onlyOwner bool) (bool, error) {
+	before := obj.GetOwnerReferences()
+
+	if owner.GetNamespace() != obj.GetNamespace() {
+		if len(before) == 0 {
+			return false, nil
+		}
+		obj.SetOwnerReferences(nil)
+		return true, nil
+	}
+
+	if onlyOwner {
+		obj.SetOwnerReferences(nil)
+	} else if len(before) == 0 {
+		// Объект уже используется без ссылок (владелец из другого namespace или объект прежней версии),
+		// ссылка только на owner позволила бы GC удалить объект, пока он нужен остальным
+		return false, nil
+	}
+
+	if err := controllerutil.SetOwnerReference(owner, obj, scheme); err != nil {
+		return false, err
+	}
+	return !reflect.DeepEqual(before, obj.GetOwnerReferences()), nil
+}
@@ -0,0 +1,100 @@
+/*
+ * Тесты owner reference общих объектов (owner_references.go, http01_solver_vs_routes.go):
+ *
+ * - setSharedOwnerReference: владельцы из namespace объекта, владелец из другого namespace,
+ *   объект без ссылок, используемый другими владельцами
+ * - pruneSolverServiceOwners: ссылки на Service удаленных маршрутов снимаются
+ */
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// testSolverService возвращает Service солвера с UID, необходимым для owner reference
+func testSolverService(namespace, name string) *corev1.Service {
+	return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(name)}}
+}
+
+// ownerNames возвращает имена владельцев объекта
+func ownerNames(refs []metav1.OwnerReference) []string {
+	names := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+	return names
+}
+
+var _ = Describe("Shared owner references", func() {
+	var vs *istionetworkingv1beta1.VirtualService
+
+	BeforeEach(func() {
+		vs = &istionetworkingv1beta1.VirtualService{ObjectMeta: metav1.ObjectMeta{Name: "http01-solver-app", Namespace: "app"}}
+	})
+
+	It("adds every owner from the object namespace", func() {
+		changed, err := setSharedOwnerReference(testSolverService("app", "solver-a"), vs, newTestScheme(), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+
+		changed, err = setSharedOwnerReference(testSolverService("app", "solver-b"), vs, newTestScheme(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(ownerNames(vs.OwnerReferences)).To(Equal([]string{"solver-a", "solver-b"}))
+		Expect(vs.OwnerReferences[0].Kind).To(Equal("Service"))
+		Expect(vs.OwnerReferences[0].Controller).To(BeNil())
+
+		changed, err = setSharedOwnerReference(testSolverService("app", "solver-b"), vs, newTestScheme(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+	})
+
+	It("drops all owners once an owner from another namespace uses the object", func() {
+		_, err := setSharedOwnerReference(testSolverService("app", "solver-a"), vs, newTestScheme(), true)
+		Expect(err).NotTo(HaveOccurred())
+
+		changed, err := setSharedOwnerReference(testSolverService("other", "solver-b"), vs, newTestScheme(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(vs.OwnerReferences).To(BeEmpty())
+
+		By("keeping the object unowned while it is shared")
+		changed, err = setSharedOwnerReference(testSolverService("app", "solver-c"), vs, newTestScheme(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+		Expect(vs.OwnerReferences).To(BeEmpty())
+	})
+
+	It("resets owners when the owner is the only user", func() {
+		_, err := setSharedOwnerReference(testSolverService("app", "solver-a"), vs, newTestScheme(), true)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = setSharedOwnerReference(testSolverService("app", "solver-b"), vs, newTestScheme(), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ownerNames(vs.OwnerReferences)).To(Equal([]string{"solver-b"}))
+	})
+
+	It("prunes owners of removed solver routes", func() {
+		vs.Spec.Http = []*istioapinetworkingv1beta1.HTTPRoute{
+			testSolverRoute("solver-a", "token-a"),
+			testSolverRoute("solver-b", "token-b"),
+		}
+		for _, name := range []string{"solver-a", "solver-b"} {
+			_, err := setSharedOwnerReference(testSolverService("app", name), vs, newTestScheme(), name == "solver-a")
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(removeSolverRoutes(vs, func(route *istioapinetworkingv1beta1.HTTPRoute) bool {
+			return route.Name == "solver-a"
+		})).To(Equal(1))
+		Expect(ownerNames(vs.OwnerReferences)).To(Equal([]string{"solver-b"}))
+	})
+})
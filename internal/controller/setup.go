@@ -3,19 +3,38 @@
  *
  * - SetupControllers(mgr) error
  *   Настраивает и регистрирует все контроллеры оператора
+ *
+ * - isGatewayAPIAvailable(mgr) bool
+ *   Проверяет, установлены ли в кластере CRD Kubernetes Gateway API (Gateway и HTTPRoute)
+ *
+ * - isChallengeAPIAvailable(mgr) bool
+ *   Проверяет, установлен ли в кластере CRD Challenge cert-manager (acme.cert-manager.io)
  */
 
 package controller
 
 import (
+	"context"
 	"os"
 	"strconv"
 
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	ctrl "sigs.k8s.io/controller-runtime"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
 // SetupControllers настраивает все контроллеры оператора
 func SetupControllers(mgr ctrl.Manager) error {
+	// Gateway API поддерживается только если CRD установлены в кластере
+	gatewayAPIEnabled := isGatewayAPIAvailable(mgr)
+	ctrl.Log.Info("Gateway API support", "enabled", gatewayAPIEnabled)
+
+	// Field индексы, по которым контроллеры находят связанные ресурсы в кэше
+	if err := setupFieldIndexes(context.Background(), mgr, gatewayAPIEnabled); err != nil {
+		return err
+	}
+
 	// Certificate controller
 	debugMode := false
 	if debugEnv := os.Getenv("DEBUG_MODE"); debugEnv != "" {
@@ -27,20 +46,59 @@ func SetupControllers(mgr ctrl.Manager) error {
 		Client:    mgr.GetClient(),
 		Scheme:    mgr.GetScheme(),
 		DebugMode: debugMode,
+
+		GatewayAPIEnabled: gatewayAPIEnabled,
+		Recorder:          mgr.GetEventRecorderFor(eventRecorderName),
 	}).SetupWithManager(mgr); err != nil {
 		return err
 	}
 
 	// HTTP01 Solver Pod controller
-	if err := (&HTTP01SolverPodReconciler{
+	// Если CRD Challenge установлен, поды Challenge маршрутизирует ChallengeReconciler, а разбор пода - запасной путь
+	challengeAPIEnabled := isChallengeAPIAvailable(mgr)
+	ctrl.Log.Info("Challenge API support", "enabled", challengeAPIEnabled)
+	// Предварительная проверка маршрута challenge включена по умолчанию; SOLVER_PREFLIGHT=false отключает ее,
+	// если оператор не может обращаться к адресу ingress gateway
+	preflightEnabled := true
+	if preflightEnv := os.Getenv("SOLVER_PREFLIGHT"); preflightEnv != "" {
+		if parsed, err := strconv.ParseBool(preflightEnv); err == nil {
+			preflightEnabled = parsed
+		}
+	}
+	solverReconciler := &HTTP01SolverPodReconciler{
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		GatewayAPIEnabled: gatewayAPIEnabled,
+		Recorder:          mgr.GetEventRecorderFor(eventRecorderName),
+
+		ChallengeControllerEnabled: challengeAPIEnabled,
+		PreflightEnabled:           preflightEnabled,
+	}
+	if err := solverReconciler.SetupWithManager(mgr); err != nil {
+		return err
+	}
+
+	// Challenge controller
+	if challengeAPIEnabled {
+		if err := (&ChallengeReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+			Solver: solverReconciler,
+		}).SetupWithManager(mgr); err != nil {
+			return err
+		}
+	}
+
+	// Issuer controller
+	if err := (&IssuerReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
 		return err
 	}
 
-	// Issuer controller
-	if err := (&IssuerReconciler{
+	// ClusterIssuer controller
+	if err := (&ClusterIssuerReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
@@ -55,5 +113,46 @@ func SetupControllers(mgr ctrl.Manager) error {
 		return err
 	}
 
+	// Http01Policy controller
+	if err := (&Http01PolicyReconciler{
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		GatewayAPIEnabled: gatewayAPIEnabled,
+	}).SetupWithManager(mgr); err != nil {
+		return err
+	}
+
+	// Gateway API Gateway controller
+	if gatewayAPIEnabled {
+		if err := (&GatewayAPIReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// isGatewayAPIAvailable проверяет, установлены ли в кластере CRD Kubernetes Gateway API
+func isGatewayAPIAvailable(mgr ctrl.Manager) bool {
+	for _, kind := range []string{"Gateway", "HTTPRoute"} {
+		if _, err := mgr.GetRESTMapper().RESTMapping(schema.GroupKind{
+			Group: gatewayapiv1.GroupName,
+			Kind:  kind,
+		}, gatewayapiv1.GroupVersion.Version); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isChallengeAPIAvailable проверяет, установлен ли в кластере CRD Challenge cert-manager
+func isChallengeAPIAvailable(mgr ctrl.Manager) bool {
+	_, err := mgr.GetRESTMapper().RESTMapping(schema.GroupKind{
+		Group: cmacme.SchemeGroupVersion.Group,
+		Kind:  "Challenge",
+	}, cmacme.SchemeGroupVersion.Version)
+	return err == nil
+}
@@ -0,0 +1,244 @@
+/*
+ * Настройка тестов пакета controller:
+ *
+ * - TestControllers(t)
+ *   Запускает Ginkgo suite пакета
+ *
+ * - BeforeSuite / AfterSuite
+ *   Поднимают envtest (kube-apiserver и etcd) с CRD оператора, cert-manager и Istio
+ *   и запускают менеджер со всеми контроллерами (SetupControllers)
+ *
+ * - requireEnvtest()
+ *   Пропускает интеграционный тест, если бинарники envtest не найдены
+ *
+ * - newTestScheme() *runtime.Scheme
+ *   Схема с теми же типами, что и в cmd/main.go
+ *
+ * - createTestNamespace() string
+ *   Создает namespace для одного теста
+ *
+ * - newTestGateway(namespace, name, host, secretName) *Gateway
+ *   Istio Gateway с HTTP сервером (httpsRedirect) и HTTPS сервером с credentialName
+ *
+ * - newTestVirtualService(namespace, name, host, gateway) *VirtualService
+ *   VirtualService приложения, привязывающий домен к Gateway
+ *
+ * - setCertificateReady(key, ready)
+ *   Выставляет условие Ready в статусе Certificate (вместо cert-manager)
+ *
+ * Unit тесты (без envtest) выполняются всегда; интеграционные тесты требуют
+ * KUBEBUILDER_ASSETS или бинарники в bin/k8s (make setup-envtest)
+ */
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	istioapinetworkingv1beta1 "istio.io/api/networking/v1beta1"
+	istionetworkingv1beta1 "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayapiv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	http01v1alpha1 "github.com/rieset/istio-http01/api/v1alpha1"
+)
+
+const (
+	// eventuallyTimeout время ожидания реконсиляции в интеграционных тестах
+	eventuallyTimeout = 20 * time.Second
+	// eventuallyInterval интервал проверки состояния в интеграционных тестах
+	eventuallyInterval = 250 * time.Millisecond
+)
+
+var (
+	testCtx    context.Context
+	testCancel context.CancelFunc
+	testEnv    *envtest.Environment
+	// k8sClient читает напрямую из kube-apiserver (без кэша менеджера)
+	k8sClient client.Client
+	// envtestAvailable true, если envtest запущен и контроллеры работают
+	envtestAvailable bool
+)
+
+func TestControllers(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controller Suite")
+}
+
+var _ = BeforeSuite(func() {
+	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
+	testCtx, testCancel = context.WithCancel(context.Background())
+
+	binaryDir := getFirstFoundEnvTestBinaryDir()
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" && binaryDir == "" {
+		GinkgoWriter.Println("envtest binaries not found (run `make setup-envtest`), integration tests will be skipped")
+		return
+	}
+
+	By("bootstrapping test environment")
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths: []string{
+			filepath.Join("..", "..", "config", "crd", "bases"),
+			// CRD cert-manager и Istio (см. test/crds/README.md)
+			filepath.Join("..", "..", "test", "crds"),
+		},
+		ErrorIfCRDPathMissing: true,
+		BinaryAssetsDirectory: binaryDir,
+	}
+
+	cfg, err := testEnv.Start()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(cfg).NotTo(BeNil())
+
+	scheme := newTestScheme()
+	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme})
+	Expect(err).NotTo(HaveOccurred())
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(SetupControllers(mgr)).To(Succeed())
+
+	go func() {
+		defer GinkgoRecover()
+		Expect(mgr.Start(testCtx)).To(Succeed())
+	}()
+	envtestAvailable = true
+})
+
+var _ = AfterSuite(func() {
+	testCancel()
+	if testEnv != nil {
+		By("tearing down the test environment")
+		Expect(testEnv.Stop()).To(Succeed())
+	}
+})
+
+// requireEnvtest пропускает интеграционный тест, если envtest не запущен
+func requireEnvtest() {
+	if !envtestAvailable {
+		Skip("envtest is not available: set KUBEBUILDER_ASSETS or run `make setup-envtest`")
+	}
+}
+
+// newTestScheme возвращает схему с теми же типами, что и в cmd/main.go
+func newTestScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(certmanagerv1.AddToScheme(scheme))
+	utilruntime.Must(cmacme.AddToScheme(scheme))
+	utilruntime.Must(istionetworkingv1beta1.AddToScheme(scheme))
+	utilruntime.Must(gatewayapiv1.AddToScheme(scheme))
+	utilruntime.Must(gatewayapiv1beta1.AddToScheme(scheme))
+	utilruntime.Must(http01v1alpha1.AddToScheme(scheme))
+	return scheme
+}
+
+// createTestNamespace создает namespace со случайным именем для одного теста
+func createTestNamespace() string {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "istio-http01-test-"}}
+	Expect(k8sClient.Create(testCtx, namespace)).To(Succeed())
+	return namespace.Name
+}
+
+// newTestGateway возвращает Istio Gateway с HTTP сервером (httpsRedirect) и HTTPS сервером с credentialName
+func newTestGateway(namespace, name, host, secretName string) *istionetworkingv1beta1.Gateway {
+	return &istionetworkingv1beta1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: istioapinetworkingv1beta1.Gateway{
+			Selector: map[string]string{"istio": "ingressgateway"},
+			Servers: []*istioapinetworkingv1beta1.Server{
+				{
+					Port:  &istioapinetworkingv1beta1.Port{Number: 80, Name: "http", Protocol: "HTTP"},
+					Hosts: []string{host},
+					Tls:   &istioapinetworkingv1beta1.ServerTLSSettings{HttpsRedirect: true},
+				},
+				{
+					Port:  &istioapinetworkingv1beta1.Port{Number: 443, Name: "https", Protocol: "HTTPS"},
+					Hosts: []string{host},
+					Tls: &istioapinetworkingv1beta1.ServerTLSSettings{
+						Mode:           istioapinetworkingv1beta1.ServerTLSSettings_SIMPLE,
+						CredentialName: secretName,
+					},
+				},
+			},
+		},
+	}
+}
+
+// newTestVirtualService возвращает VirtualService приложения, привязывающий домен к Gateway
+func newTestVirtualService(namespace, name, host, gateway string) *istionetworkingv1beta1.VirtualService {
+	return &istionetworkingv1beta1.VirtualService{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: istioapinetworkingv1beta1.VirtualService{
+			Hosts:    []string{host},
+			Gateways: []string{gateway},
+			Http: []*istioapinetworkingv1beta1.HTTPRoute{{
+				Route: []*istioapinetworkingv1beta1.HTTPRouteDestination{{
+					Destination: &istioapinetworkingv1beta1.Destination{Host: name},
+				}},
+			}},
+		},
+	}
+}
+
+// setCertificateReady выставляет условие Ready в статусе Certificate, как это делает cert-manager
+func setCertificateReady(key client.ObjectKey, ready bool) {
+	status := cmmeta.ConditionFalse
+	if ready {
+		status = cmmeta.ConditionTrue
+	}
+	Eventually(func() error {
+		cert := &certmanagerv1.Certificate{}
+		if err := k8sClient.Get(testCtx, key, cert); err != nil {
+			return err
+		}
+		cert.Status.Conditions = []certmanagerv1.CertificateCondition{{
+			Type:               certmanagerv1.CertificateConditionReady,
+			Status:             status,
+			Reason:             "Test",
+			LastTransitionTime: &metav1.Time{Time: time.Now()},
+		}}
+		return k8sClient.Status().Update(testCtx, cert)
+	}, eventuallyTimeout, eventuallyInterval).Should(Succeed())
+}
+
+// getFirstFoundEnvTestBinaryDir находит бинарники envtest, установленные `make setup-envtest` в bin/k8s
+// Позволяет запускать тесты из IDE без KUBEBUILDER_ASSETS
+func getFirstFoundEnvTestBinaryDir() string {
+	basePath := filepath.Join("..", "..", "bin", "k8s")
+	entries, err := os.ReadDir(basePath)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return filepath.Join(basePath, entry.Name())
+		}
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+/*
+ * Функции, определенные в этом файле:
+ *
+ * - RunUninstallCleanup(ctx, mgr) error
+ *   Откатывает изменения Gateway всех Certificate с finalizer оператора и снимает finalizer (удаление оператора)
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// RunUninstallCleanup откатывает изменения Gateway всех Certificate с finalizer оператора и снимает finalizer
+// Запускается флагом --uninstall-cleanup из Helm hook после удаления Deployment оператора:
+// без работающего оператора finalizer заблокировал бы удаление Certificate, а Gateway остались бы
+// на временном секрете с отключенными httpsRedirect и HSTS
+// Контроллеры не регистрируются, менеджер используется только ради кэша с field индексами
+func RunUninstallCleanup(ctx context.Context, mgr ctrl.Manager) error {
+	logger := log.FromContext(ctx).WithName("uninstall-cleanup")
+	ctx = log.IntoContext(ctx, logger)
+
+	gatewayAPIEnabled := isGatewayAPIAvailable(mgr)
+	if err := setupFieldIndexes(ctx, mgr, gatewayAPIEnabled); err != nil {
+		return err
+	}
+
+	cacheCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		if err := mgr.GetCache().Start(cacheCtx); err != nil {
+			logger.Error(err, "cache stopped with error")
+		}
+	}()
+	if !mgr.GetCache().WaitForCacheSync(cacheCtx) {
+		return errors.New("failed to sync cache")
+	}
+
+	r := &CertificateReconciler{
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		GatewayAPIEnabled: gatewayAPIEnabled,
+	}
+
+	certificates := &certmanagerv1.CertificateList{}
+	if err := r.List(ctx, certificates); err != nil {
+		return fmt.Errorf("failed to list Certificates: %w", err)
+	}
+
+	var errs []error
+	finalized := 0
+	for i := range certificates.Items {
+		cert := &certificates.Items[i]
+		if !controllerutil.ContainsFinalizer(cert, certificateFinalizer) {
+			continue
+		}
+		if err := r.finalizeCertificate(ctx, cert); err != nil {
+			logger.Error(err, "failed to roll back Gateway changes of certificate",
+				"certificateName", cert.Name,
+				"certificateNamespace", cert.Namespace,
+			)
+			errs = append(errs, fmt.Errorf("certificate %s/%s: %w", cert.Namespace, cert.Name, err))
+			continue
+		}
+		finalized++
+	}
+
+	logger.Info("Uninstall cleanup finished",
+		"certificates", len(certificates.Items),
+		"finalized", finalized,
+		"failed", len(errs),
+	)
+	return errors.Join(errs...)
+}